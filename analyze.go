@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/monitor"
+	"github.com/Channel-3-Eugene/tribd/reader"
+	uriHandler "github.com/Channel-3-Eugene/tribd/urihandler"
+)
+
+const analyzeUsage = `usage: tribd analyze [flags] <uri>
+
+Runs the ETSI TR 101 290 checks over a transport stream and prints a report.
+<uri> is a file path, file://path, - for stdin, udp://host:port or tcp://host:port.
+Live inputs print a report every -interval until interrupted; files print a summary at the end.
+The exit status is 1 when priority 1 errors were found.
+
+`
+
+var errUnsupportedURI = errors.New("analyze: unsupported URI")
+
+// analyze implements the analyze command and returns the process exit status.
+func analyze(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, analyzeUsage)
+		fs.PrintDefaults()
+	}
+	interval := fs.Duration("interval", 5*time.Second, "time between reports for live inputs; zero prints only the summary")
+	pidTimeout := fs.Duration("pid-timeout", monitor.DefaultPIDTimeout, "longest absence of a PID referenced by a PMT")
+	quiet := fs.Bool("quiet", false, "do not print alarms as they are raised and cleared")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	uri := fs.Arg(0)
+	src, live, err := openSource(uri)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	dc := src.DataChan()
+
+	// Alarms and reports are written from the reading and reporting goroutines.
+	var outMu sync.Mutex
+	opts := monitor.Options{PIDTimeout: *pidTimeout}
+	if !*quiet {
+		opts.OnAlarm = func(a monitor.Alarm) {
+			outMu.Lock()
+			defer outMu.Unlock()
+			at := a.Time.Format(time.RFC3339Nano)
+			if !live {
+				at = "+" + a.Time.Sub(time.Unix(0, 0)).String() // Stream time of the file.
+			}
+			if a.Raised {
+				fmt.Fprintf(stdout, "%s ALARM %s: %s\n", at, a.Check, a.Detail)
+			} else {
+				fmt.Fprintf(stdout, "%s CLEAR %s\n", at, a.Check)
+			}
+		}
+	}
+	m := monitor.NewMonitor(uri, opts)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-signals:
+			src.Close() // Ends the read loop.
+		case <-done:
+		}
+	}()
+
+	if live && *interval > 0 {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					m.Tick(time.Now())
+					outMu.Lock()
+					fmt.Fprintln(stdout, m.Report())
+					outMu.Unlock()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for data := dc.Receive(); data != nil; data = dc.Receive() {
+		at := time.Time{} // Files are timed by their own PCRs.
+		if live {
+			at = time.Now()
+		}
+		m.PushBytes(data, at)
+	}
+	src.Close()
+	if live {
+		m.Tick(time.Now())
+	}
+
+	report := m.Report()
+	outMu.Lock()
+	fmt.Fprint(stdout, report)
+	outMu.Unlock()
+	if report.Errors(1) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// openSource opens the uriHandler handler reading the input named by uri and reports whether it is live.
+// The data channel of the handler is closed at the end of a file or when a live input ends.
+func openSource(uri string) (reader.Source, bool, error) {
+	if uri == "-" {
+		return openFile("/dev/stdin")
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 { // A Windows drive letter is not a scheme.
+		return openFile(uri)
+	}
+
+	var src reader.Source
+	switch u.Scheme {
+	case "file":
+		return openFile(u.Path)
+	case "udp":
+		src = uriHandler.NewUDPHandler(u.Host, 0, 0, uriHandler.Reader, []string{uriHandler.AnySource}, nil)
+	case "tcp":
+		src = uriHandler.NewTCPHandler(u.Host, 0, 0, uriHandler.Client, uriHandler.Reader)
+	default:
+		return nil, false, fmt.Errorf("%w: %s", errUnsupportedURI, uri)
+	}
+	if err := src.Open(); err != nil {
+		return nil, false, err
+	}
+	return src, true, nil
+}
+
+// openFile opens a recording, read once to its end, or a pipe or FIFO which is treated as live.
+func openFile(path string) (reader.Source, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err // The handler would create a missing file.
+	}
+	h := uriHandler.NewFileHandler(path, uriHandler.Reader, false, 0, 0)
+	h.SetReadToEnd(true)
+	if err := h.Open(); err != nil {
+		return nil, false, err
+	}
+	return h, !info.Mode().IsRegular(), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeRecording writes a single program recording of the given number of 40 ms frames. The PAT
+// is left out after patFrames frames.
+func writeRecording(t *testing.T, frames, patFrames int) string {
+	var buf bytes.Buffer
+	var patCC, pmtCC uint8
+	pp := mpegts.NewPESPacketizer(0x100)
+	for i := 0; i < frames; i++ {
+		var packets mpegts.EncodedPackets
+		if i < patFrames {
+			pat := mpegts.NewPAT(1, 0)
+			pat.Programs[1] = 0x1000
+			packets, patCC = pat.Encode(patCC)
+		}
+		pmt := &mpegts.PMT{ProgramNumber: 1, CurrentNext: true, PCRPID: 0x100, Streams: []mpegts.ElementaryStream{{StreamType: mpegts.StreamTypeH264, ElementaryPID: 0x100}}}
+		p, cc, err := pmt.Encode(0x1000, pmtCC)
+		assert.NoError(t, err)
+		pmtCC = cc
+		packets = append(packets, p...)
+
+		pes := &mpegts.PESPacket{StreamID: mpegts.StreamIDVideoBase, HasPTS: true, PTS: mpegts.PTS(i) * 3600, Payload: make([]byte, 500)}
+		p, err = pp.Packetize(pes, &mpegts.AdaptationField{HasPCR: true, PCR: mpegts.PCR(i) * 3600 * 300})
+		assert.NoError(t, err)
+		packets = append(packets, p...)
+
+		for _, ep := range packets {
+			buf.Write(ep[:])
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "recording.ts")
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func TestAnalyzeFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := analyze([]string{writeRecording(t, 50, 50)}, &stdout, &stderr)
+	assert.Equal(t, 0, status, stdout.String())
+	assert.Contains(t, stdout.String(), "250 packets in 1.96s")
+	assert.Contains(t, stdout.String(), "program 1 PID 0x0100: 50 PCRs")
+
+	stdout.Reset()
+	status = analyze([]string{"file://" + writeRecording(t, 50, 20)}, &stdout, &stderr)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stdout.String(), "+1.24s ALARM PAT_error_2: no PAT for 500ms")
+}
+
+func TestAnalyzeUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, analyze(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "usage: tribd analyze")
+
+	assert.Equal(t, 1, analyze([]string{"srt://example.com:9000"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), errUnsupportedURI.Error())
+}
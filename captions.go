@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Channel-3-Eugene/tribd/captions"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+const captionsUsage = `usage: tribd captions [flags] -pid <pid> <uri>
+
+Decodes the CEA-608 field 1 captions carried in the A/53 SEI of the H.264 or HEVC stream on a PID
+and writes them as SRT or WebVTT, timed from the first picture.
+<uri> is a file path, file://path, - for stdin, udp://host:port or tcp://host:port.
+Live inputs are read until interrupted.
+
+`
+
+// extractCaptions implements the captions command and returns the process exit status.
+func extractCaptions(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("captions", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, captionsUsage)
+		fs.PrintDefaults()
+	}
+	pid := fs.Uint("pid", 0, "PID of the video stream")
+	codec := fs.String("codec", "h264", "video coding: h264 or hevc")
+	channel := fs.Int("channel", 1, "caption data channel: 1 for CC1 or 2 for CC2")
+	formatName := fs.String("format", "srt", "output format: srt or vtt")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *pid == 0 || *pid > 0x1FFE {
+		fs.Usage()
+		return 2
+	}
+
+	var st mpegts.StreamType
+	switch *codec {
+	case "h264":
+		st = mpegts.StreamTypeH264
+	case "hevc":
+		st = mpegts.StreamTypeHEVC
+	default:
+		fmt.Fprintf(stderr, "captions: unknown codec %s\n", *codec)
+		return 2
+	}
+	if *channel != int(captions.CC1) && *channel != int(captions.CC2) {
+		fmt.Fprintf(stderr, "captions: unknown channel %d\n", *channel)
+		return 2
+	}
+	format, err := captions.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	uri := fs.Arg(0)
+	src, _, err := openSource(uri)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-signals:
+			src.Close() // Ends the read loop.
+		case <-done:
+		}
+	}()
+
+	framer := mpegts.NewFramer(0)
+	extractor := captions.NewExtractor(uint16(*pid), st, captions.Channel(*channel))
+	w := captions.NewWriter(stdout, format)
+	write := func(cues []captions.Cue) error {
+		for _, c := range cues {
+			if err := w.WriteCue(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	dc := src.DataChan()
+	for data := dc.Receive(); data != nil; data = dc.Receive() {
+		packets, _ := framer.Push(data)
+		for _, ep := range packets {
+			cues, _ := extractor.Push(ep) // Captions resume after lost packets.
+			if err := write(cues); err != nil {
+				fmt.Fprintln(stderr, err)
+				src.Close()
+				return 1
+			}
+		}
+	}
+	src.Close()
+
+	if err := write(extractor.Flush()); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := w.Close(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
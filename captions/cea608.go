@@ -0,0 +1,332 @@
+package captions
+
+import (
+	"strings"
+	"time"
+)
+
+// CEA-608 caption screen.
+const (
+	screenRows    = 15
+	screenColumns = 32
+)
+
+// Channel is a CEA-608 caption data channel of field 1.
+type Channel int
+
+const (
+	CC1 Channel = 1
+	CC2 Channel = 2
+)
+
+// Cue is a caption displayed from Start to End.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // Rows of the caption, separated by newlines.
+}
+
+// captionMode is the CEA-608 caption style in effect.
+type captionMode int
+
+const (
+	modeNone    captionMode = iota // No caption mode selected yet; characters are ignored.
+	modePopOn                      // Characters build the non-displayed memory, shown by EOC.
+	modeRollUp                     // Characters are added to the bottom row, CR scrolls.
+	modePaintOn                    // Characters are written straight to the display.
+	modeText                       // Text service; characters are ignored.
+)
+
+// screen is a CEA-608 caption memory. Zero cells are empty.
+type screen [screenRows][screenColumns]rune
+
+// text returns the non-empty rows of the screen, trimmed and separated by newlines.
+func (s *screen) text() string {
+	var rows []string
+	for _, row := range s {
+		line := strings.TrimSpace(strings.Map(func(r rune) rune {
+			if r == 0 {
+				return ' '
+			}
+			return r
+		}, string(row[:])))
+		if line != "" {
+			rows = append(rows, line)
+		}
+	}
+	return strings.Join(rows, "\n")
+}
+
+// Decoder decodes the CEA-608 byte pairs of one field 1 data channel into cues. Pop-on captions are
+// timed by the EOC command that displays them; roll-up and paint-on captions are timed from their
+// first character, and are emitted when the next command changes the display.
+type Decoder struct {
+	channel   Channel
+	current   Channel // Data channel of the latest control code.
+	mode      captionMode
+	rollRows  int
+	displayed screen
+	buffer    screen // Non-displayed memory.
+	row, col  int
+	lastCtrl  [2]byte // Control codes are sent twice; the repeat is ignored.
+
+	at      time.Duration // Time of the latest byte pair.
+	dirty   bool          // Displayed memory changed since the last command.
+	changed time.Duration // Time of the first change while dirty.
+	text    string        // Text of the open cue.
+	start   time.Duration
+	cues    []Cue
+}
+
+// NewDecoder creates a decoder for a data channel.
+func NewDecoder(channel Channel) *Decoder {
+	return &Decoder{channel: channel, current: CC1, rollRows: 2, row: screenRows - 1}
+}
+
+// Decode processes a field 1 byte pair received at time at.
+func (d *Decoder) Decode(at time.Duration, b1, b2 byte) {
+	d.at = at
+	b1 &= 0x7F // Parity.
+	b2 &= 0x7F
+
+	if b1 >= 0x10 && b1 <= 0x1F {
+		d.control(b1, b2)
+		return
+	}
+	if b1 == 0 && b2 == 0 {
+		return // Padding.
+	}
+	d.lastCtrl = [2]byte{}
+	if d.current != d.channel {
+		return
+	}
+	for _, b := range []byte{b1, b2} {
+		if b >= 0x20 {
+			d.put(basicChar(b))
+		}
+	}
+}
+
+// Cues returns the cues completed since the last call.
+func (d *Decoder) Cues() []Cue {
+	cues := d.cues
+	d.cues = nil
+	return cues
+}
+
+// Flush ends the displayed caption at the time of the latest byte pair and returns the remaining cues.
+func (d *Decoder) Flush() []Cue {
+	d.update()
+	d.emit(d.at)
+	d.text = ""
+	return d.Cues()
+}
+
+// control processes a control code, preamble address code or special character.
+func (d *Decoder) control(b1, b2 byte) {
+	pair := [2]byte{b1, b2}
+	if pair == d.lastCtrl {
+		d.lastCtrl = [2]byte{}
+		return
+	}
+	d.lastCtrl = pair
+
+	d.current = CC1
+	if b1&0x08 != 0 {
+		d.current = CC2
+	}
+	if d.current != d.channel {
+		return
+	}
+
+	c := b1 &^ 0x08
+	switch {
+	case c == 0x11 && b2 >= 0x30 && b2 <= 0x3F:
+		d.put(specialChars[b2-0x30])
+	case c == 0x11 && b2 >= 0x20 && b2 <= 0x2F:
+		d.put(' ') // Mid-row codes display as a space.
+	case (c == 0x12 || c == 0x13) && b2 >= 0x20 && b2 <= 0x3F:
+		// Extended characters follow a basic character standing in for decoders without them.
+		if d.col > 0 {
+			d.col--
+		}
+		d.put(extendedChars[c-0x12][b2-0x20])
+	case (c == 0x14 || c == 0x15) && b2 >= 0x20 && b2 <= 0x2F:
+		d.command(b2)
+	case c == 0x17 && b2 >= 0x21 && b2 <= 0x23:
+		d.col = min(d.col+int(b2-0x20), screenColumns-1) // Tab offset.
+	case b2 >= 0x40:
+		d.preamble(c, b2)
+	}
+}
+
+// command executes a miscellaneous control code.
+func (d *Decoder) command(code byte) {
+	d.update() // Shows characters written to the display since the last command.
+	switch code {
+	case 0x20: // RCL, resume caption loading.
+		d.mode = modePopOn
+	case 0x21: // BS, backspace.
+		if d.col > 0 {
+			d.col--
+			d.target()[d.row][d.col] = 0
+		}
+	case 0x24: // DER, delete to end of row.
+		for c := d.col; c < screenColumns; c++ {
+			d.target()[d.row][c] = 0
+		}
+	case 0x25, 0x26, 0x27: // RU2, RU3 and RU4, roll-up captions.
+		if d.mode != modeRollUp {
+			d.displayed, d.buffer = screen{}, screen{}
+			d.row, d.col = screenRows-1, 0
+		}
+		d.mode = modeRollUp
+		d.rollRows = int(code-0x25) + 2
+	case 0x29: // RDC, resume direct captioning.
+		d.mode = modePaintOn
+	case 0x2A, 0x2B: // TR and RTD, text restart and resume text display.
+		d.mode = modeText
+	case 0x2C: // EDM, erase displayed memory.
+		d.displayed = screen{}
+	case 0x2D: // CR, carriage return.
+		if d.mode == modeRollUp {
+			d.rollUp()
+		}
+	case 0x2E: // ENM, erase non-displayed memory.
+		d.buffer = screen{}
+	case 0x2F: // EOC, end of caption.
+		d.displayed, d.buffer = d.buffer, d.displayed
+		d.mode = modePopOn
+	}
+	d.update()
+}
+
+// preamble executes a preamble address code, which moves the cursor to a row and indent.
+func (d *Decoder) preamble(c, b2 byte) {
+	rows, ok := pacRows[c]
+	if !ok {
+		return
+	}
+	row := rows[b2>>5&1]
+	if d.mode == modeRollUp && row != d.row {
+		// The roll-up window moves to the new base row with its contents.
+		var moved screen
+		for i := 0; i < d.rollRows; i++ {
+			if d.row-i >= 0 && row-i >= 0 {
+				moved[row-i] = d.displayed[d.row-i]
+			}
+		}
+		d.displayed = moved
+	}
+	d.row, d.col = row, 0
+	if b2&0x10 != 0 {
+		d.col = int(b2&0x0E) << 1 // Indent in steps of four columns.
+	}
+}
+
+// rollUp scrolls the roll-up window up by one row and returns the cursor to the start of the base row.
+func (d *Decoder) rollUp() {
+	top := max(d.row-d.rollRows+1, 0)
+	for r := 0; r < d.row; r++ {
+		if r >= top {
+			d.displayed[r] = d.displayed[r+1]
+		} else {
+			d.displayed[r] = [screenColumns]rune{}
+		}
+	}
+	d.displayed[d.row] = [screenColumns]rune{}
+	d.col = 0
+}
+
+// put writes a character at the cursor of the memory of the current mode.
+func (d *Decoder) put(r rune) {
+	if d.mode == modeNone || d.mode == modeText {
+		return
+	}
+	d.target()[d.row][d.col] = r
+	if d.col < screenColumns-1 {
+		d.col++
+	}
+	if d.mode != modePopOn && !d.dirty {
+		d.dirty, d.changed = true, d.at
+	}
+}
+
+// target returns the memory characters are written to.
+func (d *Decoder) target() *screen {
+	if d.mode == modePopOn {
+		return &d.buffer
+	}
+	return &d.displayed
+}
+
+// update ends the open cue when the displayed text has changed and opens a cue for the new text.
+// Changes made by roll-up and paint-on characters date from the first of them.
+func (d *Decoder) update() {
+	at := d.at
+	if d.dirty {
+		at, d.dirty = d.changed, false
+	}
+	text := d.displayed.text()
+	if text == d.text {
+		return
+	}
+	d.emit(at)
+	d.text, d.start = text, at
+}
+
+// emit completes the open cue at time end.
+func (d *Decoder) emit(end time.Duration) {
+	if d.text != "" && end > d.start {
+		d.cues = append(d.cues, Cue{Start: d.start, End: end, Text: d.text})
+	}
+}
+
+// basicChar maps a CEA-608 basic character to Unicode. The set is ASCII with a few substitutions.
+func basicChar(b byte) rune {
+	switch b {
+	case 0x2A:
+		return 'á'
+	case 0x5C:
+		return 'é'
+	case 0x5E:
+		return 'í'
+	case 0x5F:
+		return 'ó'
+	case 0x60:
+		return 'ú'
+	case 0x7B:
+		return 'ç'
+	case 0x7C:
+		return '÷'
+	case 0x7D:
+		return 'Ñ'
+	case 0x7E:
+		return 'ñ'
+	case 0x7F:
+		return '█'
+	}
+	return rune(b)
+}
+
+// specialChars are the characters of codes 0x11 0x30 to 0x3F. 0x39 is a transparent space.
+var specialChars = []rune("®°½¿™¢£♪à èâêîôû")
+
+// extendedChars are the characters of codes 0x12 and 0x13 0x20 to 0x3F.
+var extendedChars = [2][]rune{
+	[]rune("ÁÉÓÚÜü‘¡*'—©℠•“”ÀÂÇÈÊËëÎÏïÔÙùÛ«»"),
+	[]rune("ÃãÍÌìÒòÕõ{}\\^_|~ÄäÖöß¥¤│ÅåØø┌┐└┘"),
+}
+
+// pacRows maps the first byte of a preamble address code to its two rows, selected by bit 5 of the
+// second byte.
+var pacRows = map[byte][2]int{
+	0x11: {0, 1},
+	0x12: {2, 3},
+	0x15: {4, 5},
+	0x16: {6, 7},
+	0x17: {8, 9},
+	0x10: {10, 10},
+	0x13: {11, 12},
+	0x14: {13, 14},
+}
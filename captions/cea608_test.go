@@ -0,0 +1,147 @@
+package captions
+
+import (
+	"math/bits"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// timedPair is a CEA-608 byte pair received at a time.
+type timedPair struct {
+	at   time.Duration
+	pair [2]byte
+}
+
+// parity sets the odd parity bit of a CEA-608 byte.
+func parity(b byte) byte {
+	if bits.OnesCount8(b)%2 == 0 {
+		return b | 0x80
+	}
+	return b
+}
+
+// script builds the byte pairs of a caption from commands and text. Commands are sent twice, as
+// broadcasters do, each pair one frame apart.
+type script struct {
+	at    time.Duration
+	pairs []timedPair
+}
+
+func (s *script) send(b1, b2 byte) {
+	s.pairs = append(s.pairs, timedPair{s.at, [2]byte{parity(b1), parity(b2)}})
+	s.at += time.Second / 30
+}
+
+func (s *script) control(b1, b2 byte) *script {
+	s.send(b1, b2)
+	s.send(b1, b2)
+	return s
+}
+
+func (s *script) text(t string) *script {
+	for i := 0; i < len(t); i += 2 {
+		b2 := byte(0)
+		if i+1 < len(t) {
+			b2 = t[i+1]
+		}
+		s.send(t[i], b2)
+	}
+	return s
+}
+
+func (s *script) wait(at time.Duration) *script {
+	s.at = at
+	return s
+}
+
+func (s *script) decode(d *Decoder) []Cue {
+	for _, p := range s.pairs {
+		d.Decode(p.at, p.pair[0], p.pair[1])
+	}
+	return append(d.Cues(), d.Flush()...)
+}
+
+// CEA-608 miscellaneous control codes of channel 1.
+const (
+	rcl = 0x20
+	bs  = 0x21
+	ru2 = 0x25
+	rdc = 0x29
+	edm = 0x2C
+	cr  = 0x2D
+	enm = 0x2E
+	eoc = 0x2F
+)
+
+func TestDecoderPopOn(t *testing.T) {
+	s := &script{}
+	s.control(0x14, rcl).control(0x14, enm)
+	s.control(0x13, 0x50)                // Row 12, column 0.
+	s.text("HELLO,").control(0x11, 0x37) // Music note.
+	s.control(0x14, 0x70)                // Row 15, column 0.
+	s.text("WORLD").control(0x17, 0x21)  // Tab offset.
+	s.text("A\x27").control(0x12, 0x29)  // The apostrophe is replaced by the extended one.
+	s.wait(time.Second).control(0x14, eoc)
+	s.control(0x14, rcl).text("x") // The next caption loads off screen.
+	s.wait(3*time.Second).control(0x14, edm)
+
+	cues := s.decode(NewDecoder(CC1))
+	assert.Equal(t, []Cue{{Start: time.Second, End: 3 * time.Second, Text: "HELLO,♪\nWORLD A'"}}, cues)
+}
+
+func TestDecoderRollUp(t *testing.T) {
+	s := &script{}
+	s.control(0x14, ru2).control(0x14, 0x70)
+	s.wait(time.Second).text("ONE")
+	s.wait(2*time.Second).control(0x14, cr)
+	s.wait(3 * time.Second).text("TWO")
+	s.wait(4*time.Second).control(0x14, cr)
+	s.wait(5*time.Second).control(0x14, edm)
+
+	cues := s.decode(NewDecoder(CC1))
+	assert.Equal(t, []Cue{
+		{Start: time.Second, End: 3 * time.Second, Text: "ONE"},
+		{Start: 3 * time.Second, End: 4 * time.Second, Text: "ONE\nTWO"},
+		{Start: 4 * time.Second, End: 5 * time.Second, Text: "TWO"},
+	}, cues)
+}
+
+func TestDecoderPaintOn(t *testing.T) {
+	s := &script{}
+	s.control(0x14, rdc).control(0x14, 0x70)
+	s.wait(time.Second).text("PAINTED TEXT")
+	s.wait(4*time.Second).control(0x14, edm)
+
+	cues := s.decode(NewDecoder(CC1))
+	assert.Equal(t, []Cue{{Start: time.Second, End: 4 * time.Second, Text: "PAINTED TEXT"}}, cues)
+}
+
+func TestDecoderChannels(t *testing.T) {
+	s := &script{}
+	s.control(0x14, rcl).control(0x14, 0x70).text("ONE")
+	s.control(0x1C, rcl).control(0x1C, 0x70).text("TWO") // CC2 sets bit 3 of the first byte.
+	s.wait(time.Second).control(0x1C, eoc)
+	s.wait(2*time.Second).control(0x14, eoc)
+	s.wait(3*time.Second).control(0x14, edm).control(0x1C, edm)
+
+	cues := s.decode(NewDecoder(CC1))
+	assert.Equal(t, []Cue{{Start: 2 * time.Second, End: 3 * time.Second, Text: "ONE"}}, cues)
+
+	cues = s.decode(NewDecoder(CC2))
+	assert.Equal(t, []Cue{{Start: time.Second, End: 3*time.Second + 2*time.Second/30, Text: "TWO"}}, cues)
+}
+
+func TestDecoderRedundantControl(t *testing.T) {
+	s := &script{}
+	s.control(0x14, rcl).control(0x14, 0x70).text("AB")
+	s.send(0x14, bs) // A single backspace is executed...
+	s.text("C")
+	s.send(0x14, bs) // ...but a repeated pair only once.
+	s.send(0x14, bs)
+	s.control(0x14, eoc)
+
+	cues := s.decode(NewDecoder(CC1))
+	assert.Equal(t, "A", cues[0].Text)
+}
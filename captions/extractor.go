@@ -0,0 +1,111 @@
+package captions
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+// reorderDepth is the number of pictures held back to restore presentation order, enough for the
+// B-frame pyramids of common encoders.
+const reorderDepth = 8
+
+// picture is the field 1 caption data of one access unit.
+type picture struct {
+	pts mpegts.PTS
+	cc  [][2]byte
+}
+
+// Extractor decodes the captions of the video stream on one PID. Access units arrive in decode order;
+// their caption data is decoded in presentation order. Cue times run from the first presented picture,
+// following the PTS across wraps.
+type Extractor struct {
+	pid     uint16
+	st      mpegts.StreamType
+	pes     *mpegts.PESAssembler
+	decoder *Decoder
+	pending []picture // Sorted by PTS.
+
+	hasPTS  bool
+	lastPTS mpegts.PTS // PTS of the latest access unit, for PES packets without one.
+	started bool
+	last    mpegts.PTS // PTS of the latest decoded picture.
+	elapsed time.Duration
+}
+
+// NewExtractor creates an extractor for the captions of a data channel of the H.264 or HEVC stream on
+// pid.
+func NewExtractor(pid uint16, st mpegts.StreamType, channel Channel) *Extractor {
+	return &Extractor{
+		pid:     pid,
+		st:      st,
+		pes:     mpegts.NewPESAssembler(),
+		decoder: NewDecoder(channel),
+	}
+}
+
+// Push feeds a packet to the extractor and returns the cues it completes. Packets of other PIDs are
+// ignored. Errors report PES packets lost to discontinuities; extraction continues.
+func (e *Extractor) Push(ep *mpegts.EncodedPacket) ([]Cue, error) {
+	if ep.GetPID() != e.pid {
+		return nil, nil
+	}
+	packets, err := e.pes.Push(ep)
+	for _, p := range packets {
+		e.addPES(p)
+	}
+	for len(e.pending) > reorderDepth {
+		e.decodeNext()
+	}
+	return e.decoder.Cues(), err
+}
+
+// Flush decodes the pictures still held, ends the displayed caption and returns the remaining cues.
+func (e *Extractor) Flush() []Cue {
+	for _, p := range e.pes.Flush() {
+		e.addPES(p)
+	}
+	for len(e.pending) > 0 {
+		e.decodeNext()
+	}
+	return e.decoder.Flush()
+}
+
+// addPES queues the field 1 caption data of an access unit.
+func (e *Extractor) addPES(p *mpegts.PESPacket) {
+	if p.HasPTS {
+		e.hasPTS, e.lastPTS = true, p.PTS
+	}
+	if !e.hasPTS {
+		return
+	}
+
+	pic := picture{pts: e.lastPTS}
+	for _, cc := range ExtractCCData(e.st, p.Payload) {
+		if cc.Valid && cc.Type == CCTypeField1 {
+			pic.cc = append(pic.cc, cc.Data)
+		}
+	}
+	i := sort.Search(len(e.pending), func(i int) bool { return pic.pts.Before(e.pending[i].pts) })
+	e.pending = append(e.pending, picture{})
+	copy(e.pending[i+1:], e.pending[i:])
+	e.pending[i] = pic
+}
+
+// decodeNext decodes the caption data of the earliest pending picture.
+func (e *Extractor) decodeNext() {
+	pic := e.pending[0]
+	e.pending = e.pending[1:]
+
+	if e.started {
+		if d := pic.pts.Since(e.last); d > 0 {
+			e.elapsed += d
+		}
+	}
+	e.started, e.last = true, pic.pts
+
+	for _, pair := range pic.cc {
+		e.decoder.Decode(e.elapsed, pair[0], pair[1])
+	}
+}
@@ -0,0 +1,58 @@
+package captions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractor(t *testing.T) {
+	// One caption pair per 40 ms frame: a pop-on caption displayed at frame 10 and erased at frame 60.
+	s := &script{}
+	s.control(0x14, rcl).control(0x14, 0x70).text("HELLO")
+	for len(s.pairs) < 10 {
+		s.send(0, 0)
+	}
+	s.control(0x14, eoc)
+	for len(s.pairs) < 60 {
+		s.send(0, 0)
+	}
+	s.control(0x14, edm)
+	s.send(0, 0)
+
+	for _, st := range []mpegts.StreamType{mpegts.StreamTypeH264, mpegts.StreamTypeHEVC} {
+		// Frames are sent in decode order, each P frame ahead of the two B frames it precedes, with the
+		// PTS wrapping during the caption.
+		start := mpegts.NewPTS(mpegts.PTSWrap - 20*3600)
+		pp := mpegts.NewPESPacketizer(0x100)
+		e := NewExtractor(0x100, st, CC1)
+		var cues []Cue
+		for group := 0; group < len(s.pairs); group += 3 {
+			for _, frame := range []int{group + 2, group, group + 1} {
+				if frame >= len(s.pairs) {
+					continue
+				}
+				pair := s.pairs[frame].pair
+				es := seiNAL(st, []CCData{
+					{Valid: true, Type: CCTypeField1, Data: pair},
+					{Valid: true, Type: CCTypeField2, Data: [2]byte{0x94, 0x2C}}, // Field 2 is not decoded.
+				})
+				pes := &mpegts.PESPacket{StreamID: mpegts.StreamIDVideoBase, HasPTS: true, PTS: start.Add(time.Duration(frame) * 40 * time.Millisecond), Payload: es}
+				packets, err := pp.Packetize(pes, nil)
+				assert.NoError(t, err)
+				for _, ep := range packets {
+					c, err := e.Push(ep)
+					assert.NoError(t, err)
+					cues = append(cues, c...)
+				}
+			}
+			_, err := e.Push(&mpegts.EncodedPacket{0x47, 0x01, 0x01, 0x10}) // Other PIDs are ignored.
+			assert.NoError(t, err)
+		}
+		cues = append(cues, e.Flush()...)
+
+		assert.Equal(t, []Cue{{Start: 400 * time.Millisecond, End: 2400 * time.Millisecond, Text: "HELLO"}}, cues, "stream type 0x%02X", st)
+	}
+}
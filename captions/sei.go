@@ -0,0 +1,162 @@
+// Package captions extracts CEA-608 closed captions carried as ATSC A/53 cc_data in the SEI of H.264
+// and HEVC video, and writes them as SRT or WebVTT timed text.
+package captions
+
+import (
+	"bytes"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+const (
+	nalTypeH264SEI       = 6
+	nalTypeHEVCPrefixSEI = 39
+	nalTypeHEVCSuffixSEI = 40
+
+	seiUserDataRegistered = 4    // user_data_registered_itu_t_t35.
+	t35CountryUS          = 0xB5 // itu_t_t35_country_code of A/53 user data.
+	t35ProviderATSC       = 0x0031
+	a53CCDataType         = 0x03 // user_data_type_code of cc_data.
+)
+
+// a53UserIdentifier is the user_identifier of ATSC A/53 user data.
+var a53UserIdentifier = []byte("GA94")
+
+// cc_type values of CEA-708 cc_data.
+const (
+	CCTypeField1     = 0 // CEA-608 byte pair of field 1 (CC1 and CC2).
+	CCTypeField2     = 1 // CEA-608 byte pair of field 2 (CC3, CC4 and XDS).
+	CCTypeDTVCCData  = 2 // Continuation of a CEA-708 DTVCC packet.
+	CCTypeDTVCCStart = 3 // Start of a CEA-708 DTVCC packet.
+)
+
+// CCData is one cc_data construct: a byte pair and its type.
+type CCData struct {
+	Valid bool // cc_valid.
+	Type  uint8
+	Data  [2]byte
+}
+
+// ExtractCCData returns the cc_data carried by the A/53 user data SEI messages of an H.264 or HEVC
+// access unit in Annex B byte stream format. Other stream types yield nothing.
+func ExtractCCData(st mpegts.StreamType, au []byte) []CCData {
+	var cc []CCData
+	for _, nal := range splitNALUnits(au) {
+		var rbsp []byte
+		switch st {
+		case mpegts.StreamTypeH264:
+			if len(nal) < 1 || nal[0]&0x1F != nalTypeH264SEI {
+				continue
+			}
+			rbsp = unescapeRBSP(nal[1:])
+		case mpegts.StreamTypeHEVC:
+			if len(nal) < 2 {
+				continue
+			}
+			if t := nal[0] >> 1 & 0x3F; t != nalTypeHEVCPrefixSEI && t != nalTypeHEVCSuffixSEI {
+				continue
+			}
+			rbsp = unescapeRBSP(nal[2:])
+		default:
+			return nil
+		}
+		cc = append(cc, parseSEI(rbsp)...)
+	}
+	return cc
+}
+
+// splitNALUnits splits an Annex B byte stream at its start codes.
+func splitNALUnits(data []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nals = append(nals, bytes.TrimRight(data[start:i], "\x00"))
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(data) {
+		nals = append(nals, data[start:])
+	}
+	return nals
+}
+
+// unescapeRBSP removes the emulation prevention bytes of a NAL unit payload.
+func unescapeRBSP(data []byte) []byte {
+	rbsp := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
+
+// parseSEI returns the cc_data of the SEI messages of an SEI RBSP.
+func parseSEI(rbsp []byte) []CCData {
+	var cc []CCData
+	for len(rbsp) > 0 && rbsp[0] != 0x80 { // rbsp_trailing_bits.
+		var payloadType, payloadSize int
+		payloadType, rbsp = seiValue(rbsp)
+		payloadSize, rbsp = seiValue(rbsp)
+		if payloadSize > len(rbsp) {
+			break
+		}
+		if payloadType == seiUserDataRegistered {
+			cc = append(cc, parseA53(rbsp[:payloadSize])...)
+		}
+		rbsp = rbsp[payloadSize:]
+	}
+	return cc
+}
+
+// seiValue reads an SEI payload type or size, coded as a run of 0xFF bytes and a final byte.
+func seiValue(data []byte) (int, []byte) {
+	v := 0
+	for len(data) > 0 {
+		b := data[0]
+		data = data[1:]
+		v += int(b)
+		if b != 0xFF {
+			break
+		}
+	}
+	return v, data
+}
+
+// parseA53 returns the cc_data of an ITU-T T.35 payload if it holds A/53 closed captions.
+func parseA53(p []byte) []CCData {
+	if len(p) < 10 || p[0] != t35CountryUS || int(p[1])<<8|int(p[2]) != t35ProviderATSC ||
+		!bytes.Equal(p[3:7], a53UserIdentifier) || p[7] != a53CCDataType {
+		return nil
+	}
+	flags := p[8]
+	if flags&0x40 == 0 { // process_cc_data_flag.
+		return nil
+	}
+	count := int(flags & 0x1F)
+	data := p[10:] // Skips em_data.
+
+	cc := make([]CCData, 0, count)
+	for i := 0; i < count && len(data) >= 3; i++ {
+		cc = append(cc, CCData{
+			Valid: data[0]&0x04 != 0,
+			Type:  data[0] & 0x03,
+			Data:  [2]byte{data[1], data[2]},
+		})
+		data = data[3:]
+	}
+	return cc
+}
@@ -0,0 +1,60 @@
+package captions
+
+import (
+	"testing"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// a53Payload builds an A/53 user_data_registered_itu_t_t35 payload of cc_data.
+func a53Payload(cc []CCData) []byte {
+	p := []byte{t35CountryUS, 0x00, 0x31, 'G', 'A', '9', '4', a53CCDataType, 0x40 | byte(len(cc)), 0xFF}
+	for _, c := range cc {
+		b := 0xF8 | c.Type
+		if c.Valid {
+			b |= 0x04
+		}
+		p = append(p, b, c.Data[0], c.Data[1])
+	}
+	return append(p, 0xFF) // marker_bits.
+}
+
+// seiNAL builds an Annex B SEI NAL unit with a leading unrelated message and an A/53 caption message.
+func seiNAL(st mpegts.StreamType, cc []CCData) []byte {
+	nal := []byte{0x00, 0x00, 0x00, 0x01, 0x06}
+	if st == mpegts.StreamTypeHEVC {
+		nal = []byte{0x00, 0x00, 0x00, 0x01, nalTypeHEVCPrefixSEI << 1, 0x01}
+	}
+	nal = append(nal, 0x05, 0x02, 0xAA, 0xBB) // user_data_unregistered, skipped.
+	payload := a53Payload(cc)
+	nal = append(nal, seiUserDataRegistered, byte(len(payload)))
+	nal = append(nal, payload...)
+	return append(nal, 0x80)
+}
+
+func TestExtractCCData(t *testing.T) {
+	cc := []CCData{
+		{Valid: true, Type: CCTypeField1, Data: [2]byte{0x94, 0x20}},
+		{Valid: true, Type: CCTypeField2, Data: [2]byte{0x80, 0x80}},
+		{Valid: false, Type: CCTypeDTVCCData, Data: [2]byte{0x00, 0x00}},
+	}
+	slice := []byte{0x00, 0x00, 0x01, 0x65, 0x88, 0x84}
+
+	for _, st := range []mpegts.StreamType{mpegts.StreamTypeH264, mpegts.StreamTypeHEVC} {
+		au := append([]byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xF0}, seiNAL(st, cc)...)
+		au = append(au, slice...)
+		assert.Equal(t, cc, ExtractCCData(st, au), "stream type 0x%02X", st)
+	}
+
+	assert.Empty(t, ExtractCCData(mpegts.StreamTypeH264, seiNAL(mpegts.StreamTypeHEVC, cc)), "HEVC NAL header in H.264")
+	assert.Empty(t, ExtractCCData(mpegts.StreamTypeMPEG2Video, seiNAL(mpegts.StreamTypeH264, cc)))
+
+	// Other registered user data, such as AFD, is ignored.
+	afd := []byte{0x00, 0x00, 0x01, 0x06, 0x04, 0x09, 0xB5, 0x00, 0x31, 'D', 'T', 'G', '1', 0x41, 0xF8, 0x80}
+	assert.Empty(t, ExtractCCData(mpegts.StreamTypeH264, afd))
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	assert.Equal(t, []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x03, 0x00}, unescapeRBSP([]byte{0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x03, 0x00}))
+}
@@ -0,0 +1,101 @@
+package captions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("captions: unknown timed text format")
+
+// Format is a timed text file format.
+type Format int
+
+const (
+	SRT Format = iota
+	WebVTT
+)
+
+// ParseFormat returns the format named by s: "srt", or "vtt" or "webvtt".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "srt":
+		return SRT, nil
+	case "vtt", "webvtt":
+		return WebVTT, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownFormat, s)
+}
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case SRT:
+		return "SRT"
+	case WebVTT:
+		return "WebVTT"
+	}
+	return "unknown"
+}
+
+// Writer writes cues as timed text as they are decoded.
+type Writer struct {
+	w       io.Writer
+	format  Format
+	started bool // The header has been written.
+	count   int
+}
+
+// NewWriter creates a writer of the given format.
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{w: w, format: format}
+}
+
+// WriteCue writes one cue.
+func (tw *Writer) WriteCue(c Cue) error {
+	if err := tw.header(); err != nil {
+		return err
+	}
+	tw.count++
+
+	var err error
+	switch tw.format {
+	case SRT:
+		_, err = fmt.Fprintf(tw.w, "%d\n%s --> %s\n%s\n\n", tw.count, timecode(c.Start, ','), timecode(c.End, ','), c.Text)
+	case WebVTT:
+		_, err = fmt.Fprintf(tw.w, "%s --> %s\n%s\n\n", timecode(c.Start, '.'), timecode(c.End, '.'), vttEscaper.Replace(c.Text))
+	}
+	return err
+}
+
+// Close completes the file. A WebVTT file without cues still gets its header.
+func (tw *Writer) Close() error {
+	return tw.header()
+}
+
+// header writes the WebVTT file header ahead of the first cue.
+func (tw *Writer) header() error {
+	if tw.started {
+		return nil
+	}
+	tw.started = true
+	if tw.format != WebVTT {
+		return nil
+	}
+	_, err := io.WriteString(tw.w, "WEBVTT\n\n")
+	return err
+}
+
+// vttEscaper escapes the characters WebVTT cue text reserves.
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// timecode formats d as hh:mm:ss followed by the separator and milliseconds.
+func timecode(d time.Duration, sep byte) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,47 @@
+package captions
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	cues := []Cue{
+		{Start: 1500 * time.Millisecond, End: 3 * time.Second, Text: "HELLO\nWORLD"},
+		{Start: time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond, End: time.Hour + 2*time.Minute + 5*time.Second, Text: "A < B & C"},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, SRT)
+	for _, c := range cues {
+		assert.NoError(t, w.WriteCue(c))
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "1\n00:00:01,500 --> 00:00:03,000\nHELLO\nWORLD\n\n2\n01:02:03,004 --> 01:02:05,000\nA < B & C\n\n", buf.String())
+
+	buf.Reset()
+	w = NewWriter(&buf, WebVTT)
+	for _, c := range cues {
+		assert.NoError(t, w.WriteCue(c))
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "WEBVTT\n\n00:00:01.500 --> 00:00:03.000\nHELLO\nWORLD\n\n01:02:03.004 --> 01:02:05.000\nA &lt; B &amp; C\n\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, NewWriter(&buf, WebVTT).Close())
+	assert.Equal(t, "WEBVTT\n\n", buf.String())
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("SRT")
+	assert.NoError(t, err)
+	assert.Equal(t, SRT, f)
+	f, err = ParseFormat("webvtt")
+	assert.NoError(t, err)
+	assert.Equal(t, WebVTT, f)
+	_, err = ParseFormat("ttml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCaptionedRecording writes 25 fps H.264 frames on PID 0x100 whose SEI carries a pop-on caption
+// shown from frame 10 to frame 35.
+func writeCaptionedRecording(t *testing.T) string {
+	pairs := [][2]byte{{0x14, 0x20}, {0x14, 0x20}, {0x14, 0x70}, {0x14, 0x70}, {'O', 'N'}, {' ', 'A'}, {'I', 'R'}}
+	for len(pairs) < 10 {
+		pairs = append(pairs, [2]byte{})
+	}
+	pairs = append(pairs, [2]byte{0x14, 0x2F}, [2]byte{0x14, 0x2F})
+	for len(pairs) < 35 {
+		pairs = append(pairs, [2]byte{})
+	}
+	pairs = append(pairs, [2]byte{0x14, 0x2C}, [2]byte{0x14, 0x2C}, [2]byte{})
+
+	var buf bytes.Buffer
+	pp := mpegts.NewPESPacketizer(0x100)
+	for i, pair := range pairs {
+		for j := range pair {
+			if bits.OnesCount8(pair[j])%2 == 0 {
+				pair[j] |= 0x80 // Odd parity.
+			}
+		}
+		sei := []byte{0x00, 0x00, 0x00, 0x01, 0x06, 0x04, 14, 0xB5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03, 0x41, 0xFF, 0xFC, pair[0], pair[1], 0xFF, 0x80}
+		es := append(sei, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84)
+		pes := &mpegts.PESPacket{StreamID: mpegts.StreamIDVideoBase, HasPTS: true, PTS: 90000 + mpegts.PTS(i)*3600, Payload: es}
+		packets, err := pp.Packetize(pes, nil)
+		assert.NoError(t, err)
+		for _, ep := range packets {
+			buf.Write(ep[:])
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "captions.ts")
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+func TestCaptions(t *testing.T) {
+	path := writeCaptionedRecording(t)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, extractCaptions([]string{"-pid", "0x100", path}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, "1\n00:00:00,400 --> 00:00:01,400\nON AIR\n\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, extractCaptions([]string{"-pid", "256", "-format", "vtt", path}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, "WEBVTT\n\n00:00:00.400 --> 00:00:01.400\nON AIR\n\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, extractCaptions([]string{"-pid", "0x100", "-channel", "2", path}, &stdout, &stderr))
+	assert.Empty(t, stdout.String())
+}
+
+func TestCaptionsUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, extractCaptions([]string{"recording.ts"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "usage: tribd captions")
+
+	stderr.Reset()
+	assert.Equal(t, 2, extractCaptions([]string{"-pid", "0x100", "-codec", "vp9", "recording.ts"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "unknown codec")
+
+	stderr.Reset()
+	assert.Equal(t, 2, extractCaptions([]string{"-pid", "0x100", "-format", "ttml", "recording.ts"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "unknown timed text format")
+}
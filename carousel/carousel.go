@@ -0,0 +1,300 @@
+// Package carousel repeats the PSI and SI tables generated by tribd: each table is sent at its own
+// repetition interval, the tables sharing an interval are spread across it rather than sent in bursts,
+// and the version_number of a table is bumped only when its content changes.
+package carousel
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/fifobuffer"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+var (
+	ErrInvalidTable    = errors.New("carousel: invalid table")
+	ErrInvalidInterval = errors.New("carousel: invalid repetition interval")
+)
+
+// Typical repetition intervals of DVB and MPEG tables, within the maxima of ETSI TR 101 290 and
+// ETSI TS 101 211.
+const (
+	PATInterval = 100 * time.Millisecond
+	PMTInterval = 100 * time.Millisecond
+	CATInterval = 100 * time.Millisecond
+	NITInterval = 2 * time.Second
+	SDTInterval = 2 * time.Second
+	EITInterval = 2 * time.Second // Present/following of the actual transport stream.
+	TDTInterval = 5 * time.Second
+)
+
+// Key identifies a table of the carousel.
+type Key struct {
+	PID       uint16
+	TableID   uint8
+	Extension uint16 // table_id_extension, or 0 for short form tables.
+}
+
+// Generator returns the sections of a table regenerated at the time it is sent, such as a TDT or TOT.
+type Generator func(at time.Time) []*mpegts.Section
+
+// table is a table of the carousel.
+type table struct {
+	key       Key
+	interval  time.Duration
+	sections  []*mpegts.Section // Sections as sent, with the version of the carousel.
+	generator Generator
+	version   uint8
+	deadline  time.Time // When the table is next sent.
+}
+
+// Carousel schedules the tables of a transport stream. It is safe for concurrent use.
+type Carousel struct {
+	mu     sync.Mutex
+	tables map[Key]*table
+	cc     map[uint16]uint8 // Continuity counter of each PID.
+	now    func() time.Time
+}
+
+// NewCarousel creates an empty carousel.
+func NewCarousel() *Carousel {
+	return &Carousel{
+		tables: make(map[Key]*table),
+		cc:     make(map[uint16]uint8),
+		now:    time.Now,
+	}
+}
+
+// Set adds the table made of the given sections to the carousel, sent on pid every interval, or updates
+// it. The sections must be those of one table: the same table_id and table_id_extension. A new table
+// keeps the version of its sections and is given the free slot farthest from the other tables of its
+// interval. An update that changes the content of the table is sent with the next version at its next
+// slot, and one that leaves the content unchanged only changes the interval.
+func (c *Carousel) Set(pid uint16, interval time.Duration, sections ...*mpegts.Section) error {
+	key, err := tableKey(pid, sections)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return ErrInvalidInterval
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[key]
+	switch {
+	case !ok:
+		t = c.add(key, interval)
+		t.version = sections[0].Version
+		t.sections = versioned(pid, sections, t.version)
+	case !sameContent(t.sections, sections):
+		t.version = (t.version + 1) & 0x1F
+		t.sections = versioned(pid, sections, t.version)
+	}
+	t.interval = interval
+	t.generator = nil
+	return nil
+}
+
+// SetFunc adds a table whose sections are regenerated by generator each time it is sent, every interval.
+// The table is identified by the sections the generator returns for the current time. Versions are not
+// managed for generated tables, which are usually the versionless TDT and TOT.
+func (c *Carousel) SetFunc(pid uint16, interval time.Duration, generator Generator) error {
+	if interval <= 0 {
+		return ErrInvalidInterval
+	}
+	key, err := tableKey(pid, generator(c.now()))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[key]
+	if !ok {
+		t = c.add(key, interval)
+	}
+	t.interval = interval
+	t.sections = nil
+	t.generator = generator
+	return nil
+}
+
+// Remove takes a table out of the carousel.
+func (c *Carousel) Remove(key Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tables, key)
+}
+
+// Version returns the version_number a table is sent with.
+func (c *Carousel) Version(key Key) (uint8, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tables[key]
+	if !ok {
+		return 0, false
+	}
+	return t.version, true
+}
+
+// Keys returns the tables of the carousel in the order of their keys.
+func (c *Carousel) Keys() []Key {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]Key, 0, len(c.tables))
+	for key := range c.tables {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compareKeys)
+	return keys
+}
+
+// Due returns the packets of the tables due by now, earliest deadline first, and schedules their next
+// transmission one interval later. A table that has fallen more than an interval behind, because Due
+// was not called for a while, is rescheduled from now rather than sent repeatedly to catch up.
+func (c *Carousel) Due() mpegts.EncodedPackets {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+
+	var due []*table
+	for _, t := range c.tables {
+		if !t.deadline.After(now) {
+			due = append(due, t)
+		}
+	}
+	slices.SortFunc(due, func(a, b *table) int {
+		if n := a.deadline.Compare(b.deadline); n != 0 {
+			return n
+		}
+		return compareKeys(a.key, b.key)
+	})
+
+	var packets mpegts.EncodedPackets
+	for _, t := range due {
+		sections := t.sections
+		if t.generator != nil {
+			sections = t.generator(now)
+		}
+		data := make([][]byte, len(sections))
+		for i, s := range sections {
+			data[i] = s.Data
+		}
+		encoded, cc := mpegts.PacketizeSections(t.key.PID, c.cc[t.key.PID], data...)
+		c.cc[t.key.PID] = cc
+		packets = append(packets, encoded...)
+
+		t.deadline = t.deadline.Add(t.interval)
+		if !t.deadline.After(now) {
+			t.deadline = now.Add(t.interval)
+		}
+	}
+	return packets
+}
+
+// Fill pushes the packets of the tables due by now to the buffer, ahead of the given elementary stream
+// packets.
+func (c *Carousel) Fill(buffer *fifobuffer.FIFOBuffer[*mpegts.EncodedPacket], packets ...*mpegts.EncodedPacket) {
+	for _, ep := range c.Due() {
+		buffer.Push(ep)
+	}
+	for _, ep := range packets {
+		buffer.Push(ep)
+	}
+}
+
+// add creates a table in the middle of the largest gap between the next deadlines of the tables with
+// the same interval, or due now when it is the first of its interval.
+func (c *Carousel) add(key Key, interval time.Duration) *table {
+	now := c.now()
+	var offsets []time.Duration
+	for _, t := range c.tables {
+		if t.interval == interval {
+			offset := t.deadline.Sub(now) % interval
+			if offset < 0 {
+				offset += interval
+			}
+			offsets = append(offsets, offset)
+		}
+	}
+
+	var offset time.Duration
+	if len(offsets) > 0 {
+		slices.Sort(offsets)
+		offsets = append(offsets, offsets[0]+interval) // The gap wrapping around the interval.
+		largest := time.Duration(-1)
+		for i := 1; i < len(offsets); i++ {
+			if gap := offsets[i] - offsets[i-1]; gap > largest {
+				largest = gap
+				offset = offsets[i-1] + gap/2
+			}
+		}
+		offset %= interval
+	}
+
+	t := &table{key: key, interval: interval, deadline: now.Add(offset)}
+	c.tables[key] = t
+	return t
+}
+
+// tableKey returns the key of the table made of sections, which must share a table_id and
+// table_id_extension.
+func tableKey(pid uint16, sections []*mpegts.Section) (Key, error) {
+	if len(sections) == 0 || pid > 0x1FFE {
+		return Key{}, ErrInvalidTable
+	}
+	key := Key{PID: pid, TableID: sections[0].TableID, Extension: sections[0].TableIDExtension}
+	for _, s := range sections {
+		if s.TableID != key.TableID || s.TableIDExtension != key.Extension {
+			return Key{}, ErrInvalidTable
+		}
+	}
+	return key, nil
+}
+
+// versioned returns copies of long form sections carrying the given version and PID.
+func versioned(pid uint16, sections []*mpegts.Section, version uint8) []*mpegts.Section {
+	copies := make([]*mpegts.Section, len(sections))
+	for i, s := range sections {
+		c := *s
+		c.PID = pid
+		if s.SectionSyntaxIndicator {
+			c.Version = version
+			c.Marshal(s.Body())
+		}
+		copies[i] = &c
+	}
+	return copies
+}
+
+// sameContent reports whether two tables carry the same sections, ignoring their versions.
+func sameContent(a, b []*mpegts.Section) bool {
+	return slices.EqualFunc(a, b, func(x, y *mpegts.Section) bool {
+		return bytes.Equal(unversioned(x), unversioned(y))
+	})
+}
+
+// unversioned returns the bytes of a section without its version_number and CRC.
+func unversioned(s *mpegts.Section) []byte {
+	if !s.SectionSyntaxIndicator || len(s.Data) < 8+4 {
+		return s.Data
+	}
+	data := slices.Clone(s.Data[:len(s.Data)-4])
+	data[5] &^= 0x3E
+	return data
+}
+
+// compareKeys orders keys by PID, table_id and table_id_extension.
+func compareKeys(a, b Key) int {
+	switch {
+	case a.PID != b.PID:
+		return int(a.PID) - int(b.PID)
+	case a.TableID != b.TableID:
+		return int(a.TableID) - int(b.TableID)
+	}
+	return int(a.Extension) - int(b.Extension)
+}
@@ -0,0 +1,207 @@
+package carousel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/fifobuffer"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a manual clock for the carousel.
+type clock struct {
+	at time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.at
+}
+
+func newTestCarousel() (*Carousel, *clock) {
+	clk := &clock{at: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := NewCarousel()
+	c.now = clk.now
+	return c, clk
+}
+
+// run advances the clock in steps of one millisecond for d and returns the elapsed time at which each
+// PID was sent.
+func run(c *Carousel, clk *clock, d time.Duration) map[uint16][]time.Duration {
+	sent := make(map[uint16][]time.Duration)
+	for elapsed := time.Duration(0); elapsed < d; elapsed += time.Millisecond {
+		seen := make(map[uint16]bool)
+		for _, ep := range c.Due() {
+			if pid := ep.GetPID(); !seen[pid] {
+				seen[pid] = true
+				sent[pid] = append(sent[pid], elapsed)
+			}
+		}
+		clk.at = clk.at.Add(time.Millisecond)
+	}
+	return sent
+}
+
+func testPAT(programs ...uint16) *mpegts.PAT {
+	pat := mpegts.NewPAT(1, 0)
+	for _, program := range programs {
+		pat.Programs[program] = 0x1000 + program
+	}
+	return pat
+}
+
+// testSDT returns the sections of an SDT with a single service.
+func testSDT(t *testing.T, name string) []*mpegts.Section {
+	sdt := &mpegts.SDT{Actual: true, TransportStreamID: 1, OriginalNetworkID: 1, CurrentNext: true, Services: []mpegts.SDTService{
+		{ServiceID: 1, RunningStatus: 4, Descriptors: mpegts.Descriptors(&mpegts.ServiceDescriptor{ServiceType: 1, ServiceName: name})},
+	}}
+	sections, err := sdt.Sections()
+	assert.NoError(t, err)
+	return sections
+}
+
+// sent parses the sections of the packets on a PID.
+func sent(t *testing.T, packets mpegts.EncodedPackets, pid uint16) []*mpegts.Section {
+	sa := mpegts.NewSectionAssembler()
+	var sections []*mpegts.Section
+	for _, ep := range packets {
+		if ep.GetPID() == pid {
+			s, err := sa.Push(ep)
+			assert.NoError(t, err)
+			sections = append(sections, s...)
+		}
+	}
+	return sections
+}
+
+func TestCarouselRepetition(t *testing.T) {
+	c, clk := newTestCarousel()
+	assert.NoError(t, c.Set(mpegts.PATPID, PATInterval, testPAT(1).Sections()...))
+	assert.NoError(t, c.Set(mpegts.SDTPID, SDTInterval, testSDT(t, "one")...))
+
+	times := run(c, clk, 5*time.Second)
+	assert.Len(t, times[mpegts.PATPID], 50)
+	for i, at := range times[mpegts.PATPID] {
+		assert.Equal(t, time.Duration(i)*PATInterval, at)
+	}
+	assert.Equal(t, []time.Duration{0, 2 * time.Second, 4 * time.Second}, times[mpegts.SDTPID])
+	assert.Equal(t, []Key{{mpegts.PATPID, mpegts.PATTableID, 1}, {mpegts.SDTPID, mpegts.SDTActualTableID, 1}}, c.Keys())
+}
+
+func TestCarouselSpread(t *testing.T) {
+	c, clk := newTestCarousel()
+	for program := uint16(1); program <= 4; program++ {
+		pmt := &mpegts.PMT{ProgramNumber: program, CurrentNext: true, PCRPID: 0x100}
+		s, err := pmt.Section()
+		assert.NoError(t, err)
+		assert.NoError(t, c.Set(0x1000+program, PMTInterval, s))
+	}
+
+	// Each table takes the middle of the largest gap left by the others.
+	times := run(c, clk, 200*time.Millisecond)
+	ms := time.Millisecond
+	assert.Equal(t, []time.Duration{0, 100 * ms}, times[0x1001])
+	assert.Equal(t, []time.Duration{50 * ms, 150 * ms}, times[0x1002])
+	assert.Equal(t, []time.Duration{25 * ms, 125 * ms}, times[0x1003])
+	assert.Equal(t, []time.Duration{75 * ms, 175 * ms}, times[0x1004])
+}
+
+func TestCarouselVersions(t *testing.T) {
+	c, _ := newTestCarousel()
+	key := Key{mpegts.PATPID, mpegts.PATTableID, 1}
+
+	pat := testPAT(1)
+	pat.Version = 7
+	assert.NoError(t, c.Set(mpegts.PATPID, PATInterval, pat.Sections()...))
+	version, ok := c.Version(key)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(7), version)
+
+	// The same content under another version is not a change.
+	pat.Version = 3
+	assert.NoError(t, c.Set(mpegts.PATPID, PATInterval, pat.Sections()...))
+	version, _ = c.Version(key)
+	assert.Equal(t, uint8(7), version)
+
+	// New content is sent with the next version, whatever the version of its sections.
+	assert.NoError(t, c.Set(mpegts.PATPID, PATInterval, testPAT(1, 2).Sections()...))
+	sections := sent(t, c.Due(), mpegts.PATPID)
+	assert.Len(t, sections, 1)
+	parsed, err := mpegts.ParsePAT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(8), parsed.Version)
+	assert.Equal(t, map[uint16]uint16{1: 0x1001, 2: 0x1002}, parsed.Programs)
+
+	// The version wraps at 5 bits.
+	for i := 3; i < 28; i++ {
+		assert.NoError(t, c.Set(mpegts.PATPID, PATInterval, testPAT(uint16(i)).Sections()...))
+	}
+	version, _ = c.Version(key)
+	assert.Equal(t, uint8(1), version)
+
+	c.Remove(key)
+	_, ok = c.Version(key)
+	assert.False(t, ok)
+	assert.Empty(t, c.Due())
+}
+
+func TestCarouselGenerated(t *testing.T) {
+	c, clk := newTestCarousel()
+	start := clk.at
+	assert.NoError(t, c.SetFunc(mpegts.TDTPID, TDTInterval, func(at time.Time) []*mpegts.Section {
+		return []*mpegts.Section{(&mpegts.TDT{UTCTime: at}).Section()}
+	}))
+
+	for i := 0; i < 3; i++ {
+		sections := sent(t, c.Due(), mpegts.TDTPID)
+		assert.Len(t, sections, 1)
+		tdt, err := mpegts.ParseTDT(sections[0])
+		assert.NoError(t, err)
+		assert.Equal(t, start.Add(time.Duration(i)*TDTInterval), tdt.UTCTime)
+
+		assert.Empty(t, c.Due())
+		clk.at = clk.at.Add(TDTInterval)
+	}
+}
+
+func TestCarouselCatchUp(t *testing.T) {
+	c, clk := newTestCarousel()
+	assert.NoError(t, c.Set(mpegts.PATPID, PATInterval, testPAT(1).Sections()...))
+	assert.Len(t, c.Due(), 1)
+
+	// After a stall the table is sent once and rescheduled from then.
+	clk.at = clk.at.Add(time.Second + 10*time.Millisecond)
+	packets := c.Due()
+	assert.Len(t, packets, 1)
+	assert.Equal(t, uint8(1), packets[0].GetCC())
+	assert.Empty(t, c.Due())
+	clk.at = clk.at.Add(PATInterval)
+	assert.Len(t, c.Due(), 1)
+}
+
+func TestCarouselFill(t *testing.T) {
+	c, _ := newTestCarousel()
+	assert.NoError(t, c.Set(mpegts.PATPID, PATInterval, testPAT(1).Sections()...))
+
+	buffer := fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket]()
+	es := &mpegts.EncodedPacket{0x47, 0x01, 0x00, 0x10}
+	c.Fill(buffer, es)
+	c.Fill(buffer, es) // The PAT is not due again yet.
+
+	var pids []uint16
+	for ep, ok := buffer.Pop(); ok; ep, ok = buffer.Pop() {
+		pids = append(pids, ep.GetPID())
+	}
+	assert.Equal(t, []uint16{mpegts.PATPID, 0x100, 0x100}, pids)
+}
+
+func TestCarouselErrors(t *testing.T) {
+	c, _ := newTestCarousel()
+	pat := testPAT(1).Sections()
+	assert.ErrorIs(t, c.Set(mpegts.PATPID, 0, pat...), ErrInvalidInterval)
+	assert.ErrorIs(t, c.Set(mpegts.PATPID, PATInterval), ErrInvalidTable)
+	assert.ErrorIs(t, c.Set(0x1FFF, PATInterval, pat...), ErrInvalidTable)
+	assert.ErrorIs(t, c.Set(mpegts.SDTPID, SDTInterval, append(testSDT(t, "a"), pat...)...), ErrInvalidTable)
+	assert.ErrorIs(t, c.SetFunc(mpegts.TDTPID, 0, nil), ErrInvalidInterval)
+	assert.Empty(t, c.Keys())
+}
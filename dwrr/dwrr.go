@@ -51,6 +51,14 @@ func (dwrr *DWRR[T]) RemoveQueue() {
 	dwrr.quantums = dwrr.quantums[:len(dwrr.quantums)-1]
 }
 
+// Len returns the number of queues.
+func (dwrr *DWRR[T]) Len() uint {
+	dwrr.mu.Lock()
+	defer dwrr.mu.Unlock()
+
+	return uint(len(dwrr.queues))
+}
+
 // Enqueue adds items to a specific queue.
 // `queue` is the index of the queue to which items are added.
 // `items` is a slice of items of type T to be added to the queue.
@@ -1,7 +1,26 @@
 package main
 
+import (
+	"flag"
+	"os"
+
+	"github.com/Channel-3-Eugene/tribd/config"
+)
+
 func main() {
-	// Get configuration
-	config := &Config{}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "analyze":
+			os.Exit(analyze(os.Args[2:], os.Stdout, os.Stderr))
+		case "captions":
+			os.Exit(extractCaptions(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
 
+	configPath := flag.String("config", "tribd.conf", "configuration file")
+	flag.Parse()
+
+	// Get configuration
+	cfg := &config.Config{}
+	cfg.Read(*configPath)
 }
@@ -0,0 +1,129 @@
+package monitor
+
+import "time"
+
+// Check identifies one of the ETSI TR 101 290 measurements.
+type Check int
+
+// Priority 1 checks.
+const (
+	TSSyncLoss Check = iota
+	SyncByteError
+	PATError
+	ContinuityCountError
+	PMTError
+	PIDError
+)
+
+// Priority 2 checks.
+const (
+	TransportError Check = iota + PIDError + 1
+	CRCError
+	PCRRepetitionError
+	PCRDiscontinuityError
+	PCRAccuracyError
+	PTSError
+	CATError
+)
+
+// Priority 3 checks.
+const (
+	NITError Check = iota + CATError + 1
+	SIRepetitionError
+	UnreferencedPID
+	SDTError
+	EITError
+	TDTError
+
+	numChecks
+)
+
+// Checks lists every check in report order.
+var Checks = func() []Check {
+	checks := make([]Check, numChecks)
+	for i := range checks {
+		checks[i] = Check(i)
+	}
+	return checks
+}()
+
+var checkNames = [numChecks]string{
+	TSSyncLoss:            "TS_sync_loss",
+	SyncByteError:         "Sync_byte_error",
+	PATError:              "PAT_error_2",
+	ContinuityCountError:  "Continuity_count_error",
+	PMTError:              "PMT_error_2",
+	PIDError:              "PID_error",
+	TransportError:        "Transport_error",
+	CRCError:              "CRC_error",
+	PCRRepetitionError:    "PCR_repetition_error",
+	PCRDiscontinuityError: "PCR_discontinuity_indicator_error",
+	PCRAccuracyError:      "PCR_accuracy_error",
+	PTSError:              "PTS_error",
+	CATError:              "CAT_error",
+	NITError:              "NIT_error",
+	SIRepetitionError:     "SI_repetition_error",
+	UnreferencedPID:       "Unreferenced_PID",
+	SDTError:              "SDT_error",
+	EITError:              "EIT_error",
+	TDTError:              "TDT_error",
+}
+
+// String returns the TR 101 290 name of the check.
+func (c Check) String() string {
+	if c < 0 || c >= numChecks {
+		return "unknown"
+	}
+	return checkNames[c]
+}
+
+// Priority returns the TR 101 290 priority of the check: 1, 2 or 3.
+func (c Check) Priority() int {
+	switch {
+	case c <= PIDError:
+		return 1
+	case c <= CATError:
+		return 2
+	}
+	return 3
+}
+
+// Intervals from TR 101 290 used by the checks.
+const (
+	PATInterval          = 500 * time.Millisecond // Longest gap between PAT sections.
+	PMTInterval          = 500 * time.Millisecond // Longest gap between sections of each PMT.
+	PTSInterval          = 700 * time.Millisecond // Longest gap between PTS values of an audio or video PID.
+	NITInterval          = 10 * time.Second       // Longest gap between NIT actual sections.
+	SDTInterval          = 2 * time.Second        // Longest gap between SDT actual sections.
+	EITInterval          = 2 * time.Second        // Longest gap between EIT present/following actual sections.
+	TDTInterval          = 30 * time.Second       // Longest gap between TDT sections.
+	SIMinInterval        = 25 * time.Millisecond  // Shortest gap between repetitions of a section.
+	UnreferencedInterval = 500 * time.Millisecond // How long a PID no table references may be present.
+)
+
+const (
+	DefaultPIDTimeout = 5 * time.Second // Default longest absence of a PID referenced by a PMT.
+	DefaultAlarmHold  = time.Second     // Default time an alarm stays raised after its last error.
+
+	tickInterval = 10 * time.Millisecond  // Spacing of the timeout checks.
+	maxClockStep = 100 * time.Millisecond // Largest PCR step followed by the stream clock.
+)
+
+// CheckState is the counter and alarm state of one check.
+type CheckState struct {
+	Check   Check
+	Count   uint64    // Errors detected.
+	Active  bool      // The alarm is raised.
+	Since   time.Time // When the alarm was raised; zero when it is not active.
+	Last    time.Time // Time of the last error.
+	Cleared time.Time // When the alarm was last cleared.
+	Detail  string    // Description of the last error.
+}
+
+// Alarm reports a change in the alarm state of a check.
+type Alarm struct {
+	Check  Check
+	Raised bool // False when the alarm cleared.
+	Time   time.Time
+	Detail string
+}
@@ -0,0 +1,667 @@
+// Package monitor measures MPEG transport streams against ETSI TR 101 290 and keeps alarm states
+// for every check. A Monitor can be attached to any input or output of tribd.
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+// SI PIDs and table ids followed by the monitor besides those of the mpegts package.
+const (
+	eitPID   = 0x0012
+	maxSIPID = 0x001F
+
+	batTableID         = 0x4A
+	eitPFActualTableID = 0x4E
+	eitLastTableID     = 0x6F
+	stTableID          = 0x72
+)
+
+// Options configures a Monitor.
+type Options struct {
+	// PIDTimeout is the longest a PID referenced by a PMT may be absent. Zero uses DefaultPIDTimeout.
+	PIDTimeout time.Duration
+	// AlarmHold is how long an alarm stays raised after its last error. Zero uses DefaultAlarmHold.
+	AlarmHold time.Duration
+	// OnAlarm, when set, is called whenever an alarm is raised or cleared. It is called while the
+	// monitor is locked and must not call back into it.
+	OnAlarm func(Alarm)
+}
+
+// timer follows the repetition of a table or PID.
+type timer struct {
+	last time.Time
+	late bool // The timeout was reported and the item has not been seen since.
+}
+
+// touch records an occurrence of the item.
+func (t *timer) touch(at time.Time) {
+	t.last, t.late = at, false
+}
+
+// expired reports the item once when it has not been seen for longer than limit.
+func (t *timer) expired(at time.Time, limit time.Duration) bool {
+	if t.late || at.Sub(t.last) <= limit {
+		return false
+	}
+	t.late = true
+	return true
+}
+
+// Monitor runs the TR 101 290 checks over a transport stream. It is safe for concurrent use, so that
+// reports can be taken while packets are pushed.
+type Monitor struct {
+	mu      sync.Mutex
+	name    string
+	opts    Options
+	framer  *mpegts.Framer
+	badSync uint64 // Framer BadSyncBytes already counted.
+
+	started bool
+	start   time.Time
+	now     time.Time
+	ticked  time.Time
+	clock   streamClock
+	packets uint64
+	pids    map[uint16]uint64
+	tei     map[uint16]uint64 // Packets with transport_error_indicator set, per PID.
+
+	checks   [numChecks]CheckState
+	cc       *mpegts.ContinuityTracker
+	pcr      *mpegts.PCRAnalyzer
+	pcrStats map[uint16]mpegts.PCRStats // Last analysis of each program, keyed by program number.
+	sections *mpegts.SectionAssembler
+
+	pat          timer
+	pmts         map[uint16]*timer    // Keyed by PMT PID.
+	programs     map[uint16][]uint16  // PIDs referenced by each PMT, keyed by PMT PID.
+	esPIDs       map[uint16]*timer    // PIDs referenced by PMTs, for PID_error.
+	ptsPIDs      map[uint16]*timer    // Audio and video PIDs, for PTS_error.
+	caPIDs       map[uint16]bool      // EMM and ECM PIDs from the CAT and PMTs.
+	si           map[uint16]*timer    // NIT, SDT, EIT and TDT PIDs, once their table was first seen.
+	lastSection  map[uint64]time.Time // Last occurrence of each section, for SI_repetition_error.
+	unreferenced map[uint16]time.Time // First sighting of each PID that no table references.
+	catSeen      bool
+	syncLost     bool
+}
+
+// NewMonitor creates a monitor. The name identifies the stream in reports.
+func NewMonitor(name string, opts Options) *Monitor {
+	if opts.PIDTimeout <= 0 {
+		opts.PIDTimeout = DefaultPIDTimeout
+	}
+	if opts.AlarmHold <= 0 {
+		opts.AlarmHold = DefaultAlarmHold
+	}
+	m := &Monitor{
+		name:         name,
+		opts:         opts,
+		framer:       mpegts.NewFramer(mpegts.DefaultLockCount),
+		pids:         make(map[uint16]uint64),
+		tei:          make(map[uint16]uint64),
+		cc:           mpegts.NewContinuityTracker(),
+		pcr:          mpegts.NewPCRAnalyzer(),
+		pcrStats:     make(map[uint16]mpegts.PCRStats),
+		sections:     mpegts.NewSectionAssembler(),
+		pmts:         make(map[uint16]*timer),
+		programs:     make(map[uint16][]uint16),
+		esPIDs:       make(map[uint16]*timer),
+		ptsPIDs:      make(map[uint16]*timer),
+		caPIDs:       make(map[uint16]bool),
+		si:           make(map[uint16]*timer),
+		lastSection:  make(map[uint64]time.Time),
+		unreferenced: make(map[uint16]time.Time),
+	}
+	for _, c := range Checks {
+		m.checks[c].Check = c
+	}
+	return m
+}
+
+// Write frames raw transport stream bytes, such as those read from a socket, and monitors the packets
+// found. Arrival times are taken from the wall clock. It always consumes the whole chunk.
+func (m *Monitor) Write(chunk []byte) (int, error) {
+	m.PushBytes(chunk, time.Now())
+	return len(chunk), nil
+}
+
+// PushBytes frames raw transport stream bytes that arrived at the given time and monitors the packets
+// found, reporting TS_sync_loss and Sync_byte_error from the framer. It returns the packets.
+func (m *Monitor) PushBytes(chunk []byte, at time.Time) mpegts.EncodedPackets {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	packets, events := m.framer.Push(chunk)
+	for _, e := range events {
+		now := m.timestamp(nil, at)
+		if e.Type == mpegts.SyncLost {
+			m.syncLost = true
+			m.event(TSSyncLoss, now, "sync lost at byte %d", e.Offset)
+		} else {
+			m.syncLost = false
+			m.clear(TSSyncLoss, now)
+		}
+	}
+	if stats := m.framer.Stats(); stats.BadSyncBytes > m.badSync {
+		m.badSync = stats.BadSyncBytes
+		m.event(SyncByteError, m.timestamp(nil, at), "corrupted sync byte")
+	}
+	for _, ep := range packets {
+		m.push(ep, at)
+	}
+	return packets
+}
+
+// Push monitors one aligned packet that arrived at the given time. A zero time, as when reading a
+// file, times the stream from its own PCRs instead.
+func (m *Monitor) Push(ep *mpegts.EncodedPacket, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.push(ep, at)
+}
+
+func (m *Monitor) push(ep *mpegts.EncodedPacket, arrival time.Time) {
+	at := m.timestamp(ep, arrival)
+	m.packets++
+
+	if !ep.IsMPEGTS() {
+		m.event(SyncByteError, at, "sync byte 0x%02X", ep.GetSyncByte())
+		return
+	}
+	// Packets flagged as corrupted still count towards their PID, but are not checked further.
+	pid := ep.GetPID()
+	m.pids[pid]++
+	if ep.GetTEI() {
+		m.tei[pid]++
+		m.event(TransportError, at, "transport_error_indicator on PID 0x%04X", pid)
+		m.tick(at)
+		return
+	}
+
+	// Null packets count towards the stream's bitrate.
+	m.pcr.Push(ep, arrival)
+	if hasPCR(ep) {
+		m.checkPCR(at)
+	}
+
+	if ep.IsNullPacket() {
+		m.tick(at)
+		return
+	}
+
+	if m.cc.Check(ep) == mpegts.ContinuityGap {
+		m.event(ContinuityCountError, at, "PID 0x%04X", pid)
+	}
+
+	scrambled := ep.GetTSC() != 0
+	switch {
+	case pid == mpegts.PATPID && scrambled:
+		m.event(PATError, at, "scrambled PAT packet")
+	case m.pmts[pid] != nil && scrambled:
+		m.event(PMTError, at, "scrambled PMT packet on PID 0x%04X", pid)
+	case scrambled && !m.catSeen:
+		m.event(CATError, at, "scrambled packet on PID 0x%04X without a CAT", pid)
+	}
+
+	if pid <= maxSIPID || m.pmts[pid] != nil {
+		sections, err := m.sections.Push(ep)
+		if errors.Is(err, mpegts.ErrCRCMismatch) {
+			m.event(CRCError, at, "PID 0x%04X", pid)
+		}
+		for _, s := range sections {
+			m.section(s, at)
+		}
+	}
+
+	if t := m.esPIDs[pid]; t != nil {
+		t.touch(at)
+	}
+	if t := m.ptsPIDs[pid]; t != nil {
+		if _, ok := ep.GetPTS(); ok {
+			if !t.late && at.Sub(t.last) > PTSInterval {
+				m.event(PTSError, at, "PID 0x%04X: PTS after %s", pid, at.Sub(t.last))
+			}
+			t.touch(at)
+		}
+	}
+
+	if pid > maxSIPID && !m.referenced(pid) {
+		first, ok := m.unreferenced[pid]
+		switch {
+		case !ok:
+			m.unreferenced[pid] = at
+		case !first.IsZero() && at.Sub(first) > UnreferencedInterval && m.pmtsParsed():
+			m.event(UnreferencedPID, at, "PID 0x%04X", pid)
+			m.unreferenced[pid] = time.Time{} // Reported.
+		}
+	}
+
+	m.tick(at)
+}
+
+// hasPCR reports whether the packet carries a PCR, including a PCR of zero.
+func hasPCR(ep *mpegts.EncodedPacket) bool {
+	af, err := mpegts.ParseAdaptationField(ep)
+	return err == nil && af != nil && af.HasPCR
+}
+
+// referenced reports whether a table references the PID.
+func (m *Monitor) referenced(pid uint16) bool {
+	return m.pmts[pid] != nil || m.esPIDs[pid] != nil || m.caPIDs[pid]
+}
+
+// section runs the checks on a reassembled PSI/SI section.
+func (m *Monitor) section(s *mpegts.Section, at time.Time) {
+	valid := true
+	switch s.PID {
+	case mpegts.PATPID:
+		if valid = s.TableID == mpegts.PATTableID; !valid {
+			m.event(PATError, at, "table_id 0x%02X on PID 0x0000", s.TableID)
+			break
+		}
+		m.pat.touch(at)
+		if pat, err := mpegts.ParsePAT(s); err == nil {
+			m.updatePAT(pat, at)
+		}
+	case mpegts.CATPID:
+		if valid = s.TableID == mpegts.CATTableID; !valid {
+			m.event(CATError, at, "table_id 0x%02X on PID 0x0001", s.TableID)
+			break
+		}
+		m.catSeen = true
+		if cat, err := mpegts.ParseCAT(s); err == nil {
+			m.addCAPIDs(cat.EMMPIDs())
+		}
+	case mpegts.NITPID:
+		valid = s.TableID == mpegts.NITActualTableID || s.TableID == mpegts.NITOtherTableID || s.TableID == stTableID
+		m.siTable(NITError, s, valid, s.TableID == mpegts.NITActualTableID, at)
+	case mpegts.SDTPID:
+		valid = s.TableID == mpegts.SDTActualTableID || s.TableID == mpegts.SDTOtherTableID || s.TableID == batTableID || s.TableID == stTableID
+		m.siTable(SDTError, s, valid, s.TableID == mpegts.SDTActualTableID, at)
+	case eitPID:
+		valid = s.TableID >= eitPFActualTableID && s.TableID <= eitLastTableID || s.TableID == stTableID
+		m.siTable(EITError, s, valid, s.TableID == eitPFActualTableID, at)
+	case mpegts.TDTPID:
+		valid = s.TableID == mpegts.TDTTableID || s.TableID == mpegts.TOTTableID || s.TableID == stTableID
+		m.siTable(TDTError, s, valid, s.TableID == mpegts.TDTTableID, at)
+	default:
+		t := m.pmts[s.PID]
+		if t == nil {
+			return
+		}
+		if valid = s.TableID == mpegts.PMTTableID; !valid {
+			m.event(PMTError, at, "table_id 0x%02X on PMT PID 0x%04X", s.TableID, s.PID)
+			break
+		}
+		t.touch(at)
+		if pmt, err := mpegts.ParsePMT(s); err == nil {
+			m.updatePMT(s.PID, pmt, at)
+		}
+	}
+
+	if valid && s.TableID != mpegts.TDTTableID && s.TableID != mpegts.TOTTableID && s.TableID != stTableID {
+		m.repetition(s, at)
+	}
+}
+
+// siTable checks a DVB SI section and starts following the table once its actual variant was seen.
+func (m *Monitor) siTable(check Check, s *mpegts.Section, valid, actual bool, at time.Time) {
+	if !valid {
+		m.event(check, at, "table_id 0x%02X on PID 0x%04X", s.TableID, s.PID)
+		return
+	}
+	if !actual {
+		return
+	}
+	if t := m.si[s.PID]; t != nil {
+		t.touch(at)
+	} else {
+		m.si[s.PID] = &timer{last: at}
+	}
+}
+
+// repetition reports sections repeated faster than SIMinInterval.
+func (m *Monitor) repetition(s *mpegts.Section, at time.Time) {
+	key := uint64(s.PID)<<40 | uint64(s.TableID)<<32 | uint64(s.TableIDExtension)<<16 | uint64(s.SectionNumber)
+	if last, ok := m.lastSection[key]; ok && at.Sub(last) < SIMinInterval && at.After(last) {
+		m.event(SIRepetitionError, at, "table_id 0x%02X on PID 0x%04X repeated after %s", s.TableID, s.PID, at.Sub(last))
+	}
+	m.lastSection[key] = at
+}
+
+// updatePAT follows the PMT PIDs listed in the PAT.
+func (m *Monitor) updatePAT(pat *mpegts.PAT, at time.Time) {
+	listed := make(map[uint16]bool)
+	for _, program := range pat.ProgramNumbers() {
+		pid, _ := pat.PMTPID(program)
+		listed[pid] = true
+		if m.pmts[pid] == nil {
+			m.pmts[pid] = &timer{last: at}
+			m.programs[pid] = nil
+		}
+	}
+	for pid := range m.pmts {
+		if !listed[pid] {
+			m.dropPIDs(m.programs[pid])
+			delete(m.pmts, pid)
+			delete(m.programs, pid)
+		}
+	}
+}
+
+// updatePMT follows the elementary, PCR and ECM PIDs listed in a PMT.
+func (m *Monitor) updatePMT(pmtPID uint16, pmt *mpegts.PMT, at time.Time) {
+	pids := []uint16{}
+	add := func(pid uint16) {
+		pids = append(pids, pid)
+		if m.esPIDs[pid] == nil {
+			m.esPIDs[pid] = &timer{last: at}
+		}
+	}
+
+	m.addCAPIDs(pmt.ECMPIDs())
+	if pmt.PCRPID != 0x1FFF {
+		add(pmt.PCRPID)
+	}
+	for _, es := range pmt.Streams {
+		add(es.ElementaryPID)
+		category, _ := mpegts.ClassifyStream(es.StreamType, es.Descriptors)
+		if (category == mpegts.CategoryVideo || category == mpegts.CategoryAudio) && m.ptsPIDs[es.ElementaryPID] == nil {
+			m.ptsPIDs[es.ElementaryPID] = &timer{last: at}
+		}
+	}
+
+	old := m.programs[pmtPID]
+	m.programs[pmtPID] = pids
+	m.dropPIDs(old)
+}
+
+// pmtsParsed reports whether the PAT and every PMT it lists have been parsed.
+func (m *Monitor) pmtsParsed() bool {
+	for _, pids := range m.programs {
+		if pids == nil {
+			return false
+		}
+	}
+	return len(m.programs) > 0
+}
+
+// dropPIDs stops following PIDs no longer referenced by any PMT.
+func (m *Monitor) dropPIDs(pids []uint16) {
+	for _, pid := range pids {
+		used := false
+		for _, others := range m.programs {
+			for _, other := range others {
+				used = used || other == pid
+			}
+		}
+		if !used {
+			delete(m.esPIDs, pid)
+			delete(m.ptsPIDs, pid)
+		}
+	}
+}
+
+// addCAPIDs marks EMM or ECM PIDs as referenced.
+func (m *Monitor) addCAPIDs(pids []uint16) {
+	for _, pid := range pids {
+		m.caPIDs[pid] = true
+	}
+}
+
+// checkPCR reports the errors found by the PCR analysis since the last PCR.
+func (m *Monitor) checkPCR(at time.Time) {
+	for _, stats := range m.pcr.Results() {
+		last := m.pcrStats[stats.Program]
+		m.pcrStats[stats.Program] = stats
+		if stats.IntervalErrors > last.IntervalErrors {
+			m.event(PCRRepetitionError, at, "program %d: PCR interval %s", stats.Program, stats.Interval)
+		}
+		if stats.DiscontinuityErrors > last.DiscontinuityErrors {
+			m.event(PCRDiscontinuityError, at, "program %d: PCR discontinuity without indicator", stats.Program)
+		}
+		if stats.AccuracyErrors > last.AccuracyErrors {
+			m.event(PCRAccuracyError, at, "program %d: PCR off by %s", stats.Program, stats.Accuracy)
+		}
+	}
+}
+
+// Tick runs the timeout checks at the given time, for when no packets arrive. A zero time uses the
+// time of the last packet.
+func (m *Monitor) Tick(at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.started {
+		return
+	}
+	if at.IsZero() {
+		at = m.now
+	}
+	m.ticked = time.Time{}
+	m.tick(at)
+}
+
+// tick runs the timeout checks and clears the alarms whose errors stopped.
+func (m *Monitor) tick(at time.Time) {
+	if !m.ticked.IsZero() && at.Sub(m.ticked) < tickInterval {
+		return
+	}
+	m.ticked = at
+
+	if m.pat.expired(at, PATInterval) {
+		m.event(PATError, at, "no PAT for %s", PATInterval)
+	}
+	for pid, t := range m.pmts {
+		if t.expired(at, PMTInterval) {
+			m.event(PMTError, at, "no PMT on PID 0x%04X for %s", pid, PMTInterval)
+		}
+	}
+	for pid, t := range m.esPIDs {
+		if t.expired(at, m.opts.PIDTimeout) {
+			m.event(PIDError, at, "no packets on PID 0x%04X for %s", pid, m.opts.PIDTimeout)
+		}
+	}
+	for pid, t := range m.ptsPIDs {
+		if t.expired(at, PTSInterval) {
+			m.event(PTSError, at, "no PTS on PID 0x%04X for %s", pid, PTSInterval)
+		}
+	}
+	for pid, t := range m.si {
+		check, limit := siTimeout(pid)
+		if t.expired(at, limit) {
+			m.event(check, at, "no table on PID 0x%04X for %s", pid, limit)
+		}
+	}
+
+	// Alarms clear once their errors have stopped for the hold time and no timeout is outstanding.
+	late := m.lateChecks()
+	for c := range m.checks {
+		state := &m.checks[c]
+		if state.Active && !late[c] && at.Sub(state.Last) >= m.opts.AlarmHold {
+			m.clear(Check(c), at)
+		}
+	}
+}
+
+// siTimeout returns the check and repetition limit of the table followed on an SI PID.
+func siTimeout(pid uint16) (Check, time.Duration) {
+	switch pid {
+	case mpegts.NITPID:
+		return NITError, NITInterval
+	case mpegts.SDTPID:
+		return SDTError, SDTInterval
+	case eitPID:
+		return EITError, EITInterval
+	}
+	return TDTError, TDTInterval
+}
+
+// lateChecks returns the checks with a timeout still outstanding.
+func (m *Monitor) lateChecks() [numChecks]bool {
+	var late [numChecks]bool
+	late[TSSyncLoss] = m.syncLost
+	late[PATError] = m.pat.late
+	for _, t := range m.pmts {
+		late[PMTError] = late[PMTError] || t.late
+	}
+	for _, t := range m.esPIDs {
+		late[PIDError] = late[PIDError] || t.late
+	}
+	for _, t := range m.ptsPIDs {
+		late[PTSError] = late[PTSError] || t.late
+	}
+	for pid, t := range m.si {
+		check, _ := siTimeout(pid)
+		late[check] = late[check] || t.late
+	}
+	return late
+}
+
+// event counts an error and raises its alarm.
+func (m *Monitor) event(c Check, at time.Time, format string, args ...interface{}) {
+	state := &m.checks[c]
+	state.Count++
+	state.Last = at
+	state.Detail = fmt.Sprintf(format, args...)
+	if state.Active {
+		return
+	}
+	state.Active, state.Since = true, at
+	if m.opts.OnAlarm != nil {
+		m.opts.OnAlarm(Alarm{Check: c, Raised: true, Time: at, Detail: state.Detail})
+	}
+}
+
+// clear lowers the alarm of a check.
+func (m *Monitor) clear(c Check, at time.Time) {
+	state := &m.checks[c]
+	if !state.Active {
+		return
+	}
+	state.Active, state.Since, state.Cleared = false, time.Time{}, at
+	if m.opts.OnAlarm != nil {
+		m.opts.OnAlarm(Alarm{Check: c, Raised: false, Time: at})
+	}
+}
+
+// timestamp returns the time of a packet: its arrival time when known, or else the stream time
+// given by the PCRs seen so far.
+func (m *Monitor) timestamp(ep *mpegts.EncodedPacket, arrival time.Time) time.Time {
+	at := arrival
+	if at.IsZero() {
+		if ep != nil {
+			m.clock.push(ep)
+		}
+		at = m.clock.now()
+	}
+	if !m.started {
+		m.started, m.start = true, at
+		m.pat.last = at
+	}
+	m.now = at
+	return at
+}
+
+// streamClock derives time from the PCRs of the first PID carrying them.
+type streamClock struct {
+	pid     uint16
+	has     bool
+	lastPCR mpegts.PCR
+	elapsed time.Duration
+}
+
+// push advances the clock on the PCR carried by the packet.
+func (sc *streamClock) push(ep *mpegts.EncodedPacket) {
+	if !hasPCR(ep) {
+		return
+	}
+	pcr := ep.GetPCR()
+	if !sc.has {
+		sc.pid, sc.lastPCR, sc.has = ep.GetPID(), pcr, true
+		return
+	}
+	if ep.GetPID() != sc.pid {
+		return
+	}
+	step := pcr.Since(sc.lastPCR)
+	if step >= 0 && step <= maxClockStep {
+		sc.elapsed += step // Backward steps and jumps hold the clock.
+	}
+	sc.lastPCR = pcr
+}
+
+// now returns the stream time, counted from the Unix epoch so that reports show elapsed time.
+func (sc *streamClock) now() time.Time {
+	return time.Unix(0, 0).Add(sc.elapsed)
+}
+
+// Report is a snapshot of the monitor's checks.
+type Report struct {
+	Name    string
+	Start   time.Time // Time of the first packet.
+	Time    time.Time // Time of the last packet.
+	Packets uint64
+	Checks  []CheckState
+	PIDs    []PIDReport
+	PCR     []mpegts.PCRStats
+}
+
+// PIDReport counts the packets and continuity errors of one PID.
+type PIDReport struct {
+	PID             uint16
+	Packets         uint64
+	CCErrors        uint64
+	TransportErrors uint64 // Packets with transport_error_indicator set.
+	Referenced      bool
+}
+
+// Report returns the current state of every check.
+func (m *Monitor) Report() Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := Report{
+		Name:    m.name,
+		Start:   m.start,
+		Time:    m.now,
+		Packets: m.packets,
+		Checks:  append([]CheckState(nil), m.checks[:]...),
+		PCR:     m.pcr.Results(),
+	}
+	for pid, count := range m.pids {
+		r.PIDs = append(r.PIDs, PIDReport{
+			PID:             pid,
+			Packets:         count,
+			CCErrors:        m.cc.PIDStats(pid).Errors(),
+			TransportErrors: m.tei[pid],
+			Referenced:      pid <= maxSIPID || m.referenced(pid),
+		})
+	}
+	sortPIDs(r.PIDs)
+	return r
+}
+
+// State returns the state of one check.
+func (m *Monitor) State(c Check) CheckState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checks[c]
+}
+
+// Active returns the checks whose alarm is raised.
+func (m *Monitor) Active() []Check {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var active []Check
+	for _, state := range m.checks {
+		if state.Active {
+			active = append(active, state.Check)
+		}
+	}
+	return active
+}
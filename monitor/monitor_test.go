@@ -0,0 +1,282 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// testStream produces a constant bitrate, single program stream, 25 frames per second, with a PAT
+// and PMT ahead of every frame, and pushes it into a monitor. Packets left out of the stream are
+// replaced by null packets to keep the bitrate constant.
+type testStream struct {
+	t        *testing.T
+	m        *Monitor
+	now      time.Time
+	frame    int
+	patCC    uint8
+	pmtCC    uint8
+	video    *mpegts.PESPacketizer
+	audio    *mpegts.PESPacketizer
+	noPAT    bool
+	noAudio  bool
+	file     bool                                // Push zero arrival times, as when reading a file.
+	packetFn func(ep *mpegts.EncodedPacket) bool // Returns false to replace the packet by a null packet.
+}
+
+func newTestStream(t *testing.T, opts Options) *testStream {
+	return &testStream{
+		t:     t,
+		m:     NewMonitor("test", opts),
+		now:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		video: mpegts.NewPESPacketizer(0x100),
+		audio: mpegts.NewPESPacketizer(0x101),
+	}
+}
+
+// run pushes n frames.
+func (ts *testStream) run(n int) {
+	for i := 0; i < n; i++ {
+		ts.step()
+	}
+}
+
+// step pushes the packets of one frame.
+func (ts *testStream) step() {
+	var packets mpegts.EncodedPackets
+	pat := mpegts.NewPAT(1, 0)
+	pat.Programs[1] = 0x1000
+	p, patCC := pat.Encode(ts.patCC)
+	if ts.noPAT {
+		p = nullPackets(len(p))
+	} else {
+		ts.patCC = patCC
+	}
+	packets = append(packets, p...)
+
+	pmt := &mpegts.PMT{ProgramNumber: 1, CurrentNext: true, PCRPID: 0x100, Streams: []mpegts.ElementaryStream{
+		{StreamType: mpegts.StreamTypeH264, ElementaryPID: 0x100},
+		{StreamType: mpegts.StreamTypeADTSAAC, ElementaryPID: 0x101},
+	}}
+	p, cc, err := pmt.Encode(0x1000, ts.pmtCC)
+	assert.NoError(ts.t, err)
+	ts.pmtCC = cc
+	packets = append(packets, p...)
+
+	pts := mpegts.PTS(ts.frame) * 3600
+	video := &mpegts.PESPacket{StreamID: mpegts.StreamIDVideoBase, HasPTS: true, PTS: pts, Payload: make([]byte, 1000)}
+	p, err = ts.video.Packetize(video, &mpegts.AdaptationField{HasPCR: true, PCR: pts.PCR()})
+	assert.NoError(ts.t, err)
+	packets = append(packets, p...)
+
+	if ts.noAudio {
+		packets = append(packets, nullPackets(2)...)
+	} else {
+		audio := &mpegts.PESPacket{StreamID: mpegts.StreamIDAudioBase, HasPTS: true, PTS: pts, Payload: make([]byte, 200)}
+		p, err = ts.audio.Packetize(audio, nil)
+		assert.NoError(ts.t, err)
+		packets = append(packets, p...)
+	}
+
+	at := ts.now
+	if ts.file {
+		at = time.Time{}
+	}
+	for _, ep := range packets {
+		if ts.packetFn != nil && !ts.packetFn(ep) {
+			ep = nullPackets(1)[0]
+		}
+		ts.m.Push(ep, at)
+	}
+	ts.frame++
+	ts.now = ts.now.Add(40 * time.Millisecond)
+}
+
+func nullPackets(n int) mpegts.EncodedPackets {
+	packets := make(mpegts.EncodedPackets, n)
+	for i := range packets {
+		packets[i] = &mpegts.EncodedPacket{0x47, 0x1F, 0xFF, 0x10}
+	}
+	return packets
+}
+
+func TestCleanStream(t *testing.T) {
+	ts := newTestStream(t, Options{})
+	ts.run(100)
+
+	r := ts.m.Report()
+	assert.Zero(t, r.Errors(0), "%s", r)
+	assert.Empty(t, ts.m.Active())
+	assert.Equal(t, 3960*time.Millisecond, r.Duration())
+	assert.Len(t, r.PCR, 1)
+	assert.Equal(t, 40*time.Millisecond, r.PCR[0].MaxInterval)
+	for _, p := range r.PIDs {
+		assert.True(t, p.Referenced, "PID 0x%04X", p.PID)
+	}
+}
+
+func TestPATErrorAlarm(t *testing.T) {
+	var alarms []Alarm
+	ts := newTestStream(t, Options{OnAlarm: func(a Alarm) { alarms = append(alarms, a) }})
+	ts.run(10)
+
+	ts.noPAT = true
+	ts.run(20)
+	state := ts.m.State(PATError)
+	assert.Equal(t, uint64(1), state.Count, "a missing PAT is reported once")
+	assert.True(t, state.Active)
+
+	ts.noPAT = false
+	ts.run(50)
+	state = ts.m.State(PATError)
+	assert.False(t, state.Active, "cleared after the hold time")
+	assert.Equal(t, uint64(1), state.Count)
+	assert.True(t, state.Cleared.After(state.Last))
+
+	assert.Len(t, alarms, 2)
+	assert.Equal(t, PATError, alarms[0].Check)
+	assert.True(t, alarms[0].Raised)
+	assert.False(t, alarms[1].Raised)
+}
+
+func TestContinuityAndTransportErrors(t *testing.T) {
+	ts := newTestStream(t, Options{})
+	dropped := false
+	ts.packetFn = func(ep *mpegts.EncodedPacket) bool {
+		if ts.frame == 20 && ep.GetPID() == 0x100 && !ep.GetPUSI() && !dropped {
+			dropped = true
+			return false
+		}
+		if ts.frame == 30 && ep.GetPID() == 0x101 {
+			ep.SetTEI()
+		}
+		return true
+	}
+	ts.run(40)
+
+	// Packets with transport_error_indicator set are not checked further, so the next audio packet
+	// also shows a continuity error.
+	assert.Equal(t, uint64(2), ts.m.State(ContinuityCountError).Count)
+	report := ts.m.Report()
+	total := uint64(0)
+	for _, p := range report.PIDs {
+		total += p.Packets
+		if p.PID == 0x100 || p.PID == 0x101 {
+			assert.Equal(t, uint64(1), p.CCErrors, "PID 0x%04X", p.PID)
+		}
+		if p.PID == 0x101 {
+			assert.Equal(t, uint64(2), p.TransportErrors, "corrupted packets count towards their PID")
+		} else {
+			assert.Zero(t, p.TransportErrors, "PID 0x%04X", p.PID)
+		}
+	}
+	assert.Equal(t, report.Packets, total)
+	assert.Contains(t, report.String(), "2 transport errors")
+	assert.Equal(t, uint64(2), ts.m.State(TransportError).Count, "both audio packets of the frame")
+	assert.Equal(t, TransportError.Priority(), 2)
+}
+
+func TestCRCError(t *testing.T) {
+	ts := newTestStream(t, Options{})
+	ts.packetFn = func(ep *mpegts.EncodedPacket) bool {
+		if ts.frame == 5 && ep.GetPID() == 0x1000 {
+			ep[20] ^= 0xFF
+		}
+		return true
+	}
+	ts.run(10)
+	assert.Equal(t, uint64(1), ts.m.State(CRCError).Count)
+}
+
+func TestPIDAndPTSErrors(t *testing.T) {
+	ts := newTestStream(t, Options{PIDTimeout: time.Second})
+	ts.run(10)
+	ts.noAudio = true
+	ts.run(50)
+
+	assert.Equal(t, uint64(1), ts.m.State(PTSError).Count)
+	assert.Equal(t, uint64(1), ts.m.State(PIDError).Count)
+	assert.Contains(t, ts.m.State(PIDError).Detail, "0x0101")
+	assert.ElementsMatch(t, []Check{PIDError, PTSError}, ts.m.Active())
+}
+
+func TestPCRRepetitionError(t *testing.T) {
+	ts := newTestStream(t, Options{})
+	ts.packetFn = func(ep *mpegts.EncodedPacket) bool {
+		// Drop the PCR of every other frame.
+		if ts.frame%2 == 1 && ep.GetPID() == 0x100 && ep.GetPUSI() {
+			ep.ClearPCR()
+		}
+		return true
+	}
+	ts.run(10)
+	assert.Equal(t, uint64(4), ts.m.State(PCRRepetitionError).Count)
+	assert.Contains(t, ts.m.State(PCRRepetitionError).Detail, "80ms")
+}
+
+func TestUnreferencedPID(t *testing.T) {
+	ts := newTestStream(t, Options{})
+	stray := ts.frame
+	ts.packetFn = func(ep *mpegts.EncodedPacket) bool {
+		if ep.GetPID() == 0x101 && ts.frame > stray {
+			ep.SetPID(0x200)
+		}
+		return true
+	}
+	ts.run(30)
+
+	assert.Equal(t, uint64(1), ts.m.State(UnreferencedPID).Count)
+	assert.Equal(t, "PID 0x0200", ts.m.State(UnreferencedPID).Detail)
+}
+
+func TestSyncLoss(t *testing.T) {
+	m := NewMonitor("bytes", Options{})
+	pat := mpegts.NewPAT(1, 0)
+	packets, _ := pat.Encode(0)
+	ep := packets[0]
+
+	var data []byte
+	for i := 0; i < 10; i++ {
+		data = append(data, ep[:]...)
+	}
+	data = append(data, make([]byte, 3*188)...) // Sync lost.
+	for i := 0; i < 10; i++ {
+		data = append(data, ep[:]...)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.PushBytes(data[:2000], start)
+	m.PushBytes(data[2000:], start.Add(time.Millisecond))
+
+	state := m.State(TSSyncLoss)
+	assert.Equal(t, uint64(1), state.Count)
+	assert.False(t, state.Active, "sync was acquired again")
+}
+
+func TestStreamClock(t *testing.T) {
+	ts := newTestStream(t, Options{})
+	ts.file = true
+	ts.run(25)
+
+	r := ts.m.Report()
+	assert.Equal(t, 960*time.Millisecond, r.Duration())
+	assert.Zero(t, r.Errors(0), "%s", r)
+}
+
+func TestGeneratedStream(t *testing.T) {
+	g, err := mpegts.NewStreamGenerator(mpegts.DefaultGeneratorConfig(2))
+	assert.NoError(t, err)
+	m := NewMonitor("generated", Options{})
+	for _, ep := range g.Generate(10000) {
+		m.Push(ep, time.Time{})
+	}
+
+	r := m.Report()
+	assert.Zero(t, r.Errors(0), "%s", r)
+	assert.Len(t, r.PCR, 2)
+	for _, p := range r.PIDs {
+		assert.True(t, p.Referenced || p.PID == 0x1FFF, "PID 0x%04X", p.PID)
+	}
+}
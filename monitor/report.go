@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sortPIDs orders PID reports by PID.
+func sortPIDs(pids []PIDReport) {
+	sort.Slice(pids, func(i, j int) bool { return pids[i].PID < pids[j].PID })
+}
+
+// Duration returns the stream time covered by the report.
+func (r Report) Duration() time.Duration {
+	return r.Time.Sub(r.Start)
+}
+
+// Errors returns the total error count of the checks of the given priority, or of every check when
+// priority is zero.
+func (r Report) Errors(priority int) uint64 {
+	var total uint64
+	for _, state := range r.Checks {
+		if priority == 0 || state.Check.Priority() == priority {
+			total += state.Count
+		}
+	}
+	return total
+}
+
+// String formats the report for the console. Times are shown relative to the first packet.
+func (r Report) String() string {
+	var b strings.Builder
+	at := func(t time.Time) string {
+		return "+" + t.Sub(r.Start).Round(time.Millisecond).String()
+	}
+
+	fmt.Fprintf(&b, "%s: %d packets in %s\n", r.Name, r.Packets, r.Duration().Round(time.Millisecond))
+	for priority := 1; priority <= 3; priority++ {
+		fmt.Fprintf(&b, "\nPriority %d\n", priority)
+		for _, state := range r.Checks {
+			if state.Check.Priority() != priority {
+				continue
+			}
+			status := "ok"
+			switch {
+			case state.Active:
+				status = "ALARM since " + at(state.Since)
+			case state.Count > 0:
+				status = "cleared " + at(state.Cleared)
+			}
+			fmt.Fprintf(&b, "  %-34s %8d  %s", state.Check, state.Count, status)
+			if state.Count > 0 {
+				fmt.Fprintf(&b, "  (last %s: %s)", at(state.Last), state.Detail)
+			}
+			b.WriteByte('\n')
+		}
+	}
+
+	if len(r.PCR) > 0 {
+		b.WriteString("\nPCR\n")
+		for _, p := range r.PCR {
+			fmt.Fprintf(&b, "  program %d PID 0x%04X: %d PCRs, interval %s (max %s), accuracy %s (max %s), %.3f Mbit/s",
+				p.Program, p.PID, p.Count, p.MeanInterval, p.MaxInterval, p.Accuracy, p.MaxAccuracy, p.Bitrate/1e6)
+			if p.Jitter != 0 || p.Drift != 0 {
+				fmt.Fprintf(&b, ", jitter %s, drift %.2f ppm", p.Jitter, p.Drift)
+			}
+			b.WriteByte('\n')
+		}
+	}
+
+	if len(r.PIDs) > 0 {
+		b.WriteString("\nPIDs\n")
+		for _, p := range r.PIDs {
+			note := ""
+			if p.TransportErrors > 0 {
+				note = fmt.Sprintf("  %d transport errors", p.TransportErrors)
+			}
+			if !p.Referenced && p.PID != 0x1FFF {
+				note += "  unreferenced"
+			}
+			fmt.Fprintf(&b, "  0x%04X %10d packets %6d CC errors%s\n", p.PID, p.Packets, p.CCErrors, note)
+		}
+	}
+	return b.String()
+}
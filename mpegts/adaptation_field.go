@@ -0,0 +1,326 @@
+package mpegts
+
+// Adaptation field flag bits, in the byte following adaptation_field_length.
+const (
+	afDiscontinuity  = 0x80
+	afRandomAccess   = 0x40
+	afESPriority     = 0x20
+	afPCR            = 0x10
+	afOPCR           = 0x08
+	afSplicingPoint  = 0x04
+	afPrivateData    = 0x02
+	afExtension      = 0x01
+	afExtLTW         = 0x80
+	afExtPiecewise   = 0x40
+	afExtSeamless    = 0x20
+	afExtReserved    = 0x1F
+	clockRefLength   = 6
+	maxAdaptationLen = packetLength - headerLength - 1 // Largest adaptation_field_length value.
+)
+
+// AdaptationField represents the adaptation field of an MPEG-TS packet.
+// Optional fields are only present in the packet when the corresponding Has flag (or non-nil value) is set.
+// PCR and OPCR values are expressed in the 27 MHz clock (base*300+extension).
+type AdaptationField struct {
+	Discontinuity      bool
+	RandomAccess       bool
+	ESPriority         bool
+	HasPCR             bool
+	PCR                PCR
+	HasOPCR            bool
+	OPCR               PCR
+	HasSpliceCountdown bool
+	SpliceCountdown    int8
+	PrivateData        []byte // transport_private_data; nil when absent.
+	Extension          *AdaptationFieldExtension
+}
+
+// AdaptationFieldExtension represents the adaptation_field_extension of an adaptation field.
+type AdaptationFieldExtension struct {
+	HasLTW            bool
+	LTWValid          bool
+	LTWOffset         uint16 // 15 bits.
+	HasPiecewiseRate  bool
+	PiecewiseRate     uint32 // 22 bits, in units of 50 bytes/second.
+	HasSeamlessSplice bool
+	SpliceType        uint8  // 4 bits.
+	DTSNextAU         uint64 // 33 bits, 90 kHz.
+	Reserved          []byte // Remaining extension bytes, kept verbatim.
+}
+
+// ParseAdaptationField decodes the adaptation field of the packet.
+// It returns nil without error when the packet carries no adaptation field.
+func ParseAdaptationField(ep *EncodedPacket) (*AdaptationField, error) {
+	afc := ep.GetAFC()
+	if afc != 0x02 && afc != 0x03 {
+		return nil, nil
+	}
+
+	length := int(ep[4])
+	if length > maxAdaptationLen || (afc == 0x03 && length == maxAdaptationLen) {
+		return nil, ErrInvalidAdaptationsField
+	}
+
+	af := &AdaptationField{}
+	if length == 0 {
+		return af, nil // A single stuffing byte.
+	}
+
+	data := ep[5 : 5+length]
+	flags := data[0]
+	data = data[1:]
+
+	af.Discontinuity = flags&afDiscontinuity != 0
+	af.RandomAccess = flags&afRandomAccess != 0
+	af.ESPriority = flags&afESPriority != 0
+
+	if flags&afPCR != 0 {
+		if len(data) < clockRefLength {
+			return nil, ErrInvalidAdaptationsField
+		}
+		af.HasPCR, af.PCR = true, decodeClockReference(data)
+		data = data[clockRefLength:]
+	}
+
+	if flags&afOPCR != 0 {
+		if len(data) < clockRefLength {
+			return nil, ErrInvalidAdaptationsField
+		}
+		af.HasOPCR, af.OPCR = true, decodeClockReference(data)
+		data = data[clockRefLength:]
+	}
+
+	if flags&afSplicingPoint != 0 {
+		if len(data) < 1 {
+			return nil, ErrInvalidAdaptationsField
+		}
+		af.HasSpliceCountdown, af.SpliceCountdown = true, int8(data[0])
+		data = data[1:]
+	}
+
+	if flags&afPrivateData != 0 {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, ErrInvalidAdaptationsField
+		}
+		af.PrivateData = append([]byte{}, data[1:1+int(data[0])]...)
+		data = data[1+int(data[0]):]
+	}
+
+	if flags&afExtension != 0 {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, ErrInvalidAdaptationsField
+		}
+		ext, err := parseAdaptationFieldExtension(data[1 : 1+int(data[0])])
+		if err != nil {
+			return nil, err
+		}
+		af.Extension = ext
+	}
+
+	// Whatever remains is stuffing.
+	return af, nil
+}
+
+// parseAdaptationFieldExtension decodes the adaptation field extension following its length byte.
+func parseAdaptationFieldExtension(data []byte) (*AdaptationFieldExtension, error) {
+	if len(data) < 1 {
+		return nil, ErrInvalidAdaptationsField
+	}
+
+	ext := &AdaptationFieldExtension{}
+	flags := data[0]
+	data = data[1:]
+
+	if flags&afExtLTW != 0 {
+		if len(data) < 2 {
+			return nil, ErrInvalidAdaptationsField
+		}
+		ext.HasLTW = true
+		ext.LTWValid = data[0]&0x80 != 0
+		ext.LTWOffset = uint16(data[0]&0x7F)<<8 | uint16(data[1])
+		data = data[2:]
+	}
+
+	if flags&afExtPiecewise != 0 {
+		if len(data) < 3 {
+			return nil, ErrInvalidAdaptationsField
+		}
+		ext.HasPiecewiseRate = true
+		ext.PiecewiseRate = uint32(data[0]&0x3F)<<16 | uint32(data[1])<<8 | uint32(data[2])
+		data = data[3:]
+	}
+
+	if flags&afExtSeamless != 0 {
+		if len(data) < timestampLength {
+			return nil, ErrInvalidAdaptationsField
+		}
+		ext.HasSeamlessSplice = true
+		ext.SpliceType = data[0] >> 4
+		ext.DTSNextAU = decodeTimestamp(data)
+		data = data[timestampLength:]
+	}
+
+	if len(data) > 0 {
+		ext.Reserved = append([]byte{}, data...)
+	}
+	return ext, nil
+}
+
+// marshal serializes the extension, without its length byte.
+func (ext *AdaptationFieldExtension) marshal() []byte {
+	data := []byte{afExtReserved}
+	if ext.HasLTW {
+		data[0] |= afExtLTW
+		hi := byte(ext.LTWOffset>>8) & 0x7F
+		if ext.LTWValid {
+			hi |= 0x80
+		}
+		data = append(data, hi, byte(ext.LTWOffset))
+	}
+	if ext.HasPiecewiseRate {
+		data[0] |= afExtPiecewise
+		data = append(data, 0xC0|byte(ext.PiecewiseRate>>16)&0x3F, byte(ext.PiecewiseRate>>8), byte(ext.PiecewiseRate))
+	}
+	if ext.HasSeamlessSplice {
+		data[0] |= afExtSeamless
+		data = append(data, encodeTimestamp(ext.SpliceType&0x0F, ext.DTSNextAU)...)
+	}
+	return append(data, ext.Reserved...)
+}
+
+// Len returns the number of bytes the adaptation field occupies, including adaptation_field_length, without stuffing.
+func (af *AdaptationField) Len() int {
+	return len(af.Marshal())
+}
+
+// Marshal serializes the adaptation field, including adaptation_field_length, without stuffing.
+func (af *AdaptationField) Marshal() []byte {
+	flags := byte(0)
+	var fields []byte
+
+	if af.Discontinuity {
+		flags |= afDiscontinuity
+	}
+	if af.RandomAccess {
+		flags |= afRandomAccess
+	}
+	if af.ESPriority {
+		flags |= afESPriority
+	}
+	if af.HasPCR {
+		flags |= afPCR
+		fields = append(fields, encodeClockReference(af.PCR)...)
+	}
+	if af.HasOPCR {
+		flags |= afOPCR
+		fields = append(fields, encodeClockReference(af.OPCR)...)
+	}
+	if af.HasSpliceCountdown {
+		flags |= afSplicingPoint
+		fields = append(fields, byte(af.SpliceCountdown))
+	}
+	if af.PrivateData != nil {
+		flags |= afPrivateData
+		fields = append(fields, byte(len(af.PrivateData)))
+		fields = append(fields, af.PrivateData...)
+	}
+	if af.Extension != nil {
+		flags |= afExtension
+		ext := af.Extension.marshal()
+		fields = append(fields, byte(len(ext)))
+		fields = append(fields, ext...)
+	}
+
+	if flags == 0 && len(fields) == 0 {
+		return []byte{0x00}
+	}
+	data := append([]byte{byte(1 + len(fields)), flags}, fields...)
+	return data
+}
+
+// FillPacket writes the adaptation field af and as much of payload as fits into the packet, returning the
+// number of payload bytes written. The adaptation field is padded with stuffing so that it and the payload
+// fill the packet exactly, and the adaptation_field_control bits are set accordingly. A nil af is only
+// written when stuffing is required. The header bytes other than adaptation_field_control are left untouched.
+func FillPacket(ep *EncodedPacket, af *AdaptationField, payload []byte) (int, error) {
+	room := packetLength - headerLength
+
+	if af == nil && len(payload) >= room {
+		ep[3] = ep[3]&0xCF | 0x10 // Payload only.
+		return copy(ep[headerLength:], payload), nil
+	}
+	if af == nil {
+		af = &AdaptationField{}
+	}
+
+	field := af.Marshal()
+	if len(field) > room {
+		return 0, ErrInvalidAdaptationsField
+	}
+
+	n := len(payload)
+	if n > room-len(field) {
+		n = room - len(field)
+	}
+	afLength := room - n // Including adaptation_field_length.
+
+	copy(ep[headerLength:], field)
+	ep[4] = byte(afLength - 1)
+	for i := headerLength + len(field); i < headerLength+afLength; i++ {
+		ep[i] = 0xFF
+	}
+	if afLength > 1 && len(field) == 1 {
+		ep[5] = 0x00 // The flags byte is mandatory once the field is longer than its length byte.
+	}
+
+	if n > 0 {
+		ep[3] = ep[3]&0xCF | 0x30 // Adaptation field and payload.
+	} else {
+		ep[3] = ep[3]&0xCF | 0x20 // Adaptation field only.
+	}
+	copy(ep[headerLength+afLength:], payload[:n])
+	return n, nil
+}
+
+// updateAdaptationField applies fn to the packet's adaptation field, creating one if absent, and writes it
+// back ahead of the existing payload. The stuffing of the field makes room for it to grow; when the grown
+// field and the payload do not fit in the packet, ErrAdaptationFieldTooLong is returned and the packet is
+// left unchanged.
+func (ep *EncodedPacket) updateAdaptationField(fn func(af *AdaptationField)) error {
+	af, err := ParseAdaptationField(ep)
+	if err != nil || af == nil {
+		af = &AdaptationField{}
+	}
+
+	var payload []byte
+	if offset := payloadOffset(ep); offset >= 0 && offset < packetLength {
+		payload = append([]byte{}, ep[offset:]...)
+	}
+
+	fn(af)
+	if len(af.Marshal())+len(payload) > packetLength-headerLength {
+		return ErrAdaptationFieldTooLong
+	}
+	_, err = FillPacket(ep, af, payload)
+	return err
+}
+
+// decodeClockReference decodes a 6 byte PCR or OPCR field into a 27 MHz value.
+func decodeClockReference(b []byte) PCR {
+	base := uint64(b[0])<<25 | uint64(b[1])<<17 | uint64(b[2])<<9 | uint64(b[3])<<1 | uint64(b[4]>>7)
+	ext := uint16(b[4]&0x01)<<8 | uint16(b[5])
+	return NewPCRFromParts(base, ext)
+}
+
+// encodeClockReference encodes a 27 MHz value into a 6 byte PCR or OPCR field.
+func encodeClockReference(v PCR) []byte {
+	base, ext := uint64(v.Base()), v.Ext()
+	return []byte{
+		byte(base >> 25),
+		byte(base >> 17),
+		byte(base >> 9),
+		byte(base >> 1),
+		byte(base<<7)&0x80 | 0x7E | byte(ext>>8)&0x01,
+		byte(ext),
+	}
+}
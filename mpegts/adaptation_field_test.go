@@ -0,0 +1,138 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptationFieldRoundTrip(t *testing.T) {
+	af := &AdaptationField{
+		Discontinuity:      true,
+		RandomAccess:       true,
+		ESPriority:         true,
+		HasPCR:             true,
+		PCR:                0x1FFFFFFFF*300 + 299,
+		HasOPCR:            true,
+		OPCR:               27000000,
+		HasSpliceCountdown: true,
+		SpliceCountdown:    -3,
+		PrivateData:        []byte{0xDE, 0xAD, 0xBE, 0xEF},
+		Extension: &AdaptationFieldExtension{
+			HasLTW:            true,
+			LTWValid:          true,
+			LTWOffset:         0x1234,
+			HasPiecewiseRate:  true,
+			PiecewiseRate:     0x2ABCDE,
+			HasSeamlessSplice: true,
+			SpliceType:        0x0B,
+			DTSNextAU:         0x123456789,
+		},
+	}
+
+	ep := &EncodedPacket{0x47}
+	payload := make([]byte, 200)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	n, err := FillPacket(ep, af, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, packetLength-headerLength-af.Len(), n)
+	assert.Equal(t, uint8(0x03), ep.GetAFC())
+
+	parsed, err := ParseAdaptationField(ep)
+	assert.NoError(t, err)
+	assert.Equal(t, af, parsed)
+	assert.Equal(t, payload[:n], ep[payloadOffset(ep):])
+}
+
+func TestFillPacketStuffing(t *testing.T) {
+	for _, size := range []int{0, 1, 100, 182, 183, 184, 500} {
+		ep := &EncodedPacket{0x47}
+		payload := make([]byte, size)
+		for i := range payload {
+			payload[i] = 0xAA
+		}
+
+		n, err := FillPacket(ep, nil, payload)
+		assert.NoError(t, err)
+
+		expected := size
+		if expected > packetLength-headerLength {
+			expected = packetLength - headerLength
+		}
+		assert.Equal(t, expected, n, "size %d", size)
+
+		switch {
+		case size == 0:
+			assert.Equal(t, uint8(0x02), ep.GetAFC())
+			assert.Equal(t, byte(maxAdaptationLen), ep[4])
+		case size >= packetLength-headerLength:
+			assert.Equal(t, uint8(0x01), ep.GetAFC())
+		default:
+			assert.Equal(t, uint8(0x03), ep.GetAFC())
+			assert.Equal(t, packetLength-n, payloadOffset(ep), "size %d", size)
+			if size == 183 {
+				assert.Equal(t, byte(0), ep[4], "a single stuffing byte is an empty adaptation field")
+			} else {
+				assert.Equal(t, byte(0x00), ep[5], "flags should be clear")
+				if size < 182 {
+					assert.Equal(t, byte(0xFF), ep[6], "remaining bytes should be stuffing")
+				}
+			}
+		}
+
+		af, err := ParseAdaptationField(ep)
+		assert.NoError(t, err)
+		if af != nil {
+			assert.Equal(t, &AdaptationField{}, af)
+		}
+	}
+
+	oversized := &AdaptationField{PrivateData: make([]byte, 200)}
+	_, err := FillPacket(&EncodedPacket{0x47}, oversized, nil)
+	assert.ErrorIs(t, err, ErrInvalidAdaptationsField)
+}
+
+func TestAdaptationFieldFlagsHonoured(t *testing.T) {
+	// A packet carrying only a PCR: OPCR, splice countdown and private data must not be read from fixed offsets.
+	ep := &EncodedPacket{0x47}
+	_, err := FillPacket(ep, &AdaptationField{HasPCR: true, PCR: 123456789}, make([]byte, 100))
+	assert.NoError(t, err)
+	for i := 12; i < 30; i++ {
+		ep[i] = 0x5A // Stuffing that the fixed offset accessors used to misread.
+	}
+
+	assert.Equal(t, PCR(123456789), ep.GetPCR())
+	assert.Equal(t, PCR(0), ep.GetOPCR())
+	assert.Equal(t, int8(0), ep.GetSpliceCountdown())
+	assert.Nil(t, ep.GetTransportPrivateData())
+	assert.Nil(t, ep.GetAdaptationFieldExtension())
+
+	// Setting a field keeps the others and the payload position consistent.
+	assert.NoError(t, ep.SetSpliceCountdown(5))
+	assert.Equal(t, PCR(123456789), ep.GetPCR())
+	assert.Equal(t, int8(5), ep.GetSpliceCountdown())
+
+	ep.ClearPCR()
+	assert.Equal(t, PCR(0), ep.GetPCR())
+	assert.Equal(t, int8(5), ep.GetSpliceCountdown())
+	assert.Equal(t, packetLength-100, payloadOffset(ep))
+
+	// A field that would displace payload is refused, leaving the packet as it was.
+	full := &EncodedPacket{0x47}
+	_, err = FillPacket(full, &AdaptationField{RandomAccess: true}, make([]byte, 178))
+	assert.NoError(t, err)
+	before := *full
+	assert.ErrorIs(t, full.SetPCR(1), ErrAdaptationFieldTooLong)
+	assert.ErrorIs(t, full.SetTransportPrivateData(make([]byte, 4)), ErrAdaptationFieldTooLong)
+	assert.Equal(t, before, *full)
+	assert.NoError(t, full.SetSpliceCountdown(1)) // Fits in the stuffing.
+	assert.Equal(t, int8(1), full.GetSpliceCountdown())
+	assert.Equal(t, packetLength-178, payloadOffset(full))
+
+	ep[4] = 200
+	_, err = ParseAdaptationField(ep)
+	assert.ErrorIs(t, err, ErrInvalidAdaptationsField)
+}
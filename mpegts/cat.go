@@ -0,0 +1,231 @@
+package mpegts
+
+import "sort"
+
+const (
+	CATPID     = 0x0001 // PID carrying the Conditional Access Table.
+	CATTableID = 0x01   // table_id of CA_section.
+)
+
+// CAT represents a Conditional Access Table. Its CA descriptors name the conditional access systems of
+// the transport stream and the PIDs carrying their EMMs.
+type CAT struct {
+	Version     uint8
+	CurrentNext bool
+	Descriptors []Descriptor
+}
+
+// ParseCAT builds a CAT from one or more reassembled sections.
+// Sections of a multi-section CAT are merged; all must share the same version.
+func ParseCAT(sections ...*Section) (*CAT, error) {
+	var cat *CAT
+	for _, s := range sections {
+		if s.TableID != CATTableID || !s.SectionSyntaxIndicator {
+			continue
+		}
+
+		if cat == nil {
+			cat = &CAT{Version: s.Version, CurrentNext: s.CurrentNext}
+		} else if s.Version != cat.Version {
+			return nil, ErrInvalidSection
+		}
+
+		descriptors, err := ParseDescriptors(s.Body())
+		if err != nil {
+			return nil, err
+		}
+		cat.Descriptors = append(cat.Descriptors, descriptors...)
+	}
+
+	if cat == nil {
+		return nil, ErrTableNotFound
+	}
+	return cat, nil
+}
+
+// CADescriptors returns the CA descriptors of the CAT.
+func (c *CAT) CADescriptors() []*CADescriptor {
+	return CADescriptors(c.Descriptors)
+}
+
+// EMMPIDs returns the EMM PIDs listed by the CAT in ascending order.
+func (c *CAT) EMMPIDs() []uint16 {
+	return caPIDs(c.Descriptors)
+}
+
+// RemapPIDs rewrites the EMM PIDs of the CA descriptors using the given lookup table.
+// PIDs missing from the table are left unchanged.
+func (c *CAT) RemapPIDs(lut map[uint16]uint16) {
+	remapCADescriptors(c.Descriptors, lut)
+}
+
+// Sections encodes the CAT, splitting the descriptor loop across sections as needed.
+// It returns ErrInvalidDescriptor if a descriptor is too long to encode.
+func (c *CAT) Sections() ([]*Section, error) {
+	entries := make([][]byte, len(c.Descriptors))
+	for i, d := range c.Descriptors {
+		entry, err := EncodeDescriptors([]Descriptor{d})
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+	}
+
+	room := maxPSISectionLength - (longSectionHeaderLen - sectionHeaderLength) - crcLength
+	groups, _ := packEntries(entries, room)
+	sections := make([]*Section, len(groups))
+	for i, group := range groups {
+		s := &Section{
+			PID:                    CATPID,
+			TableID:                CATTableID,
+			SectionSyntaxIndicator: true,
+			TableIDExtension:       0xFFFF, // reserved.
+			Version:                c.Version,
+			CurrentNext:            c.CurrentNext,
+			SectionNumber:          uint8(i),
+			LastSectionNumber:      uint8(len(groups) - 1),
+		}
+		s.Marshal(group)
+		sections[i] = s
+	}
+	return sections, nil
+}
+
+// Encode packetizes the CAT onto PID 1 starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (c *CAT) Encode(cc uint8) (EncodedPackets, uint8, error) {
+	sections, err := c.Sections()
+	if err != nil {
+		return nil, cc, err
+	}
+	packets, next := PacketizeSections(CATPID, cc, sectionData(sections)...)
+	return packets, next, nil
+}
+
+// CADescriptors returns the CA descriptors found in a descriptor loop. Malformed CA descriptors are
+// skipped.
+func CADescriptors(descriptors []Descriptor) []*CADescriptor {
+	var cas []*CADescriptor
+	for _, d := range descriptors {
+		if d.Tag != CADescriptorTag {
+			continue
+		}
+		if typed, err := d.Decode(); err == nil {
+			cas = append(cas, typed.(*CADescriptor))
+		}
+	}
+	return cas
+}
+
+// caPIDs returns the distinct CA PIDs of a descriptor loop in ascending order.
+func caPIDs(descriptors ...[]Descriptor) []uint16 {
+	seen := make(map[uint16]bool)
+	var pids []uint16
+	for _, loop := range descriptors {
+		for _, ca := range CADescriptors(loop) {
+			if !seen[ca.CAPID] {
+				seen[ca.CAPID] = true
+				pids = append(pids, ca.CAPID)
+			}
+		}
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids
+}
+
+// remapCADescriptors rewrites the CA PIDs of the CA descriptors of a loop in place.
+func remapCADescriptors(descriptors []Descriptor, lut map[uint16]uint16) {
+	for i, d := range descriptors {
+		if d.Tag != CADescriptorTag {
+			continue
+		}
+		typed, err := d.Decode()
+		if err != nil {
+			continue
+		}
+		ca := typed.(*CADescriptor)
+		if pid, ok := lut[ca.CAPID]; ok {
+			ca.CAPID = pid
+			descriptors[i] = ca.Descriptor()
+		}
+	}
+}
+
+// CAMap collects the conditional access PIDs of a transport stream: the EMM PIDs listed by the CAT and
+// the ECM PIDs listed by the PMT of each program. Remultiplexers use it to keep CA PIDs that PAT and
+// PMT alone do not reveal.
+type CAMap struct {
+	emm []uint16
+	ecm map[uint16][]uint16 // program_number -> ECM PIDs.
+}
+
+// NewCAMap creates an empty CA map.
+func NewCAMap() *CAMap {
+	return &CAMap{ecm: make(map[uint16][]uint16)}
+}
+
+// UpdateCAT replaces the EMM PIDs with those of the CAT.
+func (cm *CAMap) UpdateCAT(cat *CAT) {
+	cm.emm = cat.EMMPIDs()
+}
+
+// UpdatePMT replaces the ECM PIDs of the program with those of its PMT.
+func (cm *CAMap) UpdatePMT(pmt *PMT) {
+	if pids := pmt.ECMPIDs(); len(pids) > 0 {
+		cm.ecm[pmt.ProgramNumber] = pids
+	} else {
+		delete(cm.ecm, pmt.ProgramNumber)
+	}
+}
+
+// RemoveProgram forgets the ECM PIDs of a program dropped from the PAT.
+func (cm *CAMap) RemoveProgram(program uint16) {
+	delete(cm.ecm, program)
+}
+
+// EMMPIDs returns the EMM PIDs in ascending order.
+func (cm *CAMap) EMMPIDs() []uint16 {
+	return append([]uint16(nil), cm.emm...)
+}
+
+// ECMPIDs returns the ECM PIDs of a program in ascending order.
+func (cm *CAMap) ECMPIDs(program uint16) []uint16 {
+	return append([]uint16(nil), cm.ecm[program]...)
+}
+
+// PIDs returns every EMM and ECM PID in ascending order.
+func (cm *CAMap) PIDs() []uint16 {
+	seen := make(map[uint16]bool)
+	pids := []uint16{}
+	add := func(list []uint16) {
+		for _, pid := range list {
+			if !seen[pid] {
+				seen[pid] = true
+				pids = append(pids, pid)
+			}
+		}
+	}
+	add(cm.emm)
+	for _, list := range cm.ecm {
+		add(list)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids
+}
+
+// Contains reports whether pid carries EMMs or ECMs.
+func (cm *CAMap) Contains(pid uint16) bool {
+	for _, p := range cm.emm {
+		if p == pid {
+			return true
+		}
+	}
+	for _, list := range cm.ecm {
+		for _, p := range list {
+			if p == pid {
+				return true
+			}
+		}
+	}
+	return false
+}
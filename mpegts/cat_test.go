@@ -0,0 +1,108 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scrambledPMT returns a PMT with an ECM PID for the whole program and another for its audio.
+func scrambledPMT() *PMT {
+	return &PMT{
+		ProgramNumber: 1,
+		CurrentNext:   true,
+		PCRPID:        0x100,
+		ProgramInfo:   Descriptors(&CADescriptor{CASystemID: 0x0B00, CAPID: 0x600}),
+		Streams: []ElementaryStream{
+			{StreamType: StreamTypeH264, ElementaryPID: 0x100},
+			{StreamType: StreamTypeADTSAAC, ElementaryPID: 0x101, Descriptors: Descriptors(
+				&ISO639LanguageDescriptor{Languages: []ISO639Language{{Code: "eng"}}},
+				&CADescriptor{CASystemID: 0x0B00, CAPID: 0x601, PrivateData: []byte{0x01}},
+			)},
+		},
+	}
+}
+
+func TestCATRoundTrip(t *testing.T) {
+	cat := &CAT{Version: 3, CurrentNext: true, Descriptors: Descriptors(
+		&CADescriptor{CASystemID: 0x0B00, CAPID: 0x500},
+		&CADescriptor{CASystemID: 0x1800, CAPID: 0x400, PrivateData: []byte{0xAA, 0xBB}},
+		&RegistrationDescriptor{FormatIdentifier: "TRBD"},
+	)}
+
+	packets, cc, err := cat.Encode(0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(1), cc)
+	assert.Equal(t, uint16(CATPID), packets[0].GetPID())
+
+	sections, err := NewSectionAssembler().Push(packets[0])
+	assert.NoError(t, err)
+	parsed, err := ParseCAT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, cat, parsed)
+	assert.Equal(t, []uint16{0x400, 0x500}, parsed.EMMPIDs())
+	assert.Len(t, parsed.CADescriptors(), 2)
+
+	_, err = ParseCAT()
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestCATSplitsSections(t *testing.T) {
+	cat := &CAT{CurrentNext: true}
+	for i := 0; i < 200; i++ {
+		cat.Descriptors = append(cat.Descriptors, (&CADescriptor{CASystemID: uint16(i), CAPID: 0x400 + uint16(i)}).Descriptor())
+	}
+
+	sections, err := cat.Sections()
+	assert.NoError(t, err)
+	assert.Greater(t, len(sections), 1)
+	parsed, err := ParseCAT(sections...)
+	assert.NoError(t, err)
+	assert.Len(t, parsed.EMMPIDs(), 200)
+}
+
+func TestCATRemapPIDs(t *testing.T) {
+	cat := &CAT{CurrentNext: true, Descriptors: Descriptors(
+		&CADescriptor{CASystemID: 0x0B00, CAPID: 0x500, PrivateData: []byte{0x42}},
+		&CADescriptor{CASystemID: 0x1800, CAPID: 0x400},
+	)}
+	cat.RemapPIDs(map[uint16]uint16{0x500: 0x1500})
+	assert.Equal(t, []uint16{0x400, 0x1500}, cat.EMMPIDs())
+	assert.Equal(t, []byte{0x42}, cat.CADescriptors()[0].PrivateData, "private data is kept")
+}
+
+func TestPMTECMPIDs(t *testing.T) {
+	pmt := scrambledPMT()
+	assert.Equal(t, []uint16{0x600, 0x601}, pmt.ECMPIDs())
+
+	pmt.RemapPIDs(map[uint16]uint16{0x100: 0x200, 0x101: 0x201, 0x601: 0x701})
+	assert.Equal(t, []uint16{0x600, 0x701}, pmt.ECMPIDs())
+	assert.Equal(t, []uint16{0x200, 0x201}, pmt.PIDs())
+
+	// The remapped PMT survives a round trip.
+	section, err := pmt.Section()
+	assert.NoError(t, err)
+	parsed, err := ParsePMT(section)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{0x600, 0x701}, parsed.ECMPIDs())
+}
+
+func TestCAMap(t *testing.T) {
+	cm := NewCAMap()
+	assert.Empty(t, cm.PIDs())
+
+	cm.UpdateCAT(&CAT{Descriptors: Descriptors(&CADescriptor{CASystemID: 0x0B00, CAPID: 0x500})})
+	cm.UpdatePMT(scrambledPMT())
+	other := &PMT{ProgramNumber: 2, Streams: []ElementaryStream{{StreamType: StreamTypeH264, ElementaryPID: 0x110}}}
+	cm.UpdatePMT(other)
+
+	assert.Equal(t, []uint16{0x500}, cm.EMMPIDs())
+	assert.Equal(t, []uint16{0x600, 0x601}, cm.ECMPIDs(1))
+	assert.Empty(t, cm.ECMPIDs(2))
+	assert.Equal(t, []uint16{0x500, 0x600, 0x601}, cm.PIDs())
+	assert.True(t, cm.Contains(0x601))
+	assert.False(t, cm.Contains(0x100))
+
+	cm.RemoveProgram(1)
+	assert.Equal(t, []uint16{0x500}, cm.PIDs())
+}
@@ -0,0 +1,212 @@
+package mpegts
+
+import "bytes"
+
+// ContinuityEvent classifies the continuity_counter of a packet against the previous packet on its PID.
+type ContinuityEvent int
+
+const (
+	ContinuityOK            ContinuityEvent = iota // The counter follows the previous packet.
+	ContinuityFirst                                // First packet seen on the PID.
+	ContinuityDuplicate                            // The packet repeats the previous packet's counter; it may be dropped.
+	ContinuityGap                                  // Packets were lost or reordered.
+	ContinuityDiscontinuity                        // The counter jumped at a signalled discontinuity_indicator.
+)
+
+// String returns the name of the event.
+func (e ContinuityEvent) String() string {
+	switch e {
+	case ContinuityFirst:
+		return "first"
+	case ContinuityDuplicate:
+		return "duplicate"
+	case ContinuityGap:
+		return "gap"
+	case ContinuityDiscontinuity:
+		return "discontinuity"
+	}
+	return "ok"
+}
+
+// ContinuityStats counts the continuity events seen by a tracker.
+type ContinuityStats struct {
+	Packets         uint64
+	Gaps            uint64
+	Duplicates      uint64
+	Discontinuities uint64
+}
+
+// Errors returns the number of continuity errors. Gaps include repeated duplicates; signalled
+// discontinuities and single duplicates are allowed by ISO/IEC 13818-1 and are not errors.
+func (s ContinuityStats) Errors() uint64 {
+	return s.Gaps
+}
+
+// ccState is the continuity state of one PID.
+type ccState struct {
+	cc         uint8
+	duplicates int // Consecutive duplicates of the last packet.
+	stats      ContinuityStats
+}
+
+// ContinuityTracker follows the continuity_counter of every PID of one input and classifies each packet.
+// Use one tracker per input so that errors are counted per input.
+type ContinuityTracker struct {
+	pids  map[uint16]*ccState
+	stats ContinuityStats
+}
+
+// NewContinuityTracker creates an empty tracker.
+func NewContinuityTracker() *ContinuityTracker {
+	return &ContinuityTracker{pids: make(map[uint16]*ccState)}
+}
+
+// Check classifies the packet's continuity_counter and updates the tracker. Null packets are not tracked
+// and always report ContinuityOK.
+func (ct *ContinuityTracker) Check(ep *EncodedPacket) ContinuityEvent {
+	if ep.IsNullPacket() {
+		return ContinuityOK
+	}
+	pid := ep.GetPID()
+
+	cc := ep.GetCC()
+	state, ok := ct.pids[pid]
+	if !ok {
+		state = &ccState{cc: cc}
+		ct.pids[pid] = state
+		ct.count(state, ContinuityFirst)
+		return ContinuityFirst
+	}
+
+	event := ContinuityOK
+	hasPayload := ep.GetAFC()&0x01 != 0
+	switch {
+	case hasDiscontinuityIndicator(ep):
+		// Any value is allowed at a signalled discontinuity.
+		if !hasPayload && cc != state.cc || hasPayload && cc != (state.cc+1)&0x0F {
+			event = ContinuityDiscontinuity
+		}
+		state.duplicates = 0
+	case !hasPayload:
+		// Packets without payload do not increment the counter.
+		if cc != state.cc {
+			event = ContinuityGap
+		}
+	case cc == (state.cc+1)&0x0F:
+		state.duplicates = 0
+	case cc == state.cc:
+		// A packet may be sent twice; more repetitions are an error.
+		state.duplicates++
+		event = ContinuityDuplicate
+		if state.duplicates > 1 {
+			event = ContinuityGap
+		}
+	default:
+		state.duplicates = 0
+		event = ContinuityGap
+	}
+
+	state.cc = cc
+	ct.count(state, event)
+	return event
+}
+
+// count adds the event to the PID and tracker counters.
+func (ct *ContinuityTracker) count(state *ccState, event ContinuityEvent) {
+	for _, s := range []*ContinuityStats{&state.stats, &ct.stats} {
+		s.Packets++
+		switch event {
+		case ContinuityGap:
+			s.Gaps++
+		case ContinuityDuplicate:
+			s.Duplicates++
+		case ContinuityDiscontinuity:
+			s.Discontinuities++
+		}
+	}
+}
+
+// Stats returns the counters for all PIDs of the input.
+func (ct *ContinuityTracker) Stats() ContinuityStats {
+	return ct.stats
+}
+
+// PIDStats returns the counters for one PID.
+func (ct *ContinuityTracker) PIDStats(pid uint16) ContinuityStats {
+	if state, ok := ct.pids[pid]; ok {
+		return state.stats
+	}
+	return ContinuityStats{}
+}
+
+// Reset forgets the state of a PID, so that its next packet is reported as ContinuityFirst.
+func (ct *ContinuityTracker) Reset(pid uint16) {
+	delete(ct.pids, pid)
+}
+
+// hasDiscontinuityIndicator reports whether the packet's adaptation field sets the discontinuity_indicator.
+func hasDiscontinuityIndicator(ep *EncodedPacket) bool {
+	afc := ep.GetAFC()
+	return (afc == 0x02 || afc == 0x03) && ep[4] > 0 && ep[5]&afDiscontinuity != 0
+}
+
+// ContinuityStamper rewrites the continuity_counter of output packets so that every output PID is
+// continuous, whatever the counters of the inputs they were taken from.
+type ContinuityStamper struct {
+	next map[uint16]uint8
+	last map[uint16]*EncodedPacket // Last packet with payload of each PID, as received.
+}
+
+// NewContinuityStamper creates a stamper with every PID starting at zero.
+func NewContinuityStamper() *ContinuityStamper {
+	return &ContinuityStamper{next: make(map[uint16]uint8), last: make(map[uint16]*EncodedPacket)}
+}
+
+// Stamp sets the continuity_counter of the packet from the state of its PID. Packets without payload
+// repeat the previous counter, as required by ISO/IEC 13818-1, and so does a single duplicate of the
+// previous packet of the PID: the same counter and payload, as ISO/IEC 13818-1 allows a packet to be
+// sent twice. Null packets are left untouched.
+func (cs *ContinuityStamper) Stamp(ep *EncodedPacket) {
+	if ep.IsNullPacket() {
+		return
+	}
+	pid := ep.GetPID()
+	next := cs.next[pid]
+	if ep.GetAFC()&0x01 == 0 {
+		ep.SetCC((next - 1) & 0x0F)
+		return
+	}
+	if last := cs.last[pid]; last != nil && isDuplicate(last, ep) {
+		delete(cs.last, pid) // A further repetition is not a duplicate.
+		ep.SetCC((next - 1) & 0x0F)
+		return
+	}
+
+	received := *ep
+	cs.last[pid] = &received
+	ep.SetCC(next)
+	cs.next[pid] = (next + 1) & 0x0F
+}
+
+// isDuplicate reports whether ep repeats prev: the same header, counter included, and the same payload.
+// Only the adaptation field may differ, as a duplicate carries its own PCR.
+func isDuplicate(prev, ep *EncodedPacket) bool {
+	if prev[1] != ep[1] || prev[2] != ep[2] || prev[3] != ep[3] {
+		return false
+	}
+	a, b := payloadOffset(prev), payloadOffset(ep)
+	return a >= 0 && b >= 0 && bytes.Equal(prev[a:], ep[b:])
+}
+
+// StampAll stamps every packet in order.
+func (cs *ContinuityStamper) StampAll(packets EncodedPackets) {
+	for _, ep := range packets {
+		cs.Stamp(ep)
+	}
+}
+
+// SetNext sets the counter the next packet with payload on pid will carry.
+func (cs *ContinuityStamper) SetNext(pid uint16, cc uint8) {
+	cs.next[pid] = cc & 0x0F
+	delete(cs.last, pid)
+}
@@ -0,0 +1,142 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ccPacket builds a packet on pid with the given adaptation_field_control and continuity counter.
+func ccPacket(pid uint16, afc, cc uint8) *EncodedPacket {
+	ep := &EncodedPacket{0x47}
+	ep.SetPID(pid)
+	ep[3] = afc<<4 | cc&0x0F
+	if afc&0x02 != 0 {
+		ep[4] = 1
+	}
+	return ep
+}
+
+func TestContinuityTracker(t *testing.T) {
+	ct := NewContinuityTracker()
+
+	events := []struct {
+		ep   *EncodedPacket
+		want ContinuityEvent
+	}{
+		{ccPacket(0x100, 0x01, 3), ContinuityFirst},
+		{ccPacket(0x100, 0x01, 4), ContinuityOK},
+		{ccPacket(0x100, 0x02, 4), ContinuityOK}, // Adaptation field only: no increment.
+		{ccPacket(0x100, 0x01, 4), ContinuityDuplicate},
+		{ccPacket(0x100, 0x01, 4), ContinuityGap}, // Second duplicate.
+		{ccPacket(0x100, 0x01, 5), ContinuityOK},
+		{ccPacket(0x100, 0x01, 8), ContinuityGap},
+		{ccPacket(0x100, 0x01, 9), ContinuityOK},
+		{ccPacket(0x100, 0x01, 15), ContinuityGap},
+		{ccPacket(0x100, 0x01, 0), ContinuityOK}, // Wraps.
+		{ccPacket(0x1FFF, 0x01, 7), ContinuityOK},
+		{ccPacket(0x200, 0x01, 0), ContinuityFirst},
+	}
+	for i, e := range events {
+		assert.Equal(t, e.want, ct.Check(e.ep), "packet %d", i)
+	}
+
+	stats := ct.PIDStats(0x100)
+	assert.Equal(t, uint64(10), stats.Packets)
+	assert.Equal(t, uint64(3), stats.Gaps)
+	assert.Equal(t, uint64(1), stats.Duplicates)
+	assert.Equal(t, uint64(3), stats.Errors())
+	assert.Equal(t, uint64(11), ct.Stats().Packets, "null packets are not counted")
+	assert.Equal(t, ContinuityStats{}, ct.PIDStats(0x300))
+
+	ct.Reset(0x100)
+	assert.Equal(t, ContinuityFirst, ct.Check(ccPacket(0x100, 0x01, 12)))
+}
+
+func TestContinuityTrackerDiscontinuity(t *testing.T) {
+	ct := NewContinuityTracker()
+	ct.Check(ccPacket(0x100, 0x01, 3))
+
+	ep := ccPacket(0x100, 0x03, 9)
+	ep[5] = afDiscontinuity
+	assert.Equal(t, ContinuityDiscontinuity, ct.Check(ep))
+	assert.Equal(t, ContinuityOK, ct.Check(ccPacket(0x100, 0x01, 10)))
+
+	// A discontinuity_indicator on a continuous packet is not reported.
+	ep = ccPacket(0x100, 0x03, 11)
+	ep[5] = afDiscontinuity
+	assert.Equal(t, ContinuityOK, ct.Check(ep))
+
+	stats := ct.Stats()
+	assert.Equal(t, uint64(1), stats.Discontinuities)
+	assert.Equal(t, uint64(0), stats.Errors())
+}
+
+func TestContinuityStamper(t *testing.T) {
+	cs := NewContinuityStamper()
+	cs.SetNext(0x200, 14)
+
+	// Packets from two inputs with unrelated counters muxed onto the same output PIDs.
+	other := ccPacket(0x200, 0x01, 5)
+	other[4] = 0xAB // Same counter as the previous packet of the PID, other payload.
+	packets := EncodedPackets{
+		ccPacket(0x100, 0x01, 7),
+		ccPacket(0x100, 0x01, 2),
+		ccPacket(0x100, 0x02, 9),
+		ccPacket(0x200, 0x01, 5),
+		ccPacket(0x100, 0x03, 0),
+		other,
+		ccPacket(0x200, 0x01, 1),
+		ccPacket(0x1FFF, 0x01, 6),
+	}
+	cs.StampAll(packets)
+
+	var got []uint8
+	for _, ep := range packets {
+		got = append(got, ep.GetCC())
+	}
+	assert.Equal(t, []uint8{0, 1, 1, 14, 2, 15, 0, 6}, got)
+
+	ct := NewContinuityTracker()
+	for _, ep := range packets {
+		ct.Check(ep)
+	}
+	assert.Equal(t, uint64(0), ct.Stats().Errors())
+	assert.Equal(t, uint64(0), ct.Stats().Duplicates)
+}
+
+func TestContinuityStamperDuplicate(t *testing.T) {
+	cs := NewContinuityStamper()
+	cs.SetNext(0x100, 4)
+
+	// A packet sent twice keeps its counter once; a third copy is new data as far as the output goes.
+	packet := ccPacket(0x100, 0x01, 9)
+	packet[10] = 0x55
+	withPCR := &EncodedPacket{0x47}
+	withPCR.SetPID(0x100)
+	withPCR[3] = 0x09
+	_, err := FillPacket(withPCR, &AdaptationField{HasPCR: true, PCR: 1}, make([]byte, 176))
+	assert.NoError(t, err)
+	duplicatePCR := *withPCR
+	duplicatePCR[6] ^= 0x01 // A duplicate may carry another PCR.
+
+	packets := EncodedPackets{}
+	for _, ep := range []*EncodedPacket{packet, packet, packet, withPCR, &duplicatePCR} {
+		copied := *ep
+		packets = append(packets, &copied)
+	}
+	cs.StampAll(packets)
+
+	var got []uint8
+	for _, ep := range packets {
+		got = append(got, ep.GetCC())
+	}
+	assert.Equal(t, []uint8{4, 4, 5, 6, 6}, got)
+
+	ct := NewContinuityTracker()
+	for _, ep := range packets {
+		ct.Check(ep)
+	}
+	assert.Equal(t, uint64(0), ct.Stats().Errors())
+	assert.Equal(t, uint64(2), ct.Stats().Duplicates)
+}
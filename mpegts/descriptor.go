@@ -0,0 +1,715 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"sync"
+	"unicode/utf8"
+)
+
+// Descriptor tags with typed implementations or consulted elsewhere in the package.
+// Tags 0x00-0x3F are defined by ISO/IEC 13818-1, 0x40-0x7F by ETSI EN 300 468 and 0x80-0xFE are user private.
+const (
+	RegistrationDescriptorTag        = 0x05
+	DataStreamAlignmentDescriptorTag = 0x06
+	CADescriptorTag                  = 0x09
+	ISO639LanguageDescriptorTag      = 0x0A
+	MetadataPointerDescriptorTag     = 0x25
+	MetadataDescriptorTag            = 0x26
+	NetworkNameDescriptorTag         = 0x40
+	ServiceDescriptorTag             = 0x48
+	StreamIdentifierDescriptorTag    = 0x52
+	TeletextDescriptorTag            = 0x56
+	LocalTimeOffsetDescriptorTag     = 0x58
+	SubtitlingDescriptorTag          = 0x59
+	AC3DescriptorTag                 = 0x6A
+	EAC3DescriptorTag                = 0x7A
+	DTSDescriptorTag                 = 0x7B
+	AACDescriptorTag                 = 0x7C
+	CueIdentifierDescriptorTag       = 0x8A // SCTE-35 cue_identifier_descriptor.
+)
+
+// Descriptor represents a single entry of a PSI/SI descriptor loop.
+// The payload is kept as raw bytes so descriptors survive a parse and encode round trip untouched.
+type Descriptor struct {
+	Tag  uint8
+	Data []byte
+}
+
+// ParseDescriptors splits a descriptor loop into its descriptors.
+func ParseDescriptors(data []byte) ([]Descriptor, error) {
+	var descriptors []Descriptor
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, ErrInvalidSection
+		}
+		length := int(data[1])
+		if len(data) < 2+length {
+			return nil, ErrInvalidSection
+		}
+		payload := make([]byte, length)
+		copy(payload, data[2:2+length])
+		descriptors = append(descriptors, Descriptor{Tag: data[0], Data: payload})
+		data = data[2+length:]
+	}
+	return descriptors, nil
+}
+
+// EncodeDescriptors serializes a descriptor loop. It returns ErrInvalidDescriptor if a descriptor carries
+// more than the 255 bytes its length field can signal.
+func EncodeDescriptors(descriptors []Descriptor) ([]byte, error) {
+	var data []byte
+	for _, d := range descriptors {
+		if len(d.Data) > 0xFF {
+			return nil, ErrInvalidDescriptor
+		}
+		data = append(data, d.Tag, byte(len(d.Data)))
+		data = append(data, d.Data...)
+	}
+	return data, nil
+}
+
+// FindDescriptor returns the first descriptor with the given tag.
+func FindDescriptor(descriptors []Descriptor, tag uint8) (Descriptor, bool) {
+	for _, d := range descriptors {
+		if d.Tag == tag {
+			return d, true
+		}
+	}
+	return Descriptor{}, false
+}
+
+// TypedDescriptor is a decoded descriptor. Descriptor encodes it back into its raw form.
+type TypedDescriptor interface {
+	Descriptor() Descriptor
+}
+
+// DescriptorDecoder decodes the raw form of a descriptor.
+type DescriptorDecoder func(d Descriptor) (TypedDescriptor, error)
+
+// descriptorMu guards descriptorDecoders, which RegisterDescriptor may change while descriptors are
+// decoded.
+var descriptorMu sync.RWMutex
+
+// descriptorDecoders maps descriptor tags to their decoders.
+var descriptorDecoders = map[uint8]DescriptorDecoder{
+	RegistrationDescriptorTag:        decodeRegistrationDescriptor,
+	DataStreamAlignmentDescriptorTag: decodeDataStreamAlignmentDescriptor,
+	CADescriptorTag:                  decodeCADescriptor,
+	ISO639LanguageDescriptorTag:      decodeISO639LanguageDescriptor,
+	MetadataPointerDescriptorTag:     decodeMetadataPointerDescriptor,
+	MetadataDescriptorTag:            decodeMetadataDescriptor,
+	NetworkNameDescriptorTag:         decodeNetworkNameDescriptor,
+	ServiceDescriptorTag:             func(d Descriptor) (TypedDescriptor, error) { return ParseServiceDescriptor(d) },
+	LocalTimeOffsetDescriptorTag:     decodeLocalTimeOffsetDescriptor,
+	StreamIdentifierDescriptorTag:    decodeStreamIdentifierDescriptor,
+	AC3DescriptorTag:                 decodeAC3Descriptor,
+	EAC3DescriptorTag:                decodeEAC3Descriptor,
+	CueIdentifierDescriptorTag:       decodeCueIdentifierDescriptor,
+}
+
+// RegisterDescriptor installs the decoder used for tag, replacing any existing one. It is meant to be
+// called from init functions, for example to decode the user private tags of a particular platform.
+func RegisterDescriptor(tag uint8, decoder DescriptorDecoder) {
+	descriptorMu.Lock()
+	defer descriptorMu.Unlock()
+	descriptorDecoders[tag] = decoder
+}
+
+// Decode returns the typed form of the descriptor. Descriptors with no registered decoder are returned as
+// an OpaqueDescriptor. It returns ErrInvalidDescriptor if the payload does not match its tag.
+func (d Descriptor) Decode() (TypedDescriptor, error) {
+	descriptorMu.RLock()
+	decoder, ok := descriptorDecoders[d.Tag]
+	descriptorMu.RUnlock()
+	if !ok {
+		return OpaqueDescriptor(d), nil
+	}
+	return decoder(d)
+}
+
+// DecodeDescriptors returns the typed form of every descriptor of a loop.
+func DecodeDescriptors(descriptors []Descriptor) ([]TypedDescriptor, error) {
+	typed := make([]TypedDescriptor, len(descriptors))
+	for i, d := range descriptors {
+		td, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		typed[i] = td
+	}
+	return typed, nil
+}
+
+// Descriptors encodes typed descriptors into a descriptor loop.
+func Descriptors(typed ...TypedDescriptor) []Descriptor {
+	descriptors := make([]Descriptor, len(typed))
+	for i, td := range typed {
+		descriptors[i] = td.Descriptor()
+	}
+	return descriptors
+}
+
+// OpaqueDescriptor is a descriptor whose tag has no registered decoder. Its payload is kept verbatim.
+type OpaqueDescriptor Descriptor
+
+// Descriptor returns the raw form of the descriptor.
+func (d OpaqueDescriptor) Descriptor() Descriptor {
+	return Descriptor(d)
+}
+
+// RegistrationDescriptor identifies the format of private data (ISO/IEC 13818-1 registration_descriptor).
+type RegistrationDescriptor struct {
+	FormatIdentifier string // Four characters, such as "HEVC" or "CUEI".
+	AdditionalInfo   []byte
+}
+
+func decodeRegistrationDescriptor(d Descriptor) (TypedDescriptor, error) {
+	if len(d.Data) < 4 {
+		return nil, ErrInvalidDescriptor
+	}
+	rd := &RegistrationDescriptor{FormatIdentifier: string(d.Data[:4])}
+	if len(d.Data) > 4 {
+		rd.AdditionalInfo = append([]byte{}, d.Data[4:]...)
+	}
+	return rd, nil
+}
+
+// Descriptor encodes the registration descriptor.
+func (rd *RegistrationDescriptor) Descriptor() Descriptor {
+	data := []byte((rd.FormatIdentifier + "    ")[:4])
+	return Descriptor{Tag: RegistrationDescriptorTag, Data: append(data, rd.AdditionalInfo...)}
+}
+
+// DataStreamAlignmentDescriptor signals the alignment of PES payloads to access units.
+type DataStreamAlignmentDescriptor struct {
+	AlignmentType uint8
+}
+
+func decodeDataStreamAlignmentDescriptor(d Descriptor) (TypedDescriptor, error) {
+	if len(d.Data) < 1 {
+		return nil, ErrInvalidDescriptor
+	}
+	return &DataStreamAlignmentDescriptor{AlignmentType: d.Data[0]}, nil
+}
+
+// Descriptor encodes the data stream alignment descriptor.
+func (dd *DataStreamAlignmentDescriptor) Descriptor() Descriptor {
+	return Descriptor{Tag: DataStreamAlignmentDescriptorTag, Data: []byte{dd.AlignmentType}}
+}
+
+// CADescriptor identifies a conditional access system and the PID carrying its ECMs or EMMs.
+type CADescriptor struct {
+	CASystemID  uint16
+	CAPID       uint16
+	PrivateData []byte
+}
+
+func decodeCADescriptor(d Descriptor) (TypedDescriptor, error) {
+	if len(d.Data) < 4 {
+		return nil, ErrInvalidDescriptor
+	}
+	cd := &CADescriptor{
+		CASystemID: binary.BigEndian.Uint16(d.Data[0:2]),
+		CAPID:      binary.BigEndian.Uint16(d.Data[2:4]) & 0x1FFF,
+	}
+	if len(d.Data) > 4 {
+		cd.PrivateData = append([]byte{}, d.Data[4:]...)
+	}
+	return cd, nil
+}
+
+// Descriptor encodes the CA descriptor.
+func (cd *CADescriptor) Descriptor() Descriptor {
+	data := binary.BigEndian.AppendUint16(nil, cd.CASystemID)
+	data = binary.BigEndian.AppendUint16(data, 0xE000|cd.CAPID&0x1FFF)
+	return Descriptor{Tag: CADescriptorTag, Data: append(data, cd.PrivateData...)}
+}
+
+// ISO639Language is one entry of an ISO_639_language_descriptor.
+type ISO639Language struct {
+	Code      string // ISO 639-2 three letter code.
+	AudioType uint8  // 0 undefined, 1 clean effects, 2 hearing impaired, 3 visual impaired commentary.
+}
+
+// ISO639LanguageDescriptor lists the languages of an elementary stream.
+type ISO639LanguageDescriptor struct {
+	Languages []ISO639Language
+}
+
+func decodeISO639LanguageDescriptor(d Descriptor) (TypedDescriptor, error) {
+	if len(d.Data)%4 != 0 {
+		return nil, ErrInvalidDescriptor
+	}
+	ld := &ISO639LanguageDescriptor{}
+	for data := d.Data; len(data) > 0; data = data[4:] {
+		ld.Languages = append(ld.Languages, ISO639Language{Code: string(data[:3]), AudioType: data[3]})
+	}
+	return ld, nil
+}
+
+// Descriptor encodes the ISO_639_language_descriptor.
+func (ld *ISO639LanguageDescriptor) Descriptor() Descriptor {
+	data := make([]byte, 0, 4*len(ld.Languages))
+	for _, l := range ld.Languages {
+		data = append(data, (l.Code + "   ")[:3]...)
+		data = append(data, l.AudioType)
+	}
+	return Descriptor{Tag: ISO639LanguageDescriptorTag, Data: data}
+}
+
+// NetworkNameDescriptor carries the name of a delivery system in the NIT.
+type NetworkNameDescriptor struct {
+	Name string
+}
+
+func decodeNetworkNameDescriptor(d Descriptor) (TypedDescriptor, error) {
+	return &NetworkNameDescriptor{Name: decodeDVBString(d.Data)}, nil
+}
+
+// Descriptor encodes the network name descriptor.
+func (nd *NetworkNameDescriptor) Descriptor() Descriptor {
+	return Descriptor{Tag: NetworkNameDescriptorTag, Data: encodeDVBString(nd.Name)}
+}
+
+// ServiceDescriptor carries the service type, provider name and service name of a service.
+type ServiceDescriptor struct {
+	ServiceType  uint8
+	ProviderName string
+	ServiceName  string
+}
+
+// ParseServiceDescriptor decodes a service descriptor.
+func ParseServiceDescriptor(d Descriptor) (*ServiceDescriptor, error) {
+	if d.Tag != ServiceDescriptorTag || len(d.Data) < 2 {
+		return nil, ErrInvalidDescriptor
+	}
+	sd := &ServiceDescriptor{ServiceType: d.Data[0]}
+
+	data := d.Data[1:]
+	providerLength := int(data[0])
+	if len(data) < 1+providerLength+1 {
+		return nil, ErrInvalidDescriptor
+	}
+	sd.ProviderName = decodeDVBString(data[1 : 1+providerLength])
+
+	data = data[1+providerLength:]
+	nameLength := int(data[0])
+	if len(data) < 1+nameLength {
+		return nil, ErrInvalidDescriptor
+	}
+	sd.ServiceName = decodeDVBString(data[1 : 1+nameLength])
+
+	return sd, nil
+}
+
+// Encode encodes the service descriptor. It returns ErrInvalidDescriptor when the names, once encoded,
+// do not fit in the 255 bytes of the descriptor.
+func (sd *ServiceDescriptor) Encode() (Descriptor, error) {
+	provider, name := encodeDVBString(sd.ProviderName), encodeDVBString(sd.ServiceName)
+	if 3+len(provider)+len(name) > 0xFF {
+		return Descriptor{}, ErrInvalidDescriptor
+	}
+	data := []byte{sd.ServiceType, byte(len(provider))}
+	data = append(data, provider...)
+	data = append(data, byte(len(name)))
+	data = append(data, name...)
+	return Descriptor{Tag: ServiceDescriptorTag, Data: data}, nil
+}
+
+// Descriptor encodes the service descriptor. Names too long for the descriptor are shortened, the
+// longer first, until they fit; use Encode to have them refused instead.
+func (sd *ServiceDescriptor) Descriptor() Descriptor {
+	short := *sd
+	for {
+		d, err := short.Encode()
+		if err == nil {
+			return d
+		}
+		if len(short.ProviderName) > len(short.ServiceName) {
+			short.ProviderName = trimLastRune(short.ProviderName)
+		} else {
+			short.ServiceName = trimLastRune(short.ServiceName)
+		}
+	}
+}
+
+// trimLastRune removes the last character of s.
+func trimLastRune(s string) string {
+	_, size := utf8.DecodeLastRuneInString(s)
+	return s[:len(s)-size]
+}
+
+// StreamIdentifierDescriptor labels a component of a service so it can be referenced from other tables.
+type StreamIdentifierDescriptor struct {
+	ComponentTag uint8
+}
+
+func decodeStreamIdentifierDescriptor(d Descriptor) (TypedDescriptor, error) {
+	if len(d.Data) < 1 {
+		return nil, ErrInvalidDescriptor
+	}
+	return &StreamIdentifierDescriptor{ComponentTag: d.Data[0]}, nil
+}
+
+// Descriptor encodes the stream identifier descriptor.
+func (sd *StreamIdentifierDescriptor) Descriptor() Descriptor {
+	return Descriptor{Tag: StreamIdentifierDescriptorTag, Data: []byte{sd.ComponentTag}}
+}
+
+// AC3Descriptor describes an AC-3 stream carried as private PES (ETSI EN 300 468 Annex D).
+type AC3Descriptor struct {
+	HasComponentType bool
+	ComponentType    uint8
+	HasBSID          bool
+	BSID             uint8
+	HasMainID        bool
+	MainID           uint8
+	HasASVC          bool
+	ASVC             uint8
+	AdditionalInfo   []byte
+}
+
+func decodeAC3Descriptor(d Descriptor) (TypedDescriptor, error) {
+	ad := &AC3Descriptor{}
+	rest, err := decodeAudioFields(d.Data, ad.fields())
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		ad.AdditionalInfo = append([]byte{}, rest...)
+	}
+	return ad, nil
+}
+
+// Descriptor encodes the AC-3 descriptor.
+func (ad *AC3Descriptor) Descriptor() Descriptor {
+	data := encodeAudioFields(ad.fields())
+	data[0] |= 0x0F // Reserved.
+	return Descriptor{Tag: AC3DescriptorTag, Data: append(data, ad.AdditionalInfo...)}
+}
+
+// fields lists the optional fields of the descriptor in flag order.
+func (ad *AC3Descriptor) fields() []audioField {
+	return []audioField{
+		{&ad.HasComponentType, &ad.ComponentType},
+		{&ad.HasBSID, &ad.BSID},
+		{&ad.HasMainID, &ad.MainID},
+		{&ad.HasASVC, &ad.ASVC},
+	}
+}
+
+// EAC3Descriptor describes an Enhanced AC-3 stream carried as private PES (ETSI EN 300 468 Annex D).
+type EAC3Descriptor struct {
+	HasComponentType bool
+	ComponentType    uint8
+	HasBSID          bool
+	BSID             uint8
+	HasMainID        bool
+	MainID           uint8
+	HasASVC          bool
+	ASVC             uint8
+	MixInfoExists    bool
+	HasSubstream1    bool
+	Substream1       uint8
+	HasSubstream2    bool
+	Substream2       uint8
+	HasSubstream3    bool
+	Substream3       uint8
+	AdditionalInfo   []byte
+}
+
+func decodeEAC3Descriptor(d Descriptor) (TypedDescriptor, error) {
+	ad := &EAC3Descriptor{}
+	rest, err := decodeAudioFields(d.Data, ad.fields())
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		ad.AdditionalInfo = append([]byte{}, rest...)
+	}
+	return ad, nil
+}
+
+// Descriptor encodes the E-AC-3 descriptor.
+func (ad *EAC3Descriptor) Descriptor() Descriptor {
+	data := encodeAudioFields(ad.fields())
+	return Descriptor{Tag: EAC3DescriptorTag, Data: append(data, ad.AdditionalInfo...)}
+}
+
+// fields lists the optional fields of the descriptor in flag order. mixinfoexists is a flag without a field.
+func (ad *EAC3Descriptor) fields() []audioField {
+	return []audioField{
+		{&ad.HasComponentType, &ad.ComponentType},
+		{&ad.HasBSID, &ad.BSID},
+		{&ad.HasMainID, &ad.MainID},
+		{&ad.HasASVC, &ad.ASVC},
+		{&ad.MixInfoExists, nil},
+		{&ad.HasSubstream1, &ad.Substream1},
+		{&ad.HasSubstream2, &ad.Substream2},
+		{&ad.HasSubstream3, &ad.Substream3},
+	}
+}
+
+// audioField pairs a flag of an AC-3 or E-AC-3 descriptor with the optional byte it signals.
+type audioField struct {
+	has   *bool
+	value *uint8 // nil for flags without a field.
+}
+
+// decodeAudioFields decodes the flags byte and the optional fields it signals, returning the remaining
+// additional_info bytes.
+func decodeAudioFields(data []byte, fields []audioField) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, ErrInvalidDescriptor
+	}
+	flags := data[0]
+	data = data[1:]
+	for i, f := range fields {
+		if flags&(0x80>>i) == 0 {
+			continue
+		}
+		*f.has = true
+		if f.value == nil {
+			continue
+		}
+		if len(data) < 1 {
+			return nil, ErrInvalidDescriptor
+		}
+		*f.value = data[0]
+		data = data[1:]
+	}
+	return data, nil
+}
+
+// encodeAudioFields encodes the flags byte and the optional fields that are present.
+func encodeAudioFields(fields []audioField) []byte {
+	data := []byte{0}
+	for i, f := range fields {
+		if !*f.has {
+			continue
+		}
+		data[0] |= 0x80 >> i
+		if f.value != nil {
+			data = append(data, *f.value)
+		}
+	}
+	return data
+}
+
+// CueIdentifierDescriptor signals the type of splice commands carried on an SCTE-35 PID.
+type CueIdentifierDescriptor struct {
+	CueStreamType uint8 // 0x00 insert, null and schedule; 0x01 all commands; 0x02 segmentation; 0x03-0x04 tiered.
+}
+
+func decodeCueIdentifierDescriptor(d Descriptor) (TypedDescriptor, error) {
+	if len(d.Data) < 1 {
+		return nil, ErrInvalidDescriptor
+	}
+	return &CueIdentifierDescriptor{CueStreamType: d.Data[0]}, nil
+}
+
+// Descriptor encodes the cue identifier descriptor.
+func (cd *CueIdentifierDescriptor) Descriptor() Descriptor {
+	return Descriptor{Tag: CueIdentifierDescriptorTag, Data: []byte{cd.CueStreamType}}
+}
+
+// MetadataFormat identifies a metadata application and format, as carried by the metadata descriptors.
+type MetadataFormat struct {
+	ApplicationFormat           uint16 // metadata_application_format; 0xFFFF defers to the identifier.
+	ApplicationFormatIdentifier string // Four characters, present when ApplicationFormat is 0xFFFF.
+	Format                      uint8  // metadata_format; 0xFF defers to the identifier.
+	FormatIdentifier            string // Four characters, present when Format is 0xFF.
+	ServiceID                   uint8  // metadata_service_id.
+}
+
+// decodeMetadataFormat reads the leading fields shared by the metadata descriptors and returns the rest.
+func decodeMetadataFormat(data []byte) (MetadataFormat, []byte, error) {
+	var mf MetadataFormat
+	if len(data) < 2 {
+		return mf, nil, ErrInvalidDescriptor
+	}
+	mf.ApplicationFormat = binary.BigEndian.Uint16(data[0:2])
+	data = data[2:]
+	if mf.ApplicationFormat == 0xFFFF {
+		if len(data) < 4 {
+			return mf, nil, ErrInvalidDescriptor
+		}
+		mf.ApplicationFormatIdentifier = string(data[:4])
+		data = data[4:]
+	}
+	if len(data) < 1 {
+		return mf, nil, ErrInvalidDescriptor
+	}
+	mf.Format = data[0]
+	data = data[1:]
+	if mf.Format == 0xFF {
+		if len(data) < 4 {
+			return mf, nil, ErrInvalidDescriptor
+		}
+		mf.FormatIdentifier = string(data[:4])
+		data = data[4:]
+	}
+	if len(data) < 1 {
+		return mf, nil, ErrInvalidDescriptor
+	}
+	mf.ServiceID = data[0]
+	return mf, data[1:], nil
+}
+
+// encode serializes the metadata format fields.
+func (mf MetadataFormat) encode() []byte {
+	data := binary.BigEndian.AppendUint16(nil, mf.ApplicationFormat)
+	if mf.ApplicationFormat == 0xFFFF {
+		data = append(data, (mf.ApplicationFormatIdentifier + "    ")[:4]...)
+	}
+	data = append(data, mf.Format)
+	if mf.Format == 0xFF {
+		data = append(data, (mf.FormatIdentifier + "    ")[:4]...)
+	}
+	return append(data, mf.ServiceID)
+}
+
+// lengthPrefixed reads a field preceded by its one byte length.
+func lengthPrefixed(data []byte) ([]byte, []byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, nil, ErrInvalidDescriptor
+	}
+	return append([]byte{}, data[1:1+int(data[0])]...), data[1+int(data[0]):], nil
+}
+
+// MetadataPointerDescriptor points a program at the stream carrying its metadata service
+// (ISO/IEC 13818-1 metadata_pointer_descriptor).
+type MetadataPointerDescriptor struct {
+	MetadataFormat
+	LocatorRecord           []byte // metadata_locator_record; nil when absent.
+	CarriageFlags           uint8  // MPEG_carriage_flags: 0 this transport stream, 1 another, 2 a program stream, 3 elsewhere.
+	ProgramNumber           uint16 // Present when CarriageFlags is 0, 1 or 2.
+	TransportStreamLocation uint16 // Present when CarriageFlags is 1.
+	TransportStreamID       uint16 // Present when CarriageFlags is 1.
+	PrivateData             []byte
+}
+
+func decodeMetadataPointerDescriptor(d Descriptor) (TypedDescriptor, error) {
+	mf, data, err := decodeMetadataFormat(d.Data)
+	if err != nil || len(data) < 1 {
+		return nil, ErrInvalidDescriptor
+	}
+	md := &MetadataPointerDescriptor{MetadataFormat: mf, CarriageFlags: data[0] >> 5 & 0x03}
+	flags := data[0]
+	data = data[1:]
+	if flags&0x80 != 0 {
+		if md.LocatorRecord, data, err = lengthPrefixed(data); err != nil {
+			return nil, err
+		}
+	}
+	if md.CarriageFlags <= 2 {
+		if len(data) < 2 {
+			return nil, ErrInvalidDescriptor
+		}
+		md.ProgramNumber = binary.BigEndian.Uint16(data[0:2])
+		data = data[2:]
+	}
+	if md.CarriageFlags == 1 {
+		if len(data) < 4 {
+			return nil, ErrInvalidDescriptor
+		}
+		md.TransportStreamLocation = binary.BigEndian.Uint16(data[0:2])
+		md.TransportStreamID = binary.BigEndian.Uint16(data[2:4])
+		data = data[4:]
+	}
+	if len(data) > 0 {
+		md.PrivateData = append([]byte{}, data...)
+	}
+	return md, nil
+}
+
+// Descriptor encodes the metadata pointer descriptor.
+func (md *MetadataPointerDescriptor) Descriptor() Descriptor {
+	data := md.encode()
+	flags := 0x1F | (md.CarriageFlags&0x03)<<5 // Reserved bits.
+	if md.LocatorRecord != nil {
+		flags |= 0x80
+	}
+	data = append(data, flags)
+	if md.LocatorRecord != nil {
+		data = append(data, byte(len(md.LocatorRecord)))
+		data = append(data, md.LocatorRecord...)
+	}
+	if md.CarriageFlags <= 2 {
+		data = binary.BigEndian.AppendUint16(data, md.ProgramNumber)
+	}
+	if md.CarriageFlags == 1 {
+		data = binary.BigEndian.AppendUint16(data, md.TransportStreamLocation)
+		data = binary.BigEndian.AppendUint16(data, md.TransportStreamID)
+	}
+	return Descriptor{Tag: MetadataPointerDescriptorTag, Data: append(data, md.PrivateData...)}
+}
+
+// MetadataDescriptor describes the metadata service carried by an elementary stream
+// (ISO/IEC 13818-1 metadata_descriptor).
+type MetadataDescriptor struct {
+	MetadataFormat
+	DecoderConfigFlags    uint8  // decoder_config_flags (3 bits).
+	ServiceIdentification []byte // service_identification_record; nil unless the DSM-CC flag is set.
+	// DecoderConfig holds, by DecoderConfigFlags, the decoder_config (1), dec_config_identification_record
+	// (3), decoder_config_metadata_service_id (4, one byte) or reserved_data (5 and 6).
+	DecoderConfig []byte
+	PrivateData   []byte
+}
+
+func decodeMetadataDescriptor(d Descriptor) (TypedDescriptor, error) {
+	mf, data, err := decodeMetadataFormat(d.Data)
+	if err != nil || len(data) < 1 {
+		return nil, ErrInvalidDescriptor
+	}
+	md := &MetadataDescriptor{MetadataFormat: mf, DecoderConfigFlags: data[0] >> 5}
+	flags := data[0]
+	data = data[1:]
+	if flags&0x10 != 0 {
+		if md.ServiceIdentification, data, err = lengthPrefixed(data); err != nil {
+			return nil, err
+		}
+	}
+	switch md.DecoderConfigFlags {
+	case 1, 3, 5, 6:
+		if md.DecoderConfig, data, err = lengthPrefixed(data); err != nil {
+			return nil, err
+		}
+	case 4:
+		if len(data) < 1 {
+			return nil, ErrInvalidDescriptor
+		}
+		md.DecoderConfig = []byte{data[0]}
+		data = data[1:]
+	}
+	if len(data) > 0 {
+		md.PrivateData = append([]byte{}, data...)
+	}
+	return md, nil
+}
+
+// Descriptor encodes the metadata descriptor.
+func (md *MetadataDescriptor) Descriptor() Descriptor {
+	data := md.encode()
+	flags := 0x0F | md.DecoderConfigFlags<<5 // Reserved bits.
+	if md.ServiceIdentification != nil {
+		flags |= 0x10
+	}
+	data = append(data, flags)
+	if md.ServiceIdentification != nil {
+		data = append(data, byte(len(md.ServiceIdentification)))
+		data = append(data, md.ServiceIdentification...)
+	}
+	switch md.DecoderConfigFlags {
+	case 1, 3, 5, 6:
+		data = append(data, byte(len(md.DecoderConfig)))
+		data = append(data, md.DecoderConfig...)
+	case 4:
+		var serviceID byte
+		if len(md.DecoderConfig) > 0 {
+			serviceID = md.DecoderConfig[0]
+		}
+		data = append(data, serviceID)
+	}
+	return Descriptor{Tag: MetadataDescriptorTag, Data: append(data, md.PrivateData...)}
+}
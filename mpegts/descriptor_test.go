@@ -0,0 +1,162 @@
+package mpegts
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescriptorLoopRoundTrip(t *testing.T) {
+	descriptors := []Descriptor{
+		{Tag: 0x05, Data: []byte("HDMV")},
+		{Tag: 0x52, Data: []byte{0x01}},
+		{Tag: 0xE0, Data: []byte{}},
+	}
+
+	data, err := EncodeDescriptors(descriptors)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x05, 0x04, 'H', 'D', 'M', 'V', 0x52, 0x01, 0x01, 0xE0, 0x00}, data)
+
+	parsed, err := ParseDescriptors(data)
+	assert.NoError(t, err)
+	assert.Equal(t, descriptors, parsed)
+
+	d, ok := FindDescriptor(parsed, 0x52)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0x01}, d.Data)
+
+	_, ok = FindDescriptor(parsed, 0x0A)
+	assert.False(t, ok)
+
+	_, err = ParseDescriptors([]byte{0x05, 0x04, 'H'})
+	assert.ErrorIs(t, err, ErrInvalidSection)
+}
+
+func TestDescriptorLoopTooLong(t *testing.T) {
+	long := Descriptor{Tag: 0x05, Data: make([]byte, 300)}
+	_, err := EncodeDescriptors([]Descriptor{long})
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+
+	// The tables refuse to encode the loop rather than signal a wrapped length.
+	pmt := &PMT{ProgramNumber: 1, PCRPID: 0x100, ProgramInfo: []Descriptor{long}}
+	_, err = pmt.Section()
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = pmt.Encode(0x1000, 0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+
+	_, err = (&SDT{Services: []SDTService{{ServiceID: 1, Descriptors: []Descriptor{long}}}}).Sections()
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = (&NIT{NetworkDescriptors: []Descriptor{long}}).Encode(0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = (&CAT{Descriptors: []Descriptor{long}}).Encode(0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = (&TOT{Descriptors: []Descriptor{long}}).Encode(0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = (&EIT{Events: []EITEvent{{Descriptors: []Descriptor{long}}}}).Encode(0x1D00, 0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = (&VCT{Channels: []VirtualChannel{{Descriptors: []Descriptor{long}}}}).Encode(0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = (&STT{Descriptors: []Descriptor{long}}).Encode(0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+	_, _, err = (&MGT{Descriptors: []Descriptor{long}}).Encode(0)
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+}
+
+func TestTypedDescriptorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		typed TypedDescriptor
+		raw   Descriptor
+	}{
+		{"registration", &RegistrationDescriptor{FormatIdentifier: "HEVC"}, Descriptor{Tag: 0x05, Data: []byte("HEVC")}},
+		{"registration info", &RegistrationDescriptor{FormatIdentifier: "CUEI", AdditionalInfo: []byte{0x01}}, Descriptor{Tag: 0x05, Data: []byte{'C', 'U', 'E', 'I', 0x01}}},
+		{"data stream alignment", &DataStreamAlignmentDescriptor{AlignmentType: 1}, Descriptor{Tag: 0x06, Data: []byte{0x01}}},
+		{"CA", &CADescriptor{CASystemID: 0x0B00, CAPID: 0x1FF0, PrivateData: []byte{0xAA}}, Descriptor{Tag: 0x09, Data: []byte{0x0B, 0x00, 0xFF, 0xF0, 0xAA}}},
+		{"ISO 639", &ISO639LanguageDescriptor{Languages: []ISO639Language{{"eng", 0}, {"spa", 3}}}, Descriptor{Tag: 0x0A, Data: []byte{'e', 'n', 'g', 0, 's', 'p', 'a', 3}}},
+		{"network name", &NetworkNameDescriptor{Name: "tribd"}, Descriptor{Tag: 0x40, Data: []byte("tribd")}},
+		{"service", &ServiceDescriptor{ServiceType: 1, ProviderName: "P", ServiceName: "S"}, Descriptor{Tag: 0x48, Data: []byte{0x01, 0x01, 'P', 0x01, 'S'}}},
+		{"stream identifier", &StreamIdentifierDescriptor{ComponentTag: 0x21}, Descriptor{Tag: 0x52, Data: []byte{0x21}}},
+		{"AC-3 empty", &AC3Descriptor{}, Descriptor{Tag: 0x6A, Data: []byte{0x0F}}},
+		{"AC-3", &AC3Descriptor{HasComponentType: true, ComponentType: 0x42, HasASVC: true, ASVC: 7, AdditionalInfo: []byte{0xEE}}, Descriptor{Tag: 0x6A, Data: []byte{0x9F, 0x42, 0x07, 0xEE}}},
+		{"E-AC-3", &EAC3Descriptor{HasBSID: true, BSID: 16, MixInfoExists: true, HasSubstream3: true, Substream3: 2}, Descriptor{Tag: 0x7A, Data: []byte{0x49, 0x10, 0x02}}},
+		{"cue identifier", &CueIdentifierDescriptor{CueStreamType: 1}, Descriptor{Tag: 0x8A, Data: []byte{0x01}}},
+		{"ID3 metadata pointer", NewID3MetadataPointerDescriptor(1), Descriptor{Tag: 0x25, Data: []byte{0xFF, 0xFF, 'I', 'D', '3', ' ', 0xFF, 'I', 'D', '3', ' ', 0x00, 0x1F, 0x00, 0x01}}},
+		{"metadata pointer", &MetadataPointerDescriptor{MetadataFormat: MetadataFormat{ApplicationFormat: 0x0100, Format: 0x3F, ServiceID: 2}, LocatorRecord: []byte{0xAA}, CarriageFlags: 1, ProgramNumber: 3, TransportStreamLocation: 4, TransportStreamID: 5}, Descriptor{Tag: 0x25, Data: []byte{0x01, 0x00, 0x3F, 0x02, 0xBF, 0x01, 0xAA, 0x00, 0x03, 0x00, 0x04, 0x00, 0x05}}},
+		{"ID3 metadata", NewID3MetadataDescriptor(), Descriptor{Tag: 0x26, Data: []byte{0xFF, 0xFF, 'I', 'D', '3', ' ', 0xFF, 'I', 'D', '3', ' ', 0x00, 0x0F}}},
+		{"metadata", &MetadataDescriptor{MetadataFormat: MetadataFormat{ApplicationFormat: 0x0100, Format: 0x3F}, DecoderConfigFlags: 4, ServiceIdentification: []byte{0xBB}, DecoderConfig: []byte{0x07}, PrivateData: []byte{0xCC}}, Descriptor{Tag: 0x26, Data: []byte{0x01, 0x00, 0x3F, 0x00, 0x9F, 0x01, 0xBB, 0x07, 0xCC}}},
+		{"opaque", OpaqueDescriptor{Tag: 0xE0, Data: []byte{1, 2, 3}}, Descriptor{Tag: 0xE0, Data: []byte{1, 2, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.raw, tt.typed.Descriptor())
+
+			decoded, err := tt.raw.Decode()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.typed, decoded)
+		})
+	}
+}
+
+func TestDecodeDescriptors(t *testing.T) {
+	raw := []Descriptor{
+		{Tag: RegistrationDescriptorTag, Data: []byte("AC-3")},
+		{Tag: 0xF0, Data: []byte{0x01}},
+	}
+	typed, err := DecodeDescriptors(raw)
+	assert.NoError(t, err)
+	assert.IsType(t, &RegistrationDescriptor{}, typed[0])
+	assert.IsType(t, OpaqueDescriptor{}, typed[1])
+	assert.Equal(t, raw, Descriptors(typed...))
+
+	_, err = DecodeDescriptors([]Descriptor{{Tag: CADescriptorTag, Data: []byte{0x0B}}})
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+
+	_, err = Descriptor{Tag: ISO639LanguageDescriptorTag, Data: []byte("en")}.Decode()
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+}
+
+type testPrivateDescriptor struct {
+	Value uint8
+}
+
+func (d *testPrivateDescriptor) Descriptor() Descriptor {
+	return Descriptor{Tag: 0xF1, Data: []byte{d.Value}}
+}
+
+func TestRegisterDescriptor(t *testing.T) {
+	RegisterDescriptor(0xF1, func(d Descriptor) (TypedDescriptor, error) {
+		if len(d.Data) != 1 {
+			return nil, ErrInvalidDescriptor
+		}
+		return &testPrivateDescriptor{Value: d.Data[0]}, nil
+	})
+	defer func() {
+		descriptorMu.Lock()
+		delete(descriptorDecoders, 0xF1)
+		descriptorMu.Unlock()
+	}()
+
+	decoded, err := Descriptor{Tag: 0xF1, Data: []byte{0x2A}}.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, &testPrivateDescriptor{Value: 0x2A}, decoded)
+
+	// Decoders may be registered while other goroutines decode.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterDescriptor(0xF1, func(d Descriptor) (TypedDescriptor, error) {
+				return &testPrivateDescriptor{Value: d.Data[0]}, nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := Descriptor{Tag: 0xF1, Data: []byte{0x2A}}.Decode()
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,219 @@
+package mpegts
+
+import "encoding/binary"
+
+const (
+	eitEventLength  = 10 // event_id, start_time, ETM_location, length_in_seconds and title_length.
+	ettHeaderLength = 5  // protocol_version and ETM_id.
+)
+
+// EIT represents an ATSC Event Information Table for one virtual channel and three hour time slot.
+type EIT struct {
+	SourceID        uint16
+	Version         uint8
+	CurrentNext     bool
+	ProtocolVersion uint8
+	Events          []EITEvent
+}
+
+// EITEvent describes one entry of the ATSC EIT event loop.
+type EITEvent struct {
+	EventID     uint16 // 14 bits.
+	StartTime   uint32 // Seconds since the GPS epoch; see GPSToUTC.
+	ETMLocation uint8  // 2 bits.
+	Duration    uint32 // length_in_seconds, 20 bits.
+	Title       MultipleString
+	Descriptors []Descriptor
+}
+
+// ChannelETMID returns the ETM_id of the extended text describing a virtual channel.
+func ChannelETMID(sourceID uint16) uint32 {
+	return uint32(sourceID) << 16
+}
+
+// EventETMID returns the ETM_id of the extended text describing an event.
+func EventETMID(sourceID, eventID uint16) uint32 {
+	return uint32(sourceID)<<16 | uint32(eventID&0x3FFF)<<2 | 0x02
+}
+
+// ParseEIT builds an EIT from one or more reassembled sections of the same table instance.
+func ParseEIT(sections ...*Section) (*EIT, error) {
+	var eit *EIT
+	for _, s := range sections {
+		if s.TableID != EITTableID || !s.SectionSyntaxIndicator {
+			continue
+		}
+		body := s.Body()
+		if len(body) < 2 {
+			return nil, ErrInvalidSection
+		}
+
+		if eit == nil {
+			eit = &EIT{
+				SourceID:        s.TableIDExtension,
+				Version:         s.Version,
+				CurrentNext:     s.CurrentNext,
+				ProtocolVersion: body[0],
+			}
+		} else if s.TableIDExtension != eit.SourceID || s.Version != eit.Version {
+			return nil, ErrInvalidSection
+		}
+
+		count := int(body[1])
+		body = body[2:]
+		for i := 0; i < count; i++ {
+			if len(body) < eitEventLength {
+				return nil, ErrInvalidSection
+			}
+			ev := EITEvent{
+				EventID:     binary.BigEndian.Uint16(body[0:2]) & 0x3FFF,
+				StartTime:   binary.BigEndian.Uint32(body[2:6]),
+				ETMLocation: (body[6] >> 4) & 0x03,
+				Duration:    binary.BigEndian.Uint32(body[6:10]) >> 8 & 0x0FFFFF,
+			}
+			titleLength := int(body[9])
+			body = body[eitEventLength:]
+			if len(body) < titleLength+2 {
+				return nil, ErrInvalidSection
+			}
+			if titleLength > 0 {
+				title, _, err := parseMultipleString(body[:titleLength])
+				if err != nil {
+					return nil, err
+				}
+				ev.Title = title
+			}
+			body = body[titleLength:]
+
+			length := int(binary.BigEndian.Uint16(body[0:2]) & 0x0FFF)
+			if len(body) < 2+length {
+				return nil, ErrInvalidSection
+			}
+			descriptors, err := ParseDescriptors(body[2 : 2+length])
+			if err != nil {
+				return nil, err
+			}
+			ev.Descriptors = descriptors
+			eit.Events = append(eit.Events, ev)
+			body = body[2+length:]
+		}
+	}
+
+	if eit == nil {
+		return nil, ErrTableNotFound
+	}
+	return eit, nil
+}
+
+// marshal serializes the event loop entry.
+func (ev *EITEvent) marshal() ([]byte, error) {
+	var title []byte
+	if len(ev.Title) > 0 {
+		title = ev.Title.marshal()
+	}
+	descriptors, err := EncodeDescriptors(ev.Descriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, eitEventLength, eitEventLength+len(title)+2+len(descriptors))
+	binary.BigEndian.PutUint16(data[0:2], 0xC000|ev.EventID&0x3FFF)
+	binary.BigEndian.PutUint32(data[2:6], ev.StartTime)
+	binary.BigEndian.PutUint32(data[6:10], 0xC0000000|uint32(ev.ETMLocation&0x03)<<28|(ev.Duration&0x0FFFFF)<<8|uint32(len(title)&0xFF))
+	data = append(data, title...)
+	data = binary.BigEndian.AppendUint16(data, 0xF000|uint16(len(descriptors))&0x0FFF)
+	return append(data, descriptors...), nil
+}
+
+// Sections encodes the EIT, splitting the event loop across sections as needed.
+// Sections are built for the PSIP base PID; Encode places them on the PID listed in the MGT.
+// It returns ErrInvalidDescriptor if an event descriptor is too long to encode.
+func (eit *EIT) Sections() ([]*Section, error) {
+	entries := make([][]byte, len(eit.Events))
+	for i := range eit.Events {
+		entry, err := eit.Events[i].marshal()
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+	}
+
+	room := maxSectionLength - (longSectionHeaderLen - sectionHeaderLength) - crcLength - 2
+	groups, counts := packEntries(entries, room)
+	sections := make([]*Section, len(groups))
+	for i, group := range groups {
+		body := append([]byte{eit.ProtocolVersion, byte(counts[i])}, group...)
+
+		s := psipSection(PSIPBasePID, EITTableID, eit.SourceID, eit.Version)
+		s.CurrentNext = eit.CurrentNext
+		s.SectionNumber = uint8(i)
+		s.LastSectionNumber = uint8(len(groups) - 1)
+		s.Marshal(body)
+		sections[i] = s
+	}
+	return sections, nil
+}
+
+// Encode packetizes the EIT onto pid starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (eit *EIT) Encode(pid uint16, cc uint8) (EncodedPackets, uint8, error) {
+	sections, err := eit.Sections()
+	if err != nil {
+		return nil, cc, err
+	}
+	for _, s := range sections {
+		s.PID = pid
+	}
+	packets, next := PacketizeSections(pid, cc, sectionData(sections)...)
+	return packets, next, nil
+}
+
+// ETT represents an ATSC Extended Text Table carrying the description of a channel or event.
+type ETT struct {
+	TableIDExtension uint16
+	Version          uint8
+	ProtocolVersion  uint8
+	ETMID            uint32
+	Text             MultipleString
+}
+
+// ParseETT decodes an ETT from its reassembled section.
+func ParseETT(s *Section) (*ETT, error) {
+	if s.TableID != ETTTableID || !s.SectionSyntaxIndicator {
+		return nil, ErrTableNotFound
+	}
+	body := s.Body()
+	if len(body) < ettHeaderLength {
+		return nil, ErrInvalidSection
+	}
+	text, _, err := parseMultipleString(body[ettHeaderLength:])
+	if err != nil {
+		return nil, err
+	}
+	return &ETT{
+		TableIDExtension: s.TableIDExtension,
+		Version:          s.Version,
+		ProtocolVersion:  body[0],
+		ETMID:            binary.BigEndian.Uint32(body[1:5]),
+		Text:             text,
+	}, nil
+}
+
+// Section encodes the ETT for the PSIP base PID; Encode places it on the PID listed in the MGT.
+func (ett *ETT) Section() *Section {
+	body := []byte{ett.ProtocolVersion}
+	body = binary.BigEndian.AppendUint32(body, ett.ETMID)
+	body = append(body, ett.Text.marshal()...)
+
+	s := psipSection(PSIPBasePID, ETTTableID, ett.TableIDExtension, ett.Version)
+	s.Marshal(body)
+	return s
+}
+
+// Encode packetizes the ETT onto pid starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (ett *ETT) Encode(pid uint16, cc uint8) (EncodedPackets, uint8) {
+	s := ett.Section()
+	s.PID = pid
+	return PacketizeSections(pid, cc, s.Data)
+}
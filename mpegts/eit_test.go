@@ -0,0 +1,80 @@
+package mpegts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEITRoundTrip(t *testing.T) {
+	start := UTCToGPS(time.Date(2024, time.May, 1, 18, 0, 0, 0, time.UTC), 18)
+	eit := &EIT{
+		SourceID:    1,
+		Version:     5,
+		CurrentNext: true,
+		Events: []EITEvent{
+			{EventID: 0x3001, StartTime: start, ETMLocation: ETMInChannelTS, Duration: 1800, Title: NewMultipleString("eng", "Evening News")},
+			{EventID: 0x3002, StartTime: start + 1800, Duration: 3600, Title: NewMultipleString("spa", "Película"),
+				Descriptors: []Descriptor{{Tag: 0x87, Data: []byte{0xC1, 0x01}}}},
+			{EventID: 0x3003, StartTime: start + 5400, Duration: 0x0FFFFF},
+		},
+	}
+
+	packets, cc, err := eit.Encode(0x1D00, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x1D00), packets[0].GetPID())
+	assert.Equal(t, uint8(3), packets[0].GetCC())
+	assert.Equal(t, uint8(4), cc)
+
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+
+	parsed, err := ParseEIT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, eit, parsed)
+	assert.Equal(t, "Evening News", parsed.Events[0].Title.String())
+	assert.Equal(t, time.Date(2024, time.May, 1, 18, 30, 0, 0, time.UTC), GPSToUTC(parsed.Events[1].StartTime, 18))
+}
+
+func TestEITMultipleSections(t *testing.T) {
+	eit := &EIT{SourceID: 2, CurrentNext: true}
+	for i := 0; i < 150; i++ {
+		eit.Events = append(eit.Events, EITEvent{EventID: uint16(i), StartTime: uint32(i) * 60, Duration: 60, Title: NewMultipleString("eng", "A programme title")})
+	}
+
+	sections, err := eit.Sections()
+	assert.NoError(t, err)
+	assert.Greater(t, len(sections), 1)
+
+	packets, _, err := eit.Encode(0x1D01, 0)
+	assert.NoError(t, err)
+	parsed, err := ParseEIT(reassemble(t, packets)...)
+	assert.NoError(t, err)
+	assert.Equal(t, eit.Events, parsed.Events)
+
+	_, err = ParseEIT()
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestETTRoundTrip(t *testing.T) {
+	ett := &ETT{
+		TableIDExtension: 0x0101,
+		ETMID:            EventETMID(1, 0x3001),
+		Text:             NewMultipleString("eng", "Local and national headlines."),
+	}
+	assert.Equal(t, uint32(0x0001C006), ett.ETMID)
+	assert.Equal(t, uint32(0x00010000), ChannelETMID(1))
+
+	packets, _ := ett.Encode(0x1E00, 0)
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+
+	parsed, err := ParseETT(sections[0])
+	assert.NoError(t, err)
+	assert.Equal(t, ett, parsed)
+	assert.Equal(t, "Local and national headlines.", parsed.Text.String())
+
+	_, err = ParseETT(&Section{TableID: EITTableID, SectionSyntaxIndicator: true})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
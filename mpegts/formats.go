@@ -0,0 +1,258 @@
+package mpegts
+
+import "encoding/binary"
+
+// PacketFormat identifies the framing of MPEG-TS packets on the wire or on disk.
+type PacketFormat int
+
+const (
+	FormatTS   PacketFormat = iota // Plain 188-byte packets.
+	FormatM2TS                     // 192-byte BDAV packets: 4-byte TP_extra_header followed by the packet.
+	FormatRS                       // 204-byte packets: the packet followed by 16 bytes of Reed-Solomon parity.
+)
+
+const (
+	m2tsPacketLength = 192
+	m2tsHeaderLength = 4
+	rsPacketLength   = 204
+	rsParityLength   = rsPacketLength - packetLength
+
+	// ArrivalClockMask masks the 30-bit arrival_time_stamp of the M2TS TP_extra_header (27 MHz).
+	ArrivalClockMask = 1<<30 - 1
+)
+
+// Size returns the length in bytes of one packet in the format.
+func (f PacketFormat) Size() int {
+	switch f {
+	case FormatM2TS:
+		return m2tsPacketLength
+	case FormatRS:
+		return rsPacketLength
+	}
+	return packetLength
+}
+
+// syncOffset returns the offset of the sync byte within one packet of the format.
+func (f PacketFormat) syncOffset() int {
+	if f == FormatM2TS {
+		return m2tsHeaderLength
+	}
+	return 0
+}
+
+// String returns the name of the format.
+func (f PacketFormat) String() string {
+	switch f {
+	case FormatM2TS:
+		return "m2ts"
+	case FormatRS:
+		return "ts204"
+	}
+	return "ts"
+}
+
+// packetFormats lists the formats in the order they are tried when detecting the framing of a stream.
+var packetFormats = []PacketFormat{FormatTS, FormatM2TS, FormatRS}
+
+// DetectPacketFormat returns the framing of data and the offset of its first complete packet, requiring
+// lockCount consecutive sync bytes. It returns ErrInvalidSyncByte if no format matches.
+func DetectPacketFormat(data []byte, lockCount int) (PacketFormat, int, error) {
+	if lockCount < 1 {
+		lockCount = DefaultLockCount
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] != 0x47 {
+			continue
+		}
+		for _, format := range packetFormats {
+			start := i - format.syncOffset()
+			if start < 0 || i+(lockCount-1)*format.Size() >= len(data) {
+				continue
+			}
+			if syncRun(data, i, format.Size(), lockCount) {
+				return format, start, nil
+			}
+		}
+	}
+	return FormatTS, 0, ErrInvalidSyncByte
+}
+
+// syncRun reports whether count sync bytes are found every stride bytes from data[i].
+func syncRun(data []byte, i, stride, count int) bool {
+	for k := 0; k < count; k++ {
+		if data[i+k*stride] != 0x47 {
+			return false
+		}
+	}
+	return true
+}
+
+// FramedPacket is a packet recovered by the framer together with the metadata of its wire format.
+type FramedPacket struct {
+	Packet              *EncodedPacket
+	Format              PacketFormat
+	HasArrivalTimestamp bool
+	ArrivalTimestamp    uint32 // 30-bit 27 MHz arrival_time_stamp from the M2TS TP_extra_header.
+	CopyPermission      uint8  // 2-bit copy_permission_indicator from the M2TS TP_extra_header.
+}
+
+// ParseM2TS converts a 192-byte M2TS packet into its 188-byte packet and TP_extra_header fields.
+func ParseM2TS(data []byte) (*FramedPacket, error) {
+	if len(data) < m2tsPacketLength {
+		return nil, ErrInvalidPacketSize
+	}
+	if data[m2tsHeaderLength] != 0x47 {
+		return nil, ErrInvalidSyncByte
+	}
+	header := binary.BigEndian.Uint32(data[:m2tsHeaderLength])
+	ep := &EncodedPacket{}
+	copy(ep[:], data[m2tsHeaderLength:m2tsPacketLength])
+	return &FramedPacket{
+		Packet:              ep,
+		Format:              FormatM2TS,
+		HasArrivalTimestamp: true,
+		ArrivalTimestamp:    header & ArrivalClockMask,
+		CopyPermission:      uint8(header >> 30),
+	}, nil
+}
+
+// MarshalM2TS builds a 192-byte M2TS packet from a packet and an arrival timestamp.
+func MarshalM2TS(ep *EncodedPacket, arrivalTimestamp uint32, copyPermission uint8) []byte {
+	data := make([]byte, m2tsPacketLength)
+	binary.BigEndian.PutUint32(data, uint32(copyPermission&0x03)<<30|arrivalTimestamp&ArrivalClockMask)
+	copy(data[m2tsHeaderLength:], ep[:])
+	return data
+}
+
+// ParseRS converts a 204-byte packet into its 188-byte packet, discarding the Reed-Solomon parity.
+// Use CheckRSParity to verify the parity beforehand when it is known to be genuine.
+func ParseRS(data []byte) (*FramedPacket, error) {
+	if len(data) < rsPacketLength {
+		return nil, ErrInvalidPacketSize
+	}
+	if data[0] != 0x47 {
+		return nil, ErrInvalidSyncByte
+	}
+	ep := &EncodedPacket{}
+	copy(ep[:], data[:packetLength])
+	return &FramedPacket{Packet: ep, Format: FormatRS}, nil
+}
+
+// MarshalRS builds a 204-byte packet carrying the DVB RS(204,188) parity of the packet.
+func MarshalRS(ep *EncodedPacket) []byte {
+	data := make([]byte, rsPacketLength)
+	copy(data, ep[:])
+	copy(data[packetLength:], rsParity(ep[:]))
+	return data
+}
+
+// CheckRSParity reports whether a 204-byte packet is a valid RS(204,188) codeword.
+func CheckRSParity(data []byte) bool {
+	if len(data) < rsPacketLength {
+		return false
+	}
+	for i := 0; i < rsParityLength; i++ {
+		if rsSyndrome(data[:rsPacketLength], gfExp[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// M2TSEncoder converts packets into 192-byte M2TS packets with generated arrival timestamps,
+// spacing them as a constant bitrate stream.
+type M2TSEncoder struct {
+	clock          float64 // Arrival time of the next packet, in 27 MHz ticks.
+	ticksPerPacket float64
+}
+
+// NewM2TSEncoder creates an encoder pacing packets at the given bitrate in bits per second.
+func NewM2TSEncoder(bitrate uint64) *M2TSEncoder {
+	if bitrate == 0 {
+		bitrate = 1
+	}
+	return &M2TSEncoder{
+		ticksPerPacket: float64(packetLength*8) * 27e6 / float64(bitrate),
+	}
+}
+
+// Encode converts packets into consecutive M2TS packets, advancing the arrival clock for each.
+func (e *M2TSEncoder) Encode(packets EncodedPackets) []byte {
+	data := make([]byte, 0, len(packets)*m2tsPacketLength)
+	for _, ep := range packets {
+		ats := uint32(uint64(e.clock) & ArrivalClockMask)
+		data = append(data, MarshalM2TS(ep, ats, 0)...)
+		e.clock += e.ticksPerPacket
+		if e.clock >= ArrivalClockMask+1 {
+			e.clock -= ArrivalClockMask + 1
+		}
+	}
+	return data
+}
+
+// Reed-Solomon RS(204,188, t=8) as specified by ETSI EN 300 421: a shortened RS(255,239) code over
+// GF(2^8) with field polynomial x^8+x^4+x^3+x^2+1 and code generator roots λ^0..λ^15, λ = 0x02.
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var (
+		exp [512]byte
+		log [256]byte
+	)
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+// rsGenerator holds the coefficients of g(x) = (x+λ^0)(x+λ^1)...(x+λ^15), highest degree first.
+var rsGenerator = func() [rsParityLength + 1]byte {
+	var gen [rsParityLength + 1]byte
+	gen[0] = 1
+	for i := 0; i < rsParityLength; i++ {
+		for j := i + 1; j > 0; j-- {
+			gen[j] ^= gfMul(gen[j-1], gfExp[i])
+		}
+	}
+	return gen
+}()
+
+// gfMul multiplies two elements of GF(2^8).
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// rsParity computes the 16 parity bytes of a 188-byte message.
+func rsParity(message []byte) []byte {
+	parity := make([]byte, rsParityLength)
+	for _, b := range message {
+		feedback := b ^ parity[0]
+		copy(parity, parity[1:])
+		parity[rsParityLength-1] = 0
+		if feedback != 0 {
+			for j := 0; j < rsParityLength; j++ {
+				parity[j] ^= gfMul(feedback, rsGenerator[j+1])
+			}
+		}
+	}
+	return parity
+}
+
+// rsSyndrome evaluates the codeword polynomial at x.
+func rsSyndrome(codeword []byte, x byte) byte {
+	s := byte(0)
+	for _, b := range codeword {
+		s = gfMul(s, x) ^ b
+	}
+	return s
+}
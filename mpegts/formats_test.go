@@ -0,0 +1,152 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectPacketFormat(t *testing.T) {
+	packets, data := testStream(10)
+
+	format, offset, err := DetectPacketFormat(data, DefaultLockCount)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatTS, format)
+	assert.Equal(t, 0, offset)
+
+	var m2ts, rs []byte
+	for i, ep := range packets {
+		m2ts = append(m2ts, MarshalM2TS(ep, uint32(i*1000), 0)...)
+		rs = append(rs, MarshalRS(ep)...)
+	}
+
+	format, offset, err = DetectPacketFormat(m2ts[10:], DefaultLockCount)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatM2TS, format)
+	assert.Equal(t, m2tsPacketLength-10, offset)
+
+	format, offset, err = DetectPacketFormat(rs, DefaultLockCount)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatRS, format)
+	assert.Equal(t, 0, offset)
+
+	_, _, err = DetectPacketFormat(make([]byte, 2000), DefaultLockCount)
+	assert.ErrorIs(t, err, ErrInvalidSyncByte)
+}
+
+func TestM2TSRoundTrip(t *testing.T) {
+	packets, _ := testStream(1)
+
+	data := MarshalM2TS(packets[0], 0x7FFFFFFF, 0x03)
+	assert.Len(t, data, m2tsPacketLength)
+
+	fp, err := ParseM2TS(data)
+	assert.NoError(t, err)
+	assert.Equal(t, packets[0], fp.Packet)
+	assert.True(t, fp.HasArrivalTimestamp)
+	assert.Equal(t, uint32(0x3FFFFFFF), fp.ArrivalTimestamp)
+	assert.Equal(t, uint8(0x03), fp.CopyPermission)
+
+	_, err = ParseM2TS(data[:100])
+	assert.ErrorIs(t, err, ErrInvalidPacketSize)
+}
+
+func TestRSParity(t *testing.T) {
+	packets, _ := testStream(3)
+	for _, ep := range packets {
+		data := MarshalRS(ep)
+		assert.Len(t, data, rsPacketLength)
+		assert.True(t, CheckRSParity(data))
+
+		fp, err := ParseRS(data)
+		assert.NoError(t, err)
+		assert.Equal(t, ep, fp.Packet)
+
+		data[100] ^= 0x01
+		assert.False(t, CheckRSParity(data))
+	}
+
+	// The all-zero message has all-zero parity.
+	assert.Equal(t, make([]byte, rsParityLength), rsParity(make([]byte, packetLength)))
+}
+
+func TestRSParityKnownAnswer(t *testing.T) {
+	// Parity of fixed packets, computed by long division by the EN 300 421 generator polynomial
+	// outside this package rather than by the encoder under test.
+	counter := &EncodedPacket{0x47, 0x01, 0x00, 0x10}
+	for i := 4; i < packetLength; i++ {
+		counter[i] = byte(i - 4)
+	}
+	tests := []struct {
+		name   string
+		packet *EncodedPacket
+		parity []byte
+	}{
+		{"counter", counter, []byte{
+			0x00, 0x10, 0xC1, 0x82, 0xC8, 0x71, 0xFB, 0xEB, 0xD3, 0xDC, 0x05, 0x73, 0x6E, 0x01, 0x55, 0xEF,
+		}},
+		{"null", NewNullPacket(), []byte{
+			0x43, 0xBF, 0x42, 0xC1, 0xE1, 0x18, 0xF8, 0x7F, 0x23, 0x90, 0xBA, 0x66, 0x7D, 0xA8, 0x62, 0x6E,
+		}},
+	}
+	for _, tt := range tests {
+		data := MarshalRS(tt.packet)
+		assert.Equal(t, tt.packet[:], data[:packetLength], tt.name)
+		assert.Equal(t, tt.parity, data[packetLength:], tt.name)
+	}
+}
+
+func TestM2TSEncoder(t *testing.T) {
+	packets, _ := testStream(4)
+
+	// At 1.504 Mbit/s a 188-byte packet lasts exactly 1 ms, i.e. 27000 ticks.
+	e := NewM2TSEncoder(1504000)
+	data := e.Encode(packets)
+	assert.Len(t, data, 4*m2tsPacketLength)
+
+	for i := range packets {
+		fp, err := ParseM2TS(data[i*m2tsPacketLength:])
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(i*27000), fp.ArrivalTimestamp)
+	}
+}
+
+func TestFramerFormats(t *testing.T) {
+	packets, _ := testStream(20)
+
+	var m2ts, rs []byte
+	for i, ep := range packets {
+		m2ts = append(m2ts, MarshalM2TS(ep, uint32(i*27000), 0)...)
+		rs = append(rs, MarshalRS(ep)...)
+	}
+
+	t.Run("M2TS", func(t *testing.T) {
+		f := NewFramer(DefaultLockCount)
+		var framed []*FramedPacket
+		for i := 0; i < len(m2ts); i += 1000 {
+			end := i + 1000
+			if end > len(m2ts) {
+				end = len(m2ts)
+			}
+			p, _ := f.PushFramed(m2ts[i:end])
+			framed = append(framed, p...)
+		}
+
+		assert.Equal(t, FormatM2TS, f.Format())
+		assert.Len(t, framed, len(packets))
+		for i, fp := range framed {
+			assert.Equal(t, packets[i], fp.Packet)
+			assert.True(t, fp.HasArrivalTimestamp)
+			assert.Equal(t, uint32(i*27000), fp.ArrivalTimestamp)
+		}
+	})
+
+	t.Run("RS", func(t *testing.T) {
+		f := NewFramer(DefaultLockCount)
+		framed, events := f.Push(append([]byte{0x01, 0x02, 0x03}, rs...))
+
+		assert.Equal(t, FormatRS, f.Format())
+		assert.Len(t, events, 1)
+		assert.Equal(t, packets, framed)
+	})
+}
@@ -0,0 +1,199 @@
+package mpegts
+
+const (
+	// DefaultLockCount is the number of consecutive sync bytes required to acquire sync (ETSI TR 101 290).
+	DefaultLockCount = 5
+	// syncLossCount is the number of consecutive corrupted sync bytes after which sync is lost.
+	syncLossCount = 2
+)
+
+// SyncEventType identifies a change in the framer's synchronisation state.
+type SyncEventType int
+
+const (
+	SyncAcquired SyncEventType = iota
+	SyncLost
+)
+
+// String returns the name of the event type.
+func (t SyncEventType) String() string {
+	if t == SyncAcquired {
+		return "sync acquired"
+	}
+	return "sync lost"
+}
+
+// SyncEvent reports a change in synchronisation at a byte offset of the input stream.
+type SyncEvent struct {
+	Type   SyncEventType
+	Offset uint64 // Offset of the first byte of the packet where the change was detected.
+}
+
+// FramerStats holds counters describing the framer's input.
+type FramerStats struct {
+	Packets        uint64 // Packets emitted.
+	SyncLosses     uint64 // Number of times sync was lost.
+	BadSyncBytes   uint64 // Packets dropped while locked because of a corrupted sync byte.
+	BytesDiscarded uint64 // Bytes skipped while hunting for sync.
+}
+
+// Framer turns arbitrary byte chunks into aligned MPEG-TS packets.
+// It hunts for the 0x47 sync byte, confirms lock over a number of consecutive packets, carries partial
+// packets across chunks and re-synchronises after corruption. The packet format (188, 192 or 204 bytes)
+// is detected while hunting, and every packet is converted to a 188-byte EncodedPacket.
+type Framer struct {
+	lockCount int
+	locked    bool
+	format    PacketFormat
+	badSyncs  int    // Consecutive corrupted sync bytes seen while locked.
+	buf       []byte // Unconsumed input.
+	offset    uint64 // Stream offset of buf[0].
+	stats     FramerStats
+}
+
+// NewFramer creates a framer that requires lockCount consecutive sync bytes to acquire sync.
+// A lockCount below one uses DefaultLockCount.
+func NewFramer(lockCount int) *Framer {
+	if lockCount < 1 {
+		lockCount = DefaultLockCount
+	}
+	return &Framer{lockCount: lockCount}
+}
+
+// Locked reports whether the framer currently holds sync.
+func (f *Framer) Locked() bool {
+	return f.locked
+}
+
+// Format returns the packet format detected when sync was last acquired.
+func (f *Framer) Format() PacketFormat {
+	return f.format
+}
+
+// Stats returns the framer's counters.
+func (f *Framer) Stats() FramerStats {
+	return f.stats
+}
+
+// Push feeds a chunk of input to the framer. It returns the packets completed by the chunk and any
+// changes in synchronisation detected while processing it.
+func (f *Framer) Push(chunk []byte) (EncodedPackets, []SyncEvent) {
+	framed, events := f.PushFramed(chunk)
+	packets := make(EncodedPackets, len(framed))
+	for i, fp := range framed {
+		packets[i] = fp.Packet
+	}
+	return packets, events
+}
+
+// PushFramed is like Push but also returns the wire format metadata of each packet, such as the
+// arrival timestamps of M2TS input.
+func (f *Framer) PushFramed(chunk []byte) ([]*FramedPacket, []SyncEvent) {
+	f.buf = append(f.buf, chunk...)
+
+	var (
+		packets []*FramedPacket
+		events  []SyncEvent
+	)
+
+	for {
+		if !f.locked {
+			if !f.hunt() {
+				break
+			}
+			events = append(events, SyncEvent{Type: SyncAcquired, Offset: f.offset})
+		}
+
+		size := f.format.Size()
+		if len(f.buf) < size {
+			break
+		}
+
+		if f.buf[f.format.syncOffset()] != 0x47 {
+			f.badSyncs++
+			if f.badSyncs >= syncLossCount {
+				f.locked = false
+				f.badSyncs = 0
+				f.stats.SyncLosses++
+				events = append(events, SyncEvent{Type: SyncLost, Offset: f.offset})
+				continue // Hunt again from the current position.
+			}
+			// Assume a single corrupted packet and stay aligned.
+			f.stats.BadSyncBytes++
+			f.consume(size)
+			continue
+		}
+
+		f.badSyncs = 0
+		var fp *FramedPacket
+		switch f.format {
+		case FormatM2TS:
+			fp, _ = ParseM2TS(f.buf[:size])
+		case FormatRS:
+			fp, _ = ParseRS(f.buf[:size])
+		default:
+			ep := &EncodedPacket{}
+			copy(ep[:], f.buf[:packetLength])
+			fp = &FramedPacket{Packet: ep, Format: FormatTS}
+		}
+		packets = append(packets, fp)
+		f.stats.Packets++
+		f.consume(size)
+	}
+
+	return packets, events
+}
+
+// hunt searches the buffer for lockCount consecutive sync bytes spaced one packet apart, trying every
+// packet format. It discards the bytes ahead of the first packet found and reports whether lock was acquired.
+func (f *Framer) hunt() bool {
+	for i := 0; i < len(f.buf); i++ {
+		if f.buf[i] != 0x47 {
+			continue
+		}
+
+		pending := false
+		for _, format := range packetFormats {
+			if i+(f.lockCount-1)*format.Size() >= len(f.buf) {
+				pending = true // Not enough data to confirm this candidate in this format yet.
+				continue
+			}
+			if !syncRun(f.buf, i, format.Size(), f.lockCount) {
+				continue
+			}
+
+			start := i - format.syncOffset()
+			if start < 0 {
+				// The header ahead of the first sync byte was cut off; start with the next packet.
+				start += format.Size()
+			}
+			f.discard(start)
+			f.format = format
+			f.locked = true
+			return true
+		}
+
+		if pending {
+			// Keep the candidate, and room for an M2TS header ahead of it, for the next chunk.
+			if i > m2tsHeaderLength {
+				f.discard(i - m2tsHeaderLength)
+			}
+			return false
+		}
+	}
+
+	f.discard(len(f.buf))
+	return false
+}
+
+// discard drops n bytes that are not part of any packet.
+func (f *Framer) discard(n int) {
+	f.stats.BytesDiscarded += uint64(n)
+	f.consume(n)
+}
+
+// consume advances past n bytes of input.
+func (f *Framer) consume(n int) {
+	f.buf = f.buf[n:]
+	f.offset += uint64(n)
+}
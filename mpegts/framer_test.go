@@ -0,0 +1,100 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStream returns count packets on PID 0x100 with incrementing CC and their concatenated bytes.
+func testStream(count int) (EncodedPackets, []byte) {
+	var (
+		packets EncodedPackets
+		data    []byte
+	)
+	for i := 0; i < count; i++ {
+		ep := &EncodedPacket{0x47}
+		ep.SetPID(0x100)
+		ep[3] = 0x10 | byte(i&0x0F)
+		for j := headerLength; j < packetLength; j++ {
+			ep[j] = byte(i) // Avoid stray sync bytes in the payload of the first packets.
+		}
+		packets = append(packets, ep)
+		data = append(data, ep[:]...)
+	}
+	return packets, data
+}
+
+func TestFramerArbitraryChunks(t *testing.T) {
+	packets, data := testStream(50)
+
+	for _, chunkSize := range []int{1, 7, 188, 1000, 1316, 4096} {
+		f := NewFramer(DefaultLockCount)
+		var (
+			framed EncodedPackets
+			events []SyncEvent
+		)
+		for i := 0; i < len(data); i += chunkSize {
+			end := i + chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			p, e := f.Push(data[i:end])
+			framed = append(framed, p...)
+			events = append(events, e...)
+		}
+
+		assert.Equal(t, packets, framed, "chunk size %d", chunkSize)
+		assert.Equal(t, []SyncEvent{{Type: SyncAcquired, Offset: 0}}, events, "chunk size %d", chunkSize)
+		assert.True(t, f.Locked())
+	}
+}
+
+func TestFramerLeadingGarbage(t *testing.T) {
+	packets, data := testStream(10)
+	garbage := []byte{0x00, 0x47, 0x12, 0x47, 0xFF}
+	input := append(append([]byte{}, garbage...), data...)
+
+	f := NewFramer(3)
+	framed, events := f.Push(input)
+	assert.Equal(t, packets, framed)
+	assert.Equal(t, []SyncEvent{{Type: SyncAcquired, Offset: uint64(len(garbage))}}, events)
+	assert.Equal(t, uint64(len(garbage)), f.Stats().BytesDiscarded)
+}
+
+func TestFramerResync(t *testing.T) {
+	packets, data := testStream(30)
+
+	// Drop 50 bytes in the middle of packet 10, breaking alignment for everything that follows.
+	cut := 10*packetLength + 20
+	corrupted := append(append([]byte{}, data[:cut]...), data[cut+50:]...)
+
+	f := NewFramer(DefaultLockCount)
+	framed, events := f.Push(corrupted)
+
+	assert.Len(t, events, 3)
+	assert.Equal(t, SyncAcquired, events[0].Type)
+	assert.Equal(t, SyncLost, events[1].Type)
+	assert.Equal(t, SyncAcquired, events[2].Type)
+	assert.Equal(t, uint64(1), f.Stats().SyncLosses)
+
+	// Everything ahead of the damage and everything after re-acquiring sync is delivered intact.
+	assert.Equal(t, packets[:10], framed[:10])
+	assert.Equal(t, packets[len(packets)-1], framed[len(framed)-1])
+	for _, ep := range framed {
+		assert.True(t, ep.IsMPEGTS())
+	}
+}
+
+func TestFramerSingleCorruptSyncByte(t *testing.T) {
+	packets, data := testStream(20)
+	data[8*packetLength] = 0x00
+
+	f := NewFramer(DefaultLockCount)
+	framed, events := f.Push(data)
+
+	assert.Len(t, events, 1, "a single corrupted sync byte should not lose sync")
+	assert.Len(t, framed, 19)
+	assert.Equal(t, uint64(1), f.Stats().BadSyncBytes)
+	assert.Equal(t, packets[9], framed[8])
+}
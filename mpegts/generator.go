@@ -3,13 +3,16 @@ package mpegts
 import (
 	"crypto/rand"
 	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
 )
 
 // PIDs for video, audio, and data streams
 const (
 	packetLength = 188
 	headerLength = 4
-	MaxPCRValue  = (1 << 33) - 1
 
 	VideoPID = 0x101
 	AudioPID = 0x102
@@ -54,21 +57,15 @@ func GenerateMPEGTSPackets(count int) ([]EncodedPacket, error) {
 		// Set continuity counter
 		packet[3] |= byte(i & 0x0F)
 
-		// Set PCR value
-		pcr := uint64(i) * pcrIncrement
-		packet.SetPCR(pcr)
-
-		// Calculate and set adaptation field length
-		adaptationFieldLength := calculateAdaptationFieldLength(&packet)
-		packet[4] = byte(adaptationFieldLength - 1) // Set adaptation field length byte
-
-		// Generate random payload
-		payloadLength := packetLength - headerLength - adaptationFieldLength
-		payload := make([]byte, payloadLength)
+		// Set PCR value and fill the rest of the packet with random payload
+		af := &AdaptationField{HasPCR: true, PCR: PCR(uint64(i) * pcrIncrement)}
+		payload := make([]byte, packetLength-headerLength-len(af.Marshal()))
 		if _, err := rand.Read(payload); err != nil {
 			return nil, err
 		}
-		copy(packet[headerLength+adaptationFieldLength:], payload)
+		if _, err := FillPacket(&packet, af, payload); err != nil {
+			return nil, err
+		}
 
 		packets[i] = packet
 	}
@@ -88,3 +85,465 @@ func randIntn(n int) int {
 	}
 	return int(b[0]) % n
 }
+
+// NewNullPacket returns a null packet (PID 0x1FFF) used to stuff a stream to a constant bitrate.
+func NewNullPacket() *EncodedPacket {
+	ep := &EncodedPacket{0x47, 0x1F, 0xFF, 0x10}
+	for i := headerLength; i < packetLength; i++ {
+		ep[i] = 0xFF
+	}
+	return ep
+}
+
+const (
+	audioSampleRate  = 48000    // Sample rate of the generated AAC audio.
+	aacFrameSamples  = 1024     // Samples per AAC frame.
+	dataPESInterval  = PCRClock // One data PES per second.
+	fillerByte       = 0xAA     // Elementary stream filler that cannot form a start code.
+	registrationTRBD = "TRBD"   // format_identifier of the generated data streams.
+)
+
+// GeneratorProgram configures one program of a StreamGenerator. The video PID also carries the PCR.
+type GeneratorProgram struct {
+	ProgramNumber uint16
+	ServiceName   string
+	PMTPID        uint16
+	VideoPID      uint16
+	AudioPID      uint16
+	DataPID       uint16 // Zero omits the data stream.
+	VideoBitrate  int    // Elementary stream rates, bits per second.
+	AudioBitrate  int
+	DataBitrate   int
+}
+
+// GeneratorConfig configures a StreamGenerator. Zero durations and rates take the defaults of
+// DefaultGeneratorConfig.
+type GeneratorConfig struct {
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Bitrate           int // Constant transport stream rate, bits per second, reached with null packets.
+	Programs          []GeneratorProgram
+	FrameRate         float64       // Video frames per second.
+	GOPLength         int           // Frames from one IDR picture to the next.
+	PCRInterval       time.Duration // Spacing of the PCRs of each program.
+	PSIInterval       time.Duration // Spacing of the PAT and PMTs.
+	SDTInterval       time.Duration
+	PTSOffset         time.Duration // How far the DTS of an access unit leads the PCR when it is produced.
+	StartPCR          PCR           // PCR of the first packet, so tests can cross the wrap.
+}
+
+// DefaultGeneratorConfig returns a configuration of n programs, each with 2 Mbit/s of 25 fps H.264
+// video, 128 kbit/s AAC audio and a 16 kbit/s data stream. Program i is numbered i+1, has its PMT on
+// PID 0x1000+i and its streams on PIDs 0x100+0x10*i onwards.
+func DefaultGeneratorConfig(n int) GeneratorConfig {
+	cfg := GeneratorConfig{
+		TransportStreamID: 1,
+		OriginalNetworkID: 1,
+		Bitrate:           n * 2500000,
+		FrameRate:         25,
+		GOPLength:         25,
+		PCRInterval:       30 * time.Millisecond,
+		PSIInterval:       100 * time.Millisecond,
+		SDTInterval:       500 * time.Millisecond,
+		PTSOffset:         500 * time.Millisecond,
+	}
+	for i := 0; i < n; i++ {
+		base := uint16(0x100 + 0x10*i)
+		cfg.Programs = append(cfg.Programs, GeneratorProgram{
+			ProgramNumber: uint16(i + 1),
+			ServiceName:   fmt.Sprintf("Channel %d", i+1),
+			PMTPID:        uint16(0x1000 + i),
+			VideoPID:      base,
+			AudioPID:      base + 1,
+			DataPID:       base + 2,
+			VideoBitrate:  2000000,
+			AudioBitrate:  128000,
+			DataBitrate:   16000,
+		})
+	}
+	return cfg
+}
+
+// validate fills in defaults and checks the configuration.
+func (cfg *GeneratorConfig) validate() error {
+	defaults := DefaultGeneratorConfig(0)
+	if cfg.FrameRate <= 0 {
+		cfg.FrameRate = defaults.FrameRate
+	}
+	if cfg.GOPLength <= 0 {
+		cfg.GOPLength = defaults.GOPLength
+	}
+	if cfg.PCRInterval <= 0 {
+		cfg.PCRInterval = defaults.PCRInterval
+	}
+	if cfg.PSIInterval <= 0 {
+		cfg.PSIInterval = defaults.PSIInterval
+	}
+	if cfg.SDTInterval <= 0 {
+		cfg.SDTInterval = defaults.SDTInterval
+	}
+	if cfg.PTSOffset <= 0 {
+		cfg.PTSOffset = defaults.PTSOffset
+	}
+	if cfg.Bitrate <= 0 || len(cfg.Programs) == 0 {
+		return ErrInvalidConfig
+	}
+
+	used := map[uint16]bool{PATPID: true, SDTPID: true, 0x1FFF: true}
+	for _, p := range cfg.Programs {
+		for _, pid := range []uint16{p.PMTPID, p.VideoPID, p.AudioPID, p.DataPID} {
+			if pid == 0 && p.DataPID == 0 {
+				continue
+			}
+			if pid < 0x20 || pid > 0x1FFE || used[pid] {
+				return ErrInvalidConfig
+			}
+			used[pid] = true
+		}
+		if p.VideoBitrate <= 0 || p.AudioBitrate <= 0 || p.DataPID != 0 && p.DataBitrate <= 0 {
+			return ErrInvalidConfig
+		}
+		if p.DataBitrate/8+pesFixedHeaderLen+pesOptionalFixedLen+timestampLength > pesFixedHeaderLen+0xFFFF {
+			return ErrInvalidConfig // A data PES of a second would not fit in a bounded PES packet.
+		}
+	}
+	if cfg.transportRate() >= float64(cfg.Bitrate) {
+		return ErrInvalidConfig
+	}
+	return nil
+}
+
+// transportRate estimates from above the rate, in bits per second, of the packets the configuration
+// produces: the elementary streams with their PES headers, the packets that carry them, the stuffing
+// ending each PES, the PCR-only packets, the PSI and the SDT.
+func (cfg *GeneratorConfig) transportRate() float64 {
+	second := float64(time.Second)
+	g := &StreamGenerator{cfg: *cfg, cc: make(map[uint16]uint8)}
+	psi := float64(len(g.psiPackets())) * second / float64(cfg.PSIInterval)
+	sdt, _, _ := g.sdt().Encode(0)
+	packets := psi + float64(len(sdt))*second/float64(cfg.SDTInterval)
+
+	pesHeader := pesFixedHeaderLen + pesOptionalFixedLen + timestampLength
+	for _, p := range cfg.Programs {
+		packets += second / float64(cfg.PCRInterval)
+		// The video PES carries a DTS and, on IDR pictures, a random_access_indicator.
+		packets += pesPackets(p.VideoBitrate, cfg.FrameRate, pesHeader+timestampLength+2)
+		packets += pesPackets(p.AudioBitrate, audioSampleRate/aacFrameSamples, pesHeader)
+		if p.DataPID != 0 {
+			packets += pesPackets(p.DataBitrate, 1, pesHeader)
+		}
+	}
+	return packets * packetLength * 8
+}
+
+// pesPackets bounds the packets per second of an elementary stream sent as rate PES packets a second,
+// each with header bytes of PES header and adaptation field. The last packet of each PES is counted
+// whole, as its stuffing pads it.
+func pesPackets(bitrate int, rate float64, header int) float64 {
+	payload := packetLength - headerLength
+	return (float64(bitrate)/8+rate*float64(header))/float64(payload) + rate
+}
+
+// generatorStream is one elementary stream of a generated program.
+type generatorStream struct {
+	pid     uint16
+	pp      *PESPacketizer
+	queue   EncodedPackets
+	next    uint64 // Stream time of the next access unit, 27 MHz.
+	count   uint64 // Access units produced.
+	produce func(s *generatorStream, now uint64) EncodedPackets
+}
+
+// StreamGenerator produces a constant bitrate multi-program transport stream with PSI/SI, PCRs and
+// PES packets carrying monotonically increasing timestamps. It is useful for end-to-end tests.
+type StreamGenerator struct {
+	cfg     GeneratorConfig
+	streams []*generatorStream
+	nextPCR []uint64 // Per program.
+	psi     EncodedPackets
+	nextPSI uint64
+	nextSDT uint64
+	rr      int // Next stream served when several have packets queued.
+	stamper *ContinuityStamper
+	cc      map[uint16]uint8 // Counters of the tables, so that a repeated table is not a duplicate packet.
+	packets uint64
+}
+
+// NewStreamGenerator creates a generator from the configuration.
+func NewStreamGenerator(cfg GeneratorConfig) (*StreamGenerator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	g := &StreamGenerator{
+		cfg:     cfg,
+		nextPCR: make([]uint64, len(cfg.Programs)),
+		stamper: NewContinuityStamper(),
+		cc:      make(map[uint16]uint8),
+	}
+	for _, p := range cfg.Programs {
+		g.streams = append(g.streams, g.videoStream(p), g.audioStream(p))
+		if p.DataPID != 0 {
+			g.streams = append(g.streams, g.dataStream(p))
+		}
+	}
+	return g, nil
+}
+
+// Config returns the configuration of the generator, with defaults filled in.
+func (g *StreamGenerator) Config() GeneratorConfig {
+	return g.cfg
+}
+
+// Elapsed returns the stream time of the packets generated so far.
+func (g *StreamGenerator) Elapsed() time.Duration {
+	return pcrDuration(int64(g.clock(g.packets)))
+}
+
+// clock returns the stream time of packet n, 27 MHz.
+func (g *StreamGenerator) clock(n uint64) uint64 {
+	hi, lo := bits.Mul64(n, packetLength*8*PCRClock)
+	q, _ := bits.Div64(hi, lo, uint64(g.cfg.Bitrate))
+	return q
+}
+
+// ticks converts a duration to the 27 MHz clock.
+func ticks(d time.Duration) uint64 {
+	return uint64(durationTicks(d, PCRClock))
+}
+
+// Next returns the next packet of the stream.
+func (g *StreamGenerator) Next() *EncodedPacket {
+	now := g.clock(g.packets)
+	g.packets++
+
+	if now >= g.nextPSI {
+		g.psi = append(g.psi, g.psiPackets()...)
+		g.nextPSI += ticks(g.cfg.PSIInterval)
+	}
+	if now >= g.nextSDT {
+		var packets EncodedPackets
+		packets, g.cc[SDTPID], _ = g.sdt().Encode(g.cc[SDTPID])
+		g.psi = append(g.psi, packets...)
+		g.nextSDT += ticks(g.cfg.SDTInterval)
+	}
+	for _, s := range g.streams {
+		for now >= s.next {
+			s.queue = append(s.queue, s.produce(s, now)...)
+			s.count++
+		}
+	}
+
+	var ep *EncodedPacket
+	for i, p := range g.cfg.Programs {
+		if now >= g.nextPCR[i] {
+			ep = &EncodedPacket{0x47}
+			ep.SetPID(p.VideoPID)
+			FillPacket(ep, &AdaptationField{HasPCR: true, PCR: g.cfg.StartPCR.AddTicks(int64(now))}, nil)
+			g.nextPCR[i] += ticks(g.cfg.PCRInterval)
+			break
+		}
+	}
+	if ep == nil && len(g.psi) > 0 {
+		ep, g.psi = g.psi[0], g.psi[1:]
+	}
+	for i := 0; ep == nil && i < len(g.streams); i++ {
+		s := g.streams[(g.rr+i)%len(g.streams)]
+		if len(s.queue) > 0 {
+			ep, s.queue = s.queue[0], s.queue[1:]
+			g.rr = (g.rr + i + 1) % len(g.streams)
+		}
+	}
+	if ep == nil {
+		return NewNullPacket()
+	}
+	g.stamper.Stamp(ep)
+	return ep
+}
+
+// Generate returns the next n packets of the stream.
+func (g *StreamGenerator) Generate(n int) EncodedPackets {
+	packets := make(EncodedPackets, n)
+	for i := range packets {
+		packets[i] = g.Next()
+	}
+	return packets
+}
+
+// Read fills p with whole packets of the stream. It never returns io.EOF.
+func (g *StreamGenerator) Read(p []byte) (int, error) {
+	if len(p) < packetLength {
+		return 0, io.ErrShortBuffer
+	}
+	n := 0
+	for ; n+packetLength <= len(p); n += packetLength {
+		copy(p[n:], g.Next()[:])
+	}
+	return n, nil
+}
+
+// psiPackets encodes the PAT and every PMT.
+func (g *StreamGenerator) psiPackets() EncodedPackets {
+	pat := NewPAT(g.cfg.TransportStreamID, 0)
+	for _, p := range g.cfg.Programs {
+		pat.Programs[p.ProgramNumber] = p.PMTPID
+	}
+	var packets EncodedPackets
+	packets, g.cc[PATPID] = pat.Encode(g.cc[PATPID])
+	for _, p := range g.cfg.Programs {
+		pmt, cc, _ := g.pmt(p).Encode(p.PMTPID, g.cc[p.PMTPID])
+		g.cc[p.PMTPID] = cc
+		packets = append(packets, pmt...)
+	}
+	return packets
+}
+
+// pmt describes a generated program.
+func (g *StreamGenerator) pmt(p GeneratorProgram) *PMT {
+	pmt := &PMT{
+		ProgramNumber: p.ProgramNumber,
+		CurrentNext:   true,
+		PCRPID:        p.VideoPID,
+		Streams: []ElementaryStream{
+			{StreamType: StreamTypeH264, ElementaryPID: p.VideoPID},
+			{StreamType: StreamTypeADTSAAC, ElementaryPID: p.AudioPID, Descriptors: Descriptors(
+				&ISO639LanguageDescriptor{Languages: []ISO639Language{{Code: "eng"}}},
+			)},
+		},
+	}
+	if p.DataPID != 0 {
+		pmt.Streams = append(pmt.Streams, ElementaryStream{
+			StreamType:    StreamTypePrivatePES,
+			ElementaryPID: p.DataPID,
+			Descriptors:   Descriptors(&RegistrationDescriptor{FormatIdentifier: registrationTRBD}),
+		})
+	}
+	return pmt
+}
+
+// sdt names the generated services.
+func (g *StreamGenerator) sdt() *SDT {
+	sdt := &SDT{
+		Actual:            true,
+		TransportStreamID: g.cfg.TransportStreamID,
+		OriginalNetworkID: g.cfg.OriginalNetworkID,
+		CurrentNext:       true,
+	}
+	for _, p := range g.cfg.Programs {
+		sdt.Services = append(sdt.Services, SDTService{
+			ServiceID:     p.ProgramNumber,
+			RunningStatus: RunningStatusRunning,
+			Descriptors: Descriptors(&ServiceDescriptor{
+				ServiceType:  ServiceTypeDigitalTV,
+				ProviderName: "tribd",
+				ServiceName:  p.ServiceName,
+			}),
+		})
+	}
+	return sdt
+}
+
+// timestamp returns the 90 kHz timestamp for stream time t, offset by the PTS lead.
+func (g *StreamGenerator) timestamp(t uint64) PTS {
+	return g.cfg.StartPCR.AddTicks(int64(t + ticks(g.cfg.PTSOffset))).Base()
+}
+
+// videoStream produces H.264 access units, an IDR picture every GOP, with the PTS one frame after the
+// DTS.
+func (g *StreamGenerator) videoStream(p GeneratorProgram) *generatorStream {
+	frame := float64(PCRClock) / g.cfg.FrameRate
+	gop := g.cfg.GOPLength
+	average := int(float64(p.VideoBitrate) / g.cfg.FrameRate / 8)
+	idrSize := 3 * average
+	pSize := average
+	if gop > 1 {
+		pSize = (gop*average - idrSize) / (gop - 1)
+	}
+
+	return &generatorStream{
+		pid: p.VideoPID,
+		pp:  NewPESPacketizer(p.VideoPID),
+		produce: func(s *generatorStream, now uint64) EncodedPackets {
+			idr := s.count%uint64(gop) == 0
+			dts := g.timestamp(s.next)
+			s.next = uint64(float64(s.count+1) * frame)
+
+			es := []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xF0} // Access unit delimiter.
+			size := pSize
+			if idr {
+				es = append(es, 0x00, 0x00, 0x00, 0x01, 0x67, 0x64, 0x00, 0x28) // SPS.
+				es = append(es, 0x00, 0x00, 0x00, 0x01, 0x68, 0xEE, 0x3C, 0x80) // PPS.
+				es = append(es, 0x00, 0x00, 0x01, 0x65)                         // IDR slice.
+				size = idrSize
+			} else {
+				es = append(es, 0x00, 0x00, 0x01, 0x41) // Non-IDR slice.
+			}
+			es = appendFiller(es, size)
+
+			pes := &PESPacket{
+				StreamID:      StreamIDVideoBase,
+				DataAlignment: true,
+				HasPTS:        true,
+				PTS:           dts.AddTicks(int64(frame) / 300),
+				HasDTS:        true,
+				DTS:           dts,
+				Payload:       es,
+			}
+			var af *AdaptationField
+			if idr {
+				af = &AdaptationField{RandomAccess: true}
+			}
+			packets, _ := s.pp.Packetize(pes, af)
+			return packets
+		},
+	}
+}
+
+// audioStream produces ADTS AAC frames of 1024 samples at 48 kHz.
+func (g *StreamGenerator) audioStream(p GeneratorProgram) *generatorStream {
+	period := uint64(aacFrameSamples * PCRClock / audioSampleRate)
+	size := p.AudioBitrate * aacFrameSamples / audioSampleRate / 8
+
+	return &generatorStream{
+		pid: p.AudioPID,
+		pp:  NewPESPacketizer(p.AudioPID),
+		produce: func(s *generatorStream, now uint64) EncodedPackets {
+			pts := g.timestamp(s.next)
+			s.next += period
+
+			// ADTS header: MPEG-4 AAC LC, 48 kHz, stereo, no CRC.
+			length := size
+			es := []byte{0xFF, 0xF1, 0x4C, 0x80 | byte(length>>11), byte(length >> 3), byte(length<<5) | 0x1F, 0xFC}
+			es = appendFiller(es, size)
+
+			pes := &PESPacket{StreamID: StreamIDAudioBase, DataAlignment: true, HasPTS: true, PTS: pts, Payload: es}
+			packets, _ := s.pp.Packetize(pes, nil)
+			return packets
+		},
+	}
+}
+
+// dataStream produces one private PES a second.
+func (g *StreamGenerator) dataStream(p GeneratorProgram) *generatorStream {
+	size := p.DataBitrate / 8
+
+	return &generatorStream{
+		pid: p.DataPID,
+		pp:  NewPESPacketizer(p.DataPID),
+		produce: func(s *generatorStream, now uint64) EncodedPackets {
+			pts := g.timestamp(s.next)
+			s.next += dataPESInterval
+
+			pes := &PESPacket{StreamID: StreamIDPrivateStream1, HasPTS: true, PTS: pts, Payload: appendFiller(nil, size)}
+			packets, _ := s.pp.Packetize(pes, nil)
+			return packets
+		},
+	}
+}
+
+// appendFiller pads data with filler bytes up to size.
+func appendFiller(data []byte, size int) []byte {
+	for len(data) < size {
+		data = append(data, fillerByte)
+	}
+	return data
+}
@@ -0,0 +1,171 @@
+package mpegts
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamGeneratorConfig(t *testing.T) {
+	_, err := NewStreamGenerator(GeneratorConfig{})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	cfg := DefaultGeneratorConfig(2)
+	cfg.Programs[1].AudioPID = cfg.Programs[0].VideoPID
+	_, err = NewStreamGenerator(cfg)
+	assert.ErrorIs(t, err, ErrInvalidConfig, "PIDs must be unique")
+
+	cfg = DefaultGeneratorConfig(2)
+	cfg.Bitrate = 4000000
+	_, err = NewStreamGenerator(cfg)
+	assert.ErrorIs(t, err, ErrInvalidConfig, "the programs must fit the bitrate")
+
+	// The elementary streams alone fit, but not once packetized with the PCRs and tables.
+	cfg = DefaultGeneratorConfig(1)
+	cfg.Bitrate = 2200000
+	_, err = NewStreamGenerator(cfg)
+	assert.ErrorIs(t, err, ErrInvalidConfig, "the packetization overhead must fit the bitrate")
+	cfg.Bitrate = int(cfg.transportRate()) + 1
+	_, err = NewStreamGenerator(cfg)
+	assert.NoError(t, err)
+
+	cfg = DefaultGeneratorConfig(1)
+	cfg.Programs[0].DataBitrate = 600000
+	cfg.Bitrate = 10000000
+	_, err = NewStreamGenerator(cfg)
+	assert.ErrorIs(t, err, ErrInvalidConfig, "a data PES must fit a bounded PES packet")
+
+	cfg = DefaultGeneratorConfig(1)
+	cfg.Programs[0].DataPID = 0
+	cfg.FrameRate = 0
+	g, err := NewStreamGenerator(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 25.0, g.Config().FrameRate, "defaults are filled in")
+}
+
+func TestStreamGeneratorTables(t *testing.T) {
+	cfg := DefaultGeneratorConfig(3)
+	g, err := NewStreamGenerator(cfg)
+	assert.NoError(t, err)
+
+	sa := NewSectionAssembler()
+	pmts := map[uint16]*PMT{}
+	var pat *PAT
+	var sdt *SDT
+	for _, ep := range g.Generate(5000) {
+		if pid := ep.GetPID(); pid != PATPID && pid != SDTPID && pid < 0x1000 {
+			continue
+		}
+		sections, err := sa.Push(ep)
+		assert.NoError(t, err)
+		for _, s := range sections {
+			switch {
+			case s.PID == PATPID:
+				pat, err = ParsePAT(s)
+			case s.PID == SDTPID:
+				sdt, err = ParseSDT(s)
+			default:
+				var pmt *PMT
+				pmt, err = ParsePMT(s)
+				pmts[s.PID] = pmt
+			}
+			assert.NoError(t, err)
+		}
+	}
+
+	assert.NotNil(t, pat)
+	assert.Equal(t, []uint16{1, 2, 3}, pat.ProgramNumbers())
+	assert.Len(t, pmts, 3)
+	for _, p := range cfg.Programs {
+		pid, err := pat.PMTPID(p.ProgramNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, p.PMTPID, pid)
+		assert.Equal(t, p.VideoPID, pmts[pid].PCRPID)
+		assert.Equal(t, []uint16{p.VideoPID, p.AudioPID, p.DataPID}, pmts[pid].PIDs())
+
+		service, err := sdt.Service(p.ProgramNumber)
+		assert.NoError(t, err)
+		sd, ok := service.ServiceDescriptor()
+		assert.True(t, ok)
+		assert.Equal(t, p.ServiceName, sd.ServiceName)
+	}
+}
+
+func TestStreamGeneratorTiming(t *testing.T) {
+	cfg := DefaultGeneratorConfig(2)
+	cfg.StartPCR = PCRWrap - PCRClock // Wraps after one second.
+	g, err := NewStreamGenerator(cfg)
+	assert.NoError(t, err)
+
+	packets := g.Generate(cfg.Bitrate * 3 / (packetLength * 8)) // Three seconds.
+	assert.Equal(t, 3*time.Second, g.Elapsed().Round(time.Millisecond))
+
+	pa := NewPCRAnalyzer()
+	cc := NewContinuityTracker()
+	assemblers := map[uint16]*PESAssembler{}
+	var last = map[uint16]PTS{}
+	nulls := 0
+	for i, ep := range packets {
+		assert.NotEqual(t, ContinuityGap, cc.Check(ep))
+		pa.Push(ep, time.Time{})
+		if ep.IsNullPacket() {
+			nulls++
+			continue
+		}
+
+		if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.HasPCR {
+			want := cfg.StartPCR.AddTicks(int64(g.clock(uint64(i))))
+			assert.Equal(t, want, af.PCR, "PCR of packet %d", i)
+		}
+
+		pid := ep.GetPID()
+		if pid < 0x100 || pid >= 0x1000 {
+			continue
+		}
+		if assemblers[pid] == nil {
+			assemblers[pid] = NewPESAssembler()
+		}
+		pess, err := assemblers[pid].Push(ep)
+		assert.NoError(t, err)
+		for _, pes := range pess {
+			ts := pes.PTS
+			if pes.HasDTS {
+				ts = pes.DTS
+				assert.True(t, pes.PTS.After(ts), "PTS follows DTS")
+			}
+			if prev, ok := last[pid]; ok {
+				assert.True(t, ts.After(prev), "PID 0x%04X timestamps increase", pid)
+				assert.LessOrEqual(t, ts.Since(prev), time.Second, "PID 0x%04X", pid)
+			}
+			last[pid] = ts
+		}
+	}
+	assert.Len(t, last, 6)
+	assert.NotZero(t, nulls, "stuffed to the constant bitrate")
+
+	for _, stats := range pa.Results() {
+		assert.Zero(t, stats.IntervalErrors, "program %d", stats.Program)
+		assert.Zero(t, stats.AccuracyErrors, "program %d", stats.Program)
+		assert.LessOrEqual(t, stats.MaxInterval, cfg.PCRInterval+time.Millisecond)
+		assert.InDelta(t, float64(cfg.Bitrate), stats.Bitrate, float64(cfg.Bitrate)/1000)
+	}
+	assert.Len(t, pa.Results(), 2)
+}
+
+func TestStreamGeneratorRead(t *testing.T) {
+	g, err := NewStreamGenerator(DefaultGeneratorConfig(1))
+	assert.NoError(t, err)
+
+	_, err = g.Read(make([]byte, 100))
+	assert.ErrorIs(t, err, io.ErrShortBuffer)
+
+	buf := make([]byte, 7*packetLength+50)
+	n, err := g.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 7*packetLength, n)
+	for i := 0; i < n; i += packetLength {
+		assert.Equal(t, byte(0x47), buf[i])
+	}
+}
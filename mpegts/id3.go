@@ -0,0 +1,206 @@
+package mpegts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// ID3 timed metadata is carried as ID3v2 tags in PES packets on a stream_type 0x15 elementary stream,
+// described by a metadata_descriptor and pointed at by a metadata_pointer_descriptor, as used by HLS.
+
+const (
+	ID3FormatIdentifier = "ID3 " // metadata_application_format_identifier and metadata_format_identifier of ID3.
+
+	id3HeaderLength      = 10
+	id3FrameHeaderLength = 10
+	id3FlagExtended      = 0x40
+	id3FlagFooter        = 0x10
+
+	id3EncodingLatin1  = 0x00
+	id3EncodingUTF16   = 0x01
+	id3EncodingUTF16BE = 0x02
+	id3EncodingUTF8    = 0x03
+)
+
+// id3Format is the metadata format of ID3 timed metadata.
+var id3Format = MetadataFormat{
+	ApplicationFormat:           0xFFFF,
+	ApplicationFormatIdentifier: ID3FormatIdentifier,
+	Format:                      0xFF,
+	FormatIdentifier:            ID3FormatIdentifier,
+}
+
+// NewID3MetadataDescriptor returns the metadata_descriptor of an ID3 timed metadata stream.
+func NewID3MetadataDescriptor() *MetadataDescriptor {
+	return &MetadataDescriptor{MetadataFormat: id3Format}
+}
+
+// NewID3MetadataPointerDescriptor returns the metadata_pointer_descriptor pointing a program at its ID3
+// timed metadata stream in the same transport stream.
+func NewID3MetadataPointerDescriptor(program uint16) *MetadataPointerDescriptor {
+	return &MetadataPointerDescriptor{MetadataFormat: id3Format, ProgramNumber: program}
+}
+
+// IsID3Stream reports whether an elementary stream carries ID3 timed metadata: a metadata PES stream
+// with an ID3 metadata_descriptor, or a private PES stream registered as "ID3 ".
+func IsID3Stream(es ElementaryStream) bool {
+	switch es.StreamType {
+	case StreamTypeMetadataPES:
+		d, ok := FindDescriptor(es.Descriptors, MetadataDescriptorTag)
+		if !ok {
+			return false
+		}
+		typed, err := d.Decode()
+		return err == nil && typed.(*MetadataDescriptor).FormatIdentifier == ID3FormatIdentifier
+	case StreamTypePrivatePES:
+		d, ok := FindDescriptor(es.Descriptors, RegistrationDescriptorTag)
+		return ok && bytes.HasPrefix(d.Data, []byte(ID3FormatIdentifier))
+	}
+	return false
+}
+
+// ID3Frame is one frame of an ID3v2 tag, such as TIT2 (title) or PRIV (private data).
+type ID3Frame struct {
+	ID   string // Four characters.
+	Data []byte // Frame content following the frame header.
+}
+
+// NewID3TextFrame returns a text information frame, such as TIT2 or TPE1, encoded as UTF-8.
+func NewID3TextFrame(id, text string) ID3Frame {
+	return ID3Frame{ID: id, Data: append([]byte{id3EncodingUTF8}, text...)}
+}
+
+// NewID3TXXXFrame returns a user defined text frame.
+func NewID3TXXXFrame(description, value string) ID3Frame {
+	data := append([]byte{id3EncodingUTF8}, description...)
+	data = append(data, 0)
+	return ID3Frame{ID: "TXXX", Data: append(data, value...)}
+}
+
+// NewID3PRIVFrame returns a private frame, such as the beacons of an ad insertion platform.
+func NewID3PRIVFrame(owner string, data []byte) ID3Frame {
+	content := append([]byte(owner), 0)
+	return ID3Frame{ID: "PRIV", Data: append(content, data...)}
+}
+
+// Text returns the text of a text information frame. The values of a TXXX frame, and multiple values,
+// are separated by newlines. Other frames return an empty string.
+func (f ID3Frame) Text() string {
+	if len(f.ID) < 1 || f.ID[0] != 'T' || len(f.Data) < 1 {
+		return ""
+	}
+	var text string
+	data := f.Data[1:]
+	switch f.Data[0] {
+	case id3EncodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	case id3EncodingUTF16, id3EncodingUTF16BE:
+		order := binary.ByteOrder(binary.BigEndian)
+		var units []uint16
+		for i := 0; i+1 < len(data); i += 2 {
+			u := order.Uint16(data[i:])
+			switch {
+			case u == 0xFEFF:
+				continue
+			case u == 0xFFFE: // Little endian byte order mark.
+				order = binary.LittleEndian
+				continue
+			}
+			units = append(units, u)
+		}
+		text = string(utf16.Decode(units))
+	case id3EncodingUTF8:
+		text = string(data)
+	}
+	return strings.ReplaceAll(strings.TrimRight(text, "\x00"), "\x00", "\n")
+}
+
+// Owner returns the owner identifier of a PRIV frame, and its private data.
+func (f ID3Frame) Owner() (string, []byte) {
+	if f.ID != "PRIV" {
+		return "", nil
+	}
+	owner, data, _ := bytes.Cut(f.Data, []byte{0})
+	return string(owner), data
+}
+
+// EncodeID3Tag builds an ID3v2.4 tag from its frames.
+func EncodeID3Tag(frames ...ID3Frame) []byte {
+	var body []byte
+	for _, f := range frames {
+		body = append(body, (f.ID + "    ")[:4]...)
+		body = binary.BigEndian.AppendUint32(body, synchsafe(uint32(len(f.Data))))
+		body = append(body, 0, 0) // Frame flags.
+		body = append(body, f.Data...)
+	}
+	tag := []byte{'I', 'D', '3', 0x04, 0x00, 0x00}
+	tag = binary.BigEndian.AppendUint32(tag, synchsafe(uint32(len(body))))
+	return append(tag, body...)
+}
+
+// ParseID3Tag returns the frames of an ID3v2.3 or ID3v2.4 tag and the length of the tag. Padding after
+// the last frame is skipped.
+func ParseID3Tag(data []byte) ([]ID3Frame, int, error) {
+	if len(data) < id3HeaderLength || string(data[:3]) != "ID3" || data[3] < 3 || data[3] > 4 {
+		return nil, 0, ErrInvalidID3
+	}
+	version, flags := data[3], data[5]
+	size := int(unsynchsafe(binary.BigEndian.Uint32(data[6:10])))
+	length := id3HeaderLength + size
+	if flags&id3FlagFooter != 0 {
+		length += id3HeaderLength
+	}
+	if len(data) < id3HeaderLength+size {
+		return nil, 0, ErrInvalidID3
+	}
+	body := data[id3HeaderLength : id3HeaderLength+size]
+
+	if flags&id3FlagExtended != 0 {
+		if len(body) < 4 {
+			return nil, 0, ErrInvalidID3
+		}
+		extended := int(binary.BigEndian.Uint32(body[:4]))
+		if version == 4 {
+			extended = int(unsynchsafe(uint32(extended))) // Includes its own size field.
+		} else {
+			extended += 4
+		}
+		if extended > len(body) {
+			return nil, 0, ErrInvalidID3
+		}
+		body = body[extended:]
+	}
+
+	var frames []ID3Frame
+	for len(body) >= id3FrameHeaderLength && body[0] != 0 {
+		frameSize := binary.BigEndian.Uint32(body[4:8])
+		if version == 4 {
+			frameSize = unsynchsafe(frameSize)
+		}
+		if int(frameSize) > len(body)-id3FrameHeaderLength {
+			return nil, 0, ErrInvalidID3
+		}
+		frames = append(frames, ID3Frame{
+			ID:   string(body[:4]),
+			Data: append([]byte{}, body[id3FrameHeaderLength:id3FrameHeaderLength+int(frameSize)]...),
+		})
+		body = body[id3FrameHeaderLength+int(frameSize):]
+	}
+	return frames, length, nil
+}
+
+// synchsafe spreads a 28-bit value over four bytes of seven bits each.
+func synchsafe(v uint32) uint32 {
+	return v&0x7F | (v&0x3F80)<<1 | (v&0x1FC000)<<2 | (v&0xFE00000)<<3
+}
+
+// unsynchsafe reverses synchsafe.
+func unsynchsafe(v uint32) uint32 {
+	return v&0x7F | (v&0x7F00)>>1 | (v&0x7F0000)>>2 | (v&0x7F000000)>>3
+}
@@ -0,0 +1,59 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestID3Tag(t *testing.T) {
+	frames := []ID3Frame{
+		NewID3TextFrame("TIT2", "Señor"),
+		NewID3TXXXFrame("adId", "42"),
+		NewID3PRIVFrame("com.apple.streaming.transportStreamTimestamp", []byte{0, 0, 0, 0, 0, 0, 0x01, 0x00}),
+		{ID: "GEOB", Data: make([]byte, 200)}, // Synchsafe sizes above 127.
+	}
+	tag := EncodeID3Tag(frames...)
+	assert.Equal(t, []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0x02, 0x34}, tag[:10])
+
+	parsed, n, err := ParseID3Tag(append(tag, 0xFF)) // Trailing bytes are not part of the tag.
+	assert.NoError(t, err)
+	assert.Equal(t, len(tag), n)
+	assert.Equal(t, frames, parsed)
+
+	assert.Equal(t, "Señor", parsed[0].Text())
+	assert.Equal(t, "adId\n42", parsed[1].Text())
+	owner, data := parsed[2].Owner()
+	assert.Equal(t, "com.apple.streaming.transportStreamTimestamp", owner)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0x01, 0x00}, data)
+	assert.Empty(t, parsed[3].Text())
+
+	_, _, err = ParseID3Tag(tag[:20])
+	assert.ErrorIs(t, err, ErrInvalidID3)
+	_, _, err = ParseID3Tag([]byte("TAG"))
+	assert.ErrorIs(t, err, ErrInvalidID3)
+}
+
+func TestID3TagVersions(t *testing.T) {
+	// ID3v2.3 with plain frame sizes, an extended header and padding.
+	tag := []byte{'I', 'D', '3', 3, 0, id3FlagExtended, 0, 0, 0, 40,
+		0, 0, 0, 6, 0, 0, 0, 0, 0, 0, // Extended header.
+		'T', 'I', 'T', '2', 0, 0, 0, 6, 0, 0, 0x01, 0xFF, 0xFE, 'A', 0, 0, 0}
+	tag = append(tag, make([]byte, 50-len(tag))...)
+	frames, n, err := ParseID3Tag(tag)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, n)
+	assert.Len(t, frames, 1)
+	assert.Equal(t, "A", frames[0].Text())
+
+	latin1 := ID3Frame{ID: "TPE1", Data: []byte{0x00, 'B', 0xE9, 0x00, 'C'}}
+	assert.Equal(t, "Bé\nC", latin1.Text())
+}
+
+func TestIsID3Stream(t *testing.T) {
+	assert.True(t, IsID3Stream(ElementaryStream{StreamType: StreamTypeMetadataPES, Descriptors: Descriptors(NewID3MetadataDescriptor())}))
+	assert.True(t, IsID3Stream(ElementaryStream{StreamType: StreamTypePrivatePES, Descriptors: Descriptors(&RegistrationDescriptor{FormatIdentifier: "ID3 "})}))
+	assert.False(t, IsID3Stream(ElementaryStream{StreamType: StreamTypeMetadataPES}))
+	klv := &MetadataDescriptor{MetadataFormat: MetadataFormat{ApplicationFormat: 0xFFFF, ApplicationFormatIdentifier: "KLVA", Format: 0xFF, FormatIdentifier: "KLVA"}}
+	assert.False(t, IsID3Stream(ElementaryStream{StreamType: StreamTypeMetadataPES, Descriptors: Descriptors(klv)}))
+}
@@ -0,0 +1,398 @@
+package mpegts
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	indexMagic   = "TSIX"
+	indexVersion = 2
+
+	// IndexPCRInterval is the minimum spacing, in stream time, between PCR positions recorded in an index.
+	IndexPCRInterval = time.Second
+
+	maxKeyframeScan = 64 * 1024 // Bytes of a PES searched for its first slice before giving up.
+	detectLength    = 64 * 1024 // Bytes examined to detect the packet format of a file.
+
+	maxIndexEntries = 1 << 24 // Keyframes or PCR positions an index may hold, days of all-intra video.
+	indexReadBatch  = 4096    // Entries allocated at a time while reading an index.
+)
+
+// IndexEntry locates a keyframe in a recording.
+type IndexEntry struct {
+	Offset int64         // Byte offset of the packet starting the PES that carries the keyframe.
+	PTS    PTS           // PTS of the keyframe.
+	PCR    PCR           // Last PCR seen before the keyframe.
+	Time   time.Duration // Stream time of the keyframe, measured by the PCR from the first PCR of the file.
+}
+
+// PCRPosition locates a PCR in a recording.
+type PCRPosition struct {
+	Offset int64
+	PCR    PCR
+	Time   time.Duration
+}
+
+// Index lists the keyframes and PCR positions of a recorded transport stream.
+type Index struct {
+	Format    PacketFormat
+	PID       uint16 // Video PID whose keyframes are indexed.
+	Keyframes []IndexEntry
+	PCRs      []PCRPosition
+
+	// Size and modification time of the indexed recording, when known, to detect a stale index.
+	Size    int64
+	ModTime time.Time
+}
+
+// IndexPath returns the path of the sidecar index of a recording.
+func IndexPath(path string) string {
+	return path + ".idx"
+}
+
+// KeyframeAt returns the last keyframe at or before stream time t, or the first keyframe when t precedes it.
+func (idx *Index) KeyframeAt(t time.Duration) (IndexEntry, error) {
+	if len(idx.Keyframes) == 0 {
+		return IndexEntry{}, ErrKeyframeNotFound
+	}
+	i := sort.Search(len(idx.Keyframes), func(i int) bool { return idx.Keyframes[i].Time > t })
+	if i > 0 {
+		i--
+	}
+	return idx.Keyframes[i], nil
+}
+
+// Keyframe returns the n-th keyframe of the recording.
+func (idx *Index) Keyframe(n int) (IndexEntry, error) {
+	if n < 0 || n >= len(idx.Keyframes) {
+		return IndexEntry{}, ErrKeyframeNotFound
+	}
+	return idx.Keyframes[n], nil
+}
+
+// Duration returns the stream time of the last PCR position.
+func (idx *Index) Duration() time.Duration {
+	if len(idx.PCRs) == 0 {
+		return 0
+	}
+	return idx.PCRs[len(idx.PCRs)-1].Time
+}
+
+// Matches reports whether the index was built from a recording of the given size and modification time.
+func (idx *Index) Matches(size int64, modTime time.Time) bool {
+	return idx.Size == size && idx.ModTime.Equal(modTime)
+}
+
+// indexHeader is the fixed part of the sidecar index file.
+type indexHeader struct {
+	Magic     [4]byte
+	Version   uint8
+	Format    uint8
+	PID       uint16
+	Keyframes uint32
+	PCRs      uint32
+	Size      int64
+	ModTime   int64 // Unix nanoseconds, zero when unknown.
+}
+
+// WriteTo writes the index in its sidecar file format.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	header := indexHeader{
+		Version:   indexVersion,
+		Format:    uint8(idx.Format),
+		PID:       idx.PID,
+		Keyframes: uint32(len(idx.Keyframes)),
+		PCRs:      uint32(len(idx.PCRs)),
+		Size:      idx.Size,
+	}
+	if !idx.ModTime.IsZero() {
+		header.ModTime = idx.ModTime.UnixNano()
+	}
+	copy(header.Magic[:], indexMagic)
+
+	cw := &countingWriter{w: w}
+	for _, v := range []interface{}{header, idx.Keyframes, idx.PCRs} {
+		if err := binary.Write(cw, binary.BigEndian, v); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// ReadIndex reads an index in its sidecar file format.
+func ReadIndex(r io.Reader) (*Index, error) {
+	var header indexHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, ErrInvalidIndex
+	}
+	if string(header.Magic[:]) != indexMagic || header.Version != indexVersion {
+		return nil, ErrInvalidIndex
+	}
+
+	if header.Keyframes > maxIndexEntries || header.PCRs > maxIndexEntries {
+		return nil, ErrInvalidIndex
+	}
+
+	idx := &Index{
+		Format: PacketFormat(header.Format),
+		PID:    header.PID,
+		Size:   header.Size,
+	}
+	if header.ModTime != 0 {
+		idx.ModTime = time.Unix(0, header.ModTime)
+	}
+	var err error
+	if idx.Keyframes, err = readEntries[IndexEntry](r, int(header.Keyframes)); err != nil {
+		return nil, err
+	}
+	if idx.PCRs, err = readEntries[PCRPosition](r, int(header.PCRs)); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// readEntries reads n fixed size entries. The slice grows in batches as entries arrive, so that a count
+// larger than the file does not allocate memory for entries that are not there.
+func readEntries[T any](r io.Reader, n int) ([]T, error) {
+	entries := make([]T, 0, min(n, indexReadBatch))
+	for len(entries) < n {
+		batch := make([]T, min(n-len(entries), indexReadBatch))
+		if err := binary.Read(r, binary.BigEndian, batch); err != nil {
+			return nil, ErrInvalidIndex
+		}
+		entries = append(entries, batch...)
+	}
+	return entries, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// BuildIndex reads a recording and indexes the keyframes of its first H.264 or HEVC stream.
+// The packet format of the recording is detected from its first bytes.
+func BuildIndex(r io.Reader) (*Index, error) {
+	br := bufio.NewReaderSize(r, detectLength)
+	head, err := br.Peek(detectLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	format, start, err := DetectPacketFormat(head, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := br.Discard(start); err != nil {
+		return nil, err
+	}
+
+	ib := NewIndexBuilder(format)
+	record := make([]byte, format.Size())
+	offset := int64(start)
+	for {
+		if _, err := io.ReadFull(br, record); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		ep := &EncodedPacket{}
+		copy(ep[:], record[format.syncOffset():])
+		if ep.IsMPEGTS() {
+			ib.Push(ep, offset)
+		}
+		offset += int64(len(record))
+	}
+	return ib.Index(), nil
+}
+
+// IndexBuilder builds an Index from the packets of a recording. It follows the PAT and PMT to find the
+// first H.264 or HEVC stream and its PCR PID.
+type IndexBuilder struct {
+	index    *Index
+	sections *SectionAssembler
+	pmtPIDs  map[uint16]bool
+	hevc     bool
+	pcrPID   uint16
+	found    bool // A video stream has been selected.
+	lastPCR  PCR
+	pcrTicks int64 // 27 MHz ticks from the first PCR to lastPCR, across wraps.
+	hasPCR   bool
+	lastTime time.Duration
+	pes      *pendingKeyframe
+}
+
+// pendingKeyframe is a video PES whose first slice has not been seen yet.
+type pendingKeyframe struct {
+	entry IndexEntry
+	data  []byte
+}
+
+// NewIndexBuilder creates a builder for a recording in the given packet format.
+func NewIndexBuilder(format PacketFormat) *IndexBuilder {
+	return &IndexBuilder{
+		index:    &Index{Format: format},
+		sections: NewSectionAssembler(),
+		pmtPIDs:  make(map[uint16]bool),
+	}
+}
+
+// Push adds the packet found at the given byte offset of the recording.
+func (ib *IndexBuilder) Push(ep *EncodedPacket, offset int64) {
+	pid := ep.GetPID()
+
+	if pid == PATPID || ib.pmtPIDs[pid] {
+		ib.pushSection(ep)
+		return
+	}
+
+	if ib.found && pid == ib.pcrPID {
+		if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.HasPCR {
+			ib.pushPCR(af.PCR, offset)
+		}
+	}
+
+	if !ib.found || pid != ib.index.PID {
+		return
+	}
+
+	start := payloadOffset(ep)
+	if start < 0 || start >= packetLength {
+		return
+	}
+	payload := ep[start:]
+
+	if ep.GetPUSI() {
+		ib.pes = nil
+		pts, body, ok := parsePESHeader(payload)
+		if !ok {
+			return
+		}
+		ib.pes = &pendingKeyframe{
+			entry: IndexEntry{Offset: offset, PTS: PTS(pts), PCR: ib.lastPCR, Time: ib.lastTime},
+		}
+		payload = body
+	}
+	if ib.pes == nil {
+		return
+	}
+
+	ib.pes.data = append(ib.pes.data, payload...)
+	keyframe, decided := scanKeyframe(ib.pes.data, ib.hevc)
+	switch {
+	case decided && keyframe:
+		ib.index.Keyframes = append(ib.index.Keyframes, ib.pes.entry)
+		ib.pes = nil
+	case decided || len(ib.pes.data) > maxKeyframeScan:
+		ib.pes = nil
+	}
+}
+
+// Index returns the index built so far.
+func (ib *IndexBuilder) Index() *Index {
+	return ib.index
+}
+
+// pushSection follows the PAT and PMTs until a video stream is selected.
+func (ib *IndexBuilder) pushSection(ep *EncodedPacket) {
+	if ib.found {
+		return
+	}
+	sections, _ := ib.sections.Push(ep)
+	for _, s := range sections {
+		switch s.TableID {
+		case PATTableID:
+			pat, err := ParsePAT(s)
+			if err != nil {
+				continue
+			}
+			for _, program := range pat.ProgramNumbers() {
+				pid, _ := pat.PMTPID(program)
+				ib.pmtPIDs[pid] = true
+			}
+		case PMTTableID:
+			pmt, err := ParsePMT(s)
+			if err != nil {
+				continue
+			}
+			for _, es := range pmt.Streams {
+				if es.StreamType == StreamTypeH264 || es.StreamType == StreamTypeHEVC {
+					ib.index.PID = es.ElementaryPID
+					ib.hevc = es.StreamType == StreamTypeHEVC
+					ib.pcrPID = pmt.PCRPID
+					ib.found = true
+					return
+				}
+			}
+		}
+	}
+}
+
+// pushPCR records the stream time of a PCR, unwrapping it across the rollover.
+func (ib *IndexBuilder) pushPCR(pcr PCR, offset int64) {
+	if !ib.hasPCR {
+		ib.lastPCR, ib.hasPCR = pcr, true
+		ib.index.PCRs = append(ib.index.PCRs, PCRPosition{Offset: offset, PCR: pcr})
+		return
+	}
+	ib.pcrTicks += pcr.Sub(ib.lastPCR)
+	ib.lastPCR = pcr
+	ib.lastTime = pcrDuration(ib.pcrTicks)
+
+	last := ib.index.PCRs[len(ib.index.PCRs)-1]
+	if ib.lastTime-last.Time >= IndexPCRInterval {
+		ib.index.PCRs = append(ib.index.PCRs, PCRPosition{Offset: offset, PCR: pcr, Time: ib.lastTime})
+	}
+}
+
+// parsePESHeader returns the PTS of a PES packet from its first packet payload and the bytes following
+// the header.
+func parsePESHeader(data []byte) (uint64, []byte, bool) {
+	if len(data) < pesFixedHeaderLen+pesOptionalFixedLen || data[0] != 0x00 || data[1] != 0x00 || data[2] != 0x01 {
+		return 0, nil, false
+	}
+	headerEnd := pesFixedHeaderLen + pesOptionalFixedLen + int(data[8])
+	if len(data) < headerEnd {
+		return 0, nil, false
+	}
+	var pts uint64
+	if data[7]&0x80 != 0 && headerEnd >= pesFixedHeaderLen+pesOptionalFixedLen+timestampLength {
+		pts = decodeTimestamp(data[pesFixedHeaderLen+pesOptionalFixedLen:])
+	}
+	return pts, data[headerEnd:], true
+}
+
+// scanKeyframe searches elementary stream data for its first slice NAL unit. decided reports whether a
+// slice was found, and keyframe whether it belongs to an IDR picture.
+func scanKeyframe(data []byte, hevc bool) (keyframe, decided bool) {
+	for i := 0; i+3 < len(data); i++ {
+		if data[i] != 0x00 || data[i+1] != 0x00 || data[i+2] != 0x01 {
+			continue
+		}
+		header := data[i+3]
+		if hevc {
+			nalType := (header >> 1) & 0x3F
+			if nalType < 32 { // VCL NAL unit.
+				return nalType == 19 || nalType == 20, true // IDR_W_RADL, IDR_N_LP.
+			}
+		} else {
+			nalType := header & 0x1F
+			if nalType >= 1 && nalType <= 5 { // Coded slice.
+				return nalType == 5, true
+			}
+		}
+		i += 2
+	}
+	return false, false
+}
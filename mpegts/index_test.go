@@ -0,0 +1,167 @@
+package mpegts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRecording builds a single program recording with 25 fps H.264 video carrying a PCR on every frame.
+// Every gop-th frame is an IDR picture preceded by parameter sets larger than one packet.
+func testRecording(t *testing.T, frames, gop int, st StreamType) []byte {
+	var buf bytes.Buffer
+	write := func(packets EncodedPackets) {
+		for _, ep := range packets {
+			buf.Write(ep[:])
+		}
+	}
+
+	pat := NewPAT(1, 0)
+	pat.Programs[1] = 0x1000
+	packets, _ := pat.Encode(0)
+	write(packets)
+
+	pmt := &PMT{ProgramNumber: 1, CurrentNext: true, PCRPID: 0x100, Streams: []ElementaryStream{{StreamType: st, ElementaryPID: 0x100}}}
+	packets, _, err := pmt.Encode(0x1000, 0)
+	assert.NoError(t, err)
+	write(packets)
+
+	pp := NewPESPacketizer(0x100)
+	for i := 0; i < frames; i++ {
+		var es []byte
+		slice := []byte{0x00, 0x00, 0x01, 0x01} // H.264 non-IDR slice.
+		if st == StreamTypeHEVC {
+			slice = []byte{0x00, 0x00, 0x01, 0x02, 0x01} // TRAIL_R.
+		}
+		if i%gop == 0 {
+			es = append(es, 0x00, 0x00, 0x01, 0x67) // SPS.
+			es = append(es, make([]byte, 300)...)
+			slice = []byte{0x00, 0x00, 0x01, 0x65} // IDR slice.
+			if st == StreamTypeHEVC {
+				slice = []byte{0x00, 0x00, 0x01, 0x26, 0x01} // IDR_W_RADL.
+			}
+		}
+		es = append(es, slice...)
+		es = append(es, make([]byte, 500)...)
+
+		pes := &PESPacket{StreamID: StreamIDVideoBase, HasPTS: true, PTS: PTS(i) * 3600, Payload: es}
+		af := &AdaptationField{RandomAccess: i%gop == 0, HasPCR: true, PCR: PCR(i) * 1080000}
+		packets, err := pp.Packetize(pes, af)
+		assert.NoError(t, err)
+		write(packets)
+	}
+	return buf.Bytes()
+}
+
+func TestBuildIndex(t *testing.T) {
+	for _, st := range []StreamType{StreamTypeH264, StreamTypeHEVC} {
+		data := testRecording(t, 100, 25, st)
+
+		idx, err := BuildIndex(bytes.NewReader(data))
+		assert.NoError(t, err)
+		assert.Equal(t, FormatTS, idx.Format)
+		assert.Equal(t, uint16(0x100), idx.PID)
+		assert.Len(t, idx.Keyframes, 4)
+		for i, kf := range idx.Keyframes {
+			assert.Equal(t, time.Duration(i)*time.Second, kf.Time)
+			assert.Equal(t, PTS(i*25*3600), kf.PTS)
+			assert.Equal(t, byte(0x47), data[kf.Offset])
+
+			ep := &EncodedPacket{}
+			copy(ep[:], data[kf.Offset:])
+			assert.True(t, ep.GetPUSI())
+			assert.Equal(t, uint16(0x100), ep.GetPID())
+		}
+		assert.Len(t, idx.PCRs, 4)
+		assert.Equal(t, 3*time.Second, idx.Duration())
+	}
+}
+
+func TestBuildIndexM2TS(t *testing.T) {
+	data := testRecording(t, 50, 25, StreamTypeH264)
+	var packets EncodedPackets
+	for i := 0; i < len(data); i += packetLength {
+		ep := &EncodedPacket{}
+		copy(ep[:], data[i:])
+		packets = append(packets, ep)
+	}
+	m2ts := NewM2TSEncoder(10000000).Encode(packets)
+
+	idx, err := BuildIndex(bytes.NewReader(m2ts))
+	assert.NoError(t, err)
+	assert.Equal(t, FormatM2TS, idx.Format)
+	assert.Len(t, idx.Keyframes, 2)
+	assert.Equal(t, int64(0), idx.Keyframes[0].Offset%m2tsPacketLength)
+	assert.Equal(t, byte(0x47), m2ts[idx.Keyframes[1].Offset+m2tsHeaderLength])
+}
+
+func TestIndexLookup(t *testing.T) {
+	idx, err := BuildIndex(bytes.NewReader(testRecording(t, 100, 25, StreamTypeH264)))
+	assert.NoError(t, err)
+
+	kf, err := idx.KeyframeAt(2500 * time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, kf.Time)
+
+	kf, err = idx.KeyframeAt(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Second, kf.Time)
+
+	kf, err = idx.KeyframeAt(0)
+	assert.NoError(t, err)
+	assert.Equal(t, idx.Keyframes[0], kf)
+
+	kf, err = idx.Keyframe(1)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, kf.Time)
+
+	_, err = idx.Keyframe(4)
+	assert.ErrorIs(t, err, ErrKeyframeNotFound)
+	_, err = (&Index{}).KeyframeAt(0)
+	assert.ErrorIs(t, err, ErrKeyframeNotFound)
+}
+
+func TestIndexSidecarRoundTrip(t *testing.T) {
+	idx, err := BuildIndex(bytes.NewReader(testRecording(t, 100, 25, StreamTypeH264)))
+	assert.NoError(t, err)
+	idx.Size = 12345
+	idx.ModTime = time.Unix(1700000000, 123456789)
+
+	var buf bytes.Buffer
+	n, err := idx.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	read, err := ReadIndex(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, idx, read)
+	assert.True(t, read.Matches(12345, time.Unix(1700000000, 123456789).UTC()))
+	assert.False(t, read.Matches(12346, idx.ModTime))
+	assert.False(t, read.Matches(12345, idx.ModTime.Add(time.Second)))
+
+	_, err = ReadIndex(bytes.NewReader([]byte("TSIX")))
+	assert.ErrorIs(t, err, ErrInvalidIndex)
+
+	// Counts the file cannot hold are refused before anything is allocated for them.
+	for _, count := range []uint32{0xFFFFFFFF, 1000000} {
+		header := []byte("TSIX")
+		header = append(header, indexVersion, uint8(FormatTS), 0x01, 0x00)
+		header = binary.BigEndian.AppendUint32(header, count)
+		header = binary.BigEndian.AppendUint32(header, 0)
+		header = append(header, make([]byte, 16)...) // Unknown size and modification time.
+		_, err = ReadIndex(bytes.NewReader(header))
+		assert.ErrorIs(t, err, ErrInvalidIndex)
+	}
+	assert.Equal(t, "/tmp/rec.ts.idx", IndexPath("/tmp/rec.ts"))
+}
+
+func TestIndexPCRWrap(t *testing.T) {
+	ib := NewIndexBuilder(FormatTS)
+	ib.pushPCR(PCRWrap-PCRClock, 0)
+	ib.pushPCR(27000000, 188)
+	assert.Equal(t, 2*time.Second, ib.lastTime)
+	assert.Len(t, ib.Index().PCRs, 2)
+}
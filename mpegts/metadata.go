@@ -0,0 +1,280 @@
+package mpegts
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMetadataLead is how far ahead of its PTS, on the program clock, a metadata PES is sent.
+const DefaultMetadataLead = 500 * time.Millisecond
+
+// TimedMetadata is an ID3 tag presented at a PTS.
+type TimedMetadata struct {
+	Program uint16 // program_number; zero when read from a PID outside any known program.
+	PID     uint16
+	PTS     PTS
+	Frames  []ID3Frame
+}
+
+// MetadataInserter adds an ID3 timed metadata stream to a program of a transport stream. It rewrites
+// the PMT of the program to announce the stream, and sends each tag handed to Insert as a PES packet
+// once the program clock comes within the lead time of its PTS. Metadata packets take the place of null
+// packets where the stream has them, and are otherwise inserted after the next PCR packet.
+type MetadataInserter struct {
+	mu         sync.Mutex
+	program    uint16
+	pid        uint16
+	lead       time.Duration
+	sections   *SectionAssembler
+	pmtPID     uint16 // Zero until the PAT names the program.
+	pmtCC      uint8
+	pcrPID     uint16
+	hasPCRPID  bool
+	pcr        PCR
+	hasPCR     bool
+	packetizer *PESPacketizer
+	queue      []TimedMetadata // Waiting for the clock, sorted by PTS.
+	ready      EncodedPackets  // Waiting for a null packet.
+}
+
+// NewMetadataInserter creates an inserter of an ID3 stream on pid into a program. The PID must not be
+// in use in the transport stream. A lead of zero uses DefaultMetadataLead.
+func NewMetadataInserter(program, pid uint16, lead time.Duration) *MetadataInserter {
+	if lead <= 0 {
+		lead = DefaultMetadataLead
+	}
+	return &MetadataInserter{
+		program:    program,
+		pid:        pid,
+		lead:       lead,
+		sections:   NewSectionAssembler(),
+		packetizer: NewPESPacketizer(pid),
+	}
+}
+
+// Insert queues an ID3 tag for presentation at pts. Tags may be queued in any order; tags whose PTS
+// has already passed are sent at the next PCR.
+func (mi *MetadataInserter) Insert(pts PTS, frames ...ID3Frame) error {
+	if len(frames) == 0 {
+		return ErrInvalidID3
+	}
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	tm := TimedMetadata{Program: mi.program, PID: mi.pid, PTS: pts, Frames: frames}
+	i := sort.Search(len(mi.queue), func(i int) bool { return pts.Before(mi.queue[i].PTS) })
+	mi.queue = append(mi.queue, TimedMetadata{})
+	copy(mi.queue[i+1:], mi.queue[i:])
+	mi.queue[i] = tm
+	return nil
+}
+
+// Pending returns the number of tags waiting for the program clock.
+func (mi *MetadataInserter) Pending() int {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	return len(mi.queue)
+}
+
+// Push passes a packet through the inserter and returns the packets to send in its place: the packet
+// itself, the rewritten PMT when it completes a PMT of the program, or metadata packets.
+func (mi *MetadataInserter) Push(ep *EncodedPacket) (EncodedPackets, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	pid := ep.GetPID()
+	switch {
+	case pid == PATPID:
+		sections, err := mi.sections.Push(ep)
+		if pat, perr := ParsePAT(sections...); perr == nil {
+			if pmtPID, perr := pat.PMTPID(mi.program); perr == nil && pmtPID != mi.pmtPID {
+				if mi.pmtPID != 0 {
+					mi.sections.Reset(mi.pmtPID)
+				}
+				mi.pmtPID = pmtPID
+			}
+		}
+		return EncodedPackets{ep}, err
+	case mi.pmtPID != 0 && pid == mi.pmtPID:
+		return mi.rewritePMT(ep)
+	case ep.IsNullPacket() && len(mi.ready) > 0:
+		next := mi.ready[0]
+		mi.ready = mi.ready[1:]
+		return EncodedPackets{next}, nil
+	}
+
+	packets := EncodedPackets{ep}
+	if mi.hasPCRPID && pid == mi.pcrPID {
+		if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.HasPCR {
+			packets = append(packets, mi.ready...) // No null packet came along since the last PCR.
+			mi.ready = nil
+			mi.pcr, mi.hasPCR = af.PCR, true
+			if err := mi.schedule(); err != nil {
+				return packets, err
+			}
+		}
+	}
+	return packets, nil
+}
+
+// rewritePMT consumes a packet of the PMT PID and re-sends the completed sections, with the metadata
+// stream added to the PMT of the program. The version is advanced so receivers that saw the original
+// PMT pick up the change.
+func (mi *MetadataInserter) rewritePMT(ep *EncodedPacket) (EncodedPackets, error) {
+	sections, err := mi.sections.Push(ep)
+	if len(sections) == 0 {
+		return nil, err
+	}
+
+	data := make([][]byte, 0, len(sections))
+	for _, s := range sections {
+		if s.TableID == PMTTableID && s.TableIDExtension == mi.program {
+			pmt, perr := ParsePMT(s)
+			if perr == nil {
+				mi.pcrPID, mi.hasPCRPID = pmt.PCRPID, true
+				mi.addStream(pmt)
+				if rewritten, serr := pmt.Section(); serr == nil {
+					s = rewritten
+				} else if err == nil {
+					err = serr
+				}
+			} else if err == nil {
+				err = perr
+			}
+		}
+		data = append(data, s.Data)
+	}
+
+	var packets EncodedPackets
+	packets, mi.pmtCC = PacketizeSections(mi.pmtPID, mi.pmtCC, data...)
+	return packets, err
+}
+
+// addStream adds the metadata stream and pointer to a PMT of the program.
+func (mi *MetadataInserter) addStream(pmt *PMT) {
+	pmt.Version = (pmt.Version + 1) & 0x1F
+	if _, ok := FindDescriptor(pmt.ProgramInfo, MetadataPointerDescriptorTag); !ok {
+		pmt.ProgramInfo = append(pmt.ProgramInfo, NewID3MetadataPointerDescriptor(mi.program).Descriptor())
+	}
+	if _, err := pmt.Stream(mi.pid); err == nil {
+		return
+	}
+	pmt.Streams = append(pmt.Streams, ElementaryStream{
+		StreamType:    StreamTypeMetadataPES,
+		ElementaryPID: mi.pid,
+		Descriptors:   Descriptors(NewID3MetadataDescriptor()),
+	})
+}
+
+// schedule packetizes the tags due on the program clock.
+func (mi *MetadataInserter) schedule() error {
+	horizon := mi.pcr.Base().Add(mi.lead)
+	for len(mi.queue) > 0 && !mi.queue[0].PTS.After(horizon) {
+		tm := mi.queue[0]
+		mi.queue = mi.queue[1:]
+		pes := &PESPacket{
+			StreamID:      StreamIDPrivateStream1,
+			DataAlignment: true,
+			HasPTS:        true,
+			PTS:           tm.PTS,
+			Payload:       EncodeID3Tag(tm.Frames...),
+		}
+		packets, err := mi.packetizer.Packetize(pes, nil)
+		if err != nil {
+			return err
+		}
+		mi.ready = append(mi.ready, packets...)
+	}
+	return nil
+}
+
+// MetadataReader reads back the ID3 timed metadata of a transport stream. It finds the ID3 streams
+// announced by the PMTs and parses the tags of their PES packets.
+type MetadataReader struct {
+	sections *SectionAssembler
+	pes      *PESAssembler
+	pmtPIDs  map[uint16]bool
+	streams  map[uint16]uint16 // ID3 PID -> program_number.
+}
+
+// NewMetadataReader creates a reader that discovers ID3 streams from the PAT and PMTs.
+func NewMetadataReader() *MetadataReader {
+	return &MetadataReader{
+		sections: NewSectionAssembler(),
+		pes:      NewPESAssembler(),
+		pmtPIDs:  make(map[uint16]bool),
+		streams:  make(map[uint16]uint16),
+	}
+}
+
+// AddPID reads ID3 tags from a PID without waiting for a PMT to announce it.
+func (mr *MetadataReader) AddPID(pid uint16) {
+	if _, ok := mr.streams[pid]; !ok {
+		mr.streams[pid] = 0
+	}
+}
+
+// PIDs returns the ID3 PIDs found so far in ascending order.
+func (mr *MetadataReader) PIDs() []uint16 {
+	pids := make([]uint16, 0, len(mr.streams))
+	for pid := range mr.streams {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids
+}
+
+// Push feeds a packet to the reader and returns the tags completed by it.
+func (mr *MetadataReader) Push(ep *EncodedPacket) ([]TimedMetadata, error) {
+	pid := ep.GetPID()
+	if pid == PATPID || mr.pmtPIDs[pid] {
+		sections, err := mr.sections.Push(ep)
+		for _, s := range sections {
+			mr.addSection(s)
+		}
+		return nil, err
+	}
+
+	program, ok := mr.streams[pid]
+	if !ok {
+		return nil, nil
+	}
+	packets, err := mr.pes.Push(ep)
+	var metadata []TimedMetadata
+	for _, p := range packets {
+		if !p.HasPTS {
+			continue
+		}
+		frames, _, perr := ParseID3Tag(p.Payload)
+		if perr != nil {
+			if err == nil {
+				err = perr
+			}
+			continue
+		}
+		metadata = append(metadata, TimedMetadata{Program: program, PID: pid, PTS: p.PTS, Frames: frames})
+	}
+	return metadata, err
+}
+
+// addSection learns PMT PIDs from the PAT and ID3 streams from the PMTs.
+func (mr *MetadataReader) addSection(s *Section) {
+	switch s.TableID {
+	case PATTableID:
+		if pat, err := ParsePAT(s); err == nil {
+			for program, pid := range pat.Programs {
+				if program != 0 {
+					mr.pmtPIDs[pid] = true
+				}
+			}
+		}
+	case PMTTableID:
+		if pmt, err := ParsePMT(s); err == nil {
+			for _, es := range pmt.Streams {
+				if IsID3Stream(es) {
+					mr.streams[es.ElementaryPID] = pmt.ProgramNumber
+				}
+			}
+		}
+	}
+}
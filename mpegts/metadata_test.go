@@ -0,0 +1,113 @@
+package mpegts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// insertMetadata runs generated packets through an inserter, dropping null packets from the input
+// when withNulls is false.
+func insertMetadata(t *testing.T, mi *MetadataInserter, n int, withNulls bool) (in int, out EncodedPackets) {
+	gen, err := NewStreamGenerator(DefaultGeneratorConfig(1))
+	assert.NoError(t, err)
+	for _, ep := range gen.Generate(n) {
+		if ep.IsNullPacket() && !withNulls {
+			continue
+		}
+		in++
+		packets, err := mi.Push(ep)
+		assert.NoError(t, err)
+		out = append(out, packets...)
+	}
+	return in, out
+}
+
+func TestMetadataInserter(t *testing.T) {
+	for _, withNulls := range []bool{true, false} {
+		mi := NewMetadataInserter(1, 0x300, 0)
+		title := NewID3TextFrame("TIT2", "Song")
+		beacon := NewID3PRIVFrame("com.example.ads", []byte{0x01, 0x02})
+		assert.NoError(t, mi.Insert(NewPTS(180000), title))
+		assert.NoError(t, mi.Insert(NewPTS(90000), beacon, title))
+		assert.NoError(t, mi.Insert(NewPTS(0), beacon)) // Already due at the first PCR.
+		assert.ErrorIs(t, mi.Insert(NewPTS(0)), ErrInvalidID3)
+		assert.Equal(t, 3, mi.Pending())
+
+		in, out := insertMetadata(t, mi, 5000, withNulls) // Three seconds.
+		assert.Zero(t, mi.Pending())
+		metadataPackets := 3 // One per tag.
+		if withNulls {
+			assert.Less(t, len(out), in+metadataPackets, "metadata replaces null packets")
+		} else {
+			assert.Len(t, out, in+metadataPackets, "metadata is inserted after PCR packets")
+		}
+
+		// Read the tags back, checking each was sent within the lead time of its PTS.
+		mr := NewMetadataReader()
+		sa := NewSectionAssembler()
+		var pmt *PMT
+		var pcr PCR
+		var got []TimedMetadata
+		for _, ep := range out {
+			switch ep.GetPID() {
+			case 0x1000:
+				sections, err := sa.Push(ep)
+				assert.NoError(t, err)
+				if parsed, err := ParsePMT(sections...); err == nil {
+					pmt = parsed
+				}
+			case 0x100:
+				if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.HasPCR {
+					pcr = af.PCR
+				}
+			case 0x300:
+				if pts, ok := ep.GetPTS(); ok && pts != 0 {
+					lead := pts.Since(pcr.Base())
+					assert.True(t, lead > 0 && lead <= DefaultMetadataLead, "sent %v ahead", lead)
+				}
+			}
+			tm, err := mr.Push(ep)
+			assert.NoError(t, err)
+			got = append(got, tm...)
+		}
+
+		assert.Equal(t, []TimedMetadata{
+			{Program: 1, PID: 0x300, PTS: 0, Frames: []ID3Frame{beacon}},
+			{Program: 1, PID: 0x300, PTS: 90000, Frames: []ID3Frame{beacon, title}},
+			{Program: 1, PID: 0x300, PTS: 180000, Frames: []ID3Frame{title}},
+		}, got)
+		assert.Equal(t, []uint16{0x300}, mr.PIDs())
+
+		if assert.NotNil(t, pmt) {
+			assert.Equal(t, uint8(1), pmt.Version, "version is advanced")
+			es, err := pmt.Stream(0x300)
+			assert.NoError(t, err)
+			assert.True(t, IsID3Stream(*es))
+			_, ok := FindDescriptor(pmt.ProgramInfo, MetadataPointerDescriptorTag)
+			assert.True(t, ok)
+			assert.Len(t, pmt.Streams, 4, "existing streams are kept")
+		}
+	}
+}
+
+func TestMetadataReaderPID(t *testing.T) {
+	// A PID named by hand is read without a PMT.
+	pp := NewPESPacketizer(0x400)
+	packets, err := pp.Packetize(&PESPacket{StreamID: StreamIDPrivateStream1, HasPTS: true, PTS: 1234, Payload: EncodeID3Tag(NewID3TextFrame("TIT2", "x"))}, nil)
+	assert.NoError(t, err)
+
+	mr := NewMetadataReader()
+	mr.AddPID(0x400)
+	var got []TimedMetadata
+	for _, ep := range packets {
+		tm, err := mr.Push(ep)
+		assert.NoError(t, err)
+		got = append(got, tm...)
+	}
+	assert.Len(t, got, 1)
+	assert.Equal(t, PTS(1234), got[0].PTS)
+	assert.Equal(t, "x", got[0].Frames[0].Text())
+	assert.Equal(t, 500*time.Millisecond, DefaultMetadataLead)
+}
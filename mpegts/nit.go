@@ -0,0 +1,186 @@
+package mpegts
+
+import "encoding/binary"
+
+const (
+	NITPID           = 0x0010 // PID carrying the NIT.
+	NITActualTableID = 0x40   // network_information_section for the actual network.
+	NITOtherTableID  = 0x41   // network_information_section for other networks.
+
+	nitTransportStreamLength = 6 // Fixed part of each transport stream loop entry.
+)
+
+// NIT represents a DVB Network Information Table.
+type NIT struct {
+	Actual             bool // True for the actual network (table_id 0x40), false for other (0x41).
+	NetworkID          uint16
+	Version            uint8
+	CurrentNext        bool
+	NetworkDescriptors []Descriptor
+	TransportStreams   []NITTransportStream
+}
+
+// NITTransportStream describes one entry of the NIT transport stream loop.
+type NITTransportStream struct {
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Descriptors       []Descriptor
+}
+
+// NetworkName returns the name carried in the network_name_descriptor, if any.
+func (nit *NIT) NetworkName() (string, bool) {
+	d, ok := FindDescriptor(nit.NetworkDescriptors, NetworkNameDescriptorTag)
+	if !ok {
+		return "", false
+	}
+	return decodeDVBString(d.Data), true
+}
+
+// SetNetworkName replaces the network_name_descriptor with one carrying name.
+func (nit *NIT) SetNetworkName(name string) {
+	d := (&NetworkNameDescriptor{Name: name}).Descriptor()
+	for i := range nit.NetworkDescriptors {
+		if nit.NetworkDescriptors[i].Tag == NetworkNameDescriptorTag {
+			nit.NetworkDescriptors[i] = d
+			return
+		}
+	}
+	nit.NetworkDescriptors = append(nit.NetworkDescriptors, d)
+}
+
+// ParseNIT builds a NIT from one or more reassembled sections of the same sub-table.
+func ParseNIT(sections ...*Section) (*NIT, error) {
+	var nit *NIT
+	for _, s := range sections {
+		if (s.TableID != NITActualTableID && s.TableID != NITOtherTableID) || !s.SectionSyntaxIndicator {
+			continue
+		}
+
+		if nit == nil {
+			nit = &NIT{
+				Actual:      s.TableID == NITActualTableID,
+				NetworkID:   s.TableIDExtension,
+				Version:     s.Version,
+				CurrentNext: s.CurrentNext,
+			}
+		} else if s.TableIDExtension != nit.NetworkID || s.Version != nit.Version {
+			return nil, ErrInvalidSection
+		}
+
+		body := s.Body()
+		if len(body) < 2 {
+			return nil, ErrInvalidSection
+		}
+		length := int(binary.BigEndian.Uint16(body[0:2]) & 0x0FFF)
+		if len(body) < 2+length+2 {
+			return nil, ErrInvalidSection
+		}
+		descriptors, err := ParseDescriptors(body[2 : 2+length])
+		if err != nil {
+			return nil, err
+		}
+		nit.NetworkDescriptors = append(nit.NetworkDescriptors, descriptors...)
+
+		body = body[2+length:]
+		loopLength := int(binary.BigEndian.Uint16(body[0:2]) & 0x0FFF)
+		if len(body) < 2+loopLength {
+			return nil, ErrInvalidSection
+		}
+		loop := body[2 : 2+loopLength]
+		for len(loop) > 0 {
+			if len(loop) < nitTransportStreamLength {
+				return nil, ErrInvalidSection
+			}
+			length := int(binary.BigEndian.Uint16(loop[4:6]) & 0x0FFF)
+			if len(loop) < nitTransportStreamLength+length {
+				return nil, ErrInvalidSection
+			}
+			descriptors, err := ParseDescriptors(loop[nitTransportStreamLength : nitTransportStreamLength+length])
+			if err != nil {
+				return nil, err
+			}
+			nit.TransportStreams = append(nit.TransportStreams, NITTransportStream{
+				TransportStreamID: binary.BigEndian.Uint16(loop[0:2]),
+				OriginalNetworkID: binary.BigEndian.Uint16(loop[2:4]),
+				Descriptors:       descriptors,
+			})
+			loop = loop[nitTransportStreamLength+length:]
+		}
+	}
+
+	if nit == nil {
+		return nil, ErrTableNotFound
+	}
+	return nit, nil
+}
+
+// Sections encodes the NIT, splitting the transport stream loop across sections as needed.
+// The network descriptors are carried in the first section. It returns ErrInvalidDescriptor if a
+// descriptor is too long to encode.
+func (nit *NIT) Sections() ([]*Section, error) {
+	networkDescriptors, err := EncodeDescriptors(nit.NetworkDescriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([][]byte, len(nit.TransportStreams))
+	for i, ts := range nit.TransportStreams {
+		descriptors, err := EncodeDescriptors(ts.Descriptors)
+		if err != nil {
+			return nil, err
+		}
+		entry := make([]byte, nitTransportStreamLength, nitTransportStreamLength+len(descriptors))
+		binary.BigEndian.PutUint16(entry[0:2], ts.TransportStreamID)
+		binary.BigEndian.PutUint16(entry[2:4], ts.OriginalNetworkID)
+		binary.BigEndian.PutUint16(entry[4:6], 0xF000|uint16(len(descriptors))&0x0FFF)
+		entries[i] = append(entry, descriptors...)
+	}
+
+	tableID := uint8(NITOtherTableID)
+	if nit.Actual {
+		tableID = NITActualTableID
+	}
+
+	// Both loop length fields are present in every section.
+	room := maxPSISectionLength - (longSectionHeaderLen - sectionHeaderLength) - crcLength - 4
+	groups, _ := packEntries(entries, room-len(networkDescriptors))
+	sections := make([]*Section, len(groups))
+	for i, group := range groups {
+		var descriptors []byte
+		if i == 0 {
+			descriptors = networkDescriptors
+		}
+
+		body := make([]byte, 2, 4+len(descriptors)+len(group))
+		binary.BigEndian.PutUint16(body[0:2], 0xF000|uint16(len(descriptors))&0x0FFF)
+		body = append(body, descriptors...)
+		body = binary.BigEndian.AppendUint16(body, 0xF000|uint16(len(group))&0x0FFF)
+		body = append(body, group...)
+
+		s := &Section{
+			PID:                    NITPID,
+			TableID:                tableID,
+			SectionSyntaxIndicator: true,
+			PrivateIndicator:       true, // reserved_future_use.
+			TableIDExtension:       nit.NetworkID,
+			Version:                nit.Version,
+			CurrentNext:            nit.CurrentNext,
+			SectionNumber:          uint8(i),
+			LastSectionNumber:      uint8(len(groups) - 1),
+		}
+		s.Marshal(body)
+		sections[i] = s
+	}
+	return sections, nil
+}
+
+// Encode packetizes the NIT onto the NIT PID starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (nit *NIT) Encode(cc uint8) (EncodedPackets, uint8, error) {
+	sections, err := nit.Sections()
+	if err != nil {
+		return nil, cc, err
+	}
+	packets, next := PacketizeSections(NITPID, cc, sectionData(sections)...)
+	return packets, next, nil
+}
@@ -0,0 +1,76 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNITRoundTrip(t *testing.T) {
+	nit := &NIT{Actual: true, NetworkID: 0x3001, Version: 1, CurrentNext: true}
+	nit.SetNetworkName("tribd network")
+	nit.TransportStreams = []NITTransportStream{
+		{TransportStreamID: 1, OriginalNetworkID: 0x233A, Descriptors: []Descriptor{{Tag: 0x41, Data: []byte{0x00, 0x01, 0x01}}}},
+		{TransportStreamID: 2, OriginalNetworkID: 0x233A},
+	}
+
+	packets, cc, err := nit.Encode(5)
+	assert.NoError(t, err)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, uint8(6), cc)
+	assert.Equal(t, uint16(NITPID), packets[0].GetPID())
+
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+	assert.Equal(t, uint8(NITActualTableID), sections[0].TableID)
+
+	parsed, err := ParseNIT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x3001), parsed.NetworkID)
+	assert.Equal(t, nit.TransportStreams[0], parsed.TransportStreams[0])
+	assert.Equal(t, uint16(2), parsed.TransportStreams[1].TransportStreamID)
+	assert.Empty(t, parsed.TransportStreams[1].Descriptors)
+
+	name, ok := parsed.NetworkName()
+	assert.True(t, ok)
+	assert.Equal(t, "tribd network", name)
+
+	nit.SetNetworkName("renamed")
+	assert.Len(t, nit.NetworkDescriptors, 1)
+}
+
+func TestNITMultipleSections(t *testing.T) {
+	nit := &NIT{Actual: true, NetworkID: 1, CurrentNext: true}
+	nit.SetNetworkName("tribd")
+	for i := 0; i < 200; i++ {
+		nit.TransportStreams = append(nit.TransportStreams, NITTransportStream{
+			TransportStreamID: uint16(i),
+			OriginalNetworkID: 1,
+			Descriptors:       []Descriptor{{Tag: 0x41, Data: []byte{0x00, 0x01, 0x01}}},
+		})
+	}
+
+	sections, err := nit.Sections()
+	assert.NoError(t, err)
+	assert.Greater(t, len(sections), 1)
+	for _, s := range sections {
+		assert.LessOrEqual(t, len(s.Data), sectionHeaderLength+maxPSISectionLength)
+	}
+
+	packets, _, err := nit.Encode(0)
+	assert.NoError(t, err)
+	parsed, err := ParseNIT(reassemble(t, packets)...)
+	assert.NoError(t, err)
+	assert.Equal(t, nit.TransportStreams, parsed.TransportStreams)
+	assert.Equal(t, nit.NetworkDescriptors, parsed.NetworkDescriptors)
+}
+
+func TestParseNITErrors(t *testing.T) {
+	_, err := ParseNIT()
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	s := &Section{TableID: NITActualTableID, SectionSyntaxIndicator: true}
+	s.Marshal([]byte{0xF0, 0x05, 0x40})
+	_, err = ParseNIT(s)
+	assert.ErrorIs(t, err, ErrInvalidSection)
+}
@@ -20,6 +20,18 @@ var (
 	ErrProgramNotFound         = errors.New("mpegts: program not found")
 	ErrStreamNotFound          = errors.New("mpegts: stream not found")
 	ErrUnsupportedStream       = errors.New("mpegts: unsupported stream type")
+	ErrInvalidSection          = errors.New("mpegts: invalid section")
+	ErrCRCMismatch             = errors.New("mpegts: section CRC mismatch")
+	ErrInvalidPES              = errors.New("mpegts: invalid PES packet")
+	ErrPESTooLong              = errors.New("mpegts: PES packet too long for a non-video stream")
+	ErrTableNotFound           = errors.New("mpegts: table not found")
+	ErrEncryptedSplice         = errors.New("mpegts: encrypted splice_info_section")
+	ErrInvalidDescriptor       = errors.New("mpegts: invalid descriptor")
+	ErrInvalidIndex            = errors.New("mpegts: invalid index")
+	ErrKeyframeNotFound        = errors.New("mpegts: keyframe not found")
+	ErrInvalidConfig           = errors.New("mpegts: invalid generator configuration")
+	ErrInvalidID3              = errors.New("mpegts: invalid ID3 tag")
+	ErrAdaptationFieldTooLong  = errors.New("mpegts: adaptation field does not fit before the payload")
 )
 
 // EncodedPacket represents a raw MPEG-TS packet.
@@ -186,68 +198,76 @@ func (ep *EncodedPacket) SetAdaptationField(af []byte) {
 }
 
 // GetOPCR returns the Original Program Clock Reference (OPCR) value from the adaptation field.
-func (ep *EncodedPacket) GetOPCR() uint64 {
-	if ep.GetAFC() == 0x03 {
-		return binary.BigEndian.Uint64(ep[13:21]) & 0x1FFFFFFFFFFFF
+// It returns zero when the OPCR flag is not set.
+func (ep *EncodedPacket) GetOPCR() PCR {
+	if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.HasOPCR {
+		return af.OPCR
 	}
 	return 0
 }
 
-// SetOPCR sets the Original Program Clock Reference (OPCR) value in the adaptation field.
-func (ep *EncodedPacket) SetOPCR(opcr uint64) {
-	if ep.GetAFC() == 0x03 {
-		binary.BigEndian.PutUint64(ep[13:21], opcr)
-	}
+// SetOPCR sets the Original Program Clock Reference (OPCR) value in the adaptation field. It returns
+// ErrAdaptationFieldTooLong when the packet has no room for it.
+func (ep *EncodedPacket) SetOPCR(opcr PCR) error {
+	return ep.updateAdaptationField(func(af *AdaptationField) {
+		af.HasOPCR, af.OPCR = true, opcr
+	})
 }
 
 // GetSpliceCountdown returns the Splice Countdown field from the adaptation field.
-func (ep *EncodedPacket) GetSpliceCountdown() uint8 {
-	if ep.GetAFC() == 0x03 {
-		return ep[21]
+// It returns zero when the splicing_point flag is not set.
+func (ep *EncodedPacket) GetSpliceCountdown() int8 {
+	if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.HasSpliceCountdown {
+		return af.SpliceCountdown
 	}
 	return 0
 }
 
-// SetSpliceCountdown sets the Splice Countdown field in the adaptation field.
-func (ep *EncodedPacket) SetSpliceCountdown(sc uint8) {
-	if ep.GetAFC() == 0x03 {
-		ep[21] = sc
-	}
+// SetSpliceCountdown sets the Splice Countdown field in the adaptation field. It returns
+// ErrAdaptationFieldTooLong when the packet has no room for it.
+func (ep *EncodedPacket) SetSpliceCountdown(sc int8) error {
+	return ep.updateAdaptationField(func(af *AdaptationField) {
+		af.HasSpliceCountdown, af.SpliceCountdown = true, sc
+	})
 }
 
 // GetTransportPrivateData returns the Transport Private Data from the adaptation field.
+// It returns nil when the transport_private_data flag is not set.
 func (ep *EncodedPacket) GetTransportPrivateData() []byte {
-	if ep.GetAFC() == 0x03 {
-		length := ep[22]          // Get the length of the transport private data
-		return ep[23 : 23+length] // Correct slicing to exclude the length byte
+	if af, err := ParseAdaptationField(ep); err == nil && af != nil {
+		return af.PrivateData
 	}
 	return nil
 }
 
-// SetTransportPrivateData sets the Transport Private Data in the adaptation field.
-func (ep *EncodedPacket) SetTransportPrivateData(tpd []byte) {
-	if ep.GetAFC() == 0x03 {
-		ep[22] = byte(len(tpd))
-		copy(ep[23:], tpd)
-	}
+// SetTransportPrivateData sets the Transport Private Data in the adaptation field. It returns
+// ErrAdaptationFieldTooLong when the packet has no room for it.
+func (ep *EncodedPacket) SetTransportPrivateData(tpd []byte) error {
+	return ep.updateAdaptationField(func(af *AdaptationField) {
+		af.PrivateData = append([]byte{}, tpd...)
+	})
 }
 
-// GetAdaptationFieldExtension returns the Adaptation Field Extension from the adaptation field.
+// GetAdaptationFieldExtension returns the Adaptation Field Extension from the adaptation field,
+// excluding its length byte. It returns nil when the extension flag is not set.
 func (ep *EncodedPacket) GetAdaptationFieldExtension() []byte {
-	if ep.GetAFC() == 0x03 {
-		start := 22 + ep[22]                // Calculate the starting position correctly
-		length := ep[start]                 // Get the length of the extension from the start position
-		return ep[start+1 : start+1+length] // Correct slicing to exclude the length byte
+	if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.Extension != nil {
+		return af.Extension.marshal()
 	}
 	return nil
 }
 
 // SetAdaptationFieldExtension sets the Adaptation Field Extension in the adaptation field.
-func (ep *EncodedPacket) SetAdaptationFieldExtension(afe []byte) {
-	if ep.GetAFC() == 0x03 {
-		ep[22+ep[22]] = byte(len(afe))
-		copy(ep[23+ep[22]:], afe)
+// afe holds the extension excluding its length byte. It returns an error when afe is not a valid
+// extension or when the packet has no room for it.
+func (ep *EncodedPacket) SetAdaptationFieldExtension(afe []byte) error {
+	ext, err := parseAdaptationFieldExtension(afe)
+	if err != nil {
+		return err
 	}
+	return ep.updateAdaptationField(func(af *AdaptationField) {
+		af.Extension = ext
+	})
 }
 
 // calculateAdaptationFieldLength calculates the length of the adaptation field based on whether it is present.
@@ -260,57 +280,45 @@ func calculateAdaptationFieldLength(packet *EncodedPacket) int {
 	return 0
 }
 
-// GetPCR returns the Program Clock Reference (PCR) value from the adaptation field.
-// We are assuming a standard 27 MHz clock frequency for the PCR.
-func (ep *EncodedPacket) SetPCR(pcr uint64) {
-	pcrBase := pcr / 300      // Divide by 300 to convert to base unit
-	pcrExtension := pcr % 300 // Modulus 300 to find the extension
-
-	afc := ep.GetAFC()
-	if afc != 0x02 && afc != 0x03 {
-		ep.SetAFC(0x03) // Ensure the adaptation field is set to contain a PCR
-	}
-
-	// Ensure adaptation field length is enough to hold PCR (minimum 7 bytes)
-	if ep[4] < 7 {
-		ep[4] = 7
-		for i := 5; i < 12; i++ {
-			ep[i] = 0
-		}
-	}
-
-	ep[5] |= 0x10 // Set the PCR flag
-
-	// Set PCR base and extension
-	ep[6] = byte(pcrBase >> 25)
-	ep[7] = byte(pcrBase >> 17)
-	ep[8] = byte(pcrBase >> 9)
-	ep[9] = byte(pcrBase >> 1)
-	ep[10] = (byte(pcrBase<<7) & 0x80) | (byte(pcrExtension>>8) & 0x01)
-	ep[11] = byte(pcrExtension & 0xFF)
+// SetPCR sets the Program Clock Reference (PCR) value in the adaptation field, adding one if needed.
+// Values beyond MaxPCRValue are wrapped. It returns ErrAdaptationFieldTooLong when the packet has no room
+// for it.
+func (ep *EncodedPacket) SetPCR(pcr PCR) error {
+	return ep.updateAdaptationField(func(af *AdaptationField) {
+		af.HasPCR, af.PCR = true, NewPCR(uint64(pcr))
+	})
 }
 
 // GetPCR returns the Program Clock Reference (PCR) value from the adaptation field.
-func (ep *EncodedPacket) GetPCR() uint64 {
-	if (ep.GetAFC() == 0x02 || ep.GetAFC() == 0x03) && (ep[5]&0x10 == 0x10) {
-		pcrBase := uint64(ep[6])<<25 | uint64(ep[7])<<17 | uint64(ep[8])<<9 | uint64(ep[9])<<1 | uint64(ep[10]>>7)
-		pcrExtension := uint64(ep[10]&0x01)<<8 | uint64(ep[11])
-		return pcrBase*300 + pcrExtension
+// It returns zero when the PCR flag is not set.
+func (ep *EncodedPacket) GetPCR() PCR {
+	if af, err := ParseAdaptationField(ep); err == nil && af != nil && af.HasPCR {
+		return af.PCR
 	}
 	return 0
 }
 
+// GetPTS returns the PTS of the PES packet starting in this packet, in the 90 kHz clock.
+// ok is false when the packet does not start a PES packet or the PES header carries no PTS.
+func (ep *EncodedPacket) GetPTS() (pts PTS, ok bool) {
+	start := payloadOffset(ep)
+	if !ep.GetPUSI() || start < 0 || packetLength-start < pesFixedHeaderLen+pesOptionalFixedLen+timestampLength {
+		return 0, false
+	}
+	data := ep[start:]
+	if data[0] != 0x00 || data[1] != 0x00 || data[2] != 0x01 || !hasOptionalHeader(data[3]) || data[7]&0x80 == 0 {
+		return 0, false
+	}
+	return PTS(decodeTimestamp(data[pesFixedHeaderLen+pesOptionalFixedLen:])), true
+}
+
 // ClearPCR removes the PCR data from the packet if it exists.
 func (ep *EncodedPacket) ClearPCR() {
-	afc := ep.GetAFC()
-	if afc == 0x02 || afc == 0x03 { // Check if the adaptation field is present
-		afLength := int(ep[4])
-		if afLength > 0 && (ep[5]&0x10) != 0 { // Check if PCR flag is set
-			ep[5] &= 0xEF // Clear the PCR flag
-			// Zero out PCR fields (6 bytes following the adaptation field length)
-			for i := 6; i <= 11; i++ {
-				ep[5+i] = 0
-			}
-		}
+	af, err := ParseAdaptationField(ep)
+	if err != nil || af == nil || !af.HasPCR {
+		return
 	}
+	ep.updateAdaptationField(func(af *AdaptationField) { // Shrinking the field cannot fail.
+		af.HasPCR, af.PCR = false, 0
+	})
 }
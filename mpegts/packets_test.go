@@ -271,23 +271,42 @@ func TestPCRHandling(t *testing.T) {
 	packet[5] = 0x10 // Ensure PCR flag is set
 
 	// Set and retrieve a PCR value
-	originalPCR := uint64(411123456789) // Using a realistic PCR value within the 33-bit range
-	packet.SetPCR(originalPCR)          // SetPCR without frequency conversion
+	originalPCR := PCR(411123456789)              // Using a realistic PCR value within the 42-bit range
+	assert.NoError(t, packet.SetPCR(originalPCR)) // SetPCR without frequency conversion
 	retrievedPCR := packet.GetPCR()
 
 	if originalPCR != retrievedPCR {
 		t.Errorf("The set and retrieved PCR values do not match. Expected: %d, Got: %d", originalPCR, retrievedPCR)
 	}
+
+	// Values beyond the range wrap.
+	assert.NoError(t, packet.SetPCR(MaxPCRValue+2))
+	assert.Equal(t, PCR(1), packet.GetPCR())
+}
+
+// TestPTSHandling tests reading the PTS of the PES packet starting in a packet.
+func TestPTSHandling(t *testing.T) {
+	pes := &PESPacket{StreamID: StreamIDVideoBase, HasPTS: true, PTS: 0x1FFFFFFFF, Payload: make([]byte, 400)}
+	packets, err := NewPESPacketizer(0x100).Packetize(pes, &AdaptationField{HasPCR: true, PCR: 300})
+	assert.NoError(t, err)
+
+	pts, ok := packets[0].GetPTS()
+	assert.True(t, ok)
+	assert.Equal(t, PTS(MaxPTSValue), pts)
+
+	_, ok = packets[1].GetPTS()
+	assert.False(t, ok, "continuation packets start no PES packet")
 }
 
 // TestOPCRHandling tests setting and retrieving the OPCR value.
 func TestOPCRHandling(t *testing.T) {
 	packet := &EncodedPacket{}
 	packet[0] = 0x47    // Set the sync byte
-	packet.SetAFC(0x03) // Adaptation field followed by payload
+	packet.SetAFC(0x02) // Adaptation field only, its stuffing leaving room for the OPCR
+	packet[4] = 183
 
-	originalOPCR := uint64(9876543210)
-	packet.SetOPCR(originalOPCR)
+	originalOPCR := PCR(9876543210)
+	assert.NoError(t, packet.SetOPCR(originalOPCR))
 	retrievedOPCR := packet.GetOPCR()
 
 	assert.Equal(t, originalOPCR, retrievedOPCR, "The set and retrieved OPCR values do not match")
@@ -297,10 +316,11 @@ func TestOPCRHandling(t *testing.T) {
 func TestSpliceCountdownHandling(t *testing.T) {
 	packet := &EncodedPacket{}
 	packet[0] = 0x47
-	packet.SetAFC(0x03) // Assume adaptation field followed by payload includes splice countdown
+	packet.SetAFC(0x02) // Adaptation field only, its stuffing leaving room for the splice countdown
+	packet[4] = 183
 
-	originalCountdown := uint8(10)
-	packet.SetSpliceCountdown(originalCountdown)
+	originalCountdown := int8(10)
+	assert.NoError(t, packet.SetSpliceCountdown(originalCountdown))
 	retrievedCountdown := packet.GetSpliceCountdown()
 
 	assert.Equal(t, originalCountdown, retrievedCountdown, "The set and retrieved splice countdown values do not match")
@@ -324,7 +344,7 @@ func TestTransportPrivateDataHandling(t *testing.T) {
 	packet[4] = 20 // Set an adaptation field length that includes space for private data
 
 	privateData := []byte{0x01, 0x02, 0x03, 0x04}
-	packet.SetTransportPrivateData(privateData)
+	assert.NoError(t, packet.SetTransportPrivateData(privateData))
 	retrievedData := packet.GetTransportPrivateData()
 
 	assert.Equal(t, privateData, retrievedData, "The set and retrieved transport private data do not match")
@@ -338,13 +358,21 @@ func TestAdaptationFieldExtensionHandling(t *testing.T) {
 
 	// Initialize the adaptation field length including an extension
 	packet[4] = 20 // Set an adaptation field length that includes space for an extension
-	packet[22] = 5 // Position for extension length
 
-	adaptationFieldExtension := []byte{0xAA, 0xBB, 0xCC}
-	packet.SetAdaptationFieldExtension(adaptationFieldExtension)
+	// ltw_flag set with reserved bits, followed by ltw_valid_flag and ltw_offset 0x0123
+	adaptationFieldExtension := []byte{0x9F, 0x81, 0x23}
+	assert.NoError(t, packet.SetAdaptationFieldExtension(adaptationFieldExtension))
 	retrievedExtension := packet.GetAdaptationFieldExtension()
 
 	assert.Equal(t, adaptationFieldExtension, retrievedExtension, "The set and retrieved adaptation field extension do not match")
+
+	// An extension that does not fit beside the payload is refused, leaving the packet as it was.
+	full := &EncodedPacket{0x47}
+	_, err := FillPacket(full, &AdaptationField{RandomAccess: true}, make([]byte, 182))
+	assert.NoError(t, err)
+	before := *full
+	assert.ErrorIs(t, full.SetAdaptationFieldExtension(adaptationFieldExtension), ErrAdaptationFieldTooLong)
+	assert.Equal(t, before, *full)
 }
 
 // TestCalculateAdaptationFieldLength tests the function to calculate the adaptation field length.
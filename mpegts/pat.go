@@ -0,0 +1,144 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	PATPID     = 0x0000 // PID carrying the Program Association Table.
+	PATTableID = 0x00   // table_id of program_association_section.
+
+	maxPSISectionLength = 1021 // Maximum section_length of PSI sections defined by ISO/IEC 13818-1.
+	patEntryLength      = 4
+)
+
+// PAT represents a Program Association Table.
+type PAT struct {
+	TransportStreamID uint16
+	Version           uint8
+	CurrentNext       bool
+	Programs          map[uint16]uint16 // program_number -> PMT PID. Program 0 maps to the network (NIT) PID.
+}
+
+// NewPAT creates an empty, current PAT for the given transport stream.
+func NewPAT(transportStreamID uint16, version uint8) *PAT {
+	return &PAT{
+		TransportStreamID: transportStreamID,
+		Version:           version & 0x1F,
+		CurrentNext:       true,
+		Programs:          make(map[uint16]uint16),
+	}
+}
+
+// ParsePAT builds a PAT from one or more reassembled sections.
+// Sections of a multi-section PAT are merged; all must share the same version.
+func ParsePAT(sections ...*Section) (*PAT, error) {
+	var pat *PAT
+	for _, s := range sections {
+		if s.TableID != PATTableID || !s.SectionSyntaxIndicator {
+			continue
+		}
+
+		if pat == nil {
+			pat = NewPAT(s.TableIDExtension, s.Version)
+			pat.CurrentNext = s.CurrentNext
+		} else if s.Version != pat.Version || s.TableIDExtension != pat.TransportStreamID {
+			return nil, ErrInvalidSection
+		}
+
+		body := s.Body()
+		if len(body)%patEntryLength != 0 {
+			return nil, ErrInvalidSection
+		}
+		for i := 0; i < len(body); i += patEntryLength {
+			program := binary.BigEndian.Uint16(body[i : i+2])
+			pid := binary.BigEndian.Uint16(body[i+2:i+4]) & 0x1FFF
+			pat.Programs[program] = pid
+		}
+	}
+
+	if pat == nil {
+		return nil, ErrPATNotFound
+	}
+	return pat, nil
+}
+
+// ProgramNumbers returns the program numbers in the PAT in ascending order, excluding the network entry.
+func (p *PAT) ProgramNumbers() []uint16 {
+	programs := make([]uint16, 0, len(p.Programs))
+	for program := range p.Programs {
+		if program != 0 {
+			programs = append(programs, program)
+		}
+	}
+	sort.Slice(programs, func(i, j int) bool { return programs[i] < programs[j] })
+	return programs
+}
+
+// PMTPID returns the PMT PID of the given program.
+func (p *PAT) PMTPID(program uint16) (uint16, error) {
+	pid, ok := p.Programs[program]
+	if !ok {
+		return 0, ErrProgramNotFound
+	}
+	return pid, nil
+}
+
+// Sections encodes the PAT as one or more sections, splitting it when it exceeds the maximum section size.
+func (p *PAT) Sections() []*Section {
+	var programs []uint16
+	if _, ok := p.Programs[0]; ok {
+		programs = append(programs, 0)
+	}
+	programs = append(programs, p.ProgramNumbers()...)
+
+	perSection := (maxPSISectionLength - (longSectionHeaderLen - sectionHeaderLength) - crcLength) / patEntryLength
+
+	var bodies [][]byte
+	for len(programs) > 0 || len(bodies) == 0 {
+		n := len(programs)
+		if n > perSection {
+			n = perSection
+		}
+		body := make([]byte, n*patEntryLength)
+		for i, program := range programs[:n] {
+			binary.BigEndian.PutUint16(body[i*patEntryLength:], program)
+			binary.BigEndian.PutUint16(body[i*patEntryLength+2:], 0xE000|p.Programs[program]&0x1FFF)
+		}
+		bodies = append(bodies, body)
+		programs = programs[n:]
+	}
+
+	sections := make([]*Section, len(bodies))
+	for i, body := range bodies {
+		s := &Section{
+			PID:                    PATPID,
+			TableID:                PATTableID,
+			SectionSyntaxIndicator: true,
+			TableIDExtension:       p.TransportStreamID,
+			Version:                p.Version,
+			CurrentNext:            p.CurrentNext,
+			SectionNumber:          uint8(i),
+			LastSectionNumber:      uint8(len(bodies) - 1),
+		}
+		s.Marshal(body)
+		sections[i] = s
+	}
+	return sections
+}
+
+// Encode packetizes the PAT onto PID 0 starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (p *PAT) Encode(cc uint8) (EncodedPackets, uint8) {
+	return PacketizeSections(PATPID, cc, sectionData(p.Sections())...)
+}
+
+// sectionData returns the raw bytes of each section.
+func sectionData(sections []*Section) [][]byte {
+	data := make([][]byte, len(sections))
+	for i, s := range sections {
+		data[i] = s.Data
+	}
+	return data
+}
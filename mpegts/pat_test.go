@@ -0,0 +1,78 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reassemble feeds packets to a fresh SectionAssembler and collects the sections produced.
+func reassemble(t *testing.T, packets EncodedPackets) []*Section {
+	sa := NewSectionAssembler()
+	var sections []*Section
+	for _, ep := range packets {
+		s, err := sa.Push(ep)
+		assert.NoError(t, err)
+		sections = append(sections, s...)
+	}
+	return sections
+}
+
+func TestParsePAT(t *testing.T) {
+	s, err := ParseSection(PATPID, testPAT)
+	assert.NoError(t, err)
+
+	pat, err := ParsePAT(s)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), pat.TransportStreamID)
+	assert.Equal(t, uint8(0), pat.Version)
+	assert.True(t, pat.CurrentNext)
+	assert.Equal(t, map[uint16]uint16{1: 0x1000}, pat.Programs)
+
+	pid, err := pat.PMTPID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x1000), pid)
+
+	_, err = pat.PMTPID(2)
+	assert.ErrorIs(t, err, ErrProgramNotFound)
+
+	_, err = ParsePAT()
+	assert.ErrorIs(t, err, ErrPATNotFound)
+}
+
+func TestEncodePAT(t *testing.T) {
+	pat := NewPAT(1, 0)
+	pat.Programs[1] = 0x1000
+
+	sections := pat.Sections()
+	assert.Len(t, sections, 1)
+	assert.Equal(t, testPAT, sections[0].Data)
+
+	packets, cc := pat.Encode(15)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, uint8(0), cc)
+	assert.Equal(t, uint8(15), packets[0].GetCC())
+	assert.True(t, packets[0].GetPUSI())
+	assert.Equal(t, uint16(PATPID), packets[0].GetPID())
+}
+
+func TestPATRoundTrip(t *testing.T) {
+	pat := NewPAT(0x4321, 7)
+	pat.Programs[0] = 0x0010 // Network PID.
+	for i := uint16(1); i <= 300; i++ {
+		pat.Programs[i] = 0x100 + i
+	}
+
+	sections := pat.Sections()
+	assert.Len(t, sections, 2, "300 programs should not fit in a single section")
+
+	packets, _ := pat.Encode(0)
+	for i, ep := range packets {
+		assert.Equal(t, uint8(i&0x0F), ep.GetCC())
+	}
+
+	parsed, err := ParsePAT(reassemble(t, packets)...)
+	assert.NoError(t, err)
+	assert.Equal(t, pat, parsed)
+	assert.Len(t, parsed.ProgramNumbers(), 300)
+}
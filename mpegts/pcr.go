@@ -0,0 +1,306 @@
+package mpegts
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// PCRRepetitionLimit is the longest allowed interval between two PCRs of a program (ETSI TR 101 290, 1.3a).
+	PCRRepetitionLimit = 40 * time.Millisecond
+	// PCRDiscontinuityLimit is the largest PCR step accepted without a discontinuity_indicator (TR 101 290, 2.3a).
+	PCRDiscontinuityLimit = 100 * time.Millisecond
+	// PCRAccuracyLimit is the largest allowed PCR inaccuracy (ISO/IEC 13818-1, 2.4.2.2).
+	PCRAccuracyLimit = 500 * time.Nanosecond
+
+	pcrJitterWindow = 256 // PCRs kept to measure the overall jitter.
+)
+
+// PCRStats is the result of the PCR analysis of one program.
+type PCRStats struct {
+	Program uint16
+	PID     uint16
+	Count   uint64 // PCRs analysed.
+
+	// Repetition interval, measured on the PCR values.
+	Interval       time.Duration // Between the last two PCRs.
+	MinInterval    time.Duration
+	MaxInterval    time.Duration
+	MeanInterval   time.Duration
+	IntervalErrors uint64 // Intervals longer than PCRRepetitionLimit.
+
+	// PCR accuracy (PCR_AC), measured against the stream's own bitrate.
+	Bitrate        float64       // Transport stream rate in bits per second between the first and last PCR.
+	Accuracy       time.Duration // Of the last PCR.
+	MaxAccuracy    time.Duration // Largest absolute inaccuracy.
+	AccuracyErrors uint64        // PCRs off by more than PCRAccuracyLimit.
+
+	// Overall jitter and drift, measured against the arrival time. Zero when no arrival times are given.
+	Jitter time.Duration // Peak to peak, over the last PCRs, after removing the drift.
+	Drift  float64       // Frequency offset of the PCR clock from the arrival clock, in parts per million.
+
+	Discontinuities     uint64 // Signalled by the discontinuity_indicator.
+	DiscontinuityErrors uint64 // Steps backwards or beyond PCRDiscontinuityLimit without a discontinuity_indicator.
+}
+
+// pcrSample is a PCR position relative to the first PCR of the analysis.
+type pcrSample struct {
+	arrival float64 // Seconds.
+	offset  float64 // PCR time minus arrival time, seconds.
+}
+
+// pcrProgram is the analysis state of one program.
+type pcrProgram struct {
+	stats       PCRStats
+	has         bool   // A PCR has been seen since the last reset.
+	lastRaw     PCR    // Last PCR value as carried in the stream.
+	pcr         uint64 // Unwrapped PCR ticks since firstBytes.
+	bytes       int64
+	firstBytes  int64
+	sumInterval time.Duration
+	intervals   uint64
+
+	// Arrival based measurements.
+	firstArrival time.Time
+	n            float64
+	meanX        float64
+	meanY        float64
+	cxy          float64
+	vxx          float64
+	window       []pcrSample
+	next         int
+}
+
+// reset drops the clock references, for example at a discontinuity.
+func (p *pcrProgram) reset() {
+	p.has = false
+	p.firstArrival = time.Time{}
+	p.n, p.meanX, p.meanY, p.cxy, p.vxx = 0, 0, 0, 0, 0
+	p.window, p.next = p.window[:0], 0
+}
+
+// PCRAnalyzer measures the PCR repetition interval, accuracy, jitter and drift of every program of a
+// transport stream. It follows the PAT and PMTs to find each program's PCR_PID. Results may be queried
+// from other goroutines while packets are pushed.
+type PCRAnalyzer struct {
+	mu       sync.Mutex
+	sections *SectionAssembler
+	pmtPIDs  map[uint16]bool
+	programs map[uint16]*pcrProgram // Keyed by program number.
+	bytes    int64                  // Bytes of the stream pushed so far.
+}
+
+// NewPCRAnalyzer creates an analyzer with no programs.
+func NewPCRAnalyzer() *PCRAnalyzer {
+	return &PCRAnalyzer{
+		sections: NewSectionAssembler(),
+		pmtPIDs:  make(map[uint16]bool),
+		programs: make(map[uint16]*pcrProgram),
+	}
+}
+
+// SetPCRPID sets the PCR_PID of a program, for streams whose PMT is not carried.
+// Changing the PID of a known program restarts its analysis.
+func (pa *PCRAnalyzer) SetPCRPID(program, pid uint16) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	pa.setPCRPID(program, pid)
+}
+
+func (pa *PCRAnalyzer) setPCRPID(program, pid uint16) {
+	if p, ok := pa.programs[program]; ok && p.stats.PID == pid {
+		return
+	}
+	pa.programs[program] = &pcrProgram{stats: PCRStats{Program: program, PID: pid}}
+}
+
+// Push analyses a packet that arrived at the given time. A zero arrival time, as when reading a file,
+// skips the arrival based measurements.
+func (pa *PCRAnalyzer) Push(ep *EncodedPacket, arrival time.Time) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	position := pa.bytes
+	pa.bytes += packetLength
+
+	pid := ep.GetPID()
+	if pid == PATPID || pa.pmtPIDs[pid] {
+		pa.pushSection(ep)
+	}
+
+	af, err := ParseAdaptationField(ep)
+	if err != nil || af == nil {
+		return
+	}
+	for _, p := range pa.programs {
+		if p.stats.PID != pid {
+			continue
+		}
+		if af.Discontinuity {
+			p.stats.Discontinuities++
+			p.reset()
+		}
+		if af.HasPCR {
+			p.push(af.PCR, position, arrival)
+		}
+	}
+}
+
+// pushSection follows the PAT and PMTs to the PCR_PID of every program.
+func (pa *PCRAnalyzer) pushSection(ep *EncodedPacket) {
+	sections, _ := pa.sections.Push(ep)
+	for _, s := range sections {
+		switch s.TableID {
+		case PATTableID:
+			pat, err := ParsePAT(s)
+			if err != nil {
+				continue
+			}
+			for _, program := range pat.ProgramNumbers() {
+				pid, _ := pat.PMTPID(program)
+				pa.pmtPIDs[pid] = true
+			}
+		case PMTTableID:
+			pmt, err := ParsePMT(s)
+			if err != nil {
+				continue
+			}
+			pa.setPCRPID(pmt.ProgramNumber, pmt.PCRPID)
+		}
+	}
+}
+
+// push analyses a PCR carried by the packet at the given byte position of the stream.
+func (p *pcrProgram) push(raw PCR, position int64, arrival time.Time) {
+	p.stats.Count++
+	if !p.has {
+		p.has, p.lastRaw, p.pcr, p.bytes, p.firstBytes = true, raw, 0, position, position
+		p.pushArrival(arrival)
+		return
+	}
+
+	delta := raw.Sub(p.lastRaw)
+	interval := ticksToDuration(float64(delta))
+	if delta < 0 || interval > PCRDiscontinuityLimit {
+		// A step backwards or a jump: restart from this PCR.
+		p.stats.DiscontinuityErrors++
+		p.reset()
+		p.has, p.lastRaw, p.pcr, p.bytes, p.firstBytes = true, raw, 0, position, position
+		p.pushArrival(arrival)
+		return
+	}
+
+	p.stats.Interval = interval
+	if p.intervals == 0 || interval < p.stats.MinInterval {
+		p.stats.MinInterval = interval
+	}
+	if interval > p.stats.MaxInterval {
+		p.stats.MaxInterval = interval
+	}
+	if interval > PCRRepetitionLimit {
+		p.stats.IntervalErrors++
+	}
+	p.intervals++
+	p.sumInterval += interval
+	p.stats.MeanInterval = p.sumInterval / time.Duration(p.intervals)
+
+	// The stream's own rate, from the first to the previous PCR, predicts the value of this PCR.
+	if p.pcr > 0 && p.bytes > p.firstBytes {
+		expected := float64(position-p.bytes) * float64(p.pcr) / float64(p.bytes-p.firstBytes)
+		p.stats.Accuracy = ticksToDuration(float64(delta) - expected)
+		accuracy := p.stats.Accuracy
+		if accuracy < 0 {
+			accuracy = -accuracy
+		}
+		if accuracy > p.stats.MaxAccuracy {
+			p.stats.MaxAccuracy = accuracy
+		}
+		if accuracy > PCRAccuracyLimit {
+			p.stats.AccuracyErrors++
+		}
+	}
+
+	p.lastRaw, p.bytes = raw, position
+	p.pcr += uint64(delta)
+	if p.pcr > 0 {
+		p.stats.Bitrate = float64(p.bytes-p.firstBytes) * 8 * PCRClock / float64(p.pcr)
+	}
+	p.pushArrival(arrival)
+}
+
+// pushArrival compares the current PCR against its arrival time.
+func (p *pcrProgram) pushArrival(arrival time.Time) {
+	if arrival.IsZero() {
+		return
+	}
+	if p.firstArrival.IsZero() {
+		p.firstArrival = arrival
+	}
+
+	x := arrival.Sub(p.firstArrival).Seconds()
+	y := float64(p.pcr)/PCRClock - x
+
+	// Running least squares fit of the offset against the arrival time; its slope is the drift.
+	p.n++
+	dx := x - p.meanX
+	p.meanX += dx / p.n
+	p.meanY += (y - p.meanY) / p.n
+	p.cxy += dx * (y - p.meanY)
+	p.vxx += dx * (x - p.meanX)
+
+	sample := pcrSample{arrival: x, offset: y}
+	if len(p.window) < pcrJitterWindow {
+		p.window = append(p.window, sample)
+	} else {
+		p.window[p.next] = sample
+		p.next = (p.next + 1) % pcrJitterWindow
+	}
+}
+
+// result completes the arrival based measurements.
+func (p *pcrProgram) result() PCRStats {
+	stats := p.stats
+	if p.n < 2 || p.vxx == 0 {
+		return stats
+	}
+	slope := p.cxy / p.vxx
+	stats.Drift = slope * 1e6
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, s := range p.window {
+		residual := s.offset - slope*s.arrival
+		low, high = math.Min(low, residual), math.Max(high, residual)
+	}
+	stats.Jitter = time.Duration((high - low) * float64(time.Second))
+	return stats
+}
+
+// Program returns the analysis of a program.
+func (pa *PCRAnalyzer) Program(program uint16) (PCRStats, error) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	p, ok := pa.programs[program]
+	if !ok {
+		return PCRStats{}, ErrProgramNotFound
+	}
+	return p.result(), nil
+}
+
+// Results returns the analysis of every program, ordered by program number.
+func (pa *PCRAnalyzer) Results() []PCRStats {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	results := make([]PCRStats, 0, len(pa.programs))
+	for _, p := range pa.programs {
+		results = append(results, p.result())
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Program < results[j].Program })
+	return results
+}
+
+// ticksToDuration converts 27 MHz ticks to a duration.
+func ticksToDuration(ticks float64) time.Duration {
+	return time.Duration(math.Round(ticks * 1000 / 27))
+}
@@ -0,0 +1,145 @@
+package mpegts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pcrTestRate is the transport rate of the synthetic streams, in bits per second.
+const pcrTestRate = 10000000
+
+// pushPCRStream pushes count packets on PID 0x100 at pcrTestRate, with a PCR every 50 packets.
+// pcr returns the PCR carried by packet i, and arrival its arrival time.
+func pushPCRStream(pa *PCRAnalyzer, count int, pcr func(i int) PCR, arrival func(i int) time.Time) {
+	for i := 0; i < count; i++ {
+		ep := ccPacket(0x100, 0x01, uint8(i))
+		if i%50 == 0 {
+			ep = ccPacket(0x100, 0x02, uint8(i)) // Adaptation field only, with room for the PCR.
+			ep.SetPCR(pcr(i))
+		}
+		pa.Push(ep, arrival(i))
+	}
+}
+
+// cbrPCR returns the PCR of packet i of a constant bitrate stream whose clock runs at 27 MHz * (1 + ppm/1e6).
+func cbrPCR(i int, ppm float64) PCR {
+	seconds := float64(i*packetLength*8) / pcrTestRate
+	return PCR(seconds * PCRClock * (1 + ppm/1e6))
+}
+
+func cbrArrival(start time.Time, i int) time.Time {
+	return start.Add(time.Duration(float64(i*packetLength*8) / pcrTestRate * float64(time.Second)))
+}
+
+func TestPCRAnalyzerFollowsPMT(t *testing.T) {
+	pa := NewPCRAnalyzer()
+
+	pat := NewPAT(1, 0)
+	pat.Programs[1] = 0x1000
+	packets, _ := pat.Encode(0)
+	pmt := &PMT{ProgramNumber: 1, CurrentNext: true, PCRPID: 0x100, Streams: []ElementaryStream{{StreamType: StreamTypeH264, ElementaryPID: 0x100}}}
+	pmtPackets, _, err := pmt.Encode(0x1000, 0)
+	assert.NoError(t, err)
+	for _, ep := range append(packets, pmtPackets...) {
+		pa.Push(ep, time.Time{})
+	}
+
+	pushPCRStream(pa, 1000, func(i int) PCR { return cbrPCR(i, 0) }, func(int) time.Time { return time.Time{} })
+
+	results := pa.Results()
+	assert.Len(t, results, 1)
+	stats := results[0]
+	assert.Equal(t, uint16(1), stats.Program)
+	assert.Equal(t, uint16(0x100), stats.PID)
+	assert.Equal(t, uint64(20), stats.Count)
+	assert.Equal(t, 7520*time.Microsecond, stats.Interval)
+	assert.Equal(t, stats.Interval, stats.MaxInterval)
+	assert.Equal(t, stats.Interval, stats.MeanInterval)
+	assert.InDelta(t, pcrTestRate, stats.Bitrate, 10)
+	assert.LessOrEqual(t, stats.MaxAccuracy, 100*time.Nanosecond)
+	assert.Zero(t, stats.AccuracyErrors)
+	assert.Zero(t, stats.IntervalErrors)
+	assert.Zero(t, stats.Jitter, "no arrival times")
+
+	_, err = pa.Program(2)
+	assert.ErrorIs(t, err, ErrProgramNotFound)
+}
+
+func TestPCRAnalyzerDriftAndJitter(t *testing.T) {
+	pa := NewPCRAnalyzer()
+	pa.SetPCRPID(1, 0x100)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pushPCRStream(pa, 50000,
+		func(i int) PCR { return cbrPCR(i, 50) },
+		func(i int) time.Time {
+			at := cbrArrival(start, i)
+			if i/50%2 == 1 {
+				at = at.Add(time.Millisecond) // Network jitter on every other PCR.
+			}
+			return at
+		})
+
+	stats, err := pa.Program(1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 50, stats.Drift, 1)
+	assert.InDelta(t, float64(time.Millisecond), float64(stats.Jitter), float64(20*time.Microsecond))
+	assert.Zero(t, stats.AccuracyErrors, "the PCRs are consistent with the stream's own rate")
+}
+
+func TestPCRAnalyzerErrors(t *testing.T) {
+	pa := NewPCRAnalyzer()
+	pa.SetPCRPID(1, 0x100)
+
+	pushPCRStream(pa, 1000,
+		func(i int) PCR {
+			switch {
+			case i == 500:
+				return cbrPCR(i, 0) + 1000 // 37 µs off.
+			case i >= 800:
+				return cbrPCR(i, 0) + 27000000 // One second jump.
+			}
+			return cbrPCR(i, 0)
+		},
+		func(int) time.Time { return time.Time{} })
+
+	stats, err := pa.Program(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), stats.AccuracyErrors, "the inaccurate PCR and the one following it")
+	// The following PCR is predicted from a rate that includes the error, so it is off by a little more.
+	assert.InDelta(t, float64(37*time.Microsecond), float64(stats.MaxAccuracy), float64(5*time.Microsecond))
+	assert.Equal(t, uint64(1), stats.DiscontinuityErrors)
+	assert.Zero(t, stats.Discontinuities)
+
+	// A signalled discontinuity restarts the analysis without an error.
+	ep := ccPacket(0x100, 0x02, 0)
+	ep.updateAdaptationField(func(af *AdaptationField) {
+		af.Discontinuity, af.HasPCR, af.PCR = true, true, 0
+	})
+	pa.Push(ep, time.Time{})
+	ep = ccPacket(0x100, 0x02, 0)
+	ep.SetPCR(27000000 / 20) // 50 ms later.
+	pa.Push(ep, time.Time{})
+
+	stats, _ = pa.Program(1)
+	assert.Equal(t, uint64(1), stats.Discontinuities)
+	assert.Equal(t, uint64(1), stats.DiscontinuityErrors)
+	assert.Equal(t, uint64(1), stats.IntervalErrors)
+	assert.Equal(t, 50*time.Millisecond, stats.MaxInterval)
+}
+
+func TestPCRAnalyzerWrap(t *testing.T) {
+	pa := NewPCRAnalyzer()
+	pa.SetPCRPID(1, 0x100)
+
+	start := PCR(MaxPCRValue - 50000)
+	pushPCRStream(pa, 1000, func(i int) PCR { return start.AddTicks(int64(cbrPCR(i, 0))) }, func(int) time.Time { return time.Time{} })
+
+	stats, err := pa.Program(1)
+	assert.NoError(t, err)
+	assert.Zero(t, stats.DiscontinuityErrors, "the wrap is not a discontinuity")
+	assert.Zero(t, stats.AccuracyErrors)
+	assert.InDelta(t, pcrTestRate, stats.Bitrate, 10)
+}
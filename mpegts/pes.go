@@ -0,0 +1,383 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// Stream ID values with special meaning in the PES header.
+const (
+	StreamIDProgramStreamMap       = 0xBC
+	StreamIDPrivateStream1         = 0xBD
+	StreamIDPaddingStream          = 0xBE
+	StreamIDPrivateStream2         = 0xBF
+	StreamIDAudioBase              = 0xC0 // First of 32 MPEG audio stream IDs.
+	StreamIDVideoBase              = 0xE0 // First of 16 MPEG video stream IDs.
+	StreamIDECM                    = 0xF0
+	StreamIDEMM                    = 0xF1
+	StreamIDDSMCC                  = 0xF2
+	StreamIDH2221TypeE             = 0xF8
+	StreamIDMetadata               = 0xFC
+	StreamIDProgramStreamDirectory = 0xFF
+
+	pesFixedHeaderLen   = 6 // packet_start_code_prefix, stream_id and PES_packet_length.
+	pesOptionalFixedLen = 3 // Flag bytes and PES_header_data_length.
+	timestampLength     = 5
+	escrLength          = 6
+)
+
+// PESPacket represents a reassembled Packetized Elementary Stream packet.
+// Timestamps are expressed in the 90 kHz clock; the ESCR is expressed in the 27 MHz clock (base*300+extension).
+type PESPacket struct {
+	PID           uint16 // PID the packet was carried on.
+	StreamID      uint8
+	PacketLength  uint16 // PES_packet_length as signalled; zero for unbounded video PES.
+	DataAlignment bool   // data_alignment_indicator.
+	HasPTS        bool
+	PTS           PTS
+	HasDTS        bool
+	DTS           PTS
+	HasESCR       bool
+	ESCR          uint64
+	Payload       []byte // Elementary stream data following the PES header.
+}
+
+// hasOptionalHeader reports whether PES packets with the given stream_id carry the optional PES header.
+func hasOptionalHeader(streamID uint8) bool {
+	switch streamID {
+	case StreamIDProgramStreamMap, StreamIDPaddingStream, StreamIDPrivateStream2,
+		StreamIDECM, StreamIDEMM, StreamIDDSMCC, StreamIDH2221TypeE, StreamIDProgramStreamDirectory:
+		return false
+	}
+	return true
+}
+
+// IsVideoStreamID reports whether the stream_id belongs to the MPEG video range.
+func IsVideoStreamID(streamID uint8) bool {
+	return streamID&0xF0 == StreamIDVideoBase
+}
+
+// ParsePES decodes a complete PES packet.
+func ParsePES(data []byte) (*PESPacket, error) {
+	if len(data) < pesFixedHeaderLen || data[0] != 0x00 || data[1] != 0x00 || data[2] != 0x01 {
+		return nil, ErrInvalidPES
+	}
+
+	p := &PESPacket{
+		StreamID:     data[3],
+		PacketLength: binary.BigEndian.Uint16(data[4:6]),
+	}
+
+	if p.PacketLength != 0 {
+		if len(data) < pesFixedHeaderLen+int(p.PacketLength) {
+			return nil, ErrInvalidPES
+		}
+		data = data[:pesFixedHeaderLen+int(p.PacketLength)]
+	}
+
+	if !hasOptionalHeader(p.StreamID) {
+		p.Payload = data[pesFixedHeaderLen:]
+		return p, nil
+	}
+
+	if len(data) < pesFixedHeaderLen+pesOptionalFixedLen || data[6]&0xC0 != 0x80 {
+		return nil, ErrInvalidPES
+	}
+
+	p.DataAlignment = data[6]&0x04 != 0
+	flags := data[7]
+	headerEnd := pesFixedHeaderLen + pesOptionalFixedLen + int(data[8])
+	if len(data) < headerEnd {
+		return nil, ErrInvalidPES
+	}
+
+	fields := data[pesFixedHeaderLen+pesOptionalFixedLen : headerEnd]
+	switch flags >> 6 {
+	case 0x02:
+		if len(fields) < timestampLength {
+			return nil, ErrInvalidPES
+		}
+		p.HasPTS, p.PTS = true, PTS(decodeTimestamp(fields))
+		fields = fields[timestampLength:]
+	case 0x03:
+		if len(fields) < 2*timestampLength {
+			return nil, ErrInvalidPES
+		}
+		p.HasPTS, p.PTS = true, PTS(decodeTimestamp(fields))
+		p.HasDTS, p.DTS = true, PTS(decodeTimestamp(fields[timestampLength:]))
+		fields = fields[2*timestampLength:]
+	case 0x01:
+		return nil, ErrInvalidPES // Forbidden value.
+	}
+
+	if flags&0x20 != 0 {
+		if len(fields) < escrLength {
+			return nil, ErrInvalidPES
+		}
+		p.HasESCR, p.ESCR = true, decodeESCR(fields)
+	}
+
+	p.Payload = data[headerEnd:]
+	return p, nil
+}
+
+// Marshal serializes the PES packet. Only the PTS, DTS and ESCR optional fields are written.
+// PES_packet_length is computed from the payload. When it does not fit in 16 bits it is set to zero,
+// which only video streams may use; other streams return ErrPESTooLong.
+func (p *PESPacket) Marshal() ([]byte, error) {
+	var header []byte
+	if hasOptionalHeader(p.StreamID) {
+		var fields []byte
+		flags := byte(0)
+		if p.HasPTS && p.HasDTS {
+			flags |= 0xC0
+			fields = append(fields, encodeTimestamp(0x03, uint64(p.PTS))...)
+			fields = append(fields, encodeTimestamp(0x01, uint64(p.DTS))...)
+		} else if p.HasPTS {
+			flags |= 0x80
+			fields = append(fields, encodeTimestamp(0x02, uint64(p.PTS))...)
+		}
+		if p.HasESCR {
+			flags |= 0x20
+			fields = append(fields, encodeESCR(p.ESCR)...)
+		}
+
+		first := byte(0x80) // '10' marker bits.
+		if p.DataAlignment {
+			first |= 0x04
+		}
+		header = append([]byte{first, flags, byte(len(fields))}, fields...)
+	}
+
+	data := make([]byte, pesFixedHeaderLen, pesFixedHeaderLen+len(header)+len(p.Payload))
+	data[2] = 0x01
+	data[3] = p.StreamID
+	data = append(data, header...)
+	data = append(data, p.Payload...)
+
+	length := len(data) - pesFixedHeaderLen
+	if length > 0xFFFF {
+		if !IsVideoStreamID(p.StreamID) {
+			return nil, ErrPESTooLong
+		}
+		length = 0
+	}
+	binary.BigEndian.PutUint16(data[4:6], uint16(length))
+	p.PacketLength = uint16(length)
+
+	return data, nil
+}
+
+// decodeTimestamp decodes a 33-bit PTS or DTS from its 5 byte PES header encoding.
+func decodeTimestamp(b []byte) uint64 {
+	return uint64(b[0]>>1&0x07)<<30 |
+		uint64(binary.BigEndian.Uint16(b[1:3])>>1)<<15 |
+		uint64(binary.BigEndian.Uint16(b[3:5])>>1)
+}
+
+// encodeTimestamp encodes a 33-bit PTS or DTS with the given 4-bit prefix.
+func encodeTimestamp(prefix uint8, ts uint64) []byte {
+	ts &= MaxPTSValue
+	b := make([]byte, timestampLength)
+	b[0] = prefix<<4 | byte(ts>>29)&0x0E | 0x01
+	binary.BigEndian.PutUint16(b[1:3], uint16(ts>>14)&0xFFFE|0x01)
+	binary.BigEndian.PutUint16(b[3:5], uint16(ts<<1)|0x01)
+	return b
+}
+
+// decodeESCR decodes the 6 byte ESCR field into a 27 MHz value.
+func decodeESCR(b []byte) uint64 {
+	v := uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(b[2])<<24 | uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+	base := (v>>43&0x07)<<30 | (v>>27&0x7FFF)<<15 | v>>11&0x7FFF
+	ext := v >> 1 & 0x1FF
+	return base*300 + ext
+}
+
+// encodeESCR encodes a 27 MHz value into the 6 byte ESCR field.
+func encodeESCR(escr uint64) []byte {
+	base := escr / 300 & MaxPTSValue
+	ext := escr % 300
+	v := 0x3<<46 | (base>>30&0x07)<<43 | 1<<42 | (base>>15&0x7FFF)<<27 | 1<<26 | (base&0x7FFF)<<11 | 1<<10 | ext<<1 | 0x01
+	b := make([]byte, escrLength)
+	for i := range b {
+		b[i] = byte(v >> (8 * (escrLength - 1 - i)))
+	}
+	return b
+}
+
+// pesBuffer holds a partially reassembled PES packet of a single PID.
+type pesBuffer struct {
+	buf     []byte
+	started bool
+	lastCC  uint8
+}
+
+// PESAssembler reassembles PES packets from MPEG-TS packets.
+// A PES packet is complete once PES_packet_length bytes have been received, or, for unbounded
+// video PES, when the next packet with the PUSI flag arrives on the same PID.
+type PESAssembler struct {
+	buffers map[uint16]*pesBuffer
+}
+
+// NewPESAssembler creates a new, empty PESAssembler.
+func NewPESAssembler() *PESAssembler {
+	return &PESAssembler{
+		buffers: make(map[uint16]*pesBuffer),
+	}
+}
+
+// Push feeds a packet to the assembler and returns every PES packet completed by it.
+// Incomplete PES packets interrupted by lost packets are dropped and reported with ErrInvalidPES.
+func (pa *PESAssembler) Push(ep *EncodedPacket) ([]*PESPacket, error) {
+	if !ep.IsMPEGTS() || ep.GetTEI() || ep.IsNullPacket() {
+		return nil, nil
+	}
+
+	offset := payloadOffset(ep)
+	if offset < 0 || offset >= packetLength {
+		return nil, nil
+	}
+	payload := ep[offset:]
+
+	pid := ep.GetPID()
+	pb, ok := pa.buffers[pid]
+	if !ok {
+		pb = &pesBuffer{}
+		pa.buffers[pid] = pb
+	}
+
+	var (
+		packets []*PESPacket
+		err     error
+	)
+
+	cc := ep.GetCC()
+	if pb.started {
+		if cc == pb.lastCC {
+			return nil, nil // Duplicate packet, already consumed.
+		}
+		if cc != (pb.lastCC+1)&0x0F {
+			pb.buf = pb.buf[:0]
+			pb.started = false
+			err = ErrInvalidPES
+		}
+	}
+	pb.lastCC = cc
+
+	if ep.GetPUSI() {
+		if pb.started {
+			p, perr := pb.flush(pid)
+			if p != nil {
+				packets = append(packets, p)
+			} else if perr != nil && err == nil {
+				err = perr
+			}
+		}
+		pb.buf = append(pb.buf[:0], payload...)
+		pb.started = true
+	} else if pb.started {
+		pb.buf = append(pb.buf, payload...)
+	} else {
+		return nil, err // Waiting for the start of a PES packet.
+	}
+
+	// Bounded PES packets complete as soon as all their bytes have arrived.
+	if len(pb.buf) >= pesFixedHeaderLen {
+		length := int(binary.BigEndian.Uint16(pb.buf[4:6]))
+		if length != 0 && len(pb.buf) >= pesFixedHeaderLen+length {
+			p, perr := pb.flush(pid)
+			if p != nil {
+				packets = append(packets, p)
+			} else if perr != nil && err == nil {
+				err = perr
+			}
+		}
+	}
+
+	return packets, err
+}
+
+// Flush completes and returns any PES packets still buffered, such as a trailing unbounded video PES,
+// in PID order.
+func (pa *PESAssembler) Flush() []*PESPacket {
+	pids := make([]uint16, 0, len(pa.buffers))
+	for pid := range pa.buffers {
+		pids = append(pids, pid)
+	}
+	slices.Sort(pids)
+
+	var packets []*PESPacket
+	for _, pid := range pids {
+		pb := pa.buffers[pid]
+		if !pb.started {
+			continue
+		}
+		if p, err := pb.flush(pid); err == nil {
+			packets = append(packets, p)
+		}
+	}
+	return packets
+}
+
+// flush parses the buffered bytes as a PES packet and resets the buffer.
+func (pb *pesBuffer) flush(pid uint16) (*PESPacket, error) {
+	data := make([]byte, len(pb.buf))
+	copy(data, pb.buf)
+	pb.buf = pb.buf[:0]
+	pb.started = false
+
+	p, err := ParsePES(data)
+	if err != nil {
+		return nil, err
+	}
+	p.PID = pid
+	return p, nil
+}
+
+// PESPacketizer splits PES packets into MPEG-TS packets on a single PID, keeping the continuity counter.
+type PESPacketizer struct {
+	pid uint16
+	cc  uint8
+}
+
+// NewPESPacketizer creates a packetizer for the given PID.
+func NewPESPacketizer(pid uint16) *PESPacketizer {
+	return &PESPacketizer{pid: pid}
+}
+
+// Packetize turns an elementary stream access unit into MPEG-TS packets.
+// The first packet carries the PUSI flag and, when af is not nil, the given adaptation field
+// (for example a PCR or the random_access_indicator). The last packet is padded with adaptation
+// field stuffing so the PES ends exactly at the packet boundary.
+func (pp *PESPacketizer) Packetize(pes *PESPacket, af *AdaptationField) (EncodedPackets, error) {
+	data, err := pes.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var packets EncodedPackets
+	first := true
+	for first || len(data) > 0 {
+		ep := &EncodedPacket{0x47}
+		ep.SetPID(pp.pid)
+		ep.SetCC(pp.cc)
+
+		var field *AdaptationField
+		if first {
+			ep.SetPUSI()
+			field = af
+		}
+
+		n, err := FillPacket(ep, field, data)
+		if err != nil {
+			return nil, err
+		}
+
+		data = data[n:]
+		pp.cc = (pp.cc + 1) & 0x0F
+		first = false
+		packets = append(packets, ep)
+	}
+
+	return packets, nil
+}
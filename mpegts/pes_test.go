@@ -0,0 +1,174 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampEncoding(t *testing.T) {
+	// One second at 90 kHz, as found in countless PES headers.
+	assert.Equal(t, []byte{0x21, 0x00, 0x05, 0xBF, 0x21}, encodeTimestamp(0x02, 90000))
+	assert.Equal(t, uint64(90000), decodeTimestamp([]byte{0x21, 0x00, 0x05, 0xBF, 0x21}))
+
+	for _, ts := range []uint64{0, 1, 0x7FFF, 0x8000, 1 << 30, 0x1FFFFFFFF} {
+		assert.Equal(t, ts, decodeTimestamp(encodeTimestamp(0x03, ts)))
+	}
+
+	for _, escr := range []uint64{0, 299, 300, 27000000, 0x1FFFFFFFF*300 + 299} {
+		assert.Equal(t, escr, decodeESCR(encodeESCR(escr)))
+	}
+}
+
+func TestPESRoundTrip(t *testing.T) {
+	pes := &PESPacket{
+		StreamID:      StreamIDVideoBase,
+		DataAlignment: true,
+		HasPTS:        true,
+		PTS:           0x1ABCDEF01,
+		HasDTS:        true,
+		DTS:           0x1ABCDE000,
+		HasESCR:       true,
+		ESCR:          123456789,
+		Payload:       []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xF0},
+	}
+
+	data, err := pes.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(len(data)-pesFixedHeaderLen), pes.PacketLength)
+
+	parsed, err := ParsePES(data)
+	assert.NoError(t, err)
+	assert.Equal(t, pes, parsed)
+
+	// Only video may leave PES_packet_length unbounded.
+	long := &PESPacket{StreamID: StreamIDVideoBase, Payload: make([]byte, 0x10000)}
+	data, err = long.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00}, data[4:6])
+	long.StreamID = StreamIDAudioBase
+	_, err = long.Marshal()
+	assert.ErrorIs(t, err, ErrPESTooLong)
+	_, err = NewPESPacketizer(0x101).Packetize(long, nil)
+	assert.ErrorIs(t, err, ErrPESTooLong)
+
+	_, err = ParsePES([]byte{0x00, 0x00, 0x02, 0xE0, 0x00, 0x00})
+	assert.ErrorIs(t, err, ErrInvalidPES)
+
+	padding := &PESPacket{StreamID: StreamIDPaddingStream, Payload: []byte{0xFF, 0xFF}}
+	data, err = padding.Marshal()
+	assert.NoError(t, err)
+	parsed, err = ParsePES(data)
+	assert.NoError(t, err)
+	assert.Equal(t, padding, parsed)
+}
+
+func TestPESPacketizeAndAssemble(t *testing.T) {
+	sizes := []int{1, 100, 175, 176, 177, 182, 183, 184, 1000, 70000}
+	for _, size := range sizes {
+		au := make([]byte, size)
+		for i := range au {
+			au[i] = byte(i)
+		}
+
+		pes := &PESPacket{StreamID: StreamIDVideoBase, HasPTS: true, PTS: 900000, Payload: au}
+		packets, err := NewPESPacketizer(0x100).Packetize(pes, &AdaptationField{RandomAccess: true})
+		assert.NoError(t, err)
+
+		assert.True(t, packets[0].GetPUSI())
+		assert.Equal(t, byte(0x40), packets[0][5]&0x40, "random_access_indicator should be set")
+		for i, ep := range packets {
+			assert.Equal(t, uint8(i&0x0F), ep.GetCC())
+			assert.Equal(t, uint16(0x100), ep.GetPID())
+			if i > 0 {
+				assert.False(t, ep.GetPUSI())
+			}
+		}
+
+		pa := NewPESAssembler()
+		var assembled []*PESPacket
+		for _, ep := range packets {
+			p, err := pa.Push(ep)
+			assert.NoError(t, err)
+			assembled = append(assembled, p...)
+		}
+		if size > 0xFFFF {
+			// Unbounded video PES completes only on flush or at the next PUSI.
+			assert.Len(t, assembled, 0)
+			assembled = pa.Flush()
+		}
+
+		assert.Len(t, assembled, 1, "size %d", size)
+		assert.Equal(t, au, assembled[0].Payload, "size %d", size)
+		assert.Equal(t, PTS(900000), assembled[0].PTS)
+		assert.Equal(t, uint16(0x100), assembled[0].PID)
+	}
+}
+
+func TestPESAssemblerUnbounded(t *testing.T) {
+	pp := NewPESPacketizer(0x100)
+	first := &PESPacket{StreamID: StreamIDVideoBase, HasPTS: true, PTS: 3000, Payload: make([]byte, 300)}
+	second := &PESPacket{StreamID: StreamIDVideoBase, HasPTS: true, PTS: 6000, Payload: make([]byte, 300)}
+
+	firstPackets, err := pp.Packetize(first, nil)
+	assert.NoError(t, err)
+	secondPackets, err := pp.Packetize(second, nil)
+	assert.NoError(t, err)
+
+	packets := append(firstPackets, secondPackets...)
+	for _, ep := range packets {
+		// Force PES_packet_length to zero on the starting packets.
+		if ep.GetPUSI() {
+			offset := payloadOffset(ep)
+			ep[offset+4], ep[offset+5] = 0, 0
+		}
+	}
+
+	pa := NewPESAssembler()
+	var assembled []*PESPacket
+	for _, ep := range packets {
+		p, err := pa.Push(ep)
+		assert.NoError(t, err)
+		assembled = append(assembled, p...)
+	}
+	assert.Len(t, assembled, 1)
+	assert.Equal(t, PTS(3000), assembled[0].PTS)
+	assert.Len(t, assembled[0].Payload, 300)
+
+	assembled = pa.Flush()
+	assert.Len(t, assembled, 1)
+	assert.Equal(t, PTS(6000), assembled[0].PTS)
+}
+
+func TestPESAssemblerFlushOrder(t *testing.T) {
+	pa := NewPESAssembler()
+	for _, pid := range []uint16{0x300, 0x100, 0x200, 0x180} {
+		pes := &PESPacket{StreamID: StreamIDVideoBase, Payload: make([]byte, 100)}
+		packets, err := NewPESPacketizer(pid).Packetize(pes, nil)
+		assert.NoError(t, err)
+		offset := payloadOffset(packets[0])
+		packets[0][offset+4], packets[0][offset+5] = 0, 0 // Unbounded, so it waits for the flush.
+		_, err = pa.Push(packets[0])
+		assert.NoError(t, err)
+	}
+
+	var pids []uint16
+	for _, p := range pa.Flush() {
+		pids = append(pids, p.PID)
+	}
+	assert.Equal(t, []uint16{0x100, 0x180, 0x200, 0x300}, pids)
+}
+
+func TestPESAssemblerContinuityError(t *testing.T) {
+	pes := &PESPacket{StreamID: StreamIDAudioBase, HasPTS: true, PTS: 1, Payload: make([]byte, 500)}
+	packets, err := NewPESPacketizer(0x101).Packetize(pes, nil)
+	assert.NoError(t, err)
+	assert.Len(t, packets, 3)
+
+	pa := NewPESAssembler()
+	_, err = pa.Push(packets[0])
+	assert.NoError(t, err)
+	assembled, err := pa.Push(packets[2])
+	assert.ErrorIs(t, err, ErrInvalidPES)
+	assert.Len(t, assembled, 0)
+}
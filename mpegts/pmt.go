@@ -0,0 +1,269 @@
+package mpegts
+
+import "encoding/binary"
+
+// PMTTableID is the table_id of TS_program_map_section.
+const PMTTableID = 0x02
+
+// StreamType identifies the coding of an elementary stream as signalled in the PMT.
+type StreamType uint8
+
+// Common stream_type values from ISO/IEC 13818-1 and ATSC/SCTE.
+const (
+	StreamTypeMPEG1Video      StreamType = 0x01
+	StreamTypeMPEG2Video      StreamType = 0x02
+	StreamTypeMPEG1Audio      StreamType = 0x03
+	StreamTypeMPEG2Audio      StreamType = 0x04
+	StreamTypePrivateSections StreamType = 0x05
+	StreamTypePrivatePES      StreamType = 0x06
+	StreamTypeADTSAAC         StreamType = 0x0F
+	StreamTypeMPEG4Video      StreamType = 0x10
+	StreamTypeLATMAAC         StreamType = 0x11
+	StreamTypeMetadataPES     StreamType = 0x15
+	StreamTypeH264            StreamType = 0x1B
+	StreamTypeHEVC            StreamType = 0x24
+	StreamTypeAC3             StreamType = 0x81
+	StreamTypeSCTE35          StreamType = 0x86
+	StreamTypeEAC3            StreamType = 0x87
+)
+
+// StreamCategory is the broad class of an elementary stream.
+type StreamCategory int
+
+const (
+	CategoryUnknown StreamCategory = iota
+	CategoryVideo
+	CategoryAudio
+	CategoryData
+	CategorySCTE35
+)
+
+// String returns the name of the category.
+func (c StreamCategory) String() string {
+	switch c {
+	case CategoryVideo:
+		return "video"
+	case CategoryAudio:
+		return "audio"
+	case CategoryData:
+		return "data"
+	case CategorySCTE35:
+		return "scte35"
+	}
+	return "unknown"
+}
+
+// ClassifyStream returns the category of a stream type, using its ES descriptors to resolve private PES streams.
+// It returns ErrUnsupportedStream if the stream cannot be classified.
+func ClassifyStream(st StreamType, descriptors []Descriptor) (StreamCategory, error) {
+	switch st {
+	case StreamTypeMPEG1Video, StreamTypeMPEG2Video, StreamTypeMPEG4Video, StreamTypeH264, StreamTypeHEVC:
+		return CategoryVideo, nil
+	case StreamTypeMPEG1Audio, StreamTypeMPEG2Audio, StreamTypeADTSAAC, StreamTypeLATMAAC, StreamTypeAC3, StreamTypeEAC3:
+		return CategoryAudio, nil
+	case StreamTypeSCTE35:
+		return CategorySCTE35, nil
+	case StreamTypePrivateSections, StreamTypeMetadataPES:
+		return CategoryData, nil
+	case StreamTypePrivatePES:
+		for _, d := range descriptors {
+			switch d.Tag {
+			case AC3DescriptorTag, EAC3DescriptorTag, DTSDescriptorTag, AACDescriptorTag:
+				return CategoryAudio, nil
+			case TeletextDescriptorTag, SubtitlingDescriptorTag:
+				return CategoryData, nil
+			case RegistrationDescriptorTag:
+				if len(d.Data) >= 4 {
+					switch string(d.Data[:4]) {
+					case "AC-3", "EAC3", "DTS1", "DTS2", "DTS3", "Opus":
+						return CategoryAudio, nil
+					case "HEVC", "VC-1":
+						return CategoryVideo, nil
+					case "ID3 ", "KLVA":
+						return CategoryData, nil
+					}
+				}
+			}
+		}
+		return CategoryData, nil
+	}
+	return CategoryUnknown, ErrUnsupportedStream
+}
+
+// ElementaryStream describes one entry of the PMT elementary stream loop.
+type ElementaryStream struct {
+	StreamType    StreamType
+	ElementaryPID uint16
+	Descriptors   []Descriptor
+}
+
+// Category returns the broad class of the stream.
+func (es *ElementaryStream) Category() StreamCategory {
+	category, _ := ClassifyStream(es.StreamType, es.Descriptors)
+	return category
+}
+
+// PMT represents a Program Map Table for a single program.
+type PMT struct {
+	ProgramNumber uint16
+	Version       uint8
+	CurrentNext   bool
+	PCRPID        uint16
+	ProgramInfo   []Descriptor
+	Streams       []ElementaryStream
+}
+
+// ParsePMT builds a PMT from its reassembled section.
+// The first program map section in sections is used.
+func ParsePMT(sections ...*Section) (*PMT, error) {
+	for _, s := range sections {
+		if s.TableID != PMTTableID || !s.SectionSyntaxIndicator {
+			continue
+		}
+
+		body := s.Body()
+		if len(body) < 4 {
+			return nil, ErrInvalidSection
+		}
+
+		pmt := &PMT{
+			ProgramNumber: s.TableIDExtension,
+			Version:       s.Version,
+			CurrentNext:   s.CurrentNext,
+			PCRPID:        binary.BigEndian.Uint16(body[0:2]) & 0x1FFF,
+		}
+
+		infoLength := int(binary.BigEndian.Uint16(body[2:4]) & 0x0FFF)
+		if len(body) < 4+infoLength {
+			return nil, ErrInvalidSection
+		}
+		var err error
+		if pmt.ProgramInfo, err = ParseDescriptors(body[4 : 4+infoLength]); err != nil {
+			return nil, err
+		}
+
+		loop := body[4+infoLength:]
+		for len(loop) > 0 {
+			if len(loop) < 5 {
+				return nil, ErrInvalidSection
+			}
+			esInfoLength := int(binary.BigEndian.Uint16(loop[3:5]) & 0x0FFF)
+			if len(loop) < 5+esInfoLength {
+				return nil, ErrInvalidSection
+			}
+			es := ElementaryStream{
+				StreamType:    StreamType(loop[0]),
+				ElementaryPID: binary.BigEndian.Uint16(loop[1:3]) & 0x1FFF,
+			}
+			if es.Descriptors, err = ParseDescriptors(loop[5 : 5+esInfoLength]); err != nil {
+				return nil, err
+			}
+			pmt.Streams = append(pmt.Streams, es)
+			loop = loop[5+esInfoLength:]
+		}
+
+		return pmt, nil
+	}
+
+	return nil, ErrPMTNotFound
+}
+
+// Stream returns the elementary stream carried on the given PID.
+func (p *PMT) Stream(pid uint16) (*ElementaryStream, error) {
+	for i := range p.Streams {
+		if p.Streams[i].ElementaryPID == pid {
+			return &p.Streams[i], nil
+		}
+	}
+	return nil, ErrStreamNotFound
+}
+
+// PIDs returns every PID referenced by the PMT: the PCR PID followed by the elementary stream PIDs.
+func (p *PMT) PIDs() []uint16 {
+	pids := []uint16{p.PCRPID}
+	for _, es := range p.Streams {
+		if es.ElementaryPID != p.PCRPID {
+			pids = append(pids, es.ElementaryPID)
+		}
+	}
+	return pids
+}
+
+// ECMPIDs returns the ECM PIDs named by the CA descriptors of the program and of its elementary
+// streams, in ascending order.
+func (p *PMT) ECMPIDs() []uint16 {
+	loops := [][]Descriptor{p.ProgramInfo}
+	for _, es := range p.Streams {
+		loops = append(loops, es.Descriptors)
+	}
+	return caPIDs(loops...)
+}
+
+// RemapPIDs rewrites the PCR PID, elementary stream PIDs and the ECM PIDs of CA descriptors using the
+// given lookup table. PIDs missing from the table are left unchanged.
+func (p *PMT) RemapPIDs(lut map[uint16]uint16) {
+	if pid, ok := lut[p.PCRPID]; ok {
+		p.PCRPID = pid
+	}
+	remapCADescriptors(p.ProgramInfo, lut)
+	for i := range p.Streams {
+		if pid, ok := lut[p.Streams[i].ElementaryPID]; ok {
+			p.Streams[i].ElementaryPID = pid
+		}
+		remapCADescriptors(p.Streams[i].Descriptors, lut)
+	}
+}
+
+// Section encodes the PMT as a single program map section.
+// It returns ErrInvalidSection if the PMT does not fit in the maximum PSI section size, and
+// ErrInvalidDescriptor if a descriptor is too long to encode.
+func (p *PMT) Section() (*Section, error) {
+	info, err := EncodeDescriptors(p.ProgramInfo)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, 4, 4+len(info))
+	binary.BigEndian.PutUint16(body[0:2], 0xE000|p.PCRPID&0x1FFF)
+	binary.BigEndian.PutUint16(body[2:4], 0xF000|uint16(len(info))&0x0FFF)
+	body = append(body, info...)
+
+	for _, es := range p.Streams {
+		esInfo, err := EncodeDescriptors(es.Descriptors)
+		if err != nil {
+			return nil, err
+		}
+		entry := make([]byte, 5)
+		entry[0] = byte(es.StreamType)
+		binary.BigEndian.PutUint16(entry[1:3], 0xE000|es.ElementaryPID&0x1FFF)
+		binary.BigEndian.PutUint16(entry[3:5], 0xF000|uint16(len(esInfo))&0x0FFF)
+		body = append(body, entry...)
+		body = append(body, esInfo...)
+	}
+
+	if longSectionHeaderLen-sectionHeaderLength+len(body)+crcLength > maxPSISectionLength {
+		return nil, ErrInvalidSection
+	}
+
+	s := &Section{
+		TableID:                PMTTableID,
+		SectionSyntaxIndicator: true,
+		TableIDExtension:       p.ProgramNumber,
+		Version:                p.Version,
+		CurrentNext:            p.CurrentNext,
+	}
+	s.Marshal(body)
+	return s, nil
+}
+
+// Encode packetizes the PMT onto the given PID starting at continuity counter cc.
+// PMTs longer than one packet are split across as many packets as needed.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (p *PMT) Encode(pid uint16, cc uint8) (EncodedPackets, uint8, error) {
+	s, err := p.Section()
+	if err != nil {
+		return nil, cc, err
+	}
+	s.PID = pid
+	packets, next := PacketizeSections(pid, cc, s.Data)
+	return packets, next, nil
+}
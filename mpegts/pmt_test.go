@@ -0,0 +1,124 @@
+package mpegts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPMT returns a program with H.264 video, AC-3 audio carried as private PES and an SCTE-35 stream.
+func testPMT() *PMT {
+	return &PMT{
+		ProgramNumber: 1,
+		Version:       4,
+		CurrentNext:   true,
+		PCRPID:        0x100,
+		ProgramInfo:   []Descriptor{{Tag: 0x05, Data: []byte("CUEI")}},
+		Streams: []ElementaryStream{
+			{StreamType: StreamTypeH264, ElementaryPID: 0x100},
+			{StreamType: StreamTypePrivatePES, ElementaryPID: 0x101, Descriptors: []Descriptor{
+				{Tag: 0x0A, Data: []byte("eng\x00")},
+				{Tag: 0x6A, Data: []byte{0x00}},
+			}},
+			{StreamType: StreamTypeSCTE35, ElementaryPID: 0x102},
+		},
+	}
+}
+
+func TestPMTRoundTrip(t *testing.T) {
+	pmt := testPMT()
+
+	packets, cc, err := pmt.Encode(0x1000, 3)
+	assert.NoError(t, err)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, uint8(4), cc)
+
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+	assert.Equal(t, uint16(0x1000), sections[0].PID)
+
+	parsed, err := ParsePMT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, pmt, parsed)
+}
+
+func TestPMTSpanningPackets(t *testing.T) {
+	pmt := testPMT()
+	for i := uint16(0); i < 40; i++ {
+		pmt.Streams = append(pmt.Streams, ElementaryStream{
+			StreamType:    StreamTypeADTSAAC,
+			ElementaryPID: 0x200 + i,
+			Descriptors:   []Descriptor{{Tag: 0x0A, Data: []byte("spa\x00")}},
+		})
+	}
+
+	packets, _, err := pmt.Encode(0x1000, 0)
+	assert.NoError(t, err)
+	assert.Greater(t, len(packets), 1)
+
+	parsed, err := ParsePMT(reassemble(t, packets)...)
+	assert.NoError(t, err)
+	assert.Equal(t, pmt, parsed)
+
+	// Grow the PMT beyond the maximum PSI section length.
+	for i := uint16(0); i < 200; i++ {
+		pmt.Streams = append(pmt.Streams, ElementaryStream{StreamType: StreamTypeADTSAAC, ElementaryPID: 0x300 + i})
+	}
+	_, _, err = pmt.Encode(0x1000, 0)
+	assert.ErrorIs(t, err, ErrInvalidSection)
+}
+
+func TestParsePMTErrors(t *testing.T) {
+	_, err := ParsePMT()
+	assert.ErrorIs(t, err, ErrPMTNotFound)
+
+	s, err := ParseSection(PATPID, testPAT)
+	assert.NoError(t, err)
+	_, err = ParsePMT(s)
+	assert.ErrorIs(t, err, ErrPMTNotFound)
+}
+
+func TestPMTStreams(t *testing.T) {
+	pmt := testPMT()
+
+	es, err := pmt.Stream(0x101)
+	assert.NoError(t, err)
+	assert.Equal(t, CategoryAudio, es.Category())
+
+	_, err = pmt.Stream(0x1FF)
+	assert.ErrorIs(t, err, ErrStreamNotFound)
+
+	assert.Equal(t, []uint16{0x100, 0x101, 0x102}, pmt.PIDs())
+
+	pmt.RemapPIDs(map[uint16]uint16{0x100: 0x200, 0x102: 0x202})
+	assert.Equal(t, uint16(0x200), pmt.PCRPID)
+	assert.Equal(t, []uint16{0x200, 0x101, 0x202}, pmt.PIDs())
+}
+
+func TestClassifyStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		streamType  StreamType
+		descriptors []Descriptor
+		want        StreamCategory
+		wantErr     error
+	}{
+		{"H.264", StreamTypeH264, nil, CategoryVideo, nil},
+		{"HEVC", StreamTypeHEVC, nil, CategoryVideo, nil},
+		{"AAC", StreamTypeADTSAAC, nil, CategoryAudio, nil},
+		{"E-AC-3", StreamTypeEAC3, nil, CategoryAudio, nil},
+		{"SCTE-35", StreamTypeSCTE35, nil, CategorySCTE35, nil},
+		{"ID3", StreamTypeMetadataPES, nil, CategoryData, nil},
+		{"Private AC-3 descriptor", StreamTypePrivatePES, []Descriptor{{Tag: 0x6A}}, CategoryAudio, nil},
+		{"Private registration", StreamTypePrivatePES, []Descriptor{{Tag: 0x05, Data: []byte("EAC3")}}, CategoryAudio, nil},
+		{"Private teletext", StreamTypePrivatePES, []Descriptor{{Tag: 0x56}}, CategoryData, nil},
+		{"Unknown", StreamType(0xEE), nil, CategoryUnknown, ErrUnsupportedStream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ClassifyStream(tt.streamType, tt.descriptors)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	PSIPBasePID = 0x1FFB // PID carrying the MGT, VCTs, STT and RRT.
+
+	MGTTableID  = 0xC7
+	TVCTTableID = 0xC8
+	CVCTTableID = 0xC9
+	EITTableID  = 0xCB
+	ETTTableID  = 0xCC
+	STTTableID  = 0xCD
+
+	mgtTableLength = 11 // Fixed part of each MGT table loop entry.
+	sttBodyLength  = 8  // protocol_version up to and including daylight_saving.
+)
+
+// table_type values of the MGT table loop.
+const (
+	MGTTableTypeTVCTCurrent = 0x0000
+	MGTTableTypeTVCTNext    = 0x0001
+	MGTTableTypeCVCTCurrent = 0x0002
+	MGTTableTypeCVCTNext    = 0x0003
+	MGTTableTypeChannelETT  = 0x0004
+	MGTTableTypeEITBase     = 0x0100 // EIT-0; EIT-k uses MGTTableTypeEITBase+k, k < 128.
+	MGTTableTypeETTBase     = 0x0200 // Event ETT-0; ETT-k uses MGTTableTypeETTBase+k, k < 128.
+)
+
+// Compression and mode values of multiple string structure segments.
+const (
+	StringCompressionNone = 0x00
+	StringModeLatin1      = 0x00 // ISO/IEC 8859-1, the ASCII range of Unicode.
+	StringModeUTF16       = 0x3F // Standard Compression Scheme for Unicode is not supported; 0x3F is UTF-16.
+)
+
+// gpsEpoch is the origin of the GPS time used by PSIP, 1980-01-06 00:00:00 UTC.
+var gpsEpoch = time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC)
+
+// GPSToUTC converts a PSIP GPS time in seconds to UTC, given the GPS_UTC_offset signalled in the STT.
+func GPSToUTC(seconds uint32, gpsUTCOffset uint8) time.Time {
+	return gpsEpoch.Add(time.Duration(seconds)*time.Second - time.Duration(gpsUTCOffset)*time.Second)
+}
+
+// UTCToGPS converts a UTC time to PSIP GPS time in seconds, given the GPS_UTC_offset signalled in the STT.
+func UTCToGPS(t time.Time, gpsUTCOffset uint8) uint32 {
+	return uint32(t.Sub(gpsEpoch)/time.Second) + uint32(gpsUTCOffset)
+}
+
+// MultipleString is an ATSC multiple_string_structure: the same text in one or more languages.
+type MultipleString []LanguageString
+
+// LanguageString is the text of a multiple string structure in one language.
+type LanguageString struct {
+	Language string // ISO 639-2 three letter code.
+	Segments []StringSegment
+}
+
+// StringSegment is one segment of a language string. Segments are kept as raw bytes so that compressed
+// text survives a parse and encode round trip.
+type StringSegment struct {
+	CompressionType uint8
+	Mode            uint8
+	Data            []byte
+}
+
+// NewMultipleString builds a multiple string structure holding text in a single language.
+// Text within Latin-1 is stored in mode 0x00, anything else as UTF-16.
+func NewMultipleString(language, text string) MultipleString {
+	segment := StringSegment{Mode: StringModeLatin1}
+	for _, r := range text {
+		if r > 0xFF {
+			segment.Mode = StringModeUTF16
+			break
+		}
+	}
+	if segment.Mode == StringModeUTF16 {
+		for _, u := range utf16.Encode([]rune(text)) {
+			segment.Data = binary.BigEndian.AppendUint16(segment.Data, u)
+		}
+	} else {
+		for _, r := range text {
+			segment.Data = append(segment.Data, byte(r))
+		}
+	}
+	return MultipleString{{Language: language, Segments: []StringSegment{segment}}}
+}
+
+// String returns the text of the first language, decoding the uncompressed segments it understands.
+func (ms MultipleString) String() string {
+	if len(ms) == 0 {
+		return ""
+	}
+	var runes []rune
+	for _, segment := range ms[0].Segments {
+		if segment.CompressionType != StringCompressionNone {
+			continue
+		}
+		switch segment.Mode {
+		case StringModeLatin1:
+			for _, b := range segment.Data {
+				runes = append(runes, rune(b))
+			}
+		case StringModeUTF16:
+			units := make([]uint16, len(segment.Data)/2)
+			for i := range units {
+				units[i] = binary.BigEndian.Uint16(segment.Data[2*i:])
+			}
+			runes = append(runes, utf16.Decode(units)...)
+		}
+	}
+	return string(runes)
+}
+
+// parseMultipleString decodes a multiple string structure and returns the number of bytes it occupies.
+func parseMultipleString(data []byte) (MultipleString, int, error) {
+	if len(data) < 1 {
+		return nil, 0, ErrInvalidSection
+	}
+	count := int(data[0])
+	n := 1
+	ms := make(MultipleString, 0, count)
+	for i := 0; i < count; i++ {
+		if len(data) < n+4 {
+			return nil, 0, ErrInvalidSection
+		}
+		ls := LanguageString{Language: string(data[n : n+3])}
+		segments := int(data[n+3])
+		n += 4
+		for j := 0; j < segments; j++ {
+			if len(data) < n+3 || len(data) < n+3+int(data[n+2]) {
+				return nil, 0, ErrInvalidSection
+			}
+			length := int(data[n+2])
+			ls.Segments = append(ls.Segments, StringSegment{
+				CompressionType: data[n],
+				Mode:            data[n+1],
+				Data:            append([]byte{}, data[n+3:n+3+length]...),
+			})
+			n += 3 + length
+		}
+		ms = append(ms, ls)
+	}
+	return ms, n, nil
+}
+
+// marshal serializes the multiple string structure.
+func (ms MultipleString) marshal() []byte {
+	data := []byte{byte(len(ms))}
+	for _, ls := range ms {
+		data = append(data, (ls.Language + "   ")[:3]...)
+		data = append(data, byte(len(ls.Segments)))
+		for _, segment := range ls.Segments {
+			data = append(data, segment.CompressionType, segment.Mode, byte(len(segment.Data)))
+			data = append(data, segment.Data...)
+		}
+	}
+	return data
+}
+
+// MGT represents an ATSC Master Guide Table.
+type MGT struct {
+	Version         uint8
+	ProtocolVersion uint8
+	Tables          []MGTTable
+	Descriptors     []Descriptor
+}
+
+// MGTTable describes one PSIP table listed in the MGT.
+type MGTTable struct {
+	TableType   uint16
+	PID         uint16
+	Version     uint8
+	NumberBytes uint32 // Total length of all sections of the table.
+	Descriptors []Descriptor
+}
+
+// NewMGTTable builds the MGT entry describing the sections of a table carried on pid.
+func NewMGTTable(tableType, pid uint16, sections []*Section) MGTTable {
+	entry := MGTTable{TableType: tableType, PID: pid}
+	for _, s := range sections {
+		entry.Version = s.Version
+		entry.NumberBytes += uint32(len(s.Data))
+	}
+	return entry
+}
+
+// ParseMGT decodes an MGT from its reassembled section.
+func ParseMGT(sections ...*Section) (*MGT, error) {
+	for _, s := range sections {
+		if s.TableID != MGTTableID || !s.SectionSyntaxIndicator {
+			continue
+		}
+		body := s.Body()
+		if len(body) < 3 {
+			return nil, ErrInvalidSection
+		}
+		mgt := &MGT{Version: s.Version, ProtocolVersion: body[0]}
+		count := int(binary.BigEndian.Uint16(body[1:3]))
+		body = body[3:]
+		for i := 0; i < count; i++ {
+			if len(body) < mgtTableLength {
+				return nil, ErrInvalidSection
+			}
+			length := int(binary.BigEndian.Uint16(body[9:11]) & 0x0FFF)
+			if len(body) < mgtTableLength+length {
+				return nil, ErrInvalidSection
+			}
+			descriptors, err := ParseDescriptors(body[mgtTableLength : mgtTableLength+length])
+			if err != nil {
+				return nil, err
+			}
+			mgt.Tables = append(mgt.Tables, MGTTable{
+				TableType:   binary.BigEndian.Uint16(body[0:2]),
+				PID:         binary.BigEndian.Uint16(body[2:4]) & 0x1FFF,
+				Version:     body[4] & 0x1F,
+				NumberBytes: binary.BigEndian.Uint32(body[5:9]),
+				Descriptors: descriptors,
+			})
+			body = body[mgtTableLength+length:]
+		}
+
+		if len(body) < 2 || len(body) < 2+int(binary.BigEndian.Uint16(body[0:2])&0x0FFF) {
+			return nil, ErrInvalidSection
+		}
+		descriptors, err := ParseDescriptors(body[2 : 2+int(binary.BigEndian.Uint16(body[0:2])&0x0FFF)])
+		if err != nil {
+			return nil, err
+		}
+		mgt.Descriptors = descriptors
+		return mgt, nil
+	}
+	return nil, ErrTableNotFound
+}
+
+// Table returns the entry for the given table_type.
+func (mgt *MGT) Table(tableType uint16) (*MGTTable, error) {
+	for i := range mgt.Tables {
+		if mgt.Tables[i].TableType == tableType {
+			return &mgt.Tables[i], nil
+		}
+	}
+	return nil, ErrTableNotFound
+}
+
+// Section encodes the MGT. It returns ErrInvalidSection if the table does not fit in a single section,
+// and ErrInvalidDescriptor if a descriptor is too long to encode.
+func (mgt *MGT) Section() (*Section, error) {
+	body := []byte{mgt.ProtocolVersion}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(mgt.Tables)))
+	for _, table := range mgt.Tables {
+		descriptors, err := EncodeDescriptors(table.Descriptors)
+		if err != nil {
+			return nil, err
+		}
+		body = binary.BigEndian.AppendUint16(body, table.TableType)
+		body = binary.BigEndian.AppendUint16(body, 0xE000|table.PID&0x1FFF)
+		body = append(body, 0xE0|table.Version&0x1F)
+		body = binary.BigEndian.AppendUint32(body, table.NumberBytes)
+		body = binary.BigEndian.AppendUint16(body, 0xF000|uint16(len(descriptors))&0x0FFF)
+		body = append(body, descriptors...)
+	}
+	descriptors, err := EncodeDescriptors(mgt.Descriptors)
+	if err != nil {
+		return nil, err
+	}
+	body = binary.BigEndian.AppendUint16(body, 0xF000|uint16(len(descriptors))&0x0FFF)
+	body = append(body, descriptors...)
+
+	if longSectionHeaderLen-sectionHeaderLength+len(body)+crcLength > maxSectionLength {
+		return nil, ErrInvalidSection
+	}
+	s := psipSection(PSIPBasePID, MGTTableID, 0x0000, mgt.Version)
+	s.Marshal(body)
+	return s, nil
+}
+
+// Encode packetizes the MGT onto the PSIP base PID starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (mgt *MGT) Encode(cc uint8) (EncodedPackets, uint8, error) {
+	s, err := mgt.Section()
+	if err != nil {
+		return nil, cc, err
+	}
+	packets, cc := PacketizeSections(PSIPBasePID, cc, s.Data)
+	return packets, cc, nil
+}
+
+// STT represents an ATSC System Time Table.
+type STT struct {
+	ProtocolVersion uint8
+	SystemTime      uint32 // Seconds since the GPS epoch.
+	GPSUTCOffset    uint8  // Leap seconds between GPS and UTC.
+	DSStatus        bool   // Daylight saving time is in effect.
+	DSDayOfMonth    uint8  // 5 bits; day of the next transition, 0 when none is scheduled.
+	DSHour          uint8  // Hour of the next transition.
+	Descriptors     []Descriptor
+}
+
+// NewSTT builds an STT for the given UTC time.
+func NewSTT(t time.Time, gpsUTCOffset uint8) *STT {
+	return &STT{SystemTime: UTCToGPS(t, gpsUTCOffset), GPSUTCOffset: gpsUTCOffset}
+}
+
+// UTC returns the system time in UTC.
+func (stt *STT) UTC() time.Time {
+	return GPSToUTC(stt.SystemTime, stt.GPSUTCOffset)
+}
+
+// ParseSTT decodes an STT from its reassembled section.
+func ParseSTT(s *Section) (*STT, error) {
+	if s.TableID != STTTableID {
+		return nil, ErrTableNotFound
+	}
+	body := s.Body()
+	if len(body) < sttBodyLength {
+		return nil, ErrInvalidSection
+	}
+	descriptors, err := ParseDescriptors(body[sttBodyLength:])
+	if err != nil {
+		return nil, err
+	}
+	return &STT{
+		ProtocolVersion: body[0],
+		SystemTime:      binary.BigEndian.Uint32(body[1:5]),
+		GPSUTCOffset:    body[5],
+		DSStatus:        body[6]&0x80 != 0,
+		DSDayOfMonth:    body[6] & 0x1F,
+		DSHour:          body[7],
+		Descriptors:     descriptors,
+	}, nil
+}
+
+// Section encodes the STT. It returns ErrInvalidDescriptor if a descriptor is too long to encode.
+func (stt *STT) Section() (*Section, error) {
+	descriptors, err := EncodeDescriptors(stt.Descriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	body := []byte{stt.ProtocolVersion}
+	body = binary.BigEndian.AppendUint32(body, stt.SystemTime)
+	ds := 0x60 | stt.DSDayOfMonth&0x1F
+	if stt.DSStatus {
+		ds |= 0x80
+	}
+	body = append(body, stt.GPSUTCOffset, ds, stt.DSHour)
+	body = append(body, descriptors...)
+
+	s := psipSection(PSIPBasePID, STTTableID, 0x0000, 0)
+	s.Marshal(body)
+	return s, nil
+}
+
+// Encode packetizes the STT onto the PSIP base PID starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (stt *STT) Encode(cc uint8) (EncodedPackets, uint8, error) {
+	s, err := stt.Section()
+	if err != nil {
+		return nil, cc, err
+	}
+	packets, next := PacketizeSections(PSIPBasePID, cc, s.Data)
+	return packets, next, nil
+}
+
+// psipSection returns the header of a single current PSIP section. PSIP sections set the private_indicator.
+func psipSection(pid uint16, tableID uint8, extension uint16, version uint8) *Section {
+	return &Section{
+		PID:                    pid,
+		TableID:                tableID,
+		SectionSyntaxIndicator: true,
+		PrivateIndicator:       true,
+		TableIDExtension:       extension,
+		Version:                version,
+		CurrentNext:            true,
+	}
+}
@@ -0,0 +1,94 @@
+package mpegts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGPSTime(t *testing.T) {
+	utc := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, uint32(1388102418), UTCToGPS(utc, 18))
+	assert.Equal(t, utc, GPSToUTC(1388102418, 18))
+}
+
+func TestMultipleString(t *testing.T) {
+	ms := NewMultipleString("eng", "Café")
+	assert.Equal(t, StringModeLatin1, int(ms[0].Segments[0].Mode))
+	assert.Equal(t, []byte{0x01, 'e', 'n', 'g', 0x01, 0x00, 0x00, 0x04, 'C', 'a', 'f', 0xE9}, ms.marshal())
+	assert.Equal(t, "Café", ms.String())
+
+	parsed, n, err := parseMultipleString(ms.marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, 12, n)
+	assert.Equal(t, ms, parsed)
+
+	ms = NewMultipleString("jpn", "ニュース")
+	assert.Equal(t, StringModeUTF16, int(ms[0].Segments[0].Mode))
+	assert.Equal(t, "ニュース", ms.String())
+
+	assert.Equal(t, "", MultipleString(nil).String())
+	_, _, err = parseMultipleString([]byte{0x01, 'e', 'n', 'g', 0x01, 0x00, 0x00, 0x04, 'C'})
+	assert.ErrorIs(t, err, ErrInvalidSection)
+}
+
+func TestMGTRoundTrip(t *testing.T) {
+	vct := testVCT()
+	eit := &EIT{SourceID: 1, CurrentNext: true}
+	vctSections, err := vct.Sections()
+	assert.NoError(t, err)
+	eitSections, err := eit.Sections()
+	assert.NoError(t, err)
+	mgt := &MGT{
+		Version: 4,
+		Tables: []MGTTable{
+			NewMGTTable(MGTTableTypeTVCTCurrent, PSIPBasePID, vctSections),
+			NewMGTTable(MGTTableTypeEITBase, 0x1D00, eitSections),
+		},
+	}
+	mgt.Tables[1].Descriptors = []Descriptor{{Tag: 0xAA, Data: []byte{1}}}
+	assert.Equal(t, uint32(len(vctSections[0].Data)), mgt.Tables[0].NumberBytes)
+
+	packets, cc, err := mgt.Encode(0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(1), cc)
+	assert.Equal(t, uint16(PSIPBasePID), packets[0].GetPID())
+
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+	assert.True(t, sections[0].PrivateIndicator)
+
+	parsed, err := ParseMGT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, mgt, parsed)
+
+	table, err := parsed.Table(MGTTableTypeEITBase)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x1D00), table.PID)
+	_, err = parsed.Table(MGTTableTypeCVCTCurrent)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	_, err = ParseMGT()
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestSTTRoundTrip(t *testing.T) {
+	utc := time.Date(2024, time.March, 10, 6, 59, 30, 0, time.UTC)
+	stt := NewSTT(utc, 18)
+	stt.DSDayOfMonth = 10
+	stt.DSHour = 2
+
+	packets, _, err := stt.Encode(0)
+	assert.NoError(t, err)
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+
+	parsed, err := ParseSTT(sections[0])
+	assert.NoError(t, err)
+	assert.Equal(t, stt, parsed)
+	assert.Equal(t, utc, parsed.UTC())
+
+	_, err = ParseSTT(&Section{TableID: MGTTableID})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
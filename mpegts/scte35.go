@@ -0,0 +1,644 @@
+package mpegts
+
+import "encoding/binary"
+
+const (
+	SCTE35TableID = 0xFC // splice_info_section.
+
+	// SCTE35Identifier is the identifier ("CUEI") carried by every SCTE-35 splice descriptor.
+	SCTE35Identifier = 0x43554549
+
+	spliceInfoHeaderLength = 11 // protocol_version up to and including splice_command_type.
+	spliceTimeLength       = 5  // splice_time with a PTS.
+	breakDurationLength    = 5
+	spliceDescriptorHeader = 6 // splice_descriptor_tag, descriptor_length and identifier.
+)
+
+// splice_command_type values.
+const (
+	SpliceNull           = 0x00
+	SpliceSchedule       = 0x04
+	SpliceInsertCommand  = 0x05
+	TimeSignal           = 0x06
+	BandwidthReservation = 0x07
+	PrivateCommand       = 0xFF
+)
+
+// splice_descriptor_tag values.
+const (
+	AvailDescriptorTag        = 0x00
+	DTMFDescriptorTag         = 0x01
+	SegmentationDescriptorTag = 0x02
+	TimeDescriptorTag         = 0x03
+	AudioDescriptorTag        = 0x04
+)
+
+// segmentation_upid_type values.
+const (
+	UPIDNotUsed     = 0x00
+	UPIDUserDefined = 0x01 // Deprecated.
+	UPIDISCI        = 0x02 // Deprecated.
+	UPIDAdID        = 0x03
+	UPIDUMID        = 0x04
+	UPIDISANLegacy  = 0x05 // Deprecated.
+	UPIDISAN        = 0x06
+	UPIDTID         = 0x07
+	UPIDTI          = 0x08
+	UPIDADI         = 0x09
+	UPIDEIDR        = 0x0A
+	UPIDATSC        = 0x0B
+	UPIDMPU         = 0x0C
+	UPIDMID         = 0x0D
+	UPIDADS         = 0x0E
+	UPIDURI         = 0x0F
+	UPIDUUID        = 0x10
+	UPIDSCR         = 0x11
+)
+
+// SpliceInfo represents an SCTE-35 splice_info_section.
+type SpliceInfo struct {
+	ProtocolVersion uint8
+	SAPType         uint8  // 2 bits; 3 when not specified.
+	PTSAdjustment   uint64 // 33 bits, 90 kHz, added to every PTS in the section.
+	CWIndex         uint8
+	Tier            uint16 // 12 bits.
+	CommandType     uint8
+	Insert          *SpliceInsert // Set for splice_insert.
+	TimeSignal      *SpliceTime   // Set for time_signal.
+	CommandData     []byte        // Raw command bytes for splice_schedule, private_command and unknown commands.
+	Descriptors     []SpliceDescriptor
+}
+
+// SpliceTime represents a splice_time structure. Without a specified time the splice happens immediately
+// or at a time decided by the splicer.
+type SpliceTime struct {
+	TimeSpecified bool
+	PTS           PTS
+}
+
+// BreakDuration represents a break_duration structure.
+type BreakDuration struct {
+	AutoReturn bool
+	Duration   uint64 // 33 bits, 90 kHz.
+}
+
+// SpliceInsert represents a splice_insert command.
+type SpliceInsert struct {
+	EventID           uint32
+	EventCancel       bool
+	OutOfNetwork      bool
+	ProgramSplice     bool
+	SpliceImmediate   bool
+	EventIDCompliance bool
+	SpliceTime        SpliceTime // Used when ProgramSplice is set and SpliceImmediate is not.
+	Components        []SpliceComponent
+	BreakDuration     *BreakDuration
+	UniqueProgramID   uint16
+	AvailNum          uint8
+	AvailsExpected    uint8
+}
+
+// SpliceComponent is a component entry of a splice_insert command that does not splice the whole program.
+type SpliceComponent struct {
+	Tag        uint8
+	SpliceTime SpliceTime // Used when SpliceImmediate is not set.
+}
+
+// SpliceDescriptor is a splice descriptor of a splice_info_section, kept as raw bytes.
+type SpliceDescriptor struct {
+	Tag        uint8
+	Identifier uint32 // SCTE35Identifier for descriptors defined by SCTE-35.
+	Data       []byte // Bytes following the identifier.
+}
+
+// SegmentationDescriptor represents a segmentation_descriptor.
+type SegmentationDescriptor struct {
+	EventID               uint32
+	EventCancel           bool
+	EventIDCompliance     bool
+	ProgramSegmentation   bool
+	DeliveryNotRestricted bool
+	WebDeliveryAllowed    bool
+	NoRegionalBlackout    bool
+	ArchiveAllowed        bool
+	DeviceRestrictions    uint8 // 2 bits.
+	Components            []SegmentationComponent
+	HasDuration           bool
+	Duration              uint64 // 40 bits, 90 kHz.
+	UPID                  SegmentationUPID
+	TypeID                uint8
+	SegmentNum            uint8
+	SegmentsExpected      uint8
+	HasSubSegments        bool
+	SubSegmentNum         uint8
+	SubSegmentsExpected   uint8
+}
+
+// SegmentationComponent is a component entry of a segmentation descriptor.
+type SegmentationComponent struct {
+	Tag       uint8
+	PTSOffset uint64 // 33 bits, 90 kHz.
+}
+
+// SegmentationUPID is the segmentation_upid of a segmentation descriptor.
+type SegmentationUPID struct {
+	Type  uint8
+	Value []byte
+}
+
+// MID splits a UPID of type MID into the UPIDs it carries.
+func (u SegmentationUPID) MID() ([]SegmentationUPID, error) {
+	if u.Type != UPIDMID {
+		return nil, ErrInvalidSection
+	}
+	var upids []SegmentationUPID
+	for data := u.Value; len(data) > 0; {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return nil, ErrInvalidSection
+		}
+		upids = append(upids, SegmentationUPID{Type: data[0], Value: append([]byte{}, data[2:2+int(data[1])]...)})
+		data = data[2+int(data[1]):]
+	}
+	return upids, nil
+}
+
+// NewMIDUPID builds a UPID of type MID carrying the given UPIDs.
+func NewMIDUPID(upids ...SegmentationUPID) SegmentationUPID {
+	var value []byte
+	for _, u := range upids {
+		value = append(value, u.Type, byte(len(u.Value)))
+		value = append(value, u.Value...)
+	}
+	return SegmentationUPID{Type: UPIDMID, Value: value}
+}
+
+// hasSubSegments reports whether segmentation descriptors of the type carry sub_segment fields: the
+// Provider and Distributor Placement Opportunity Starts, the Provider and Distributor Overlay Placement
+// Opportunity Starts, and the Provider and Distributor Ad Block Starts.
+func hasSubSegments(typeID uint8) bool {
+	switch typeID {
+	case 0x34, 0x36, 0x38, 0x3A, 0x44, 0x46:
+		return true
+	}
+	return false
+}
+
+// ParseSpliceInfo decodes a splice_info_section, verifying its CRC.
+// Encrypted sections return ErrEncryptedSplice.
+func ParseSpliceInfo(s *Section) (*SpliceInfo, error) {
+	if s.TableID != SCTE35TableID {
+		return nil, ErrTableNotFound
+	}
+	data := s.Data
+	if len(data) < sectionHeaderLength+spliceInfoHeaderLength+2+crcLength {
+		return nil, ErrInvalidSection
+	}
+	if CRC32(data) != 0 {
+		return nil, ErrCRCMismatch
+	}
+
+	si := &SpliceInfo{SAPType: (data[1] >> 4) & 0x03}
+	body := data[sectionHeaderLength : len(data)-crcLength]
+	si.ProtocolVersion = body[0]
+	if body[1]&0x80 != 0 {
+		return nil, ErrEncryptedSplice
+	}
+	si.PTSAdjustment = uint64(body[1]&0x01)<<32 | uint64(binary.BigEndian.Uint32(body[2:6]))
+	si.CWIndex = body[6]
+	si.Tier = binary.BigEndian.Uint16(body[7:9]) >> 4
+	commandLength := int(binary.BigEndian.Uint16(body[8:10]) & 0x0FFF)
+	si.CommandType = body[10]
+	body = body[spliceInfoHeaderLength:]
+
+	if commandLength == 0x0FFF {
+		// Legacy encoders signal an unknown length; only commands of implied length can be decoded.
+		length, err := spliceCommandLength(si.CommandType, body)
+		if err != nil {
+			return nil, err
+		}
+		commandLength = length
+	}
+	if len(body) < commandLength+2 {
+		return nil, ErrInvalidSection
+	}
+	if err := si.parseCommand(body[:commandLength]); err != nil {
+		return nil, err
+	}
+	body = body[commandLength:]
+
+	loopLength := int(binary.BigEndian.Uint16(body[0:2]))
+	body = body[2:]
+	if len(body) < loopLength {
+		return nil, ErrInvalidSection
+	}
+	for loop := body[:loopLength]; len(loop) > 0; {
+		if len(loop) < 2 || len(loop) < 2+int(loop[1]) || loop[1] < 4 {
+			return nil, ErrInvalidSection
+		}
+		si.Descriptors = append(si.Descriptors, SpliceDescriptor{
+			Tag:        loop[0],
+			Identifier: binary.BigEndian.Uint32(loop[2:6]),
+			Data:       append([]byte{}, loop[spliceDescriptorHeader:2+int(loop[1])]...),
+		})
+		loop = loop[2+int(loop[1]):]
+	}
+	return si, nil
+}
+
+// spliceCommandLength returns the length of a command whose splice_command_length is not given.
+func spliceCommandLength(commandType uint8, data []byte) (int, error) {
+	switch commandType {
+	case SpliceNull, BandwidthReservation:
+		return 0, nil
+	case TimeSignal:
+		if len(data) < 1 {
+			return 0, ErrInvalidSection
+		}
+		return spliceTimeSize(data[0]), nil
+	case SpliceInsertCommand:
+		si := &SpliceInfo{CommandType: commandType}
+		return si.parseSpliceInsert(data)
+	}
+	return 0, ErrInvalidSection
+}
+
+// parseCommand decodes the splice command bytes into si.
+func (si *SpliceInfo) parseCommand(data []byte) error {
+	switch si.CommandType {
+	case SpliceNull, BandwidthReservation:
+		return nil
+	case TimeSignal:
+		st, _, err := parseSpliceTime(data)
+		if err != nil {
+			return err
+		}
+		si.TimeSignal = &st
+		return nil
+	case SpliceInsertCommand:
+		_, err := si.parseSpliceInsert(data)
+		return err
+	}
+	si.CommandData = append([]byte{}, data...)
+	return nil
+}
+
+// parseSpliceInsert decodes a splice_insert command into si and returns its length.
+func (si *SpliceInfo) parseSpliceInsert(data []byte) (int, error) {
+	if len(data) < 5 {
+		return 0, ErrInvalidSection
+	}
+	ins := &SpliceInsert{
+		EventID:     binary.BigEndian.Uint32(data[0:4]),
+		EventCancel: data[4]&0x80 != 0,
+	}
+	n := 5
+	if !ins.EventCancel {
+		if len(data) < n+1 {
+			return 0, ErrInvalidSection
+		}
+		flags := data[n]
+		n++
+		ins.OutOfNetwork = flags&0x80 != 0
+		ins.ProgramSplice = flags&0x40 != 0
+		hasDuration := flags&0x20 != 0
+		ins.SpliceImmediate = flags&0x10 != 0
+		ins.EventIDCompliance = flags&0x08 != 0
+
+		if ins.ProgramSplice && !ins.SpliceImmediate {
+			st, size, err := parseSpliceTime(data[n:])
+			if err != nil {
+				return 0, err
+			}
+			ins.SpliceTime = st
+			n += size
+		}
+		if !ins.ProgramSplice {
+			if len(data) < n+1 {
+				return 0, ErrInvalidSection
+			}
+			count := int(data[n])
+			n++
+			for i := 0; i < count; i++ {
+				if len(data) < n+1 {
+					return 0, ErrInvalidSection
+				}
+				c := SpliceComponent{Tag: data[n]}
+				n++
+				if !ins.SpliceImmediate {
+					st, size, err := parseSpliceTime(data[n:])
+					if err != nil {
+						return 0, err
+					}
+					c.SpliceTime = st
+					n += size
+				}
+				ins.Components = append(ins.Components, c)
+			}
+		}
+		if hasDuration {
+			if len(data) < n+breakDurationLength {
+				return 0, ErrInvalidSection
+			}
+			ins.BreakDuration = &BreakDuration{
+				AutoReturn: data[n]&0x80 != 0,
+				Duration:   decodePTS33(data[n:]),
+			}
+			n += breakDurationLength
+		}
+		if len(data) < n+4 {
+			return 0, ErrInvalidSection
+		}
+		ins.UniqueProgramID = binary.BigEndian.Uint16(data[n : n+2])
+		ins.AvailNum = data[n+2]
+		ins.AvailsExpected = data[n+3]
+		n += 4
+	}
+	si.Insert = ins
+	return n, nil
+}
+
+// spliceTimeSize returns the length of a splice_time structure from its first byte.
+func spliceTimeSize(b byte) int {
+	if b&0x80 != 0 {
+		return spliceTimeLength
+	}
+	return 1
+}
+
+// parseSpliceTime decodes a splice_time structure and returns its length.
+func parseSpliceTime(data []byte) (SpliceTime, int, error) {
+	if len(data) < 1 || len(data) < spliceTimeSize(data[0]) {
+		return SpliceTime{}, 0, ErrInvalidSection
+	}
+	if data[0]&0x80 == 0 {
+		return SpliceTime{}, 1, nil
+	}
+	return SpliceTime{TimeSpecified: true, PTS: PTS(decodePTS33(data))}, spliceTimeLength, nil
+}
+
+// marshal serializes the splice_time structure.
+func (st SpliceTime) marshal() []byte {
+	if !st.TimeSpecified {
+		return []byte{0x7F}
+	}
+	return encodePTS33(0xFE, uint64(st.PTS))
+}
+
+// marshal serializes the splice_insert command.
+func (ins *SpliceInsert) marshal() []byte {
+	data := binary.BigEndian.AppendUint32(nil, ins.EventID)
+	if ins.EventCancel {
+		return append(data, 0xFF)
+	}
+	data = append(data, 0x7F)
+
+	flags := byte(0x07)
+	if ins.OutOfNetwork {
+		flags |= 0x80
+	}
+	if ins.ProgramSplice {
+		flags |= 0x40
+	}
+	if ins.BreakDuration != nil {
+		flags |= 0x20
+	}
+	if ins.SpliceImmediate {
+		flags |= 0x10
+	}
+	if ins.EventIDCompliance {
+		flags |= 0x08
+	}
+	data = append(data, flags)
+
+	if ins.ProgramSplice && !ins.SpliceImmediate {
+		data = append(data, ins.SpliceTime.marshal()...)
+	}
+	if !ins.ProgramSplice {
+		data = append(data, byte(len(ins.Components)))
+		for _, c := range ins.Components {
+			data = append(data, c.Tag)
+			if !ins.SpliceImmediate {
+				data = append(data, c.SpliceTime.marshal()...)
+			}
+		}
+	}
+	if ins.BreakDuration != nil {
+		prefix := byte(0x7E)
+		if ins.BreakDuration.AutoReturn {
+			prefix |= 0x80
+		}
+		data = append(data, encodePTS33(prefix, ins.BreakDuration.Duration)...)
+	}
+	data = binary.BigEndian.AppendUint16(data, ins.UniqueProgramID)
+	return append(data, ins.AvailNum, ins.AvailsExpected)
+}
+
+// command serializes the splice command of si.
+func (si *SpliceInfo) command() []byte {
+	switch {
+	case si.CommandType == SpliceInsertCommand && si.Insert != nil:
+		return si.Insert.marshal()
+	case si.CommandType == TimeSignal && si.TimeSignal != nil:
+		return si.TimeSignal.marshal()
+	case si.CommandType == TimeSignal:
+		return SpliceTime{}.marshal()
+	}
+	return si.CommandData
+}
+
+// AdjustedPTS applies the section's pts_adjustment to a PTS carried in it, wrapping at 33 bits.
+func (si *SpliceInfo) AdjustedPTS(pts PTS) PTS {
+	return NewPTS(uint64(pts) + si.PTSAdjustment)
+}
+
+// Section encodes the splice_info_section, including its CRC.
+func (si *SpliceInfo) Section() *Section {
+	command := si.command()
+
+	var descriptors []byte
+	for _, d := range si.Descriptors {
+		descriptors = append(descriptors, d.Tag, byte(4+len(d.Data)))
+		descriptors = binary.BigEndian.AppendUint32(descriptors, d.Identifier)
+		descriptors = append(descriptors, d.Data...)
+	}
+
+	body := make([]byte, spliceInfoHeaderLength, spliceInfoHeaderLength+len(command)+2+len(descriptors)+crcLength)
+	body[0] = si.ProtocolVersion
+	body[1] = byte(si.PTSAdjustment>>32) & 0x01 // Not encrypted.
+	binary.BigEndian.PutUint32(body[2:6], uint32(si.PTSAdjustment))
+	body[6] = si.CWIndex
+	binary.BigEndian.PutUint16(body[7:9], si.Tier<<4)
+	body[8] |= byte(len(command)>>8) & 0x0F
+	body[9] = byte(len(command))
+	body[10] = si.CommandType
+	body = append(body, command...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(descriptors)))
+	body = append(body, descriptors...)
+	body = append(body, make([]byte, crcLength)...)
+
+	s := &Section{TableID: SCTE35TableID}
+	data := s.Marshal(body)
+	data[1] = data[1]&0xCF | (si.SAPType&0x03)<<4
+	binary.BigEndian.PutUint32(data[len(data)-crcLength:], CRC32(data[:len(data)-crcLength]))
+	return s
+}
+
+// Encode packetizes the splice_info_section onto pid starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (si *SpliceInfo) Encode(pid uint16, cc uint8) (EncodedPackets, uint8) {
+	s := si.Section()
+	s.PID = pid
+	return PacketizeSections(pid, cc, s.Data)
+}
+
+// SegmentationDescriptors returns the decoded segmentation descriptors of the section.
+func (si *SpliceInfo) SegmentationDescriptors() ([]*SegmentationDescriptor, error) {
+	var sds []*SegmentationDescriptor
+	for _, d := range si.Descriptors {
+		if d.Tag != SegmentationDescriptorTag || d.Identifier != SCTE35Identifier {
+			continue
+		}
+		sd, err := ParseSegmentationDescriptor(d)
+		if err != nil {
+			return nil, err
+		}
+		sds = append(sds, sd)
+	}
+	return sds, nil
+}
+
+// ParseSegmentationDescriptor decodes a segmentation_descriptor.
+func ParseSegmentationDescriptor(d SpliceDescriptor) (*SegmentationDescriptor, error) {
+	data := d.Data
+	if d.Tag != SegmentationDescriptorTag || len(data) < 5 {
+		return nil, ErrInvalidSection
+	}
+	sd := &SegmentationDescriptor{
+		EventID:           binary.BigEndian.Uint32(data[0:4]),
+		EventCancel:       data[4]&0x80 != 0,
+		EventIDCompliance: data[4]&0x40 != 0,
+	}
+	if sd.EventCancel {
+		return sd, nil
+	}
+
+	data = data[5:]
+	if len(data) < 1 {
+		return nil, ErrInvalidSection
+	}
+	flags := data[0]
+	data = data[1:]
+	sd.ProgramSegmentation = flags&0x80 != 0
+	sd.HasDuration = flags&0x40 != 0
+	sd.DeliveryNotRestricted = flags&0x20 != 0
+	if !sd.DeliveryNotRestricted {
+		sd.WebDeliveryAllowed = flags&0x10 != 0
+		sd.NoRegionalBlackout = flags&0x08 != 0
+		sd.ArchiveAllowed = flags&0x04 != 0
+		sd.DeviceRestrictions = flags & 0x03
+	}
+
+	if !sd.ProgramSegmentation {
+		if len(data) < 1 || len(data) < 1+int(data[0])*6 {
+			return nil, ErrInvalidSection
+		}
+		count := int(data[0])
+		data = data[1:]
+		for i := 0; i < count; i++ {
+			sd.Components = append(sd.Components, SegmentationComponent{Tag: data[0], PTSOffset: decodePTS33(data[1:])})
+			data = data[6:]
+		}
+	}
+
+	if sd.HasDuration {
+		if len(data) < 5 {
+			return nil, ErrInvalidSection
+		}
+		sd.Duration = uint64(data[0])<<32 | uint64(binary.BigEndian.Uint32(data[1:5]))
+		data = data[5:]
+	}
+
+	if len(data) < 2 || len(data) < 2+int(data[1])+3 {
+		return nil, ErrInvalidSection
+	}
+	sd.UPID = SegmentationUPID{Type: data[0], Value: append([]byte{}, data[2:2+int(data[1])]...)}
+	data = data[2+int(data[1]):]
+
+	sd.TypeID, sd.SegmentNum, sd.SegmentsExpected = data[0], data[1], data[2]
+	data = data[3:]
+	// sub_segment fields were added in later revisions; older encoders may omit them.
+	if hasSubSegments(sd.TypeID) && len(data) >= 2 {
+		sd.HasSubSegments = true
+		sd.SubSegmentNum, sd.SubSegmentsExpected = data[0], data[1]
+	}
+	return sd, nil
+}
+
+// Descriptor encodes the segmentation descriptor.
+func (sd *SegmentationDescriptor) Descriptor() SpliceDescriptor {
+	data := binary.BigEndian.AppendUint32(nil, sd.EventID)
+	flags := byte(0x3F)
+	if sd.EventCancel {
+		flags |= 0x80
+	}
+	if sd.EventIDCompliance {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+
+	if !sd.EventCancel {
+		flags = 0
+		if sd.ProgramSegmentation {
+			flags |= 0x80
+		}
+		if sd.HasDuration {
+			flags |= 0x40
+		}
+		if sd.DeliveryNotRestricted {
+			flags |= 0x3F
+		} else {
+			if sd.WebDeliveryAllowed {
+				flags |= 0x10
+			}
+			if sd.NoRegionalBlackout {
+				flags |= 0x08
+			}
+			if sd.ArchiveAllowed {
+				flags |= 0x04
+			}
+			flags |= sd.DeviceRestrictions & 0x03
+		}
+		data = append(data, flags)
+
+		if !sd.ProgramSegmentation {
+			data = append(data, byte(len(sd.Components)))
+			for _, c := range sd.Components {
+				data = append(data, c.Tag)
+				data = append(data, encodePTS33(0xFE, c.PTSOffset)...)
+			}
+		}
+		if sd.HasDuration {
+			data = append(data, byte(sd.Duration>>32))
+			data = binary.BigEndian.AppendUint32(data, uint32(sd.Duration))
+		}
+		data = append(data, sd.UPID.Type, byte(len(sd.UPID.Value)))
+		data = append(data, sd.UPID.Value...)
+		data = append(data, sd.TypeID, sd.SegmentNum, sd.SegmentsExpected)
+		if sd.HasSubSegments {
+			data = append(data, sd.SubSegmentNum, sd.SubSegmentsExpected)
+		}
+	}
+	return SpliceDescriptor{Tag: SegmentationDescriptorTag, Identifier: SCTE35Identifier, Data: data}
+}
+
+// decodePTS33 decodes a 33-bit value stored in the low bit of b[0] and the following four bytes.
+func decodePTS33(b []byte) uint64 {
+	return uint64(b[0]&0x01)<<32 | uint64(binary.BigEndian.Uint32(b[1:5]))
+}
+
+// encodePTS33 encodes a 33-bit value into five bytes, the first carrying prefix in its upper seven bits.
+func encodePTS33(prefix byte, v uint64) []byte {
+	b := []byte{prefix&0xFE | byte(v>>32)&0x01, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(v))
+	return b
+}
@@ -0,0 +1,172 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Sample sections from SCTE 35 section 14.
+var (
+	testTimeSignal, _   = hex.DecodeString("fc3034000000000000fffff00506fe72bd0050001e021c435545494800008e7fcf0001a599b00808000000002ca0a18a3402009ac9d17e")
+	testSpliceInsert, _ = hex.DecodeString("fc302f000000000000fffff014054800008f7feffe7369c02efe0052ccf500000000000a0008435545490000013562dba30a")
+)
+
+func TestParseSpliceInfoTimeSignal(t *testing.T) {
+	s, err := ParseSection(0x1F0, testTimeSignal)
+	assert.NoError(t, err)
+
+	si, err := ParseSpliceInfo(s)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(3), si.SAPType)
+	assert.Equal(t, uint16(0xFFF), si.Tier)
+	assert.Equal(t, uint8(TimeSignal), si.CommandType)
+	assert.Equal(t, &SpliceTime{TimeSpecified: true, PTS: 0x072BD0050}, si.TimeSignal)
+
+	sds, err := si.SegmentationDescriptors()
+	assert.NoError(t, err)
+	assert.Len(t, sds, 1)
+	sd := sds[0]
+	assert.Equal(t, uint32(0x4800008E), sd.EventID)
+	assert.True(t, sd.EventIDCompliance)
+	assert.True(t, sd.ProgramSegmentation)
+	assert.True(t, sd.HasDuration)
+	assert.Equal(t, uint64(0x0001A599B0), sd.Duration)
+	assert.False(t, sd.DeliveryNotRestricted)
+	assert.True(t, sd.NoRegionalBlackout)
+	assert.True(t, sd.ArchiveAllowed)
+	assert.Equal(t, uint8(3), sd.DeviceRestrictions)
+	assert.Equal(t, SegmentationUPID{Type: UPIDTI, Value: []byte{0, 0, 0, 0, 0x2C, 0xA0, 0xA1, 0x8A}}, sd.UPID)
+	assert.Equal(t, uint8(0x34), sd.TypeID)
+	assert.Equal(t, uint8(2), sd.SegmentNum)
+	assert.Equal(t, uint8(0), sd.SegmentsExpected)
+	assert.False(t, sd.HasSubSegments)
+
+	assert.Equal(t, testTimeSignal, si.Section().Data)
+	assert.Equal(t, si.Descriptors[0], sd.Descriptor())
+}
+
+func TestParseSpliceInfoInsert(t *testing.T) {
+	s, err := ParseSection(0x1F0, testSpliceInsert)
+	assert.NoError(t, err)
+
+	si, err := ParseSpliceInfo(s)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(SpliceInsertCommand), si.CommandType)
+	assert.Equal(t, &SpliceInsert{
+		EventID:           0x4800008F,
+		OutOfNetwork:      true,
+		ProgramSplice:     true,
+		EventIDCompliance: true,
+		SpliceTime:        SpliceTime{TimeSpecified: true, PTS: 0x07369C02E},
+		BreakDuration:     &BreakDuration{AutoReturn: true, Duration: 0x00052CCF5},
+	}, si.Insert)
+	assert.Equal(t, []SpliceDescriptor{{Tag: AvailDescriptorTag, Identifier: SCTE35Identifier, Data: []byte{0, 0, 1, 0x35}}}, si.Descriptors)
+
+	assert.Equal(t, testSpliceInsert, si.Section().Data)
+}
+
+func TestSpliceInfoRoundTrip(t *testing.T) {
+	sd := &SegmentationDescriptor{
+		EventID:             1,
+		Components:          []SegmentationComponent{{Tag: 1, PTSOffset: 900}, {Tag: 2, PTSOffset: 0x1FFFFFFFF}},
+		UPID:                NewMIDUPID(SegmentationUPID{Type: UPIDAdID, Value: []byte("ABCD01234567")}, SegmentationUPID{Type: UPIDURI, Value: []byte("urn:tribd")}),
+		TypeID:              0x36,
+		SegmentNum:          1,
+		SegmentsExpected:    1,
+		HasSubSegments:      true,
+		SubSegmentNum:       1,
+		SubSegmentsExpected: 4,
+	}
+	tests := []*SpliceInfo{
+		{SAPType: 3, CommandType: SpliceNull, Tier: 0xFFF},
+		{SAPType: 3, CommandType: BandwidthReservation, Tier: 0xFFF},
+		{SAPType: 1, CommandType: TimeSignal, TimeSignal: &SpliceTime{}, PTSAdjustment: 0x1FFFFFFFF, Descriptors: []SpliceDescriptor{sd.Descriptor()}},
+		{CommandType: SpliceInsertCommand, Insert: &SpliceInsert{EventID: 7, EventCancel: true}},
+		{CommandType: SpliceInsertCommand, Insert: &SpliceInsert{
+			EventID:         8,
+			SpliceImmediate: true,
+			Components:      []SpliceComponent{{Tag: 1}, {Tag: 2}},
+			AvailNum:        1,
+			AvailsExpected:  2,
+		}},
+		{CommandType: SpliceInsertCommand, Insert: &SpliceInsert{
+			EventID:    9,
+			Components: []SpliceComponent{{Tag: 1, SpliceTime: SpliceTime{TimeSpecified: true, PTS: 1234}}},
+		}},
+		{CommandType: PrivateCommand, CommandData: []byte{'T', 'R', 'B', 'D', 1, 2, 3}},
+	}
+
+	for _, si := range tests {
+		packets, cc := si.Encode(0x1F0, 0)
+		assert.Len(t, packets, 1)
+		assert.Equal(t, uint8(1), cc)
+
+		sections := reassemble(t, packets)
+		assert.Len(t, sections, 1)
+		parsed, err := ParseSpliceInfo(sections[0])
+		assert.NoError(t, err)
+		assert.Equal(t, si, parsed)
+	}
+
+	parsed, err := ParseSegmentationDescriptor(sd.Descriptor())
+	assert.NoError(t, err)
+	assert.Equal(t, sd, parsed)
+
+	upids, err := parsed.UPID.MID()
+	assert.NoError(t, err)
+	assert.Equal(t, []SegmentationUPID{{Type: UPIDAdID, Value: []byte("ABCD01234567")}, {Type: UPIDURI, Value: []byte("urn:tribd")}}, upids)
+}
+
+func TestSegmentationAdBlockSubSegments(t *testing.T) {
+	for _, typeID := range []uint8{0x44, 0x46} { // Provider and Distributor Ad Block Start.
+		sd := &SegmentationDescriptor{
+			EventID:             2,
+			ProgramSegmentation: true,
+			UPID:                SegmentationUPID{Type: UPIDAdID, Value: []byte("ABCD01234567")},
+			TypeID:              typeID,
+			SegmentNum:          1,
+			SegmentsExpected:    1,
+			HasSubSegments:      true,
+			SubSegmentNum:       2,
+			SubSegmentsExpected: 3,
+		}
+		d := sd.Descriptor()
+		assert.Equal(t, []byte{typeID, 1, 1, 2, 3}, d.Data[len(d.Data)-5:])
+		parsed, err := ParseSegmentationDescriptor(d)
+		assert.NoError(t, err)
+		assert.Equal(t, sd, parsed)
+	}
+}
+
+func TestSpliceInfoAdjustedPTS(t *testing.T) {
+	si := &SpliceInfo{PTSAdjustment: 100}
+	assert.Equal(t, PTS(1100), si.AdjustedPTS(1000))
+	assert.Equal(t, PTS(99), si.AdjustedPTS(0x1FFFFFFFF))
+}
+
+func TestParseSpliceInfoErrors(t *testing.T) {
+	data := append([]byte{}, testSpliceInsert...)
+	data[len(data)-1]++
+	s, err := ParseSection(0x1F0, data)
+	assert.NoError(t, err)
+	_, err = ParseSpliceInfo(s)
+	assert.ErrorIs(t, err, ErrCRCMismatch)
+
+	encrypted := (&SpliceInfo{CommandType: SpliceNull}).Section()
+	encrypted.Data[4] |= 0x80
+	data = encrypted.Data
+	binary.BigEndian.PutUint32(data[len(data)-crcLength:], CRC32(data[:len(data)-crcLength]))
+	s, err = ParseSection(0x1F0, data)
+	assert.NoError(t, err)
+	_, err = ParseSpliceInfo(s)
+	assert.ErrorIs(t, err, ErrEncryptedSplice)
+
+	_, err = ParseSpliceInfo(&Section{TableID: PATTableID})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	_, err = ParseSegmentationDescriptor(SpliceDescriptor{Tag: SegmentationDescriptorTag, Data: []byte{0, 0, 0, 1, 0x7F, 0xFF}})
+	assert.ErrorIs(t, err, ErrInvalidSection)
+}
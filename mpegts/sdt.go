@@ -0,0 +1,268 @@
+package mpegts
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	SDTPID           = 0x0011 // PID carrying the SDT and BAT.
+	SDTActualTableID = 0x42   // service_description_section for the actual transport stream.
+	SDTOtherTableID  = 0x46   // service_description_section for other transport streams.
+
+	sdtHeaderLength  = 3 // original_network_id and a reserved byte.
+	sdtServiceLength = 5 // Fixed part of each service loop entry.
+)
+
+// Running status values used by the SDT and EIT.
+const (
+	RunningStatusUndefined  = 0
+	RunningStatusNotRunning = 1
+	RunningStatusStartsSoon = 2
+	RunningStatusPausing    = 3
+	RunningStatusRunning    = 4
+	RunningStatusOffAir     = 5
+)
+
+// Service types signalled in the service descriptor.
+const (
+	ServiceTypeDigitalTV    = 0x01
+	ServiceTypeDigitalRadio = 0x02
+	ServiceTypeHDTV         = 0x19
+)
+
+// SDT represents a DVB Service Description Table.
+type SDT struct {
+	Actual            bool // True for the actual transport stream (table_id 0x42), false for other (0x46).
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Version           uint8
+	CurrentNext       bool
+	Services          []SDTService
+}
+
+// SDTService describes one entry of the SDT service loop.
+type SDTService struct {
+	ServiceID           uint16
+	EITSchedule         bool
+	EITPresentFollowing bool
+	RunningStatus       uint8
+	FreeCAMode          bool
+	Descriptors         []Descriptor
+}
+
+// ServiceDescriptor returns the decoded service descriptor of the service, if it has one.
+func (s *SDTService) ServiceDescriptor() (*ServiceDescriptor, bool) {
+	d, ok := FindDescriptor(s.Descriptors, ServiceDescriptorTag)
+	if !ok {
+		return nil, false
+	}
+	sd, err := ParseServiceDescriptor(d)
+	if err != nil {
+		return nil, false
+	}
+	return sd, true
+}
+
+// ParseSDT builds an SDT from one or more reassembled sections of the same sub-table.
+func ParseSDT(sections ...*Section) (*SDT, error) {
+	var sdt *SDT
+	for _, s := range sections {
+		if (s.TableID != SDTActualTableID && s.TableID != SDTOtherTableID) || !s.SectionSyntaxIndicator {
+			continue
+		}
+
+		body := s.Body()
+		if len(body) < sdtHeaderLength {
+			return nil, ErrInvalidSection
+		}
+
+		if sdt == nil {
+			sdt = &SDT{
+				Actual:            s.TableID == SDTActualTableID,
+				TransportStreamID: s.TableIDExtension,
+				OriginalNetworkID: binary.BigEndian.Uint16(body[0:2]),
+				Version:           s.Version,
+				CurrentNext:       s.CurrentNext,
+			}
+		} else if s.TableIDExtension != sdt.TransportStreamID || s.Version != sdt.Version {
+			return nil, ErrInvalidSection
+		}
+
+		loop := body[sdtHeaderLength:]
+		for len(loop) > 0 {
+			if len(loop) < sdtServiceLength {
+				return nil, ErrInvalidSection
+			}
+			length := int(binary.BigEndian.Uint16(loop[3:5]) & 0x0FFF)
+			if len(loop) < sdtServiceLength+length {
+				return nil, ErrInvalidSection
+			}
+			descriptors, err := ParseDescriptors(loop[sdtServiceLength : sdtServiceLength+length])
+			if err != nil {
+				return nil, err
+			}
+			sdt.Services = append(sdt.Services, SDTService{
+				ServiceID:           binary.BigEndian.Uint16(loop[0:2]),
+				EITSchedule:         loop[2]&0x02 != 0,
+				EITPresentFollowing: loop[2]&0x01 != 0,
+				RunningStatus:       loop[3] >> 5,
+				FreeCAMode:          loop[3]&0x10 != 0,
+				Descriptors:         descriptors,
+			})
+			loop = loop[sdtServiceLength+length:]
+		}
+	}
+
+	if sdt == nil {
+		return nil, ErrTableNotFound
+	}
+	return sdt, nil
+}
+
+// Service returns the entry for the given service_id.
+func (sdt *SDT) Service(serviceID uint16) (*SDTService, error) {
+	for i := range sdt.Services {
+		if sdt.Services[i].ServiceID == serviceID {
+			return &sdt.Services[i], nil
+		}
+	}
+	return nil, ErrProgramNotFound
+}
+
+// Sections encodes the SDT, splitting the service loop across sections as needed.
+// It returns ErrInvalidDescriptor if a service descriptor is too long to encode.
+func (sdt *SDT) Sections() ([]*Section, error) {
+	entries := make([][]byte, len(sdt.Services))
+	for i, svc := range sdt.Services {
+		descriptors, err := EncodeDescriptors(svc.Descriptors)
+		if err != nil {
+			return nil, err
+		}
+		entry := make([]byte, sdtServiceLength, sdtServiceLength+len(descriptors))
+		binary.BigEndian.PutUint16(entry[0:2], svc.ServiceID)
+		entry[2] = 0xFC
+		if svc.EITSchedule {
+			entry[2] |= 0x02
+		}
+		if svc.EITPresentFollowing {
+			entry[2] |= 0x01
+		}
+		flags := uint16(svc.RunningStatus&0x07)<<13 | uint16(len(descriptors))&0x0FFF
+		if svc.FreeCAMode {
+			flags |= 0x1000
+		}
+		binary.BigEndian.PutUint16(entry[3:5], flags)
+		entries[i] = append(entry, descriptors...)
+	}
+
+	tableID := uint8(SDTOtherTableID)
+	if sdt.Actual {
+		tableID = SDTActualTableID
+	}
+
+	room := maxPSISectionLength - (longSectionHeaderLen - sectionHeaderLength) - crcLength - sdtHeaderLength
+	groups, _ := packEntries(entries, room)
+	sections := make([]*Section, len(groups))
+	for i, group := range groups {
+		body := make([]byte, sdtHeaderLength, sdtHeaderLength+len(group))
+		binary.BigEndian.PutUint16(body[0:2], sdt.OriginalNetworkID)
+		body[2] = 0xFF
+		body = append(body, group...)
+
+		s := &Section{
+			PID:                    SDTPID,
+			TableID:                tableID,
+			SectionSyntaxIndicator: true,
+			PrivateIndicator:       true, // reserved_future_use.
+			TableIDExtension:       sdt.TransportStreamID,
+			Version:                sdt.Version,
+			CurrentNext:            sdt.CurrentNext,
+			SectionNumber:          uint8(i),
+			LastSectionNumber:      uint8(len(groups) - 1),
+		}
+		s.Marshal(body)
+		sections[i] = s
+	}
+	return sections, nil
+}
+
+// Encode packetizes the SDT onto the SDT PID starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (sdt *SDT) Encode(cc uint8) (EncodedPackets, uint8, error) {
+	sections, err := sdt.Sections()
+	if err != nil {
+		return nil, cc, err
+	}
+	packets, next := PacketizeSections(SDTPID, cc, sectionData(sections)...)
+	return packets, next, nil
+}
+
+// DVB text character tables (ETSI EN 300 468 Annex A), selected by the first byte of a text field.
+const (
+	dvbTableISO8859  = 0x10 // Followed by the 16-bit ISO/IEC 8859 part number.
+	dvbTableUCS2     = 0x11 // ISO/IEC 10646 Basic Multilingual Plane, two bytes per character.
+	dvbTableUTF8     = 0x15
+	dvbTableEncoding = 0x1F // Followed by an encoding_type_id.
+)
+
+// iso8859 maps the ISO/IEC 8859 part numbers to their character maps. Part 11 is decoded as its Windows
+// superset; part 12 was never published.
+var iso8859 = map[int]*charmap.Charmap{
+	1: charmap.ISO8859_1, 2: charmap.ISO8859_2, 3: charmap.ISO8859_3, 4: charmap.ISO8859_4,
+	5: charmap.ISO8859_5, 6: charmap.ISO8859_6, 7: charmap.ISO8859_7, 8: charmap.ISO8859_8,
+	9: charmap.ISO8859_9, 10: charmap.ISO8859_10, 11: charmap.Windows874, 13: charmap.ISO8859_13,
+	14: charmap.ISO8859_14, 15: charmap.ISO8859_15, 16: charmap.ISO8859_16,
+}
+
+// decodeDVBString decodes a DVB text field (ETSI EN 300 468 Annex A). The character table selection
+// bytes are dropped and text in ISO/IEC 8859, UCS-2 or UTF-8 is converted to UTF-8. Text in the default
+// table, whose printable ASCII range matches ISO/IEC 6937, and in the tables that are not supported is
+// returned as is.
+func decodeDVBString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	var decoder *encoding.Decoder
+	switch {
+	case b[0] >= 0x20:
+	case b[0] >= 0x01 && b[0] <= 0x0B:
+		// 0x01 to 0x0B select ISO/IEC 8859 parts 5 to 15.
+		if cm := iso8859[int(b[0])+4]; cm != nil {
+			decoder = cm.NewDecoder()
+		}
+		b = b[1:]
+	case b[0] == dvbTableISO8859 && len(b) >= 3:
+		if cm := iso8859[int(binary.BigEndian.Uint16(b[1:3]))]; cm != nil {
+			decoder = cm.NewDecoder()
+		}
+		b = b[3:]
+	case b[0] == dvbTableUCS2:
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()
+		b = b[1:]
+	case b[0] == dvbTableEncoding && len(b) >= 2:
+		b = b[2:]
+	default:
+		b = b[1:] // UTF-8 and the tables that are not supported.
+	}
+	if decoder != nil {
+		if text, err := decoder.Bytes(b); err == nil {
+			return string(text)
+		}
+	}
+	return string(b)
+}
+
+// encodeDVBString encodes text into a DVB text field: as is when it is printable ASCII, which the default
+// table shares, or in UTF-8 behind its table selector otherwise.
+func encodeDVBString(text string) []byte {
+	for i := 0; i < len(text); i++ {
+		if text[i] < 0x20 || text[i] >= 0x7F {
+			return append([]byte{dvbTableUTF8}, text...)
+		}
+	}
+	return []byte(text)
+}
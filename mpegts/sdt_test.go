@@ -0,0 +1,157 @@
+package mpegts
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSDT() *SDT {
+	return &SDT{
+		Actual:            true,
+		TransportStreamID: 0x0001,
+		OriginalNetworkID: 0x233A,
+		Version:           3,
+		CurrentNext:       true,
+		Services: []SDTService{
+			{
+				ServiceID:           1,
+				EITPresentFollowing: true,
+				RunningStatus:       RunningStatusRunning,
+				Descriptors: []Descriptor{
+					(&ServiceDescriptor{ServiceType: ServiceTypeDigitalTV, ProviderName: "tribd", ServiceName: "Channel 3"}).Descriptor(),
+				},
+			},
+		},
+	}
+}
+
+func TestSDTRoundTrip(t *testing.T) {
+	sdt := testSDT()
+	packets, cc, err := sdt.Encode(0)
+	assert.NoError(t, err)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, uint8(1), cc)
+	assert.Equal(t, uint16(SDTPID), packets[0].GetPID())
+
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+	assert.Equal(t, uint8(SDTActualTableID), sections[0].TableID)
+
+	parsed, err := ParseSDT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, sdt, parsed)
+
+	svc, err := parsed.Service(1)
+	assert.NoError(t, err)
+	sd, ok := svc.ServiceDescriptor()
+	assert.True(t, ok)
+	assert.Equal(t, "tribd", sd.ProviderName)
+	assert.Equal(t, "Channel 3", sd.ServiceName)
+	assert.Equal(t, uint8(ServiceTypeDigitalTV), sd.ServiceType)
+
+	_, err = parsed.Service(2)
+	assert.ErrorIs(t, err, ErrProgramNotFound)
+}
+
+func TestSDTOther(t *testing.T) {
+	sdt := testSDT()
+	sdt.Actual = false
+	sections, err := sdt.Sections()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(SDTOtherTableID), sections[0].TableID)
+
+	parsed, err := ParseSDT(sections...)
+	assert.NoError(t, err)
+	assert.False(t, parsed.Actual)
+}
+
+func TestSDTMultipleSections(t *testing.T) {
+	sdt := testSDT()
+	for i := 2; i <= 100; i++ {
+		sd := &ServiceDescriptor{ServiceType: ServiceTypeDigitalRadio, ProviderName: "tribd", ServiceName: fmt.Sprintf("Service %d", i)}
+		sdt.Services = append(sdt.Services, SDTService{ServiceID: uint16(i), Descriptors: []Descriptor{sd.Descriptor()}})
+	}
+
+	sections, err := sdt.Sections()
+	assert.NoError(t, err)
+	assert.Greater(t, len(sections), 1)
+	for i, s := range sections {
+		assert.LessOrEqual(t, len(s.Data), sectionHeaderLength+maxPSISectionLength)
+		assert.Equal(t, uint8(i), s.SectionNumber)
+		assert.Equal(t, uint8(len(sections)-1), s.LastSectionNumber)
+	}
+
+	packets, _, err := sdt.Encode(0)
+	assert.NoError(t, err)
+	parsed, err := ParseSDT(reassemble(t, packets)...)
+	assert.NoError(t, err)
+	assert.Equal(t, sdt.Services, parsed.Services)
+}
+
+func TestParseSDTErrors(t *testing.T) {
+	_, err := ParseSDT()
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	s, err := ParseSection(PATPID, testPAT)
+	assert.NoError(t, err)
+	_, err = ParseSDT(s)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	_, err = ParseServiceDescriptor(Descriptor{Tag: ServiceDescriptorTag, Data: []byte{0x01, 0x05, 'a'}})
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+}
+
+func TestDecodeDVBString(t *testing.T) {
+	assert.Equal(t, "", decodeDVBString(nil))
+	assert.Equal(t, "News", decodeDVBString([]byte("News")))
+	assert.Equal(t, "News", decodeDVBString([]byte("\x05News")))
+	assert.Equal(t, "News", decodeDVBString([]byte("\x10\x00\x02News")))
+
+	// ISO/IEC 8859 by its short selector and by part number, UCS-2 and UTF-8.
+	assert.Equal(t, "Новости", decodeDVBString([]byte("\x01\xBD\xDE\xD2\xDE\xE1\xE2\xD8")))
+	assert.Equal(t, "Ελλάδα", decodeDVBString([]byte("\x03\xC5\xEB\xEB\xDC\xE4\xE1")))
+	assert.Equal(t, "Télé", decodeDVBString([]byte("\x10\x00\x01T\xE9l\xE9")))
+	assert.Equal(t, "Zürich €", decodeDVBString([]byte("\x10\x00\x0FZ\xFCrich \xA4")))
+	assert.Equal(t, "日本", decodeDVBString([]byte("\x11\x65\xE5\x67\x2C")))
+	assert.Equal(t, "Télé", decodeDVBString([]byte("\x15Télé")))
+	assert.Equal(t, "News", decodeDVBString([]byte("\x1F\x01News")))
+
+	// Text is sent as is when ASCII, in UTF-8 otherwise.
+	assert.Equal(t, []byte("News"), encodeDVBString("News"))
+	assert.Equal(t, []byte("\x15Télé"), encodeDVBString("Télé"))
+	for _, text := range []string{"", "News", "Télé", "Новости"} {
+		assert.Equal(t, text, decodeDVBString(encodeDVBString(text)))
+	}
+}
+
+func TestServiceDescriptorLength(t *testing.T) {
+	sd := &ServiceDescriptor{ServiceType: ServiceTypeDigitalTV, ProviderName: "Télé", ServiceName: "Canal"}
+	d, err := sd.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, sd.Descriptor(), d)
+	parsed, err := ParseServiceDescriptor(d)
+	assert.NoError(t, err)
+	assert.Equal(t, sd, parsed)
+
+	// The names share the 255 bytes of the descriptor with its three length and type bytes.
+	sd = &ServiceDescriptor{ProviderName: strings.Repeat("p", 126), ServiceName: strings.Repeat("s", 126)}
+	_, err = sd.Encode()
+	assert.NoError(t, err)
+	sd.ServiceName += "é"
+	_, err = sd.Encode()
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+
+	// Descriptor shortens the names rather than overflow the descriptor_length.
+	d = sd.Descriptor()
+	assert.LessOrEqual(t, len(d.Data), 0xFF)
+	parsed, err = ParseServiceDescriptor(d)
+	assert.NoError(t, err)
+	assert.Equal(t, sd.ProviderName, parsed.ProviderName)
+	assert.Equal(t, strings.Repeat("s", 126), parsed.ServiceName)
+	data, err := EncodeDescriptors([]Descriptor{d})
+	assert.NoError(t, err)
+	assert.Len(t, data, 2+len(d.Data))
+}
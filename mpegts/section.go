@@ -0,0 +1,367 @@
+package mpegts
+
+import "encoding/binary"
+
+const (
+	maxSectionLength     = 4093 // Maximum value of the 12-bit section_length field for private sections.
+	sectionHeaderLength  = 3    // table_id plus the two bytes carrying section_length.
+	longSectionHeaderLen = 8    // Header length of sections using the long (syntax indicator) form.
+	crcLength            = 4
+)
+
+// Section represents a complete PSI/SI section reassembled from one or more MPEG-TS packets.
+type Section struct {
+	PID                    uint16 // PID the section was carried on.
+	TableID                uint8  // table_id of the section.
+	SectionSyntaxIndicator bool   // True when the section uses the long form with version and section numbers.
+	PrivateIndicator       bool   // private_indicator bit.
+	TableIDExtension       uint16 // transport_stream_id, program_number, etc. depending on the table.
+	Version                uint8  // version_number (5 bits).
+	CurrentNext            bool   // current_next_indicator.
+	SectionNumber          uint8  // section_number.
+	LastSectionNumber      uint8  // last_section_number.
+	Data                   []byte // Raw section bytes from table_id up to and including the CRC.
+}
+
+// Body returns the section bytes following the header and preceding the CRC.
+// Short form sections return everything after the three byte header.
+func (s *Section) Body() []byte {
+	if s.SectionSyntaxIndicator {
+		return s.Data[longSectionHeaderLen : len(s.Data)-crcLength]
+	}
+	return s.Data[sectionHeaderLength:]
+}
+
+// Marshal builds the raw bytes of a section from the header fields of s and the given body.
+// section_length and, for long form sections, the CRC are computed. The result is stored in s.Data.
+func (s *Section) Marshal(body []byte) []byte {
+	headerLen := sectionHeaderLength
+	trailerLen := 0
+	if s.SectionSyntaxIndicator {
+		headerLen = longSectionHeaderLen
+		trailerLen = crcLength
+	}
+
+	data := make([]byte, headerLen+len(body)+trailerLen)
+	data[0] = s.TableID
+	length := uint16(len(data)-sectionHeaderLength) & 0x0FFF
+	flags := uint16(0x3000) // Reserved bits.
+	if s.SectionSyntaxIndicator {
+		flags |= 0x8000
+	}
+	if s.PrivateIndicator {
+		flags |= 0x4000
+	}
+	binary.BigEndian.PutUint16(data[1:3], flags|length)
+
+	if s.SectionSyntaxIndicator {
+		binary.BigEndian.PutUint16(data[3:5], s.TableIDExtension)
+		data[5] = 0xC0 | (s.Version&0x1F)<<1
+		if s.CurrentNext {
+			data[5] |= 0x01
+		}
+		data[6] = s.SectionNumber
+		data[7] = s.LastSectionNumber
+	}
+
+	copy(data[headerLen:], body)
+	if s.SectionSyntaxIndicator {
+		binary.BigEndian.PutUint32(data[len(data)-crcLength:], CRC32(data[:len(data)-crcLength]))
+	}
+
+	s.Data = data
+	return data
+}
+
+// ParseSection decodes the header of a single complete section.
+// The CRC is verified for sections using the long form.
+func ParseSection(pid uint16, data []byte) (*Section, error) {
+	if len(data) < sectionHeaderLength {
+		return nil, ErrInvalidSection
+	}
+
+	length := int(binary.BigEndian.Uint16(data[1:3]) & 0x0FFF)
+	if length > maxSectionLength || len(data) < sectionHeaderLength+length {
+		return nil, ErrInvalidSection
+	}
+	data = data[:sectionHeaderLength+length]
+
+	s := &Section{
+		PID:                    pid,
+		TableID:                data[0],
+		SectionSyntaxIndicator: data[1]&0x80 != 0,
+		PrivateIndicator:       data[1]&0x40 != 0,
+		Data:                   data,
+	}
+
+	if s.SectionSyntaxIndicator {
+		if length < longSectionHeaderLen-sectionHeaderLength+crcLength {
+			return nil, ErrInvalidSection
+		}
+		if CRC32(data) != 0 {
+			return nil, ErrCRCMismatch
+		}
+		s.TableIDExtension = binary.BigEndian.Uint16(data[3:5])
+		s.Version = (data[5] >> 1) & 0x1F
+		s.CurrentNext = data[5]&0x01 != 0
+		s.SectionNumber = data[6]
+		s.LastSectionNumber = data[7]
+	}
+
+	return s, nil
+}
+
+// sectionBuffer holds the partially reassembled sections of a single PID.
+type sectionBuffer struct {
+	buf     []byte
+	started bool  // True once a PUSI has been seen and buf holds section data.
+	lastCC  uint8 // Continuity counter of the last packet accepted.
+}
+
+// SectionAssembler reassembles PSI/SI sections from MPEG-TS packets.
+// It follows the PUSI flag and pointer_field on every PID it is fed, handling sections that
+// span several packets as well as several sections sharing a single packet.
+type SectionAssembler struct {
+	buffers map[uint16]*sectionBuffer
+}
+
+// NewSectionAssembler creates a new, empty SectionAssembler.
+func NewSectionAssembler() *SectionAssembler {
+	return &SectionAssembler{
+		buffers: make(map[uint16]*sectionBuffer),
+	}
+}
+
+// Reset discards any partially assembled section on the given PID.
+func (sa *SectionAssembler) Reset(pid uint16) {
+	delete(sa.buffers, pid)
+}
+
+// Push feeds a packet to the assembler and returns every section completed by it.
+// Sections that fail validation are dropped; the first such error is returned alongside the
+// sections that were completed successfully.
+func (sa *SectionAssembler) Push(ep *EncodedPacket) ([]*Section, error) {
+	if !ep.IsMPEGTS() || ep.GetTEI() || ep.IsNullPacket() {
+		return nil, nil
+	}
+
+	offset := payloadOffset(ep)
+	if offset < 0 || offset >= packetLength {
+		return nil, nil
+	}
+	payload := ep[offset:]
+
+	pid := ep.GetPID()
+	sb, ok := sa.buffers[pid]
+	if !ok {
+		sb = &sectionBuffer{}
+		sa.buffers[pid] = sb
+	}
+
+	cc := ep.GetCC()
+	if sb.started {
+		if cc == sb.lastCC {
+			return nil, nil // Duplicate packet, already consumed.
+		}
+		if cc != (sb.lastCC+1)&0x0F {
+			// Lost packets: whatever is buffered can no longer be completed.
+			sb.buf = sb.buf[:0]
+			sb.started = false
+		}
+	}
+	sb.lastCC = cc
+
+	var (
+		sections []*Section
+		firstErr error
+	)
+	collect := func(s []*Section, err error) {
+		sections = append(sections, s...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if ep.GetPUSI() {
+		pointer := int(payload[0])
+		payload = payload[1:]
+		if pointer > len(payload) {
+			sb.buf = sb.buf[:0]
+			sb.started = false
+			return nil, ErrInvalidSection
+		}
+
+		// The bytes ahead of the pointer finish the section already in progress.
+		if sb.started {
+			sb.buf = append(sb.buf, payload[:pointer]...)
+			collect(sb.drain(pid))
+		}
+
+		sb.buf = append(sb.buf[:0], payload[pointer:]...)
+		sb.started = true
+	} else if sb.started {
+		sb.buf = append(sb.buf, payload...)
+	} else {
+		return nil, nil // Waiting for the start of a section.
+	}
+
+	collect(sb.drain(pid))
+	return sections, firstErr
+}
+
+// drain extracts every complete section at the front of the buffer.
+func (sb *sectionBuffer) drain(pid uint16) ([]*Section, error) {
+	var (
+		sections []*Section
+		firstErr error
+	)
+
+	for len(sb.buf) >= sectionHeaderLength {
+		if sb.buf[0] == 0xFF {
+			// Stuffing: the remainder of the packet carries no sections.
+			sb.buf = sb.buf[:0]
+			sb.started = false
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(sb.buf[1:3]) & 0x0FFF)
+		if length > maxSectionLength {
+			sb.buf = sb.buf[:0]
+			sb.started = false
+			if firstErr == nil {
+				firstErr = ErrInvalidSection
+			}
+			break
+		}
+
+		total := sectionHeaderLength + length
+		if len(sb.buf) < total {
+			break // Wait for more packets.
+		}
+
+		data := make([]byte, total)
+		copy(data, sb.buf[:total])
+		sb.buf = sb.buf[total:]
+
+		s, err := ParseSection(pid, data)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		sections = append(sections, s)
+	}
+
+	return sections, firstErr
+}
+
+// PacketizeSections splits one or more raw sections into MPEG-TS packets on the given PID.
+// Sections are packed back to back; every packet in which a section starts carries the PUSI flag
+// and a pointer_field, and the tail of the last packet is filled with 0xFF stuffing.
+// cc is the continuity counter of the first packet; the counter for the next packet on the PID is returned.
+func PacketizeSections(pid uint16, cc uint8, sections ...[]byte) (EncodedPackets, uint8) {
+	var (
+		stream []byte
+		starts []int // Offsets of section starts within stream.
+	)
+	for _, section := range sections {
+		starts = append(starts, len(stream))
+		stream = append(stream, section...)
+	}
+
+	var packets EncodedPackets
+	pos := 0
+	next := 0 // Index into starts of the next section start not yet signalled.
+	for pos < len(stream) {
+		ep := &EncodedPacket{0x47}
+		ep.SetPID(pid)
+		ep[3] = 0x10 | (cc & 0x0F) // Payload only.
+		cc = (cc + 1) & 0x0F
+
+		offset := headerLength
+		limit := len(stream)
+		if next < len(starts) && starts[next] < pos+packetLength-headerLength-1 {
+			// A section starts in this packet: reserve the pointer_field.
+			ep.SetPUSI()
+			ep[offset] = byte(starts[next] - pos)
+			offset++
+			for next < len(starts) && starts[next] < pos+packetLength-offset {
+				next++
+			}
+		} else if next < len(starts) && starts[next] < pos+packetLength-headerLength {
+			// The next section would start in the last byte, leaving no room for the pointer_field.
+			// Stuff the packet instead and start the section in the following one.
+			limit = starts[next]
+		}
+
+		n := copy(ep[offset:], stream[pos:limit])
+		for i := offset + n; i < packetLength; i++ {
+			ep[i] = 0xFF
+		}
+		pos += n
+		packets = append(packets, ep)
+	}
+
+	return packets, cc
+}
+
+// packEntries groups encoded loop entries into section bodies of at most room bytes each, keeping entries
+// whole. It returns the groups and the number of entries in each. At least one, possibly empty, group is
+// always returned.
+func packEntries(entries [][]byte, room int) ([][]byte, []int) {
+	groups, counts := [][]byte{nil}, []int{0}
+	for _, entry := range entries {
+		last := len(groups) - 1
+		if len(groups[last]) > 0 && len(groups[last])+len(entry) > room {
+			groups, counts = append(groups, nil), append(counts, 0)
+			last++
+		}
+		groups[last] = append(groups[last], entry...)
+		counts[last]++
+	}
+	return groups, counts
+}
+
+// payloadOffset returns the index of the first payload byte of the packet,
+// or -1 if the packet carries no payload.
+func payloadOffset(ep *EncodedPacket) int {
+	switch ep.GetAFC() {
+	case 0x01:
+		return headerLength
+	case 0x03:
+		offset := headerLength + 1 + int(ep[4])
+		if offset > packetLength {
+			return -1
+		}
+		return offset
+	}
+	return -1
+}
+
+// crcTable holds the lookup table for the MPEG-2 CRC32 (polynomial 0x04C11DB7).
+var crcTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// CRC32 computes the MPEG-2 CRC32 used by PSI/SI sections.
+// Running it over a complete section including its CRC_32 field yields zero.
+func CRC32(data []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
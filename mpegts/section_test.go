@@ -0,0 +1,221 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPAT is the well known single program PAT: transport_stream_id 1, program 1 on PMT PID 0x1000.
+var testPAT = []byte{0x00, 0xB0, 0x0D, 0x00, 0x01, 0xC1, 0x00, 0x00, 0x00, 0x01, 0xF0, 0x00, 0x2A, 0xB1, 0x04, 0xB2}
+
+// testLongSection builds a long form section with the given table_id and a body of n bytes.
+func testLongSection(tableID uint8, n int) []byte {
+	section := make([]byte, longSectionHeaderLen+n+crcLength)
+	section[0] = tableID
+	binary.BigEndian.PutUint16(section[1:3], 0xB000|uint16(len(section)-sectionHeaderLength))
+	binary.BigEndian.PutUint16(section[3:5], 0x1234)
+	section[5] = 0xC1 | 3<<1
+	for i := 0; i < n; i++ {
+		section[longSectionHeaderLen+i] = byte(i)
+	}
+	binary.BigEndian.PutUint32(section[len(section)-crcLength:], CRC32(section[:len(section)-crcLength]))
+	return section
+}
+
+// testPackets splits a byte stream into payload only packets, setting PUSI and a pointer_field of zero on the first.
+func testPackets(pid uint16, data []byte) []*EncodedPacket {
+	var packets []*EncodedPacket
+	first := true
+	cc := uint8(0)
+	for first || len(data) > 0 {
+		ep := &EncodedPacket{0x47}
+		ep.SetPID(pid)
+		ep[3] = 0x10 | cc
+		offset := headerLength
+		if first {
+			ep.SetPUSI()
+			ep[offset] = 0
+			offset++
+			first = false
+		}
+		n := copy(ep[offset:], data)
+		for i := offset + n; i < packetLength; i++ {
+			ep[i] = 0xFF
+		}
+		data = data[n:]
+		cc = (cc + 1) & 0x0F
+		packets = append(packets, ep)
+	}
+	return packets
+}
+
+func TestCRC32(t *testing.T) {
+	assert.Equal(t, uint32(0x2AB104B2), CRC32(testPAT[:len(testPAT)-crcLength]))
+	assert.Equal(t, uint32(0), CRC32(testPAT), "CRC over a complete section should be zero")
+}
+
+func TestParseSection(t *testing.T) {
+	s, err := ParseSection(0, testPAT)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x00), s.TableID)
+	assert.True(t, s.SectionSyntaxIndicator)
+	assert.Equal(t, uint16(1), s.TableIDExtension)
+	assert.Equal(t, uint8(0), s.Version)
+	assert.True(t, s.CurrentNext)
+	assert.Equal(t, []byte{0x00, 0x01, 0xF0, 0x00}, s.Body())
+
+	corrupt := append([]byte{}, testPAT...)
+	corrupt[9] ^= 0x01
+	_, err = ParseSection(0, corrupt)
+	assert.ErrorIs(t, err, ErrCRCMismatch)
+
+	_, err = ParseSection(0, testPAT[:10])
+	assert.ErrorIs(t, err, ErrInvalidSection)
+}
+
+func TestSectionAssemblerSinglePacket(t *testing.T) {
+	sa := NewSectionAssembler()
+	packets := testPackets(0, testPAT)
+	assert.Len(t, packets, 1)
+
+	sections, err := sa.Push(packets[0])
+	assert.NoError(t, err)
+	assert.Len(t, sections, 1)
+	assert.Equal(t, testPAT, sections[0].Data)
+}
+
+func TestSectionAssemblerSpanningPackets(t *testing.T) {
+	sa := NewSectionAssembler()
+	section := testLongSection(0x42, 500)
+	packets := testPackets(0x11, section)
+	assert.Len(t, packets, 3)
+
+	var sections []*Section
+	for _, ep := range packets {
+		s, err := sa.Push(ep)
+		assert.NoError(t, err)
+		sections = append(sections, s...)
+	}
+
+	assert.Len(t, sections, 1)
+	assert.Equal(t, section, sections[0].Data)
+	assert.Equal(t, uint16(0x11), sections[0].PID)
+	assert.Equal(t, uint8(3), sections[0].Version)
+	assert.Len(t, sections[0].Body(), 500)
+}
+
+func TestSectionAssemblerSharedPacket(t *testing.T) {
+	sa := NewSectionAssembler()
+	data := append(append([]byte{}, testPAT...), testLongSection(0x02, 20)...)
+	packets := testPackets(0, data)
+
+	sections, err := sa.Push(packets[0])
+	assert.NoError(t, err)
+	assert.Len(t, sections, 2)
+	assert.Equal(t, uint8(0x00), sections[0].TableID)
+	assert.Equal(t, uint8(0x02), sections[1].TableID)
+}
+
+func TestSectionAssemblerPointerField(t *testing.T) {
+	sa := NewSectionAssembler()
+	first := testLongSection(0x42, 200)
+	second := testLongSection(0x46, 10)
+
+	packets := testPackets(0x11, first)
+	assert.Len(t, packets, 2)
+
+	// Start the second section in the tail packet of the first one, using the pointer_field.
+	tail := packets[1]
+	used := len(first) - (packetLength - headerLength - 1)
+	tail.SetPUSI()
+	copy(tail[headerLength+1:], first[len(first)-used:])
+	tail[headerLength] = byte(used)
+	copy(tail[headerLength+1+used:], second)
+
+	var sections []*Section
+	for _, ep := range packets {
+		s, err := sa.Push(ep)
+		assert.NoError(t, err)
+		sections = append(sections, s...)
+	}
+
+	assert.Len(t, sections, 2)
+	assert.Equal(t, first, sections[0].Data)
+	assert.Equal(t, second, sections[1].Data)
+}
+
+func TestSectionAssemblerErrors(t *testing.T) {
+	t.Run("CRC mismatch", func(t *testing.T) {
+		sa := NewSectionAssembler()
+		corrupt := append([]byte{}, testPAT...)
+		corrupt[len(corrupt)-1] ^= 0xFF
+
+		sections, err := sa.Push(testPackets(0, corrupt)[0])
+		assert.ErrorIs(t, err, ErrCRCMismatch)
+		assert.Len(t, sections, 0)
+	})
+
+	t.Run("Continuity error drops partial section", func(t *testing.T) {
+		sa := NewSectionAssembler()
+		packets := testPackets(0x11, testLongSection(0x42, 500))
+
+		sections, err := sa.Push(packets[0])
+		assert.NoError(t, err)
+		assert.Len(t, sections, 0)
+
+		// Skip the middle packet.
+		sections, err = sa.Push(packets[2])
+		assert.NoError(t, err)
+		assert.Len(t, sections, 0)
+	})
+
+	t.Run("Duplicate packets are ignored", func(t *testing.T) {
+		sa := NewSectionAssembler()
+		section := testLongSection(0x42, 300)
+		packets := testPackets(0x11, section)
+
+		var sections []*Section
+		for _, ep := range []*EncodedPacket{packets[0], packets[0], packets[1]} {
+			s, err := sa.Push(ep)
+			assert.NoError(t, err)
+			sections = append(sections, s...)
+		}
+		assert.Len(t, sections, 1)
+		assert.Equal(t, section, sections[0].Data)
+	})
+}
+
+func TestPacketizeSections(t *testing.T) {
+	t.Run("Round trip", func(t *testing.T) {
+		first := testLongSection(0x42, 500)
+		second := testLongSection(0x46, 30)
+		third := testLongSection(0x4A, 250)
+
+		packets, cc := PacketizeSections(0x11, 14, first, second, third)
+		assert.Equal(t, uint8((14+len(packets))&0x0F), cc)
+
+		sections := reassemble(t, packets)
+		assert.Len(t, sections, 3)
+		assert.Equal(t, first, sections[0].Data)
+		assert.Equal(t, second, sections[1].Data)
+		assert.Equal(t, third, sections[2].Data)
+	})
+
+	t.Run("Section starting in the last byte of a packet", func(t *testing.T) {
+		// The first section fills all but the last payload byte of the second packet, which has no pointer_field.
+		first := testLongSection(0x42, 2*(packetLength-headerLength)-1-1-longSectionHeaderLen-crcLength)
+		second := testLongSection(0x46, 10)
+
+		packets, _ := PacketizeSections(0x11, 0, first, second)
+		assert.Len(t, packets, 3)
+		assert.False(t, packets[1].GetPUSI())
+		assert.Equal(t, byte(0xFF), packets[1][packetLength-1])
+		assert.True(t, packets[2].GetPUSI())
+		assert.Equal(t, byte(0), packets[2][headerLength])
+
+		sections := reassemble(t, packets)
+		assert.Len(t, sections, 2)
+	})
+}
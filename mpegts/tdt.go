@@ -0,0 +1,241 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	TDTPID     = 0x0014 // PID carrying the TDT and TOT.
+	TDTTableID = 0x70   // time_date_section.
+	TOTTableID = 0x73   // time_offset_section.
+
+	utcTimeLength         = 5  // 16-bit MJD followed by 24-bit BCD time.
+	localTimeOffsetLength = 13 // One entry of the local_time_offset_descriptor.
+)
+
+// mjdEpoch is day zero of the Modified Julian Date.
+var mjdEpoch = time.Date(1858, time.November, 17, 0, 0, 0, 0, time.UTC)
+
+// TDT represents a DVB Time and Date Table.
+type TDT struct {
+	UTCTime time.Time
+}
+
+// TOT represents a DVB Time Offset Table.
+type TOT struct {
+	UTCTime     time.Time
+	Descriptors []Descriptor
+}
+
+// LocalTimeOffset is one entry of the local_time_offset_descriptor.
+type LocalTimeOffset struct {
+	CountryCode     string // ISO 3166 alpha-3 code.
+	CountryRegionID uint8  // 6 bits.
+	Offset          time.Duration
+	TimeOfChange    time.Time
+	NextOffset      time.Duration // Offset that applies from TimeOfChange.
+}
+
+// ParseTDT decodes a TDT from a reassembled section.
+func ParseTDT(s *Section) (*TDT, error) {
+	if s.TableID != TDTTableID {
+		return nil, ErrTableNotFound
+	}
+	body := s.Body()
+	if len(body) < utcTimeLength {
+		return nil, ErrInvalidSection
+	}
+	return &TDT{UTCTime: decodeUTCTime(body)}, nil
+}
+
+// Section encodes the TDT.
+func (tdt *TDT) Section() *Section {
+	s := &Section{
+		PID:              TDTPID,
+		TableID:          TDTTableID,
+		PrivateIndicator: true, // reserved_future_use.
+	}
+	s.Marshal(encodeUTCTime(tdt.UTCTime))
+	return s
+}
+
+// Encode packetizes the TDT onto the TDT PID starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (tdt *TDT) Encode(cc uint8) (EncodedPackets, uint8) {
+	return PacketizeSections(TDTPID, cc, tdt.Section().Data)
+}
+
+// ParseTOT decodes a TOT from a reassembled section, verifying its CRC.
+func ParseTOT(s *Section) (*TOT, error) {
+	if s.TableID != TOTTableID {
+		return nil, ErrTableNotFound
+	}
+	// The TOT carries a CRC even though it uses the short section form.
+	if len(s.Data) < sectionHeaderLength+utcTimeLength+2+crcLength {
+		return nil, ErrInvalidSection
+	}
+	if CRC32(s.Data) != 0 {
+		return nil, ErrCRCMismatch
+	}
+
+	body := s.Body()
+	body = body[:len(body)-crcLength]
+	length := int(binary.BigEndian.Uint16(body[utcTimeLength:utcTimeLength+2]) & 0x0FFF)
+	if len(body) < utcTimeLength+2+length {
+		return nil, ErrInvalidSection
+	}
+	descriptors, err := ParseDescriptors(body[utcTimeLength+2 : utcTimeLength+2+length])
+	if err != nil {
+		return nil, err
+	}
+	return &TOT{UTCTime: decodeUTCTime(body), Descriptors: descriptors}, nil
+}
+
+// LocalTimeOffsets returns the entries of all local_time_offset_descriptors of the TOT.
+func (tot *TOT) LocalTimeOffsets() ([]LocalTimeOffset, error) {
+	var offsets []LocalTimeOffset
+	for _, d := range tot.Descriptors {
+		if d.Tag != LocalTimeOffsetDescriptorTag {
+			continue
+		}
+		entries, err := ParseLocalTimeOffsets(d)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, entries...)
+	}
+	return offsets, nil
+}
+
+// Section encodes the TOT, including its CRC. It returns ErrInvalidDescriptor if a descriptor is too long
+// to encode.
+func (tot *TOT) Section() (*Section, error) {
+	descriptors, err := EncodeDescriptors(tot.Descriptors)
+	if err != nil {
+		return nil, err
+	}
+	body := encodeUTCTime(tot.UTCTime)
+	body = binary.BigEndian.AppendUint16(body, 0xF000|uint16(len(descriptors))&0x0FFF)
+	body = append(body, descriptors...)
+	body = append(body, make([]byte, crcLength)...)
+
+	s := &Section{
+		PID:              TDTPID,
+		TableID:          TOTTableID,
+		PrivateIndicator: true, // reserved_future_use.
+	}
+	data := s.Marshal(body)
+	binary.BigEndian.PutUint32(data[len(data)-crcLength:], CRC32(data[:len(data)-crcLength]))
+	return s, nil
+}
+
+// Encode packetizes the TOT onto the TDT PID starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (tot *TOT) Encode(cc uint8) (EncodedPackets, uint8, error) {
+	s, err := tot.Section()
+	if err != nil {
+		return nil, cc, err
+	}
+	packets, next := PacketizeSections(TDTPID, cc, s.Data)
+	return packets, next, nil
+}
+
+// LocalTimeOffsets is the typed form of a local_time_offset_descriptor.
+type LocalTimeOffsets []LocalTimeOffset
+
+// Descriptor encodes the entries into a local_time_offset_descriptor.
+func (o LocalTimeOffsets) Descriptor() Descriptor {
+	return LocalTimeOffsetDescriptor(o...)
+}
+
+// decodeLocalTimeOffsetDescriptor is the registered decoder of the local_time_offset_descriptor.
+func decodeLocalTimeOffsetDescriptor(d Descriptor) (TypedDescriptor, error) {
+	offsets, err := ParseLocalTimeOffsets(d)
+	if err != nil {
+		return nil, ErrInvalidDescriptor
+	}
+	return LocalTimeOffsets(offsets), nil
+}
+
+// ParseLocalTimeOffsets decodes the entries of a local_time_offset_descriptor.
+func ParseLocalTimeOffsets(d Descriptor) ([]LocalTimeOffset, error) {
+	if d.Tag != LocalTimeOffsetDescriptorTag || len(d.Data)%localTimeOffsetLength != 0 {
+		return nil, ErrInvalidSection
+	}
+	offsets := make([]LocalTimeOffset, 0, len(d.Data)/localTimeOffsetLength)
+	for data := d.Data; len(data) > 0; data = data[localTimeOffsetLength:] {
+		negative := data[3]&0x01 != 0
+		offsets = append(offsets, LocalTimeOffset{
+			CountryCode:     string(data[0:3]),
+			CountryRegionID: data[3] >> 2,
+			Offset:          decodeBCDOffset(data[4:6], negative),
+			TimeOfChange:    decodeUTCTime(data[6:11]),
+			NextOffset:      decodeBCDOffset(data[11:13], negative),
+		})
+	}
+	return offsets, nil
+}
+
+// LocalTimeOffsetDescriptor encodes the entries into a local_time_offset_descriptor.
+// The polarity of each entry is taken from Offset, or from NextOffset when Offset is zero.
+func LocalTimeOffsetDescriptor(offsets ...LocalTimeOffset) Descriptor {
+	data := make([]byte, 0, len(offsets)*localTimeOffsetLength)
+	for _, o := range offsets {
+		code := []byte(o.CountryCode + "   ")[:3]
+		negative := o.Offset < 0 || (o.Offset == 0 && o.NextOffset < 0)
+		flags := o.CountryRegionID<<2 | 0x02
+		if negative {
+			flags |= 0x01
+		}
+		data = append(data, code...)
+		data = append(data, flags)
+		data = append(data, encodeBCDOffset(o.Offset)...)
+		data = append(data, encodeUTCTime(o.TimeOfChange)...)
+		data = append(data, encodeBCDOffset(o.NextOffset)...)
+	}
+	return Descriptor{Tag: LocalTimeOffsetDescriptorTag, Data: data}
+}
+
+// decodeUTCTime decodes a 40-bit UTC_time field: a 16-bit Modified Julian Date and hours, minutes and
+// seconds as six BCD digits.
+func decodeUTCTime(b []byte) time.Time {
+	mjd := binary.BigEndian.Uint16(b[0:2])
+	t := mjdEpoch.AddDate(0, 0, int(mjd))
+	return t.Add(time.Duration(decodeBCD(b[2]))*time.Hour +
+		time.Duration(decodeBCD(b[3]))*time.Minute +
+		time.Duration(decodeBCD(b[4]))*time.Second)
+}
+
+// encodeUTCTime encodes t into a 40-bit UTC_time field. Sub-second precision is dropped.
+func encodeUTCTime(t time.Time) []byte {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	mjd := uint16(day.Sub(mjdEpoch) / (24 * time.Hour))
+	return []byte{byte(mjd >> 8), byte(mjd), encodeBCD(t.Hour()), encodeBCD(t.Minute()), encodeBCD(t.Second())}
+}
+
+// decodeBCDOffset decodes a 16-bit BCD hhmm offset.
+func decodeBCDOffset(b []byte, negative bool) time.Duration {
+	d := time.Duration(decodeBCD(b[0]))*time.Hour + time.Duration(decodeBCD(b[1]))*time.Minute
+	if negative {
+		return -d
+	}
+	return d
+}
+
+// encodeBCDOffset encodes the magnitude of d as a 16-bit BCD hhmm offset.
+func encodeBCDOffset(d time.Duration) []byte {
+	if d < 0 {
+		d = -d
+	}
+	return []byte{encodeBCD(int(d / time.Hour)), encodeBCD(int(d % time.Hour / time.Minute))}
+}
+
+func decodeBCD(b byte) int {
+	return int(b>>4)*10 + int(b&0x0F)
+}
+
+func encodeBCD(v int) byte {
+	return byte(v/10%10)<<4 | byte(v%10)
+}
@@ -0,0 +1,95 @@
+package mpegts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUTCTime(t *testing.T) {
+	// Example from ETSI EN 300 468 Annex C: 93/10/13 12:45:00 is coded as 0xC079124500.
+	ts := time.Date(1993, time.October, 13, 12, 45, 0, 0, time.UTC)
+	assert.Equal(t, []byte{0xC0, 0x79, 0x12, 0x45, 0x00}, encodeUTCTime(ts))
+	assert.Equal(t, ts, decodeUTCTime([]byte{0xC0, 0x79, 0x12, 0x45, 0x00}))
+}
+
+func TestTDTRoundTrip(t *testing.T) {
+	tdt := &TDT{UTCTime: time.Date(2024, time.March, 31, 1, 2, 3, 0, time.UTC)}
+
+	s := tdt.Section()
+	assert.Len(t, s.Data, sectionHeaderLength+utcTimeLength)
+	assert.Equal(t, []byte{TDTTableID, 0x70, 0x05}, s.Data[:3])
+
+	packets, cc := tdt.Encode(0)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, uint8(1), cc)
+
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+	parsed, err := ParseTDT(sections[0])
+	assert.NoError(t, err)
+	assert.Equal(t, tdt, parsed)
+
+	_, err = ParseTOT(sections[0])
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestTOTRoundTrip(t *testing.T) {
+	offsets := []LocalTimeOffset{
+		{
+			CountryCode:  "GBR",
+			Offset:       0,
+			TimeOfChange: time.Date(2024, time.March, 31, 1, 0, 0, 0, time.UTC),
+			NextOffset:   time.Hour,
+		},
+		{
+			CountryCode:     "USA",
+			CountryRegionID: 3,
+			Offset:          -5 * time.Hour,
+			TimeOfChange:    time.Date(2024, time.November, 3, 6, 0, 0, 0, time.UTC),
+			NextOffset:      -6 * time.Hour,
+		},
+	}
+	tot := &TOT{
+		UTCTime:     time.Date(2024, time.March, 30, 23, 59, 59, 0, time.UTC),
+		Descriptors: []Descriptor{LocalTimeOffsetDescriptor(offsets...)},
+	}
+
+	s, err := tot.Section()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), CRC32(s.Data))
+
+	packets, _, err := tot.Encode(0)
+	assert.NoError(t, err)
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+
+	parsed, err := ParseTOT(sections[0])
+	assert.NoError(t, err)
+	assert.Equal(t, tot.UTCTime, parsed.UTCTime)
+
+	got, err := parsed.LocalTimeOffsets()
+	assert.NoError(t, err)
+	assert.Equal(t, offsets, got)
+
+	// The descriptor also decodes through the registry.
+	typed, err := DecodeDescriptors(parsed.Descriptors)
+	assert.NoError(t, err)
+	assert.Equal(t, []TypedDescriptor{LocalTimeOffsets(offsets)}, typed)
+	assert.Equal(t, parsed.Descriptors[0], typed[0].Descriptor())
+}
+
+func TestParseTOTErrors(t *testing.T) {
+	tot := &TOT{UTCTime: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	s, err := tot.Section()
+	assert.NoError(t, err)
+	s.Data[5]++
+	_, err = ParseTOT(s)
+	assert.ErrorIs(t, err, ErrCRCMismatch)
+
+	_, err = ParseLocalTimeOffsets(Descriptor{Tag: LocalTimeOffsetDescriptorTag, Data: make([]byte, 12)})
+	assert.ErrorIs(t, err, ErrInvalidSection)
+	_, err = Descriptor{Tag: LocalTimeOffsetDescriptorTag, Data: make([]byte, 12)}.Decode()
+	assert.ErrorIs(t, err, ErrInvalidDescriptor)
+}
@@ -0,0 +1,170 @@
+package mpegts
+
+import "time"
+
+// Timestamp ranges. PTS, DTS and the PCR base count a 90 kHz clock in 33 bits; the PCR adds a 9-bit
+// extension counting 0 to 299, so the 27 MHz PCR wraps 300 times later than it would in 33 bits.
+const (
+	PTSWrap     = 1 << 33       // Number of distinct PTS values.
+	PCRWrap     = PTSWrap * 300 // Number of distinct PCR values.
+	MaxPTSValue = PTSWrap - 1
+	MaxPCRValue = PCRWrap - 1
+
+	PTSClock = 90000    // PTS ticks per second.
+	PCRClock = 27000000 // PCR ticks per second.
+)
+
+// PTS is a 33-bit presentation or decoding timestamp in the 90 kHz clock. Arithmetic and comparisons
+// are wrap-safe: two timestamps are compared over the shorter way round the 33-bit circle, so values
+// just after a wrap are later than values just before it.
+type PTS uint64
+
+// NewPTS returns the timestamp of v ticks, reduced modulo 2^33.
+func NewPTS(v uint64) PTS {
+	return PTS(v % PTSWrap)
+}
+
+// PTSFromDuration returns the timestamp of d after zero, reduced modulo 2^33.
+func PTSFromDuration(d time.Duration) PTS {
+	return PTS(0).Add(d)
+}
+
+// Sub returns the signed number of ticks from u to t, in [-2^32, 2^32).
+func (t PTS) Sub(u PTS) int64 {
+	return wrapDiff(uint64(t), uint64(u), PTSWrap)
+}
+
+// Since returns the duration from u to t.
+func (t PTS) Since(u PTS) time.Duration {
+	return ptsDuration(t.Sub(u))
+}
+
+// Add returns the timestamp d after t, wrapping as needed. Negative durations move backwards.
+func (t PTS) Add(d time.Duration) PTS {
+	return t.AddTicks(durationTicks(d, PTSClock))
+}
+
+// AddTicks returns the timestamp n 90 kHz ticks after t, wrapping as needed.
+func (t PTS) AddTicks(n int64) PTS {
+	return PTS(wrapAdd(uint64(t), n, PTSWrap))
+}
+
+// Before reports whether t is earlier than u.
+func (t PTS) Before(u PTS) bool { return t.Sub(u) < 0 }
+
+// After reports whether t is later than u.
+func (t PTS) After(u PTS) bool { return t.Sub(u) > 0 }
+
+// Duration returns the time from zero to t, ignoring wraps.
+func (t PTS) Duration() time.Duration {
+	return ptsDuration(int64(t % PTSWrap))
+}
+
+// PCR returns the 27 MHz clock reference of t.
+func (t PTS) PCR() PCR {
+	return PCR(uint64(t%PTSWrap) * 300)
+}
+
+// PCR is a 42-bit program clock reference in the 27 MHz clock, base*300+extension. Arithmetic and
+// comparisons are wrap-safe in the same way as for PTS.
+type PCR uint64
+
+// NewPCR returns the clock reference of v ticks, reduced modulo 2^33*300.
+func NewPCR(v uint64) PCR {
+	return PCR(v % PCRWrap)
+}
+
+// NewPCRFromParts returns the clock reference with the given 90 kHz base and 27 MHz extension.
+func NewPCRFromParts(base uint64, ext uint16) PCR {
+	return PCR((base%PTSWrap)*300 + uint64(ext%300))
+}
+
+// PCRFromDuration returns the clock reference of d after zero, reduced modulo 2^33*300.
+func PCRFromDuration(d time.Duration) PCR {
+	return PCR(0).Add(d)
+}
+
+// Base returns the 33-bit program_clock_reference_base, which is the PCR in the PTS clock.
+func (c PCR) Base() PTS {
+	return PTS(uint64(c%PCRWrap) / 300)
+}
+
+// Ext returns the 9-bit program_clock_reference_extension.
+func (c PCR) Ext() uint16 {
+	return uint16(c % PCRWrap % 300)
+}
+
+// Sub returns the signed number of ticks from u to c, in [-2^33*150, 2^33*150).
+func (c PCR) Sub(u PCR) int64 {
+	return wrapDiff(uint64(c), uint64(u), PCRWrap)
+}
+
+// Since returns the duration from u to c.
+func (c PCR) Since(u PCR) time.Duration {
+	return pcrDuration(c.Sub(u))
+}
+
+// Add returns the clock reference d after c, wrapping as needed. Negative durations move backwards.
+func (c PCR) Add(d time.Duration) PCR {
+	return c.AddTicks(durationTicks(d, PCRClock))
+}
+
+// AddTicks returns the clock reference n 27 MHz ticks after c, wrapping as needed.
+func (c PCR) AddTicks(n int64) PCR {
+	return PCR(wrapAdd(uint64(c), n, PCRWrap))
+}
+
+// Before reports whether c is earlier than u.
+func (c PCR) Before(u PCR) bool { return c.Sub(u) < 0 }
+
+// After reports whether c is later than u.
+func (c PCR) After(u PCR) bool { return c.Sub(u) > 0 }
+
+// Duration returns the time from zero to c, ignoring wraps.
+func (c PCR) Duration() time.Duration {
+	return pcrDuration(int64(c % PCRWrap))
+}
+
+// wrapDiff returns t-u on a circle of size wrap, in [-wrap/2, wrap/2).
+func wrapDiff(t, u, wrap uint64) int64 {
+	d := (t%wrap + wrap - u%wrap) % wrap
+	if d >= wrap/2 {
+		return int64(d) - int64(wrap)
+	}
+	return int64(d)
+}
+
+// wrapAdd returns t+n on a circle of size wrap.
+func wrapAdd(t uint64, n int64, wrap uint64) uint64 {
+	m := n % int64(wrap)
+	if m < 0 {
+		m += int64(wrap)
+	}
+	return (t%wrap + uint64(m)) % wrap
+}
+
+// durationTicks converts d to ticks of a clock of the given rate, rounding to the nearest tick.
+func durationTicks(d time.Duration, rate int64) int64 {
+	sec, frac := int64(d/time.Second), int64(d%time.Second)
+	return sec*rate + (frac*rate+sign(frac)*int64(time.Second)/2)/int64(time.Second)
+}
+
+// ptsDuration converts 90 kHz ticks to a duration.
+func ptsDuration(n int64) time.Duration {
+	return time.Duration(n) * time.Second / PTSClock
+}
+
+// pcrDuration converts 27 MHz ticks to a duration, truncated to the nanosecond.
+func pcrDuration(n int64) time.Duration {
+	return time.Duration(n) * 1000 / 27
+}
+
+func sign(n int64) int64 {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package mpegts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPTSArithmetic(t *testing.T) {
+	assert.Equal(t, PTS(5), NewPTS(PTSWrap+5))
+	assert.Equal(t, PTS(90000), PTSFromDuration(time.Second))
+
+	late := PTS(MaxPTSValue - 89999) // One second before the wrap.
+	early := late.Add(2 * time.Second)
+	assert.Equal(t, PTS(90000), early)
+	assert.Equal(t, int64(180000), early.Sub(late))
+	assert.Equal(t, int64(-180000), late.Sub(early))
+	assert.Equal(t, 2*time.Second, early.Since(late))
+	assert.True(t, early.After(late), "values after the wrap are later")
+	assert.True(t, late.Before(early))
+	assert.False(t, late.Before(late))
+	assert.Equal(t, late, early.Add(-2*time.Second))
+	assert.Equal(t, late, early.AddTicks(-180000))
+	assert.Equal(t, early, early.AddTicks(3*PTSWrap))
+
+	assert.Equal(t, time.Second, PTS(90000).Duration())
+	assert.Equal(t, 95443717677777*time.Nanosecond, PTS(MaxPTSValue).Duration())
+	assert.Equal(t, PCR(90000*300), PTS(90000).PCR())
+}
+
+func TestPCRArithmetic(t *testing.T) {
+	assert.Equal(t, PCR(5), NewPCR(PCRWrap+5))
+	assert.Equal(t, PCR(27000000), PCRFromDuration(time.Second))
+	assert.Equal(t, PCR(37), PCRFromDuration(1370*time.Nanosecond), "rounded to the nearest tick")
+
+	pcr := NewPCRFromParts(MaxPTSValue, 299)
+	assert.Equal(t, PCR(MaxPCRValue), pcr)
+	assert.Equal(t, PTS(MaxPTSValue), pcr.Base())
+	assert.Equal(t, uint16(299), pcr.Ext())
+
+	next := pcr.AddTicks(1)
+	assert.Equal(t, PCR(0), next, "the PCR wraps at 2^33*300, not 2^33")
+	assert.Equal(t, int64(1), next.Sub(pcr))
+	assert.True(t, next.After(pcr))
+
+	later := pcr.Add(40 * time.Millisecond)
+	assert.Equal(t, 40*time.Millisecond, later.Since(pcr))
+	assert.Equal(t, -40*time.Millisecond, pcr.Since(later))
+	assert.Equal(t, PCR(1079999), later)
+
+	// Half way round the circle counts as earlier.
+	assert.Equal(t, int64(-PCRWrap/2), PCR(PCRWrap/2).Sub(0))
+	assert.Equal(t, time.Second, PCR(27000000).Duration())
+}
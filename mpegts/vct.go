@@ -0,0 +1,269 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+const (
+	vctChannelLength = 32 // Fixed part of each VCT channel loop entry.
+	shortNameLength  = 7  // short_name is seven UTF-16 code units.
+)
+
+// ETM_location values.
+const (
+	ETMNone        = 0x00
+	ETMInPTC       = 0x01 // ETM carried in the physical channel carrying the event or channel.
+	ETMInChannelTS = 0x02 // ETM carried in the physical channel containing this table.
+)
+
+// ATSC service_type values.
+const (
+	ATSCServiceAnalogTV  = 0x01
+	ATSCServiceDigitalTV = 0x02
+	ATSCServiceAudio     = 0x03
+	ATSCServiceData      = 0x04
+)
+
+// Modulation modes of a virtual channel.
+const (
+	ModulationAnalog = 0x01
+	ModulationQAM64  = 0x02
+	ModulationQAM256 = 0x03
+	Modulation8VSB   = 0x04
+	Modulation16VSB  = 0x05
+)
+
+// VCT represents an ATSC Terrestrial or Cable Virtual Channel Table.
+type VCT struct {
+	Cable                 bool // CVCT (table_id 0xC9) rather than TVCT (0xC8).
+	TransportStreamID     uint16
+	Version               uint8
+	CurrentNext           bool
+	ProtocolVersion       uint8
+	Channels              []VirtualChannel
+	AdditionalDescriptors []Descriptor
+}
+
+// VirtualChannel describes one entry of the VCT channel loop.
+type VirtualChannel struct {
+	ShortName        string // Up to seven UTF-16 code units.
+	MajorNumber      uint16 // 10 bits.
+	MinorNumber      uint16 // 10 bits.
+	ModulationMode   uint8
+	CarrierFrequency uint32
+	ChannelTSID      uint16
+	ProgramNumber    uint16
+	ETMLocation      uint8 // 2 bits.
+	AccessControlled bool
+	Hidden           bool
+	PathSelect       bool // CVCT only.
+	OutOfBand        bool // CVCT only.
+	HideGuide        bool
+	ServiceType      uint8 // 6 bits.
+	SourceID         uint16
+	Descriptors      []Descriptor
+}
+
+// ParseVCT builds a TVCT or CVCT from one or more reassembled sections of the same table.
+// Additional descriptors are collected from every section.
+func ParseVCT(sections ...*Section) (*VCT, error) {
+	var vct *VCT
+	for _, s := range sections {
+		if (s.TableID != TVCTTableID && s.TableID != CVCTTableID) || !s.SectionSyntaxIndicator {
+			continue
+		}
+		body := s.Body()
+		if len(body) < 2 {
+			return nil, ErrInvalidSection
+		}
+
+		if vct == nil {
+			vct = &VCT{
+				Cable:             s.TableID == CVCTTableID,
+				TransportStreamID: s.TableIDExtension,
+				Version:           s.Version,
+				CurrentNext:       s.CurrentNext,
+				ProtocolVersion:   body[0],
+			}
+		} else if s.TableIDExtension != vct.TransportStreamID || s.Version != vct.Version {
+			return nil, ErrInvalidSection
+		}
+
+		count := int(body[1])
+		body = body[2:]
+		for i := 0; i < count; i++ {
+			if len(body) < vctChannelLength {
+				return nil, ErrInvalidSection
+			}
+			length := int(binary.BigEndian.Uint16(body[30:32]) & 0x03FF)
+			if len(body) < vctChannelLength+length {
+				return nil, ErrInvalidSection
+			}
+			descriptors, err := ParseDescriptors(body[vctChannelLength : vctChannelLength+length])
+			if err != nil {
+				return nil, err
+			}
+			vct.Channels = append(vct.Channels, parseVirtualChannel(body, vct.Cable, descriptors))
+			body = body[vctChannelLength+length:]
+		}
+
+		if len(body) < 2 || len(body) < 2+int(binary.BigEndian.Uint16(body[0:2])&0x03FF) {
+			return nil, ErrInvalidSection
+		}
+		descriptors, err := ParseDescriptors(body[2 : 2+int(binary.BigEndian.Uint16(body[0:2])&0x03FF)])
+		if err != nil {
+			return nil, err
+		}
+		vct.AdditionalDescriptors = append(vct.AdditionalDescriptors, descriptors...)
+	}
+
+	if vct == nil {
+		return nil, ErrTableNotFound
+	}
+	return vct, nil
+}
+
+// parseVirtualChannel decodes the fixed part of a channel loop entry.
+func parseVirtualChannel(data []byte, cable bool, descriptors []Descriptor) VirtualChannel {
+	units := make([]uint16, 0, shortNameLength)
+	for i := 0; i < shortNameLength; i++ {
+		u := binary.BigEndian.Uint16(data[2*i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+
+	numbers := binary.BigEndian.Uint32(data[14:18])
+	flags := binary.BigEndian.Uint16(data[26:28])
+	ch := VirtualChannel{
+		ShortName:        string(utf16.Decode(units)),
+		MajorNumber:      uint16(numbers>>18) & 0x03FF,
+		MinorNumber:      uint16(numbers>>8) & 0x03FF,
+		ModulationMode:   data[17],
+		CarrierFrequency: binary.BigEndian.Uint32(data[18:22]),
+		ChannelTSID:      binary.BigEndian.Uint16(data[22:24]),
+		ProgramNumber:    binary.BigEndian.Uint16(data[24:26]),
+		ETMLocation:      uint8(flags >> 14),
+		AccessControlled: flags&0x2000 != 0,
+		Hidden:           flags&0x1000 != 0,
+		HideGuide:        flags&0x0200 != 0,
+		ServiceType:      uint8(flags) & 0x3F,
+		SourceID:         binary.BigEndian.Uint16(data[28:30]),
+		Descriptors:      descriptors,
+	}
+	if cable {
+		ch.PathSelect = flags&0x0800 != 0
+		ch.OutOfBand = flags&0x0400 != 0
+	}
+	return ch
+}
+
+// marshal serializes the channel loop entry.
+func (ch *VirtualChannel) marshal(cable bool) ([]byte, error) {
+	descriptors, err := EncodeDescriptors(ch.Descriptors)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, vctChannelLength, vctChannelLength+len(descriptors))
+
+	units := utf16.Encode([]rune(ch.ShortName))
+	for i := 0; i < shortNameLength && i < len(units); i++ {
+		binary.BigEndian.PutUint16(data[2*i:], units[i])
+	}
+
+	numbers := uint32(0xF0000000) | uint32(ch.MajorNumber&0x03FF)<<18 | uint32(ch.MinorNumber&0x03FF)<<8 | uint32(ch.ModulationMode)
+	binary.BigEndian.PutUint32(data[14:18], numbers)
+	binary.BigEndian.PutUint32(data[18:22], ch.CarrierFrequency)
+	binary.BigEndian.PutUint16(data[22:24], ch.ChannelTSID)
+	binary.BigEndian.PutUint16(data[24:26], ch.ProgramNumber)
+
+	flags := uint16(ch.ETMLocation&0x03)<<14 | 0x01C0 | uint16(ch.ServiceType&0x3F)
+	if ch.AccessControlled {
+		flags |= 0x2000
+	}
+	if ch.Hidden {
+		flags |= 0x1000
+	}
+	if !cable || ch.PathSelect {
+		flags |= 0x0800 // Reserved in the TVCT.
+	}
+	if !cable || ch.OutOfBand {
+		flags |= 0x0400
+	}
+	if ch.HideGuide {
+		flags |= 0x0200
+	}
+	binary.BigEndian.PutUint16(data[26:28], flags)
+	binary.BigEndian.PutUint16(data[28:30], ch.SourceID)
+	binary.BigEndian.PutUint16(data[30:32], 0xFC00|uint16(len(descriptors))&0x03FF)
+	return append(data, descriptors...), nil
+}
+
+// Channel returns the channel with the given major and minor channel numbers.
+func (vct *VCT) Channel(major, minor uint16) (*VirtualChannel, error) {
+	for i := range vct.Channels {
+		if vct.Channels[i].MajorNumber == major && vct.Channels[i].MinorNumber == minor {
+			return &vct.Channels[i], nil
+		}
+	}
+	return nil, ErrProgramNotFound
+}
+
+// Sections encodes the VCT, splitting the channel loop across sections as needed.
+// The additional descriptors are carried in the first section. It returns ErrInvalidDescriptor if a
+// descriptor is too long to encode.
+func (vct *VCT) Sections() ([]*Section, error) {
+	additional, err := EncodeDescriptors(vct.AdditionalDescriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([][]byte, len(vct.Channels))
+	for i := range vct.Channels {
+		if entries[i], err = vct.Channels[i].marshal(vct.Cable); err != nil {
+			return nil, err
+		}
+	}
+
+	tableID := uint8(TVCTTableID)
+	if vct.Cable {
+		tableID = CVCTTableID
+	}
+
+	// protocol_version, num_channels_in_section and additional_descriptors_length are in every section.
+	room := maxPSISectionLength - (longSectionHeaderLen - sectionHeaderLength) - crcLength - 4
+	groups, counts := packEntries(entries, room-len(additional))
+	sections := make([]*Section, len(groups))
+	for i, group := range groups {
+		var descriptors []byte
+		if i == 0 {
+			descriptors = additional
+		}
+
+		body := []byte{vct.ProtocolVersion, byte(counts[i])}
+		body = append(body, group...)
+		body = binary.BigEndian.AppendUint16(body, 0xFC00|uint16(len(descriptors))&0x03FF)
+		body = append(body, descriptors...)
+
+		s := psipSection(PSIPBasePID, tableID, vct.TransportStreamID, vct.Version)
+		s.CurrentNext = vct.CurrentNext
+		s.SectionNumber = uint8(i)
+		s.LastSectionNumber = uint8(len(groups) - 1)
+		s.Marshal(body)
+		sections[i] = s
+	}
+	return sections, nil
+}
+
+// Encode packetizes the VCT onto the PSIP base PID starting at continuity counter cc.
+// It returns the packets and the continuity counter for the next packet on the PID.
+func (vct *VCT) Encode(cc uint8) (EncodedPackets, uint8, error) {
+	sections, err := vct.Sections()
+	if err != nil {
+		return nil, cc, err
+	}
+	packets, next := PacketizeSections(PSIPBasePID, cc, sectionData(sections)...)
+	return packets, next, nil
+}
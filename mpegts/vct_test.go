@@ -0,0 +1,104 @@
+package mpegts
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testVCT() *VCT {
+	return &VCT{
+		TransportStreamID: 0x0A01,
+		Version:           2,
+		CurrentNext:       true,
+		Channels: []VirtualChannel{
+			{
+				ShortName:      "KTRB-HD",
+				MajorNumber:    3,
+				MinorNumber:    1,
+				ModulationMode: Modulation8VSB,
+				ChannelTSID:    0x0A01,
+				ProgramNumber:  1,
+				ETMLocation:    ETMInChannelTS,
+				ServiceType:    ATSCServiceDigitalTV,
+				SourceID:       1,
+				Descriptors:    []Descriptor{{Tag: 0xA1, Data: []byte{0xE1, 0x01, 0x01}}},
+			},
+			{
+				ShortName:      "KTRB",
+				MajorNumber:    3,
+				MinorNumber:    2,
+				ModulationMode: Modulation8VSB,
+				ChannelTSID:    0x0A01,
+				ProgramNumber:  2,
+				HideGuide:      true,
+				ServiceType:    ATSCServiceDigitalTV,
+				SourceID:       2,
+			},
+		},
+	}
+}
+
+func TestVCTRoundTrip(t *testing.T) {
+	vct := testVCT()
+	packets, _, err := vct.Encode(0)
+	assert.NoError(t, err)
+	sections := reassemble(t, packets)
+	assert.Len(t, sections, 1)
+	assert.Equal(t, uint8(TVCTTableID), sections[0].TableID)
+
+	parsed, err := ParseVCT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, vct, parsed)
+
+	ch, err := parsed.Channel(3, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "KTRB", ch.ShortName)
+	assert.Equal(t, uint16(2), ch.SourceID)
+	_, err = parsed.Channel(4, 1)
+	assert.ErrorIs(t, err, ErrProgramNotFound)
+}
+
+func TestCVCTRoundTrip(t *testing.T) {
+	vct := testVCT()
+	vct.Cable = true
+	vct.Channels[0].PathSelect = true
+	vct.Channels[1].OutOfBand = true
+	vct.Channels[1].ModulationMode = ModulationQAM256
+	vct.AdditionalDescriptors = []Descriptor{{Tag: 0xF0, Data: []byte{0x01}}}
+
+	sections, err := vct.Sections()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(CVCTTableID), sections[0].TableID)
+
+	parsed, err := ParseVCT(sections...)
+	assert.NoError(t, err)
+	assert.Equal(t, vct, parsed)
+}
+
+func TestVCTMultipleSections(t *testing.T) {
+	vct := &VCT{TransportStreamID: 1, CurrentNext: true}
+	for i := 1; i <= 60; i++ {
+		vct.Channels = append(vct.Channels, VirtualChannel{
+			ShortName:   fmt.Sprintf("CH%d", i),
+			MajorNumber: 10,
+			MinorNumber: uint16(i),
+			ServiceType: ATSCServiceDigitalTV,
+			SourceID:    uint16(i),
+		})
+	}
+
+	sections, err := vct.Sections()
+	assert.NoError(t, err)
+	assert.Greater(t, len(sections), 1)
+	for _, s := range sections {
+		assert.LessOrEqual(t, len(s.Data), sectionHeaderLength+maxPSISectionLength)
+	}
+
+	packets, _, err := vct.Encode(0)
+	assert.NoError(t, err)
+	parsed, err := ParseVCT(reassemble(t, packets)...)
+	assert.NoError(t, err)
+	assert.Equal(t, vct.Channels, parsed.Channels)
+}
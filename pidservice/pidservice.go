@@ -0,0 +1,553 @@
+// Package pidservice implements the Program ID Service. It collects the PAT, CAT and PMTs of every
+// input, gives each input program a program_number and each input PID an output PID that no other input
+// uses, hands every reader the PID lookup table to rewrite its packets with, and regenerates the PAT,
+// CAT and PMTs of the multiplex.
+//
+// Collisions are resolved first come, first served: a program or PID keeps its number when it is free,
+// and otherwise takes the lowest free one, the colliding values of an update being placed in ascending
+// order after those that keep their numbers. Numbers never move once assigned, so a change to the PSI
+// of one input leaves the programs of the others, and its own unchanged programs, untouched. Numbers
+// are released when their program leaves its input's PAT, or when the input is removed.
+package pidservice
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/Channel-3-Eugene/tribd/carousel"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+const (
+	firstPID = 0x0020 // Lowest PID assigned; lower PIDs are reserved for PSI and SI.
+	lastPID  = 0x1FFE // Highest PID assigned, below the null packet PID.
+)
+
+// PIDMapper receives the PID lookup table of an input. reader.Reader satisfies it.
+type PIDMapper interface {
+	SetPIDMap(lut map[uint16]uint16)
+}
+
+// Program describes a program of the multiplex.
+type Program struct {
+	Input        uint              // Input carrying the program.
+	SourceNumber uint16            // program_number in the input.
+	Number       uint16            // program_number in the multiplex.
+	PMTPID       uint16            // PMT PID in the multiplex.
+	PIDs         map[uint16]uint16 // Input PID -> output PID of the PMT, PCR, elementary stream and ECM PIDs.
+}
+
+// Remapped reports whether the program number or any PID of the program was changed to resolve a
+// collision.
+func (p Program) Remapped() bool {
+	if p.Number != p.SourceNumber {
+		return true
+	}
+	for from, to := range p.PIDs {
+		if from != to {
+			return true
+		}
+	}
+	return false
+}
+
+// tableKey identifies a table being collected from its sections.
+type tableKey struct {
+	pid       uint16
+	tableID   uint8
+	extension uint16
+}
+
+// input holds the PSI of one input and the numbers assigned to it.
+type input struct {
+	id       uint
+	mapper   PIDMapper
+	sections *mpegts.SectionAssembler
+	pending  map[tableKey][]*mpegts.Section
+
+	pat  *mpegts.PAT
+	pmts map[uint16]*mpegts.PMT // Input program_number -> PMT.
+	cat  *mpegts.CAT
+	ca   *mpegts.CAMap
+
+	programs map[uint16]uint16 // Input program_number -> output program_number.
+	lut      map[uint16]uint16 // Input PID -> output PID.
+}
+
+// output holds a regenerated table with the PID it is sent on and its version, kept while the table is
+// absent so that a table reappearing is sent with a new one.
+type output[T any] struct {
+	table   T
+	pid     uint16
+	version uint8
+}
+
+// Service is the Program ID Service. It is safe for concurrent use.
+type Service struct {
+	mu                sync.Mutex
+	transportStreamID uint16
+	inputs            map[uint]*input
+	programs          map[uint16]bool // Assigned output program numbers.
+	pids              map[uint16]bool // Assigned output PIDs.
+
+	pat  output[*mpegts.PAT]
+	cat  output[*mpegts.CAT]
+	pmts map[uint16]*output[*mpegts.PMT] // Output program_number -> PMT.
+	cc   map[uint16]uint8                // Continuity counter of each PSI PID.
+
+	published map[carousel.Key]bool // PMTs handed to a carousel by Publish.
+}
+
+// NewService creates a Program ID Service for a multiplex with the given transport_stream_id.
+func NewService(transportStreamID uint16) *Service {
+	return &Service{
+		transportStreamID: transportStreamID,
+		inputs:            make(map[uint]*input),
+		programs:          make(map[uint16]bool),
+		pids:              make(map[uint16]bool),
+		pat:               output[*mpegts.PAT]{table: mpegts.NewPAT(transportStreamID, 0), pid: mpegts.PATPID},
+		cat:               output[*mpegts.CAT]{pid: mpegts.CATPID},
+		pmts:              make(map[uint16]*output[*mpegts.PMT]),
+		cc:                make(map[uint16]uint8),
+		published:         make(map[carousel.Key]bool),
+	}
+}
+
+// AddInput registers the mapper that receives the PID lookup table of an input, and hands it the table
+// as it stands. Inputs whose PSI arrives without a mapper are still assigned numbers.
+func (s *Service) AddInput(id uint, mapper PIDMapper) {
+	s.mu.Lock()
+	in := s.input(id)
+	in.mapper = mapper
+	lut := maps.Clone(in.lut)
+	s.mu.Unlock()
+
+	mapper.SetPIDMap(lut)
+}
+
+// RemoveInput forgets an input, releasing its program numbers and PIDs.
+func (s *Service) RemoveInput(id uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	in, ok := s.inputs[id]
+	if !ok {
+		return
+	}
+	in.pat, in.cat = nil, nil
+	in.ca = mpegts.NewCAMap()
+	clear(in.pmts)
+	s.assign(in)
+	delete(s.inputs, id)
+	s.rebuild()
+}
+
+// HandlePSI takes a PSI or SI packet of an input, as handed over by its reader. SI is ignored: the SI
+// of the multiplex is generated rather than taken from the inputs. Once a packet completes a table that
+// differs from the one the input last sent, the numbers of the input are reassigned, its mapper is
+// handed the new lookup table if it changed, and the tables of the multiplex are regenerated.
+func (s *Service) HandlePSI(id uint, ep *mpegts.EncodedPacket) {
+	s.mu.Lock()
+	in := s.input(id)
+	sections, _ := in.sections.Push(ep)
+	changed := false
+	for _, section := range sections {
+		if table := in.collect(section); table != nil && in.update(table) {
+			changed = true
+		}
+	}
+	if !changed {
+		s.mu.Unlock()
+		return
+	}
+
+	before := in.lut
+	s.assign(in)
+	s.rebuild()
+	mapper, lut := in.mapper, in.lut
+	s.mu.Unlock()
+
+	if mapper != nil && !maps.Equal(before, lut) {
+		mapper.SetPIDMap(maps.Clone(lut))
+	}
+}
+
+// Programs returns the programs of the multiplex in ascending order of program number. Programs are
+// listed once their PMT has arrived.
+func (s *Service) Programs() []Program {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var programs []Program
+	for _, in := range s.inputs {
+		for source, number := range in.programs {
+			pmt, ok := in.pmts[source]
+			if !ok {
+				continue
+			}
+			pmtPID := in.pat.Programs[source]
+			p := Program{
+				Input:        in.id,
+				SourceNumber: source,
+				Number:       number,
+				PMTPID:       in.lut[pmtPID],
+				PIDs:         map[uint16]uint16{pmtPID: in.lut[pmtPID]},
+			}
+			for _, pid := range append(pmt.PIDs(), pmt.ECMPIDs()...) {
+				if to, ok := in.lut[pid]; ok {
+					p.PIDs[pid] = to
+				}
+			}
+			programs = append(programs, p)
+		}
+	}
+	slices.SortFunc(programs, func(a, b Program) int { return int(a.Number) - int(b.Number) })
+	return programs
+}
+
+// LUT returns the PID lookup table of an input.
+func (s *Service) LUT(id uint) map[uint16]uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in, ok := s.inputs[id]; ok {
+		return maps.Clone(in.lut)
+	}
+	return map[uint16]uint16{}
+}
+
+// PAT returns the PAT of the multiplex.
+func (s *Service) PAT() *mpegts.PAT {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pat := *s.pat.table
+	pat.Programs = maps.Clone(pat.Programs)
+	return &pat
+}
+
+// Publish hands the current PAT, CAT and PMTs to a carousel at their usual repetition intervals, and
+// removes the PMTs of programs that have left the multiplex. The carousel keeps the versions of the
+// tables it sends, so Publish may be called after every change or on a timer.
+func (s *Service) Publish(c *carousel.Carousel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := c.Set(mpegts.PATPID, carousel.PATInterval, s.pat.table.Sections()...); err != nil {
+		return err
+	}
+	catKey := carousel.Key{PID: mpegts.CATPID, TableID: mpegts.CATTableID, Extension: 0xFFFF}
+	if s.cat.table == nil {
+		c.Remove(catKey)
+	} else {
+		sections, err := s.cat.table.Sections()
+		if err != nil {
+			return err
+		}
+		if err := c.Set(mpegts.CATPID, carousel.CATInterval, sections...); err != nil {
+			return err
+		}
+	}
+
+	published := make(map[carousel.Key]bool)
+	for program, out := range s.pmts {
+		if out.table == nil {
+			continue
+		}
+		section, err := out.table.Section()
+		if err != nil {
+			continue // Too large for one section.
+		}
+		if err := c.Set(out.pid, carousel.PMTInterval, section); err != nil {
+			return err
+		}
+		published[carousel.Key{PID: out.pid, TableID: mpegts.PMTTableID, Extension: program}] = true
+	}
+	for key := range s.published {
+		if !published[key] {
+			c.Remove(key)
+		}
+	}
+	s.published = published
+	return nil
+}
+
+// Packets packetizes the current PAT, the CAT when an input has one, and the PMT of every program,
+// continuing the continuity counters of each PID. Call it at the PSI repetition interval and send the
+// packets ahead of the queued ones.
+func (s *Service) Packets() mpegts.EncodedPackets {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	packets, next := s.pat.table.Encode(s.cc[mpegts.PATPID])
+	s.cc[mpegts.PATPID] = next
+
+	if s.cat.table != nil {
+		if cat, next, err := s.cat.table.Encode(s.cc[mpegts.CATPID]); err == nil {
+			s.cc[mpegts.CATPID] = next
+			packets = append(packets, cat...)
+		}
+	}
+
+	for _, program := range sortedKeys(s.pmts) {
+		out := s.pmts[program]
+		if out.table == nil {
+			continue
+		}
+		pmt, next, err := out.table.Encode(out.pid, s.cc[out.pid])
+		if err != nil {
+			continue // Too large for one section.
+		}
+		s.cc[out.pid] = next
+		packets = append(packets, pmt...)
+	}
+	return packets
+}
+
+// input returns the state of an input, creating it on first use.
+func (s *Service) input(id uint) *input {
+	in, ok := s.inputs[id]
+	if !ok {
+		in = &input{
+			id:       id,
+			sections: mpegts.NewSectionAssembler(),
+			pending:  make(map[tableKey][]*mpegts.Section),
+			pmts:     make(map[uint16]*mpegts.PMT),
+			ca:       mpegts.NewCAMap(),
+			programs: make(map[uint16]uint16),
+			lut:      make(map[uint16]uint16),
+		}
+		s.inputs[id] = in
+	}
+	return in
+}
+
+// collect gathers the sections of a table and returns them once every section of its version has
+// arrived. Sections not yet applicable, and those of other tables than the PAT, CAT and PMTs, are
+// ignored.
+func (in *input) collect(section *mpegts.Section) []*mpegts.Section {
+	switch section.TableID {
+	case mpegts.PATTableID, mpegts.CATTableID, mpegts.PMTTableID:
+	default:
+		return nil
+	}
+	if !section.SectionSyntaxIndicator || !section.CurrentNext || section.SectionNumber > section.LastSectionNumber {
+		return nil
+	}
+	key := tableKey{section.PID, section.TableID, section.TableIDExtension}
+	table := in.pending[key]
+	if len(table) != int(section.LastSectionNumber)+1 || table[0] != nil && table[0].Version != section.Version {
+		table = make([]*mpegts.Section, section.LastSectionNumber+1)
+	}
+	for _, s := range table {
+		if s != nil && s.Version != section.Version {
+			table = make([]*mpegts.Section, section.LastSectionNumber+1)
+			break
+		}
+	}
+	table[section.SectionNumber] = section
+	if slices.Contains(table, nil) {
+		in.pending[key] = table
+		return nil
+	}
+	delete(in.pending, key)
+	return table
+}
+
+// update applies a complete table to the PSI of the input and reports whether it changed. PMTs of
+// programs the PAT does not list on their PID are ignored.
+func (in *input) update(sections []*mpegts.Section) bool {
+	switch s := sections[0]; {
+	case s.PID == mpegts.PATPID && s.TableID == mpegts.PATTableID:
+		pat, err := mpegts.ParsePAT(sections...)
+		if err != nil || in.pat != nil && pat.Version == in.pat.Version && maps.Equal(pat.Programs, in.pat.Programs) {
+			return false
+		}
+		old := in.pat
+		in.pat = pat
+		for program := range in.pmts {
+			if pid, ok := pat.Programs[program]; !ok || pid != old.Programs[program] {
+				delete(in.pmts, program)
+				in.ca.RemoveProgram(program)
+			}
+		}
+		return true
+
+	case s.PID == mpegts.CATPID && s.TableID == mpegts.CATTableID:
+		cat, err := mpegts.ParseCAT(sections...)
+		if err != nil || reflect.DeepEqual(cat, in.cat) {
+			return false
+		}
+		in.cat = cat
+		in.ca.UpdateCAT(cat)
+		return true
+
+	case s.TableID == mpegts.PMTTableID:
+		if in.pat == nil || s.TableIDExtension == 0 || in.pat.Programs[s.TableIDExtension] != s.PID {
+			return false
+		}
+		pmt, err := mpegts.ParsePMT(sections...)
+		if err != nil || reflect.DeepEqual(pmt, in.pmts[pmt.ProgramNumber]) {
+			return false
+		}
+		in.pmts[pmt.ProgramNumber] = pmt
+		in.ca.UpdatePMT(pmt)
+		return true
+	}
+	return false
+}
+
+// assign releases the program numbers and PIDs the input no longer uses and assigns the new ones.
+func (s *Service) assign(in *input) {
+	var programs []uint16
+	if in.pat != nil {
+		programs = in.pat.ProgramNumbers()
+	}
+	in.programs = reassign(in.programs, programs, s.programs, 1, 0xFFFF)
+
+	used := make(map[uint16]bool)
+	for _, program := range programs {
+		used[in.pat.Programs[program]] = true
+		if pmt, ok := in.pmts[program]; ok {
+			for _, pid := range pmt.PIDs() {
+				used[pid] = true
+			}
+		}
+	}
+	for _, pid := range in.ca.PIDs() {
+		used[pid] = true
+	}
+	delete(used, 0x1FFF) // PCR_PID of programs without a PCR.
+	in.lut = reassign(in.lut, sortedKeys(used), s.pids, firstPID, lastPID)
+}
+
+// reassign maps the wanted values onto free numbers of [first, last]. Existing mappings of wanted values
+// are kept and those of values no longer wanted are released from assigned. New values keep their
+// number when it is in range and free; the others then take the lowest free numbers in turn.
+func reassign(mapping map[uint16]uint16, wanted []uint16, assigned map[uint16]bool, first, last uint16) map[uint16]uint16 {
+	next := make(map[uint16]uint16, len(wanted))
+	for _, value := range wanted {
+		if to, ok := mapping[value]; ok {
+			next[value] = to
+		}
+	}
+	for value, to := range mapping {
+		if _, ok := next[value]; !ok {
+			delete(assigned, to)
+		}
+	}
+
+	var moved []uint16
+	for _, value := range wanted {
+		if _, ok := next[value]; ok {
+			continue
+		}
+		if value < first || value > last || assigned[value] {
+			moved = append(moved, value)
+			continue
+		}
+		assigned[value] = true
+		next[value] = value
+	}
+
+	to := first
+	for _, value := range moved {
+		for assigned[to] && to < last {
+			to++
+		}
+		if assigned[to] {
+			break // Every number is taken; the rest are left unmapped.
+		}
+		assigned[to] = true
+		next[value] = to
+	}
+	return next
+}
+
+// rebuild regenerates the PAT, CAT and PMTs of the multiplex from the inputs, bumping the version of
+// each table that changed.
+func (s *Service) rebuild() {
+	pat := mpegts.NewPAT(s.transportStreamID, s.pat.version)
+	pmts := make(map[uint16]*mpegts.PMT) // Output program_number -> PMT.
+	var cat *mpegts.CAT
+
+	for _, id := range sortedKeys(s.inputs) {
+		in := s.inputs[id]
+		for program, number := range in.programs {
+			source, ok := in.pmts[program]
+			pmtPID, mapped := in.lut[in.pat.Programs[program]]
+			if !ok || !mapped {
+				continue
+			}
+			pmt := copyPMT(source)
+			pmt.ProgramNumber = number
+			pmt.RemapPIDs(in.lut)
+			pat.Programs[number] = pmtPID
+			pmts[number] = pmt
+		}
+		if in.cat != nil {
+			if cat == nil {
+				cat = &mpegts.CAT{CurrentNext: true}
+			}
+			remapped := &mpegts.CAT{Descriptors: slices.Clone(in.cat.Descriptors)}
+			remapped.RemapPIDs(in.lut)
+			cat.Descriptors = append(cat.Descriptors, remapped.Descriptors...)
+		}
+	}
+
+	if !maps.Equal(pat.Programs, s.pat.table.Programs) {
+		s.pat.version = (s.pat.version + 1) & 0x1F
+		pat.Version = s.pat.version
+		s.pat.table = pat
+	}
+
+	if cat == nil {
+		s.cat.table = nil
+	} else if s.cat.table == nil || !reflect.DeepEqual(cat.Descriptors, s.cat.table.Descriptors) {
+		s.cat.version = (s.cat.version + 1) & 0x1F
+		cat.Version = s.cat.version
+		s.cat.table = cat
+	}
+
+	for program, out := range s.pmts {
+		if _, ok := pmts[program]; !ok {
+			out.table = nil
+		}
+	}
+	for program, pmt := range pmts {
+		out, ok := s.pmts[program]
+		if !ok {
+			out = &output[*mpegts.PMT]{}
+			s.pmts[program] = out
+		}
+		pmt.Version = out.version
+		if ok && pat.Programs[program] == out.pid && reflect.DeepEqual(pmt, out.table) {
+			continue
+		}
+		if ok {
+			out.version = (out.version + 1) & 0x1F
+			pmt.Version = out.version
+		}
+		out.table, out.pid = pmt, pat.Programs[program]
+	}
+}
+
+// copyPMT returns a copy of a PMT whose descriptor loops can be remapped without touching the original.
+func copyPMT(pmt *mpegts.PMT) *mpegts.PMT {
+	c := *pmt
+	c.ProgramInfo = slices.Clone(pmt.ProgramInfo)
+	c.Streams = slices.Clone(pmt.Streams)
+	for i := range c.Streams {
+		c.Streams[i].Descriptors = slices.Clone(pmt.Streams[i].Descriptors)
+	}
+	return &c
+}
+
+// sortedKeys returns the keys of a map in ascending order.
+func sortedKeys[K uint | uint16, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
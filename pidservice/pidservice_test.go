@@ -0,0 +1,249 @@
+package pidservice
+
+import (
+	"testing"
+
+	"github.com/Channel-3-Eugene/tribd/carousel"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/Channel-3-Eugene/tribd/reader"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ reader.PSIHandler = (*Service)(nil)
+	_ PIDMapper         = (*reader.Reader)(nil)
+)
+
+// recorder records the lookup tables handed to an input.
+type recorder struct {
+	luts []map[uint16]uint16
+}
+
+func (r *recorder) SetPIDMap(lut map[uint16]uint16) {
+	r.luts = append(r.luts, lut)
+}
+
+func (r *recorder) last() map[uint16]uint16 {
+	return r.luts[len(r.luts)-1]
+}
+
+// testPMT returns a program of one video and one audio stream carrying its PCR on the video PID.
+func testPMT(program, video, audio uint16, version uint8) *mpegts.PMT {
+	return &mpegts.PMT{
+		ProgramNumber: program,
+		Version:       version,
+		CurrentNext:   true,
+		PCRPID:        video,
+		Streams: []mpegts.ElementaryStream{
+			{StreamType: mpegts.StreamTypeH264, ElementaryPID: video},
+			{StreamType: mpegts.StreamTypeADTSAAC, ElementaryPID: audio},
+		},
+	}
+}
+
+// send hands the packets of a PAT and its PMTs to the service as the reader of an input would.
+func send(t *testing.T, s *Service, input uint, pat *mpegts.PAT, pmts ...*mpegts.PMT) {
+	packets, _ := pat.Encode(0)
+	for _, pmt := range pmts {
+		encoded, _, err := pmt.Encode(pat.Programs[pmt.ProgramNumber], 0)
+		assert.NoError(t, err)
+		packets = append(packets, encoded...)
+	}
+	for _, ep := range packets {
+		s.HandlePSI(input, ep)
+	}
+}
+
+// testPAT returns a PAT of the given programs and PMT PIDs.
+func testPAT(version uint8, programs map[uint16]uint16) *mpegts.PAT {
+	pat := mpegts.NewPAT(1, version)
+	for program, pid := range programs {
+		pat.Programs[program] = pid
+	}
+	return pat
+}
+
+// tables parses the PAT, CAT and PMTs packetized by the service.
+func tables(t *testing.T, s *Service) (*mpegts.PAT, *mpegts.CAT, map[uint16]*mpegts.PMT) {
+	sa := mpegts.NewSectionAssembler()
+	var (
+		pat  *mpegts.PAT
+		cat  *mpegts.CAT
+		pmts = make(map[uint16]*mpegts.PMT)
+	)
+	for _, ep := range s.Packets() {
+		sections, err := sa.Push(ep)
+		assert.NoError(t, err)
+		for _, section := range sections {
+			switch section.TableID {
+			case mpegts.PATTableID:
+				pat, err = mpegts.ParsePAT(section)
+			case mpegts.CATTableID:
+				cat, err = mpegts.ParseCAT(section)
+			case mpegts.PMTTableID:
+				var pmt *mpegts.PMT
+				pmt, err = mpegts.ParsePMT(section)
+				assert.Equal(t, pat.Programs[pmt.ProgramNumber], section.PID)
+				pmts[pmt.ProgramNumber] = pmt
+			}
+			assert.NoError(t, err)
+		}
+	}
+	return pat, cat, pmts
+}
+
+func TestServiceCollisions(t *testing.T) {
+	s := NewService(0x10)
+	first, second := &recorder{}, &recorder{}
+	s.AddInput(0, first)
+	s.AddInput(1, second)
+	assert.Empty(t, first.last())
+
+	// Both inputs carry program 1 on the same PIDs. The first keeps them.
+	send(t, s, 0, testPAT(0, map[uint16]uint16{1: 0x1000}), testPMT(1, 0x100, 0x101, 0))
+	send(t, s, 1, testPAT(0, map[uint16]uint16{1: 0x1000, 2: 0x1001}), testPMT(1, 0x100, 0x101, 0), testPMT(2, 0x200, 0x201, 0))
+
+	assert.Equal(t, map[uint16]uint16{0x1000: 0x1000, 0x100: 0x100, 0x101: 0x101}, first.last())
+	assert.Len(t, first.luts, 3) // Empty, then after the PAT and the PMT.
+
+	// The second keeps its free program 2 and the PIDs of that program, and moves the rest to the
+	// lowest free numbers.
+	assert.Equal(t, map[uint16]uint16{0x1000: 0x20, 0x1001: 0x1001, 0x100: 0x21, 0x101: 0x22, 0x200: 0x200, 0x201: 0x201}, second.last())
+	assert.Equal(t, second.last(), s.LUT(1))
+
+	programs := s.Programs()
+	assert.Len(t, programs, 3)
+	assert.Equal(t, Program{Input: 0, SourceNumber: 1, Number: 1, PMTPID: 0x1000, PIDs: map[uint16]uint16{0x1000: 0x1000, 0x100: 0x100, 0x101: 0x101}}, programs[0])
+	assert.False(t, programs[0].Remapped())
+	assert.Equal(t, uint16(2), programs[1].Number)
+	assert.Equal(t, uint16(2), programs[1].SourceNumber)
+	assert.False(t, programs[1].Remapped())
+	assert.Equal(t, uint16(3), programs[2].Number)
+	assert.Equal(t, uint16(1), programs[2].SourceNumber)
+	assert.True(t, programs[2].Remapped())
+
+	pat, cat, pmts := tables(t, s)
+	assert.Equal(t, uint16(0x10), pat.TransportStreamID)
+	assert.Equal(t, map[uint16]uint16{1: 0x1000, 2: 0x1001, 3: 0x20}, pat.Programs)
+	assert.Nil(t, cat)
+	assert.Equal(t, testPMT(1, 0x100, 0x101, 0), pmts[1])
+	assert.Equal(t, testPMT(2, 0x200, 0x201, 0), pmts[2])
+	assert.Equal(t, testPMT(3, 0x21, 0x22, 0), pmts[3])
+}
+
+func TestServiceVersionChange(t *testing.T) {
+	s := NewService(1)
+	first, second := &recorder{}, &recorder{}
+	s.AddInput(0, first)
+	s.AddInput(1, second)
+	send(t, s, 0, testPAT(0, map[uint16]uint16{1: 0x1000}), testPMT(1, 0x100, 0x101, 0))
+	send(t, s, 1, testPAT(0, map[uint16]uint16{1: 0x1000}), testPMT(1, 0x100, 0x101, 0))
+	patVersion := s.PAT().Version
+
+	// Repeated tables change nothing.
+	send(t, s, 1, testPAT(0, map[uint16]uint16{1: 0x1000}), testPMT(1, 0x100, 0x101, 0))
+	assert.Len(t, second.luts, 3)
+
+	// A new PMT version moves the audio of the second input onto a PID the first uses. Its other
+	// PIDs, and everything of the first input, stay where they were.
+	updated := testPMT(1, 0x100, 0x101, 1)
+	updated.Streams[1].ElementaryPID = 0x102
+	updated.Streams = append(updated.Streams, mpegts.ElementaryStream{StreamType: mpegts.StreamTypeADTSAAC, ElementaryPID: 0x101})
+	send(t, s, 1, testPAT(0, map[uint16]uint16{1: 0x1000}), updated)
+
+	assert.Len(t, first.luts, 3)
+	assert.Equal(t, map[uint16]uint16{0x1000: 0x20, 0x100: 0x21, 0x101: 0x22, 0x102: 0x102}, second.last())
+
+	pat, _, pmts := tables(t, s)
+	assert.Equal(t, patVersion, pat.Version)
+	assert.Equal(t, uint8(0), pmts[1].Version)
+	assert.Equal(t, uint8(1), pmts[2].Version)
+	assert.Equal(t, uint16(0x102), pmts[2].Streams[1].ElementaryPID)
+	assert.Equal(t, uint16(0x22), pmts[2].Streams[2].ElementaryPID)
+
+	// Dropping the program releases its numbers, which the next program to collide takes.
+	send(t, s, 1, testPAT(1, map[uint16]uint16{}))
+	assert.Empty(t, second.last())
+	pat, _, pmts = tables(t, s)
+	assert.Equal(t, map[uint16]uint16{1: 0x1000}, pat.Programs)
+	assert.Equal(t, (patVersion+1)&0x1F, pat.Version)
+	assert.Len(t, pmts, 1)
+
+	third := &recorder{}
+	s.AddInput(2, third)
+	send(t, s, 2, testPAT(0, map[uint16]uint16{1: 0x1000}), testPMT(1, 0x100, 0x101, 0))
+	assert.Equal(t, map[uint16]uint16{0x1000: 0x20, 0x100: 0x21, 0x101: 0x22}, third.last())
+
+	// The reused program number is announced with a new PMT version.
+	_, _, pmts = tables(t, s)
+	assert.Equal(t, uint8(2), pmts[2].Version)
+
+	s.RemoveInput(2)
+	assert.Equal(t, map[uint16]uint16{1: 0x1000}, s.PAT().Programs)
+	assert.Len(t, s.Programs(), 1)
+}
+
+func TestServiceConditionalAccess(t *testing.T) {
+	s := NewService(1)
+	first, second := &recorder{}, &recorder{}
+	s.AddInput(0, first)
+	s.AddInput(1, second)
+
+	scrambled := func() *mpegts.PMT {
+		pmt := testPMT(1, 0x100, 0x101, 0)
+		pmt.ProgramInfo = mpegts.Descriptors(&mpegts.CADescriptor{CASystemID: 0x0B00, CAPID: 0x600})
+		return pmt
+	}
+	cat := &mpegts.CAT{CurrentNext: true, Descriptors: mpegts.Descriptors(&mpegts.CADescriptor{CASystemID: 0x0B00, CAPID: 0x500})}
+	for input := uint(0); input < 2; input++ {
+		packets, _, err := cat.Encode(0)
+		assert.NoError(t, err)
+		for _, ep := range packets {
+			s.HandlePSI(input, ep)
+		}
+		send(t, s, input, testPAT(0, map[uint16]uint16{1: 0x1000}), scrambled())
+	}
+
+	assert.Equal(t, map[uint16]uint16{0x1000: 0x1000, 0x100: 0x100, 0x101: 0x101, 0x500: 0x500, 0x600: 0x600}, first.last())
+	assert.Equal(t, map[uint16]uint16{0x500: 0x20, 0x1000: 0x21, 0x100: 0x22, 0x101: 0x23, 0x600: 0x24}, second.last())
+
+	_, out, pmts := tables(t, s)
+	assert.Equal(t, []uint16{0x20, 0x500}, out.EMMPIDs())
+	assert.Equal(t, []uint16{0x600}, pmts[1].ECMPIDs())
+	assert.Equal(t, []uint16{0x24}, pmts[2].ECMPIDs())
+}
+
+func TestServicePublish(t *testing.T) {
+	s := NewService(1)
+	send(t, s, 0, testPAT(0, map[uint16]uint16{1: 0x1000}), testPMT(1, 0x100, 0x101, 0))
+	send(t, s, 1, testPAT(0, map[uint16]uint16{1: 0x1000}), testPMT(1, 0x100, 0x101, 0))
+
+	c := carousel.NewCarousel()
+	assert.NoError(t, s.Publish(c))
+	assert.Equal(t, []carousel.Key{
+		{PID: mpegts.PATPID, TableID: mpegts.PATTableID, Extension: 1},
+		{PID: 0x20, TableID: mpegts.PMTTableID, Extension: 2},
+		{PID: 0x1000, TableID: mpegts.PMTTableID, Extension: 1},
+	}, c.Keys())
+
+	s.RemoveInput(1)
+	assert.NoError(t, s.Publish(c))
+	assert.Equal(t, []carousel.Key{
+		{PID: mpegts.PATPID, TableID: mpegts.PATTableID, Extension: 1},
+		{PID: 0x1000, TableID: mpegts.PMTTableID, Extension: 1},
+	}, c.Keys())
+	version, _ := c.Version(carousel.Key{PID: mpegts.PATPID, TableID: mpegts.PATTableID, Extension: 1})
+	assert.Equal(t, s.PAT().Version, version)
+}
+
+func TestReassign(t *testing.T) {
+	assigned := map[uint16]bool{0x20: true, 0x100: true}
+	mapping := reassign(map[uint16]uint16{0x300: 0x300}, []uint16{0x10, 0x100, 0x101}, assigned, firstPID, lastPID)
+
+	// Values out of range, or taken, move to the lowest free numbers; values no longer wanted are released.
+	assert.Equal(t, map[uint16]uint16{0x10: 0x21, 0x100: 0x22, 0x101: 0x101}, mapping)
+	assert.Equal(t, map[uint16]bool{0x20: true, 0x21: true, 0x22: true, 0x100: true, 0x101: true}, assigned)
+
+	full := map[uint16]bool{1: true, 2: true}
+	assert.Empty(t, reassign(nil, []uint16{1}, full, 1, 2))
+}
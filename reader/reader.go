@@ -0,0 +1,319 @@
+// Package reader implements the Reader Service. A reader ingests one input: it frames the received
+// bytes into transport stream packets, measures their PCRs, hands the PSI and SI to the Program ID
+// Service and queues every other packet, with its PID rewritten, on the input's slot of the DWRR queue.
+package reader
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/channels"
+	"github.com/Channel-3-Eugene/tribd/dwrr"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+var (
+	ErrRunning      = errors.New("reader: already running")
+	ErrStopped      = errors.New("reader: stopped")
+	ErrInvalidInput = errors.New("reader: input has no DWRR queue")
+)
+
+// lastSIPID is the last of the PIDs reserved for PSI and DVB SI.
+const lastSIPID = 0x001F
+
+// Source is an input whose received data is read from its packet channel. The handlers of the
+// uriHandler package satisfy it in the reader role.
+type Source interface {
+	Open() error
+	Close() error
+	DataChan() *channels.PacketChan
+}
+
+// PSIHandler receives the PSI and SI packets of the inputs, unmodified: the PAT, the CAT, the PMTs,
+// the DVB SI and the ATSC PSIP. The SI of the multiplex is regenerated rather than passed through, as the
+// SI of several inputs would collide on the same PIDs.
+type PSIHandler interface {
+	HandlePSI(input uint, ep *mpegts.EncodedPacket)
+}
+
+// State is the lifecycle state of a reader.
+type State int
+
+const (
+	Idle    State = iota // Not started.
+	Running              // Reading its source.
+	Stopped              // Stopped, or its source ended.
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case Running:
+		return "running"
+	case Stopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// Monitor observes the bytes of an input as they arrive. A *monitor.Monitor satisfies it.
+type Monitor interface {
+	PushBytes(chunk []byte, at time.Time) mpegts.EncodedPackets
+}
+
+// Stats holds the counters of one input.
+type Stats struct {
+	Input      uint // Slot of the input in the DWRR queue.
+	State      State
+	Started    time.Time
+	Bytes      uint64 // Bytes received.
+	Packets    uint64 // Packets framed from the received bytes.
+	PSIPackets uint64 // PSI and SI packets handed to the PSI handler, or dropped without one.
+	Enqueued   uint64 // Packets queued.
+	Unmapped   uint64 // Packets dropped because their PID was not mapped yet.
+	Remapped   uint64 // Queued packets whose PID was rewritten.
+	Nulls      uint64 // Null packets dropped; the writers regenerate stuffing.
+	Errored    uint64 // Queued packets flagged with the transport_error_indicator.
+	Framer     mpegts.FramerStats
+	PCR        []mpegts.PCRStats // PCR analysis of each program of the input.
+}
+
+// Reader is the Reader Service of one input.
+type Reader struct {
+	input uint
+	src   Source
+	queue *dwrr.DWRR[*mpegts.EncodedPacket]
+	psi   PSIHandler
+
+	// Owned by the reading goroutine.
+	framer   *mpegts.Framer
+	sections *mpegts.SectionAssembler
+	pmtPIDs  map[uint16]bool
+	nitPID   uint16 // NIT PID named by program 0 of the PAT, zero when none.
+	pcr      *mpegts.PCRAnalyzer
+
+	mu      sync.Mutex
+	lut     map[uint16]uint16 // Replaced, never modified, so the reading goroutine may use it unlocked.
+	monitor Monitor
+	stats   Stats
+	done    chan struct{}
+}
+
+// NewReader creates the reader of an input, queueing its packets on the given slot of queue, which must
+// exist. PSI and SI packets go to psi, or are dropped when psi is nil. With a PSI handler, which maps the
+// PIDs of the input, packets whose PID is not mapped yet are dropped so that they cannot collide with
+// those of other inputs; without one, packets keep the PIDs missing from the PID map.
+func NewReader(input uint, src Source, queue *dwrr.DWRR[*mpegts.EncodedPacket], psi PSIHandler) (*Reader, error) {
+	if input >= queue.Len() {
+		return nil, ErrInvalidInput
+	}
+	return &Reader{
+		input:    input,
+		src:      src,
+		queue:    queue,
+		psi:      psi,
+		framer:   mpegts.NewFramer(0),
+		sections: mpegts.NewSectionAssembler(),
+		pmtPIDs:  make(map[uint16]bool),
+		pcr:      mpegts.NewPCRAnalyzer(),
+		lut:      make(map[uint16]uint16),
+		stats:    Stats{Input: input},
+	}, nil
+}
+
+// Input returns the slot of the input in the DWRR queue.
+func (r *Reader) Input() uint {
+	return r.input
+}
+
+// SetPIDMap replaces the PID rewrite table of the input. It may be called while the reader runs, for
+// example by the Program ID Service.
+func (r *Reader) SetPIDMap(lut map[uint16]uint16) {
+	copied := make(map[uint16]uint16, len(lut))
+	for from, to := range lut {
+		copied[from] = to
+	}
+	r.mu.Lock()
+	r.lut = copied
+	r.mu.Unlock()
+}
+
+// PIDMap returns a copy of the PID rewrite table.
+func (r *Reader) PIDMap() map[uint16]uint16 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := make(map[uint16]uint16, len(r.lut))
+	for from, to := range r.lut {
+		copied[from] = to
+	}
+	return copied
+}
+
+// SetMonitor attaches a monitor that measures the input as received, before any PID is rewritten or
+// dropped. A nil monitor detaches it. It may be called while the reader runs.
+func (r *Reader) SetMonitor(m Monitor) {
+	r.mu.Lock()
+	r.monitor = m
+	r.mu.Unlock()
+}
+
+// Start opens the source and starts reading it. A reader runs once: it cannot be started again after it
+// has stopped, as closing a source closes its packet channel.
+func (r *Reader) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.stats.State {
+	case Running:
+		return ErrRunning
+	case Stopped:
+		return ErrStopped
+	}
+
+	if err := r.src.Open(); err != nil {
+		return err
+	}
+	r.stats.State = Running
+	r.stats.Started = time.Now()
+	r.done = make(chan struct{})
+	go r.run(r.src.DataChan(), r.done)
+	return nil
+}
+
+// Stop closes the source and waits for the packets already received to be queued.
+func (r *Reader) Stop() error {
+	r.mu.Lock()
+	if r.stats.State != Running {
+		r.mu.Unlock()
+		return nil
+	}
+	done := r.done
+	r.mu.Unlock()
+
+	err := r.src.Close()
+	<-done
+	return err
+}
+
+// Done returns a channel closed once the reader has stopped, either by Stop or because its source
+// ended. It is nil before Start.
+func (r *Reader) Done() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+// Stats returns the counters of the input.
+func (r *Reader) Stats() Stats {
+	r.mu.Lock()
+	stats := r.stats
+	r.mu.Unlock()
+	stats.PCR = r.pcr.Results()
+	return stats
+}
+
+// run reads the source until its packet channel is closed.
+func (r *Reader) run(dc *channels.PacketChan, done chan struct{}) {
+	defer close(done)
+	for {
+		data := dc.Receive()
+		if data == nil {
+			break
+		}
+		r.process(data, time.Now())
+	}
+
+	r.mu.Lock()
+	r.stats.State = Stopped
+	r.mu.Unlock()
+}
+
+// process frames a chunk of input received at the given time, hands its PSI packets to the PSI handler
+// and queues the others.
+func (r *Reader) process(chunk []byte, arrival time.Time) {
+	r.mu.Lock()
+	lut, monitor := r.lut, r.monitor
+	r.mu.Unlock()
+	if monitor != nil {
+		monitor.PushBytes(chunk, arrival)
+	}
+
+	packets, _ := r.framer.Push(chunk)
+
+	var (
+		psi, queued              mpegts.EncodedPackets
+		remapped, nulls, errored uint64
+		unmapped                 uint64
+	)
+	for _, ep := range packets {
+		r.pcr.Push(ep, arrival)
+		switch {
+		case ep.IsNullPacket():
+			nulls++
+		case r.isPSI(ep):
+			psi = append(psi, ep)
+		default:
+			if ep.GetTEI() {
+				errored++
+			}
+			pid, ok := lut[ep.GetPID()]
+			switch {
+			case !ok && r.psi != nil:
+				unmapped++
+				continue
+			case ok && pid != ep.GetPID():
+				ep.SetPID(pid)
+				remapped++
+			}
+			queued = append(queued, ep)
+		}
+	}
+
+	if r.psi != nil {
+		for _, ep := range psi {
+			r.psi.HandlePSI(r.input, ep)
+		}
+	}
+	if len(queued) > 0 {
+		r.queue.Enqueue(r.input, queued)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.Bytes += uint64(len(chunk))
+	r.stats.Packets += uint64(len(packets))
+	r.stats.Nulls += nulls
+	r.stats.Errored += errored
+	r.stats.Remapped += remapped
+	r.stats.Unmapped += unmapped
+	r.stats.Enqueued += uint64(len(queued))
+	r.stats.PSIPackets += uint64(len(psi))
+	r.stats.Framer = r.framer.Stats()
+}
+
+// isPSI reports whether a packet carries PSI or SI: the PAT, the CAT, a PMT, the NIT, the DVB SI PIDs
+// reserved up to 0x1F or the ATSC PSIP base PID. PMT and NIT PIDs are learned from the PAT.
+func (r *Reader) isPSI(ep *mpegts.EncodedPacket) bool {
+	pid := ep.GetPID()
+	switch {
+	case pid == mpegts.PATPID:
+		sections, _ := r.sections.Push(ep)
+		if pat, err := mpegts.ParsePAT(sections...); err == nil {
+			r.pmtPIDs = make(map[uint16]bool)
+			r.nitPID = 0
+			for program, pid := range pat.Programs {
+				if program == 0 {
+					r.nitPID = pid
+				} else {
+					r.pmtPIDs[pid] = true
+				}
+			}
+		}
+		return true
+	case pid <= lastSIPID, pid == mpegts.PSIPBasePID, r.nitPID != 0 && pid == r.nitPID:
+		return true
+	}
+	return r.pmtPIDs[pid]
+}
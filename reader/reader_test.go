@@ -0,0 +1,177 @@
+package reader
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/channels"
+	"github.com/Channel-3-Eugene/tribd/dwrr"
+	"github.com/Channel-3-Eugene/tribd/monitor"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// chunkSource sends its data in chunks that split packets when opened, and ends the input after the
+// last one unless it is to stay open.
+type chunkSource struct {
+	data     []byte
+	chunk    int
+	stayOpen bool
+	dc       *channels.PacketChan
+}
+
+func newChunkSource(data []byte, chunk int, stayOpen bool) *chunkSource {
+	return &chunkSource{data: data, chunk: chunk, stayOpen: stayOpen, dc: channels.NewPacketChan(len(data)/chunk + 1)}
+}
+
+func (s *chunkSource) Open() error {
+	for i := 0; i < len(s.data); i += s.chunk {
+		s.dc.Send(s.data[i:min(i+s.chunk, len(s.data))])
+	}
+	if !s.stayOpen {
+		s.dc.Close()
+	}
+	return nil
+}
+
+func (s *chunkSource) Close() error {
+	s.dc.Close()
+	return nil
+}
+
+func (s *chunkSource) DataChan() *channels.PacketChan {
+	return s.dc
+}
+
+// psiRecorder records the PIDs of the PSI packets it is handed.
+type psiRecorder struct {
+	mu   sync.Mutex
+	pids map[uint16]int
+}
+
+func (p *psiRecorder) HandlePSI(input uint, ep *mpegts.EncodedPacket) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pids[ep.GetPID()]++
+}
+
+// generate returns the bytes of a generated stream of two programs and the number of its packets on
+// each PID.
+func generate(t *testing.T, n int) ([]byte, map[uint16]int) {
+	gen, err := mpegts.NewStreamGenerator(mpegts.DefaultGeneratorConfig(2))
+	assert.NoError(t, err)
+	counts := make(map[uint16]int)
+	var data []byte
+	for _, ep := range gen.Generate(n) {
+		counts[ep.GetPID()]++
+		data = append(data, ep[:]...)
+	}
+	return data, counts
+}
+
+func TestReader(t *testing.T) {
+	data, counts := generate(t, 5000)
+	queue := dwrr.NewDWRR[*mpegts.EncodedPacket](2, 100)
+	psi := &psiRecorder{pids: make(map[uint16]int)}
+	r, err := NewReader(1, newChunkSource(data, 1000, false), queue, psi)
+	assert.NoError(t, err)
+	r.SetPIDMap(map[uint16]uint16{0x100: 0x200, 0x101: 0x101, 0x110: 0x110})
+
+	assert.NoError(t, r.Start())
+	<-r.Done()
+
+	// The PAT, both PMTs and the SDT went to the PSI handler, the PMTs once the PAT named them.
+	assert.Equal(t, counts[mpegts.PATPID], psi.pids[mpegts.PATPID])
+	assert.Equal(t, counts[0x1000], psi.pids[0x1000])
+	assert.Equal(t, counts[0x1001], psi.pids[0x1001])
+	assert.Equal(t, counts[mpegts.SDTPID], psi.pids[mpegts.SDTPID])
+	assert.NotZero(t, psi.pids[mpegts.SDTPID])
+	assert.Len(t, psi.pids, 4)
+
+	// Everything else was queued on the input's slot, remapped, without the nulls and the PIDs missing
+	// from the map.
+	queued := queue.DequeueAll(1)
+	assert.Empty(t, queue.DequeueAll(0))
+	pids := make(map[uint16]int)
+	for _, ep := range queued {
+		pids[ep.GetPID()]++
+	}
+	assert.Equal(t, counts[0x100], pids[0x200])
+	assert.Zero(t, pids[0x100])
+	assert.Equal(t, counts[0x101], pids[0x101])
+	assert.Equal(t, counts[0x110], pids[0x110])
+	assert.Zero(t, pids[0x1FFF])
+	assert.Zero(t, pids[mpegts.SDTPID])
+	assert.Zero(t, pids[0x111])
+	assert.Len(t, pids, 3)
+
+	stats := r.Stats()
+	assert.Equal(t, uint(1), stats.Input)
+	assert.Equal(t, Stopped, stats.State)
+	assert.Equal(t, uint64(len(data)), stats.Bytes)
+	assert.Equal(t, uint64(5000), stats.Packets)
+	assert.Equal(t, uint64(counts[0x1FFF]), stats.Nulls)
+	assert.Equal(t, uint64(counts[0x100]), stats.Remapped)
+	assert.Equal(t, uint64(len(queued)), stats.Enqueued)
+	assert.NotZero(t, stats.Unmapped)
+	assert.Equal(t, stats.Packets, stats.Enqueued+stats.PSIPackets+stats.Nulls+stats.Unmapped)
+	assert.Len(t, stats.PCR, 2)
+}
+
+func TestReaderLifecycle(t *testing.T) {
+	data, _ := generate(t, 100)
+	queue := dwrr.NewDWRR[*mpegts.EncodedPacket](1, 100)
+	r, err := NewReader(0, newChunkSource(data, 188*7, true), queue, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, r.Done())
+	assert.Equal(t, Idle, r.Stats().State)
+	assert.NoError(t, r.Stop()) // Stopping an idle reader does nothing.
+
+	assert.NoError(t, r.Start())
+	assert.Equal(t, ErrRunning, r.Start())
+	assert.Eventually(t, func() bool { return r.Stats().Packets == 100 }, time.Second, time.Millisecond)
+	assert.Equal(t, Running, r.Stats().State)
+
+	assert.NoError(t, r.Stop())
+	assert.Equal(t, Stopped, r.Stats().State)
+	assert.Equal(t, ErrStopped, r.Start())
+	assert.NotEmpty(t, queue.DequeueAll(0))
+}
+
+func TestReaderPIDMap(t *testing.T) {
+	r, err := NewReader(0, nil, dwrr.NewDWRR[*mpegts.EncodedPacket](1, 100), nil)
+	assert.NoError(t, err)
+	lut := map[uint16]uint16{0x100: 0x200}
+	r.SetPIDMap(lut)
+	lut[0x100] = 0x300 // The reader keeps its own copy.
+	assert.Equal(t, map[uint16]uint16{0x100: 0x200}, r.PIDMap())
+}
+
+func TestNewReaderInput(t *testing.T) {
+	_, err := NewReader(2, nil, dwrr.NewDWRR[*mpegts.EncodedPacket](2, 100), nil)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestReaderMonitor(t *testing.T) {
+	data, counts := generate(t, 1000)
+	queue := dwrr.NewDWRR[*mpegts.EncodedPacket](1, 100)
+	r, err := NewReader(0, newChunkSource(data, 1000, false), queue, nil)
+	assert.NoError(t, err)
+	r.SetPIDMap(map[uint16]uint16{0x100: 0x200})
+	m := monitor.NewMonitor("input", monitor.Options{})
+	r.SetMonitor(m)
+
+	assert.NoError(t, r.Start())
+	<-r.Done()
+
+	// The monitor sees the input as received, before its PIDs are rewritten.
+	report := m.Report()
+	assert.Equal(t, uint64(1000), report.Packets)
+	pids := make(map[uint16]uint64)
+	for _, p := range report.PIDs {
+		pids[p.PID] = p.Packets
+	}
+	assert.Equal(t, uint64(counts[0x100]), pids[0x100])
+	assert.Zero(t, pids[0x200])
+}
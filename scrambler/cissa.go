@@ -0,0 +1,38 @@
+package scrambler
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// DVB-CISSA version 1 (ETSI TS 103 127): AES-128 in cipher block chaining mode with a fixed
+// initialisation vector. A residue shorter than a block is left in the clear.
+
+// cissaIV is the initialisation vector of every payload.
+var cissaIV = []byte("DVBTMCPTAESCISSA")
+
+// cissaCipher scrambles payloads with one 16 byte key.
+type cissaCipher struct {
+	block cipher.Block
+}
+
+// newCISSACipher creates a cipher from a 16 byte key.
+func newCISSACipher(key []byte) (*cissaCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return &cissaCipher{block: block}, nil
+}
+
+// encrypt scrambles the whole blocks of a payload in place.
+func (c *cissaCipher) encrypt(payload []byte) {
+	n := len(payload) / aes.BlockSize * aes.BlockSize
+	cipher.NewCBCEncrypter(c.block, cissaIV).CryptBlocks(payload[:n], payload[:n])
+}
+
+// decrypt descrambles the whole blocks of a payload in place.
+func (c *cissaCipher) decrypt(payload []byte) {
+	n := len(payload) / aes.BlockSize * aes.BlockSize
+	cipher.NewCBCDecrypter(c.block, cissaIV).CryptBlocks(payload[:n], payload[:n])
+}
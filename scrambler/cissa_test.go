@@ -0,0 +1,30 @@
+package scrambler
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCISSA(t *testing.T) {
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	c, err := newCISSACipher(key)
+	assert.NoError(t, err)
+
+	// Two blocks and a three byte residue, which stays clear.
+	payload := make([]byte, 35)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	c.encrypt(payload)
+	assert.Equal(t, "eb9dca063424275590c2dbbe00b726fdfd17ae6b34fed2808ff1478dcb902fc8202122", hex.EncodeToString(payload))
+
+	c.decrypt(payload)
+	for i, b := range payload {
+		assert.Equal(t, byte(i), b)
+	}
+
+	_, err = newCISSACipher(key[:8])
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,302 @@
+package scrambler
+
+// DVB Common Scrambling Algorithm (ETSI ETR 289). The payload is enciphered with a 64-bit block cipher
+// in reverse cipher block chaining and the result is enciphered again with a stream cipher seeded by
+// the first block. A residue shorter than a block is only covered by the stream cipher.
+
+const csaBlockSize = 8
+
+// csaKeyPerm is the bit permutation applied to the control word between key schedule rounds.
+var csaKeyPerm = [64]byte{
+	0x12, 0x24, 0x09, 0x07, 0x2A, 0x31, 0x1D, 0x15, 0x1C, 0x36, 0x3E, 0x32, 0x13, 0x21, 0x3B, 0x40,
+	0x18, 0x14, 0x25, 0x27, 0x02, 0x35, 0x1B, 0x01, 0x22, 0x04, 0x0D, 0x0E, 0x39, 0x28, 0x1A, 0x29,
+	0x33, 0x23, 0x34, 0x0C, 0x16, 0x30, 0x1E, 0x3A, 0x2D, 0x1F, 0x08, 0x19, 0x17, 0x2F, 0x3D, 0x11,
+	0x3C, 0x05, 0x38, 0x2B, 0x0B, 0x06, 0x0A, 0x2C, 0x20, 0x3F, 0x2E, 0x0F, 0x03, 0x26, 0x10, 0x37,
+}
+
+// csaBlockSbox is the substitution of the block cipher.
+var csaBlockSbox = [256]byte{
+	0x3A, 0xEA, 0x68, 0xFE, 0x33, 0xE9, 0x88, 0x1A, 0x83, 0xCF, 0xE1, 0x7F, 0xBA, 0xE2, 0x38, 0x12,
+	0xE8, 0x27, 0x61, 0x95, 0x0C, 0x36, 0xE5, 0x70, 0xA2, 0x06, 0x82, 0x7C, 0x17, 0xA3, 0x26, 0x49,
+	0xBE, 0x7A, 0x6D, 0x47, 0xC1, 0x51, 0x8F, 0xF3, 0xCC, 0x5B, 0x67, 0xBD, 0xCD, 0x18, 0x08, 0xC9,
+	0xFF, 0x69, 0xEF, 0x03, 0x4E, 0x48, 0x4A, 0x84, 0x3F, 0xB4, 0x10, 0x04, 0xDC, 0xF5, 0x5C, 0xC6,
+	0x16, 0xAB, 0xAC, 0x4C, 0xF1, 0x6A, 0x2F, 0x3C, 0x3B, 0xD4, 0xD5, 0x94, 0xD0, 0xC4, 0x63, 0x62,
+	0x71, 0xA1, 0xF9, 0x4F, 0x2E, 0xAA, 0xC5, 0x56, 0xE3, 0x39, 0x93, 0xCE, 0x65, 0x64, 0xE4, 0x58,
+	0x6C, 0x19, 0x42, 0x79, 0xDD, 0xEE, 0x96, 0xF6, 0x8A, 0xEC, 0x1E, 0x85, 0x53, 0x45, 0xDE, 0xBB,
+	0x7E, 0x0A, 0x9A, 0x13, 0x2A, 0x9D, 0xC2, 0x5E, 0x5A, 0x1F, 0x32, 0x35, 0x9C, 0xA8, 0x73, 0x30,
+	0x29, 0x3D, 0xE7, 0x92, 0x87, 0x1B, 0x2B, 0x4B, 0xA5, 0x57, 0x97, 0x40, 0x15, 0xE6, 0xBC, 0x0E,
+	0xEB, 0xC3, 0x34, 0x2D, 0xB8, 0x44, 0x25, 0xA4, 0x1C, 0xC7, 0x23, 0xED, 0x90, 0x6E, 0x50, 0x00,
+	0x99, 0x9E, 0x4D, 0xD9, 0xDA, 0x8D, 0x6F, 0x5F, 0x3E, 0xD7, 0x21, 0x74, 0x86, 0xDF, 0x6B, 0x05,
+	0x8E, 0x5D, 0x37, 0x11, 0xD2, 0x28, 0x75, 0xD6, 0xA7, 0x77, 0x24, 0xBF, 0xF0, 0xB0, 0x02, 0xB7,
+	0xF8, 0xFC, 0x81, 0x09, 0xB1, 0x01, 0x76, 0x91, 0x7D, 0x0F, 0xC8, 0xA0, 0xF2, 0xCB, 0x78, 0x60,
+	0xD1, 0xF7, 0xE0, 0xB5, 0x98, 0x22, 0xB3, 0x20, 0x1D, 0xA6, 0xDB, 0x7B, 0x59, 0x9F, 0xAE, 0x31,
+	0xFB, 0xD3, 0xB6, 0xCA, 0x43, 0x72, 0x07, 0xF4, 0xD8, 0x41, 0x14, 0x55, 0x0D, 0x54, 0x8B, 0xB9,
+	0xAD, 0x46, 0x0B, 0xAF, 0x80, 0x52, 0x2C, 0xFA, 0x8C, 0x89, 0x66, 0xFD, 0xB2, 0xA9, 0x9B, 0xC0,
+}
+
+// csaBlockPerm permutes the bits of the block cipher substitution output.
+var csaBlockPerm = func() [256]byte {
+	// Destination of each source bit, from the least significant.
+	bits := [8]byte{0x02, 0x80, 0x20, 0x10, 0x04, 0x40, 0x01, 0x08}
+	var perm [256]byte
+	for v := range perm {
+		for i, dst := range bits {
+			if v&(1<<i) != 0 {
+				perm[v] |= dst
+			}
+		}
+	}
+	return perm
+}()
+
+// Stream cipher substitutions: five input bits to two output bits.
+var csaSbox = [7][32]byte{
+	{2, 0, 1, 1, 2, 3, 3, 0, 3, 2, 2, 0, 1, 1, 0, 3, 0, 3, 3, 0, 2, 2, 1, 1, 2, 2, 0, 3, 1, 1, 3, 0},
+	{3, 1, 0, 2, 2, 3, 3, 0, 1, 3, 2, 1, 0, 0, 1, 2, 3, 1, 0, 3, 3, 2, 0, 2, 0, 0, 1, 2, 2, 1, 3, 1},
+	{2, 0, 1, 2, 2, 3, 3, 1, 1, 1, 0, 3, 3, 0, 2, 0, 1, 3, 0, 1, 3, 0, 2, 2, 2, 0, 1, 2, 0, 3, 3, 1},
+	{3, 1, 2, 3, 0, 2, 1, 2, 1, 2, 0, 1, 3, 0, 0, 3, 1, 0, 3, 1, 2, 3, 0, 3, 0, 3, 2, 0, 1, 2, 2, 1},
+	{2, 0, 0, 1, 3, 2, 3, 2, 0, 1, 3, 3, 1, 0, 2, 1, 2, 3, 2, 0, 0, 3, 1, 1, 1, 0, 3, 2, 3, 1, 0, 2},
+	{0, 1, 2, 3, 1, 2, 2, 0, 0, 1, 3, 0, 2, 3, 1, 3, 2, 3, 0, 2, 3, 0, 1, 1, 2, 1, 1, 2, 0, 3, 3, 0},
+	{0, 3, 2, 2, 3, 0, 0, 1, 3, 0, 1, 3, 1, 2, 2, 1, 1, 0, 3, 3, 0, 1, 1, 2, 2, 3, 1, 0, 2, 3, 0, 2},
+}
+
+// csaCipher scrambles payloads with one control word.
+type csaCipher struct {
+	cw [8]byte
+	kk [57]byte // Expanded block cipher key, kk[1] to kk[56].
+}
+
+// newCSACipher expands an 8 byte control word.
+func newCSACipher(cw []byte) *csaCipher {
+	c := &csaCipher{}
+	copy(c.cw[:], cw)
+
+	// Seven 64-bit rounds of the key permutation, kb[7] being the control word itself.
+	var kb [8][8]byte
+	kb[7] = c.cw
+	for i := 7; i > 1; i-- {
+		var bits [64]byte
+		for j := 0; j < 64; j++ {
+			bits[csaKeyPerm[j]-1] = kb[i][j/8] >> (7 - j%8) & 1
+		}
+		for j := 0; j < 64; j++ {
+			kb[i-1][j/8] |= bits[j] << (7 - j%8)
+		}
+	}
+	for i := 0; i < 7; i++ {
+		for j := 0; j < 8; j++ {
+			c.kk[1+i*8+j] = kb[1+i][j] ^ byte(i)
+		}
+	}
+	return c
+}
+
+// encryptBlock enciphers one block with the block cipher.
+func (c *csaCipher) encryptBlock(dst, src []byte) {
+	var r [9]byte
+	copy(r[1:], src[:csaBlockSize])
+	for i := 1; i <= 56; i++ {
+		sboxOut := csaBlockSbox[c.kk[i]^r[8]]
+		permOut := csaBlockPerm[sboxOut]
+		next := r[2]
+		r[2] = r[3] ^ r[1]
+		r[3] = r[4] ^ r[1]
+		r[4] = r[5] ^ r[1]
+		r[5] = r[6]
+		r[6] = r[7] ^ permOut
+		r[7] = r[8]
+		r[8] = r[1] ^ sboxOut
+		r[1] = next
+	}
+	copy(dst, r[1:])
+}
+
+// decryptBlock deciphers one block with the block cipher.
+func (c *csaCipher) decryptBlock(dst, src []byte) {
+	var r [9]byte
+	copy(r[1:], src[:csaBlockSize])
+	for i := 56; i > 0; i-- {
+		sboxOut := csaBlockSbox[c.kk[i]^r[7]]
+		permOut := csaBlockPerm[sboxOut]
+		next := r[7]
+		r[7] = r[6] ^ permOut
+		r[6] = r[5]
+		r[5] = r[4] ^ r[8] ^ sboxOut
+		r[4] = r[3] ^ r[8] ^ sboxOut
+		r[3] = r[2] ^ r[8] ^ sboxOut
+		r[2] = r[1]
+		r[1] = r[8] ^ sboxOut
+		r[8] = next
+	}
+	copy(dst, r[1:])
+}
+
+// csaStream is the state of the stream cipher, held in nibbles.
+type csaStream struct {
+	a, b    [11]byte
+	x, y, z byte
+	d, e, f byte
+	p, q, r byte
+}
+
+// init loads the control word and clocks the first block of the payload into the state.
+func (s *csaStream) init(cw *[8]byte, sb []byte) {
+	*s = csaStream{}
+	for i := 0; i < 4; i++ {
+		s.a[1+2*i], s.a[2+2*i] = cw[i]>>4, cw[i]&0x0F
+		s.b[1+2*i], s.b[2+2*i] = cw[4+i]>>4, cw[4+i]&0x0F
+	}
+	s.clock(sb)
+}
+
+// next returns the next 8 bytes of keystream.
+func (s *csaStream) next() [8]byte {
+	return s.clock(nil)
+}
+
+// clock runs the cipher for 8 bytes. During initialisation sb holds the input block and no keystream
+// is produced.
+func (s *csaStream) clock(sb []byte) [8]byte {
+	var out [8]byte
+	init := sb != nil
+	for i := 0; i < 8; i++ {
+		var op, in1, in2 byte
+		if init {
+			in1, in2 = sb[i]>>4, sb[i]&0x0F
+		}
+		for j := 0; j < 4; j++ {
+			a := &s.a
+			s1 := csaSbox[0][bit(a[4], 0)<<4|bit(a[1], 2)<<3|bit(a[6], 1)<<2|bit(a[7], 3)<<1|bit(a[9], 0)]
+			s2 := csaSbox[1][bit(a[2], 1)<<4|bit(a[3], 2)<<3|bit(a[6], 3)<<2|bit(a[7], 0)<<1|bit(a[9], 1)]
+			s3 := csaSbox[2][bit(a[1], 3)<<4|bit(a[2], 0)<<3|bit(a[5], 1)<<2|bit(a[5], 3)<<1|bit(a[6], 2)]
+			s4 := csaSbox[3][bit(a[3], 3)<<4|bit(a[1], 1)<<3|bit(a[2], 3)<<2|bit(a[4], 2)<<1|bit(a[8], 0)]
+			s5 := csaSbox[4][bit(a[5], 2)<<4|bit(a[4], 3)<<3|bit(a[6], 0)<<2|bit(a[8], 1)<<1|bit(a[9], 2)]
+			s6 := csaSbox[5][bit(a[3], 1)<<4|bit(a[4], 1)<<3|bit(a[5], 0)<<2|bit(a[7], 2)<<1|bit(a[9], 3)]
+			s7 := csaSbox[6][bit(a[2], 2)<<4|bit(a[3], 0)<<3|bit(a[7], 1)<<2|bit(a[8], 2)<<1|bit(a[8], 3)]
+
+			b := &s.b
+			extraB := ((b[3]&1)<<3 ^ (b[6]&2)<<2 ^ (b[7]&4)<<1 ^ b[9]&8) |
+				((b[6]&1)<<2 ^ (b[8]&2)<<1 ^ (b[3]&8)>>1 ^ b[4]&4) |
+				((b[5]&8)>>2 ^ (b[8]&4)>>1 ^ (b[4]&1)<<1 ^ b[5]&2) |
+				((b[9]&4)>>2 ^ (b[6]&8)>>3 ^ (b[3]&2)>>1 ^ b[8]&1)
+
+			nextA1 := s.a[10] ^ s.x
+			nextB1 := s.b[7] ^ s.b[10] ^ s.y
+			if init {
+				if j%2 == 0 {
+					nextA1 ^= s.d ^ in1
+					nextB1 ^= in2
+				} else {
+					nextA1 ^= s.d ^ in2
+					nextB1 ^= in1
+				}
+			}
+			if s.p != 0 {
+				nextB1 = (nextB1<<1 | nextB1>>3&1) & 0x0F
+			}
+
+			s.d = s.e ^ s.z ^ extraB
+			nextE := s.f
+			if s.q != 0 {
+				s.f = s.z + s.e + s.r
+				s.r = s.f >> 4 & 1
+				s.f &= 0x0F
+			} else {
+				s.f = s.e
+			}
+			s.e = nextE
+
+			copy(s.a[2:], s.a[1:10])
+			copy(s.b[2:], s.b[1:10])
+			s.a[1], s.b[1] = nextA1, nextB1
+
+			s.x = (s4&1)<<3 | (s3&1)<<2 | s2&2 | (s1&2)>>1
+			s.y = (s6&1)<<3 | (s5&1)<<2 | s4&2 | (s3&2)>>1
+			s.z = (s2&1)<<3 | (s1&1)<<2 | s7&2 | (s5&2)>>1
+			s.p = (s7 & 2) >> 1
+			s.q = s7 & 1
+
+			op = op<<2 ^ ((s.d^s.d>>1)>>1&2 | (s.d^s.d>>1)&1)
+		}
+		out[i] = op
+	}
+	return out
+}
+
+// bit returns bit n of a nibble.
+func bit(v byte, n uint) byte {
+	return v >> n & 1
+}
+
+// encrypt scrambles a payload in place.
+func (c *csaCipher) encrypt(payload []byte) {
+	n := len(payload) / csaBlockSize
+	if n == 0 {
+		return // Payloads shorter than a block stay in the clear.
+	}
+	residue := payload[n*csaBlockSize:]
+
+	// Reverse cipher block chaining, from the last block to the first.
+	ib := make([]byte, (n+1)*csaBlockSize) // ib[k] is block k-1; the extra block is zero.
+	block := make([]byte, csaBlockSize)
+	for i := n - 1; i >= 0; i-- {
+		for j := 0; j < csaBlockSize; j++ {
+			block[j] = payload[i*csaBlockSize+j] ^ ib[(i+1)*csaBlockSize+j]
+		}
+		c.encryptBlock(ib[i*csaBlockSize:], block)
+	}
+
+	var s csaStream
+	s.init(&c.cw, ib[:csaBlockSize])
+	copy(payload, ib[:csaBlockSize])
+	for i := 1; i < n; i++ {
+		stream := s.next()
+		for j := 0; j < csaBlockSize; j++ {
+			payload[i*csaBlockSize+j] = ib[i*csaBlockSize+j] ^ stream[j]
+		}
+	}
+	if len(residue) > 0 {
+		stream := s.next()
+		for j := range residue {
+			residue[j] ^= stream[j]
+		}
+	}
+}
+
+// decrypt descrambles a payload in place.
+func (c *csaCipher) decrypt(payload []byte) {
+	n := len(payload) / csaBlockSize
+	if n == 0 {
+		return
+	}
+	residue := payload[n*csaBlockSize:]
+
+	var s csaStream
+	ib := make([]byte, csaBlockSize)
+	copy(ib, payload[:csaBlockSize])
+	s.init(&c.cw, ib)
+
+	block := make([]byte, csaBlockSize)
+	for i := 0; i < n; i++ {
+		c.decryptBlock(block, ib)
+		if i < n-1 {
+			stream := s.next()
+			for j := 0; j < csaBlockSize; j++ {
+				ib[j] = payload[(i+1)*csaBlockSize+j] ^ stream[j]
+			}
+		} else {
+			for j := range ib {
+				ib[j] = 0
+			}
+		}
+		for j := 0; j < csaBlockSize; j++ {
+			payload[i*csaBlockSize+j] = ib[j] ^ block[j]
+		}
+	}
+	if len(residue) > 0 {
+		stream := s.next()
+		for j := range residue {
+			residue[j] ^= stream[j]
+		}
+	}
+}
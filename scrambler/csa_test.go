@@ -0,0 +1,77 @@
+package scrambler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSATables(t *testing.T) {
+	seen := make(map[byte]bool)
+	for _, v := range csaBlockSbox {
+		seen[v] = true
+	}
+	assert.Len(t, seen, 256, "block cipher S-box is a permutation")
+
+	seen = make(map[byte]bool)
+	for _, v := range csaBlockPerm {
+		seen[v] = true
+	}
+	assert.Len(t, seen, 256, "block cipher bit permutation is a permutation")
+
+	for i, sbox := range csaSbox {
+		var counts [4]int
+		for _, v := range sbox {
+			counts[v&3]++
+		}
+		assert.Equal(t, [4]int{8, 8, 8, 8}, counts, "stream cipher S-box %d is balanced", i+1)
+	}
+}
+
+func TestCSABlock(t *testing.T) {
+	c := newCSACipher([]byte{0x11, 0x22, 0x33, 0x66, 0x44, 0x55, 0x66, 0xFF})
+	src := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	enc := make([]byte, 8)
+	dec := make([]byte, 8)
+	c.encryptBlock(enc, src)
+	assert.NotEqual(t, src, enc)
+	c.decryptBlock(dec, enc)
+	assert.Equal(t, src, dec)
+}
+
+func TestCSAPayload(t *testing.T) {
+	cw := []byte{0x11, 0x22, 0x33, 0x66, 0x44, 0x55, 0x66, 0xFF}
+	c := newCSACipher(cw)
+
+	// Regression vector: two whole blocks and a four byte residue.
+	payload := make([]byte, 20)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	c.encrypt(payload)
+	assert.Equal(t, "b748604ea69bd479a9ba45b8ca87ca44ae837633", hex.EncodeToString(payload))
+
+	for _, n := range []int{1, 7, 8, 9, 16, 100, 183, 184} {
+		clear := make([]byte, n)
+		for i := range clear {
+			clear[i] = byte(i * 7)
+		}
+		payload := append([]byte(nil), clear...)
+		c.encrypt(payload)
+		if n >= csaBlockSize {
+			assert.False(t, bytes.Equal(clear, payload), "payload of %d bytes is scrambled", n)
+		} else {
+			assert.Equal(t, clear, payload, "payload of %d bytes stays clear", n)
+		}
+		c.decrypt(payload)
+		assert.Equal(t, clear, payload, "payload of %d bytes round trips", n)
+	}
+
+	// A different control word does not descramble.
+	payload = make([]byte, 64)
+	c.encrypt(payload)
+	newCSACipher([]byte{1, 2, 3, 6, 4, 5, 6, 15}).decrypt(payload)
+	assert.NotEqual(t, make([]byte, 64), payload)
+}
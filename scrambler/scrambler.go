@@ -0,0 +1,308 @@
+// Package scrambler scrambles and descrambles transport stream payloads with fixed keys, for
+// contribution links: DVB-CSA with BISS-1 and BISS-E session words, and DVB-CISSA (AES-128-CBC).
+// Keys are held per program, each with an even and an odd key selected by the
+// transport_scrambling_control bits of the packets.
+package scrambler
+
+import (
+	"crypto/des"
+	"errors"
+	"sync"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+var (
+	ErrInvalidKey       = errors.New("scrambler: invalid key")
+	ErrKeyNotSet        = errors.New("scrambler: key not set")
+	ErrProgramNotFound  = errors.New("scrambler: program not found")
+	ErrReservedTSC      = errors.New("scrambler: reserved transport_scrambling_control value")
+	ErrInvalidAlgorithm = errors.New("scrambler: invalid algorithm")
+)
+
+// Algorithm is a payload scrambling algorithm.
+type Algorithm int
+
+const (
+	CSA   Algorithm = iota // DVB Common Scrambling Algorithm, 8 byte control words.
+	CISSA                  // DVB-CISSA version 1, 16 byte AES keys.
+)
+
+// String returns the name of the algorithm.
+func (a Algorithm) String() string {
+	switch a {
+	case CSA:
+		return "DVB-CSA"
+	case CISSA:
+		return "DVB-CISSA"
+	}
+	return "unknown"
+}
+
+// KeyLength returns the key length of the algorithm in bytes.
+func (a Algorithm) KeyLength() int {
+	switch a {
+	case CSA:
+		return 8
+	case CISSA:
+		return 16
+	}
+	return 0
+}
+
+// Parity selects the even or odd key. Its values are those of the transport_scrambling_control field.
+type Parity uint8
+
+const (
+	Even Parity = 0x02
+	Odd  Parity = 0x03
+)
+
+// String returns "even" or "odd".
+func (p Parity) String() string {
+	switch p {
+	case Even:
+		return "even"
+	case Odd:
+		return "odd"
+	}
+	return "unknown"
+}
+
+// BISS1Key expands a 6 byte BISS-1 session word into the 8 byte DVB-CSA control word by inserting
+// the checksum bytes after each group of three.
+func BISS1Key(sw []byte) ([]byte, error) {
+	if len(sw) != 6 {
+		return nil, ErrInvalidKey
+	}
+	return []byte{sw[0], sw[1], sw[2], sw[0] + sw[1] + sw[2], sw[3], sw[4], sw[5], sw[3] + sw[4] + sw[5]}, nil
+}
+
+// BISSEKey recovers the DVB-CSA control word of BISS-E from the 8 byte encrypted session word and the
+// 7 byte (14 hex digit) injected ID, by DES decryption under the ID.
+func BISSEKey(esw, id []byte) ([]byte, error) {
+	if len(esw) != 8 || len(id) != 7 {
+		return nil, ErrInvalidKey
+	}
+	block, err := des.NewCipher(desKey(id))
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	cw := make([]byte, 8)
+	block.Decrypt(cw, esw)
+	return cw, nil
+}
+
+// desKey spreads a 56-bit key over 8 bytes, seven bits each followed by an odd parity bit.
+func desKey(id []byte) []byte {
+	var v uint64
+	for _, b := range id {
+		v = v<<8 | uint64(b)
+	}
+	key := make([]byte, 8)
+	for i := range key {
+		k := byte(v>>(49-7*i)) << 1
+		parity := byte(1)
+		for b := k; b != 0; b >>= 1 {
+			parity ^= b & 1
+		}
+		key[i] = k | parity
+	}
+	return key
+}
+
+// payloadCipher scrambles payloads in place with one key.
+type payloadCipher interface {
+	encrypt(payload []byte)
+	decrypt(payload []byte)
+}
+
+// programKeys holds the keys of one program.
+type programKeys struct {
+	algorithm Algorithm
+	keys      map[Parity]payloadCipher
+	parity    Parity // Key used to scramble.
+}
+
+// Scrambler scrambles and descrambles the packets of the programs it is given keys for. Packets of
+// other PIDs pass unchanged. It is safe for concurrent use.
+type Scrambler struct {
+	mu       sync.RWMutex
+	programs map[uint16]*programKeys
+	pids     map[uint16]uint16 // PID -> program_number.
+}
+
+// NewScrambler creates a scrambler without programs.
+func NewScrambler() *Scrambler {
+	return &Scrambler{
+		programs: make(map[uint16]*programKeys),
+		pids:     make(map[uint16]uint16),
+	}
+}
+
+// AddProgram scrambles the given PIDs as one program with the algorithm. Scrambling starts with the
+// even key. Adding a program again replaces its keys.
+func (s *Scrambler) AddProgram(program uint16, algorithm Algorithm, pids ...uint16) error {
+	if algorithm.KeyLength() == 0 {
+		return ErrInvalidAlgorithm
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.programs[program] = &programKeys{algorithm: algorithm, keys: make(map[Parity]payloadCipher), parity: Even}
+	for _, pid := range pids {
+		s.pids[pid] = program
+	}
+	return nil
+}
+
+// AddPMT scrambles the elementary streams of the program described by the PMT. PSI, and ECM PIDs
+// named by CA descriptors, stay in the clear.
+func (s *Scrambler) AddPMT(pmt *mpegts.PMT, algorithm Algorithm) error {
+	pids := make([]uint16, 0, len(pmt.Streams))
+	for _, es := range pmt.Streams {
+		pids = append(pids, es.ElementaryPID)
+	}
+	return s.AddProgram(pmt.ProgramNumber, algorithm, pids...)
+}
+
+// SetKey sets the even or odd key of a program. CSA keys are 8 byte control words, such as those
+// returned by BISS1Key and BISSEKey; CISSA keys are 16 bytes.
+func (s *Scrambler) SetKey(program uint16, parity Parity, key []byte) error {
+	if parity != Even && parity != Odd {
+		return ErrReservedTSC
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.programs[program]
+	if !ok {
+		return ErrProgramNotFound
+	}
+	if len(key) != p.algorithm.KeyLength() {
+		return ErrInvalidKey
+	}
+
+	var c payloadCipher
+	switch p.algorithm {
+	case CSA:
+		c = newCSACipher(key)
+	case CISSA:
+		cissa, err := newCISSACipher(key)
+		if err != nil {
+			return err
+		}
+		c = cissa
+	}
+	p.keys[parity] = c
+	return nil
+}
+
+// SetParity selects the key a program is scrambled with from the next packet on. Descrambling
+// always follows the parity signalled by each packet.
+func (s *Scrambler) SetParity(program uint16, parity Parity) error {
+	if parity != Even && parity != Odd {
+		return ErrReservedTSC
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.programs[program]
+	if !ok {
+		return ErrProgramNotFound
+	}
+	p.parity = parity
+	return nil
+}
+
+// Parity returns the key a program is currently scrambled with.
+func (s *Scrambler) Parity(program uint16) (Parity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.programs[program]
+	if !ok {
+		return 0, ErrProgramNotFound
+	}
+	return p.parity, nil
+}
+
+// Scramble scrambles the payload of a clear packet of a known program in place and signals the key
+// parity in its transport_scrambling_control bits. Packets of other PIDs, packets already scrambled
+// and payloads shorter than one cipher block are left unchanged.
+func (s *Scrambler) Scramble(ep *mpegts.EncodedPacket) error {
+	if ep.GetTSC() != 0 {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := s.program(ep.GetPID())
+	if p == nil {
+		return nil
+	}
+	c, ok := p.keys[p.parity]
+	if !ok {
+		return ErrKeyNotSet
+	}
+
+	payload := payload(ep)
+	if len(payload) < blockSize(p.algorithm) {
+		return nil
+	}
+	c.encrypt(payload)
+	ep.SetTSC(uint8(p.parity))
+	return nil
+}
+
+// Descramble descrambles the payload of a scrambled packet of a known program in place with the key
+// its transport_scrambling_control bits select, and clears the bits. Clear packets and packets of
+// other PIDs are left unchanged.
+func (s *Scrambler) Descramble(ep *mpegts.EncodedPacket) error {
+	tsc := Parity(ep.GetTSC())
+	if tsc == 0 {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p := s.program(ep.GetPID())
+	if p == nil {
+		return nil
+	}
+	if tsc != Even && tsc != Odd {
+		return ErrReservedTSC
+	}
+	c, ok := p.keys[tsc]
+	if !ok {
+		return ErrKeyNotSet
+	}
+
+	c.decrypt(payload(ep))
+	ep.SetTSC(0)
+	return nil
+}
+
+// program returns the keys of the program a PID belongs to, or nil.
+func (s *Scrambler) program(pid uint16) *programKeys {
+	program, ok := s.pids[pid]
+	if !ok {
+		return nil
+	}
+	return s.programs[program]
+}
+
+// payload returns the payload bytes of a packet, following any adaptation field.
+func payload(ep *mpegts.EncodedPacket) []byte {
+	switch ep.GetAFC() {
+	case 0x01:
+		return ep[4:]
+	case 0x03:
+		if start := 5 + int(ep[4]); start < len(ep) {
+			return ep[start:]
+		}
+	}
+	return nil
+}
+
+// blockSize returns the cipher block size of the algorithm.
+func blockSize(a Algorithm) int {
+	if a == CISSA {
+		return 16
+	}
+	return csaBlockSize
+}
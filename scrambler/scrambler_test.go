@@ -0,0 +1,135 @@
+package scrambler
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPacket returns a packet on pid with a payload of counting bytes, after an adaptation field of
+// afLength bytes when afLength is not negative.
+func testPacket(pid uint16, afLength int) *mpegts.EncodedPacket {
+	ep := &mpegts.EncodedPacket{0x47, byte(pid >> 8), byte(pid), 0x10}
+	start := 4
+	if afLength >= 0 {
+		ep[3] = 0x30
+		ep[4] = byte(afLength)
+		for i := 0; i < afLength; i++ {
+			ep[5+i] = 0xFF
+		}
+		if afLength > 0 {
+			ep[5] = 0x00
+		}
+		start = 5 + afLength
+	}
+	for i := start; i < len(ep); i++ {
+		ep[i] = byte(i)
+	}
+	return ep
+}
+
+func TestBISSKeys(t *testing.T) {
+	cw, err := BISS1Key([]byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x11, 0x22, 0x33, 0x66, 0x44, 0x55, 0x66, 0xFF}, cw)
+
+	_, err = BISS1Key([]byte{1, 2, 3})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	// Single DES under the injected ID 12 34 56 78 9A BC DE, with parity bits 13 1A 15 CE 89 D5 F2 BC.
+	esw, _ := hex.DecodeString("1122334455667788")
+	id, _ := hex.DecodeString("123456789abcde")
+	cw, err = BISSEKey(esw, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "7b7eba596122ed4f", hex.EncodeToString(cw))
+
+	_, err = BISSEKey(esw, esw)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestScrambler(t *testing.T) {
+	for _, algorithm := range []Algorithm{CSA, CISSA} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			even := make([]byte, algorithm.KeyLength())
+			odd := make([]byte, algorithm.KeyLength())
+			for i := range even {
+				even[i] = byte(i)
+				odd[i] = byte(0x80 + i)
+			}
+
+			s := NewScrambler()
+			assert.NoError(t, s.AddProgram(1, algorithm, 0x100, 0x101))
+			assert.ErrorIs(t, s.Scramble(testPacket(0x100, -1)), ErrKeyNotSet)
+			assert.NoError(t, s.SetKey(1, Even, even))
+			assert.NoError(t, s.SetKey(1, Odd, odd))
+
+			for _, afLength := range []int{-1, 0, 7, 150} {
+				clear := testPacket(0x100, afLength)
+				ep := *clear
+
+				assert.NoError(t, s.Scramble(&ep))
+				assert.Equal(t, uint8(Even), ep.GetTSC())
+				assert.Equal(t, clear[:3], ep[:3], "header stays clear")
+				assert.Equal(t, clear[4:4+max(afLength+1, 0)], ep[4:4+max(afLength+1, 0)], "adaptation field stays clear")
+				assert.NotEqual(t, *clear, ep)
+
+				assert.NoError(t, s.Scramble(&ep), "scrambled packets are left alone")
+				assert.Equal(t, uint8(Even), ep.GetTSC())
+
+				assert.NoError(t, s.Descramble(&ep))
+				assert.Equal(t, *clear, ep)
+			}
+
+			// Switch to the odd key: the TSC follows and descrambling picks the key from it.
+			assert.NoError(t, s.SetParity(1, Odd))
+			parity, err := s.Parity(1)
+			assert.NoError(t, err)
+			assert.Equal(t, Odd, parity)
+			clear := testPacket(0x101, -1)
+			ep := *clear
+			assert.NoError(t, s.Scramble(&ep))
+			assert.Equal(t, uint8(Odd), ep.GetTSC())
+			assert.NoError(t, s.Descramble(&ep))
+			assert.Equal(t, *clear, ep)
+
+			// Payloads shorter than a block are sent clear.
+			short := testPacket(0x100, 180)
+			ep = *short
+			assert.NoError(t, s.Scramble(&ep))
+			assert.Equal(t, *short, ep)
+
+			// Other PIDs pass unchanged.
+			other := testPacket(0x200, -1)
+			ep = *other
+			assert.NoError(t, s.Scramble(&ep))
+			assert.Equal(t, *other, ep)
+
+			ep = *testPacket(0x100, -1)
+			ep.SetTSC(1)
+			assert.ErrorIs(t, s.Descramble(&ep), ErrReservedTSC)
+		})
+	}
+}
+
+func TestScramblerErrors(t *testing.T) {
+	s := NewScrambler()
+	assert.ErrorIs(t, s.AddProgram(1, Algorithm(9), 0x100), ErrInvalidAlgorithm)
+	assert.ErrorIs(t, s.SetKey(1, Even, make([]byte, 8)), ErrProgramNotFound)
+	assert.ErrorIs(t, s.SetParity(1, Odd), ErrProgramNotFound)
+
+	pmt := &mpegts.PMT{ProgramNumber: 7, Streams: []mpegts.ElementaryStream{
+		{StreamType: mpegts.StreamTypeH264, ElementaryPID: 0x100},
+		{StreamType: mpegts.StreamTypeADTSAAC, ElementaryPID: 0x101},
+	}}
+	assert.NoError(t, s.AddPMT(pmt, CSA))
+	assert.ErrorIs(t, s.SetKey(7, Even, make([]byte, 16)), ErrInvalidKey)
+	assert.ErrorIs(t, s.SetKey(7, Parity(1), make([]byte, 8)), ErrReservedTSC)
+	assert.ErrorIs(t, s.SetParity(7, Parity(0)), ErrReservedTSC)
+	assert.NoError(t, s.SetKey(7, Even, make([]byte, 8)))
+
+	ep := testPacket(0x101, -1)
+	assert.NoError(t, s.Scramble(ep))
+	assert.Equal(t, uint8(Even), ep.GetTSC())
+}
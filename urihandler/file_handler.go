@@ -2,6 +2,7 @@
 package uriHandler
 
 import (
+	"errors"
 	"io"
 	"os"
 	"sync"
@@ -9,8 +10,12 @@ import (
 	"time"
 
 	"github.com/Channel-3-Eugene/tribd/channels" // Correct import path
+	"github.com/Channel-3-Eugene/tribd/mpegts"
 )
 
+// ErrNotSeekable is returned when seeking a FIFO or a handler in the writer role.
+var ErrNotSeekable = errors.New("uriHandler: file is not seekable")
+
 // FileStatus represents the current status of a FileHandler, including operational configuration and state.
 type FileStatus struct {
 	FilePath     string
@@ -41,7 +46,10 @@ type FileHandler struct {
 	isFIFO       bool
 	readTimeout  time.Duration
 	writeTimeout time.Duration
-	isOpen       bool         // Tracks the open or closed state of the file.
+	isOpen       bool // Tracks the open or closed state of the file.
+	index        *mpegts.Index
+	startOffset  int64        // Offset reading starts from when the file is opened.
+	readToEnd    bool         // Deliver the file once and close the data channel at its end.
 	mu           sync.RWMutex // Use RWMutex to allow concurrent reads
 }
 
@@ -74,6 +82,16 @@ func (h *FileHandler) Status() FileStatus {
 	}
 }
 
+// SetReadToEnd makes a reader deliver the file once, as a recording is analysed: it waits while its data
+// channel is full rather than drop data, and closes the channel at the end of the file, or once the
+// writer of a FIFO or pipe has gone. By default a reader keeps waiting for data appended to the file.
+// It must be called before Open.
+func (h *FileHandler) SetReadToEnd(readToEnd bool) {
+	h.mu.Lock()
+	h.readToEnd = readToEnd
+	h.mu.Unlock()
+}
+
 // Open initializes the file handler by opening or creating the file and starting the appropriate data processing goroutines.
 func (h *FileHandler) Open() error {
 	var err error
@@ -114,9 +132,15 @@ func (h *FileHandler) Open() error {
 
 // Close terminates the file handler's operations and closes the file.
 func (h *FileHandler) Close() error {
-	if h.file != nil {
+	h.mu.RLock()
+	file := h.file
+	h.mu.RUnlock()
+	if file != nil {
+		err := file.Close() // Ends a read waiting for data, which holds the read lock.
+		if errors.Is(err, os.ErrClosed) {
+			err = nil // A reader that read to the end has closed the file already.
+		}
 		h.mu.Lock()
-		err := h.file.Close()
 		h.isOpen = false // Update the state to closed.
 		h.mu.Unlock()
 		if h.isFIFO {
@@ -147,6 +171,24 @@ func (h *FileHandler) readData() {
 	}
 	defer h.file.Close()
 
+	// A FIFO cannot seek, and a regular file only needs to when SeekTime or SeekKeyframe chose where to start.
+	h.mu.Lock()
+	if !h.isFIFO && h.startOffset != 0 {
+		_, err = h.file.Seek(h.startOffset, io.SeekStart)
+	}
+	h.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	h.mu.RLock()
+	readToEnd := h.readToEnd
+	h.mu.RUnlock()
+	if readToEnd {
+		h.readOnce()
+		return
+	}
+
 	for {
 		buffer := bufferPool.Get().([]byte)
 		if h.readTimeout > 0 {
@@ -155,7 +197,7 @@ func (h *FileHandler) readData() {
 				bufferPool.Put(buffer)
 				return // Exit the goroutine after a timeout.
 			default:
-				n, err := h.file.Read(buffer)
+				n, err := h.read(buffer)
 				if err != nil {
 					if err == io.EOF || err == syscall.EINTR {
 						bufferPool.Put(buffer)
@@ -168,7 +210,7 @@ func (h *FileHandler) readData() {
 				bufferPool.Put(buffer)
 			}
 		} else {
-			n, err := h.file.Read(buffer)
+			n, err := h.read(buffer)
 			if err != nil {
 				if err == io.EOF || err == syscall.EINTR {
 					bufferPool.Put(buffer)
@@ -183,6 +225,154 @@ func (h *FileHandler) readData() {
 	}
 }
 
+// readOnce delivers the file up to its end, waiting for room in the data channel, then closes the channel.
+func (h *FileHandler) readOnce() {
+	defer h.dataChan.Close()
+	buffer := bufferPool.Get().([]byte)
+	defer bufferPool.Put(buffer)
+	for {
+		n, err := h.read(buffer)
+		if n > 0 {
+			for h.dataChan.Send(buffer[:n]) != nil {
+				if !h.Status().IsOpen {
+					return // Closed while the channel was full.
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// read reads from the file, holding the lock so that it does not race with a seek. A FIFO never seeks, and
+// is read without the lock so that Close is not held up by a read waiting for its writer.
+func (h *FileHandler) read(buffer []byte) (int, error) {
+	if h.isFIFO {
+		return h.file.Read(buffer)
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.file.Read(buffer)
+}
+
+// LoadIndex returns the keyframe index of the recording. It reads the sidecar index next to the file, or
+// builds it from the file and writes the sidecar when there is none or when the recording changed since
+// it was built.
+func (h *FileHandler) LoadIndex() (*mpegts.Index, error) {
+	h.mu.RLock()
+	cached, isFIFO, filePath := h.index, h.isFIFO, h.filePath
+	h.mu.RUnlock()
+	if isFIFO {
+		return nil, ErrNotSeekable
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.Matches(info.Size(), info.ModTime()) {
+		return cached, nil
+	}
+
+	// The file is read without holding the lock, so that reading and seeking go on while it is indexed.
+	index, err := loadIndex(filePath, info)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	h.index = index
+	h.mu.Unlock()
+	return index, nil
+}
+
+// loadIndex reads the sidecar index of a recording when it matches the recording, or builds the index
+// and writes the sidecar.
+func loadIndex(filePath string, info os.FileInfo) (*mpegts.Index, error) {
+	indexPath := mpegts.IndexPath(filePath)
+	if f, err := os.Open(indexPath); err == nil {
+		index, err := mpegts.ReadIndex(f)
+		f.Close()
+		if err == nil && index.Matches(info.Size(), info.ModTime()) {
+			return index, nil
+		}
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	index, err := mpegts.BuildIndex(f)
+	if err != nil {
+		return nil, err
+	}
+	index.Size, index.ModTime = info.Size(), info.ModTime()
+
+	// The sidecar is a cache; failing to write it does not prevent seeking.
+	if out, err := os.Create(indexPath); err == nil {
+		_, err = index.WriteTo(out)
+		out.Close()
+		if err != nil {
+			os.Remove(indexPath)
+		}
+	}
+	return index, nil
+}
+
+// SeekTime positions a reader at the last keyframe at or before stream time t and returns that keyframe.
+// It can be called before Open to choose where reading starts. When the handler is already reading, data
+// queued before the seek is still delivered.
+func (h *FileHandler) SeekTime(t time.Duration) (mpegts.IndexEntry, error) {
+	index, err := h.seekableIndex()
+	if err != nil {
+		return mpegts.IndexEntry{}, err
+	}
+	entry, err := index.KeyframeAt(t)
+	if err != nil {
+		return mpegts.IndexEntry{}, err
+	}
+	return entry, h.seek(entry.Offset)
+}
+
+// SeekKeyframe positions a reader at the n-th keyframe of the recording and returns that keyframe.
+// It behaves like SeekTime otherwise.
+func (h *FileHandler) SeekKeyframe(n int) (mpegts.IndexEntry, error) {
+	index, err := h.seekableIndex()
+	if err != nil {
+		return mpegts.IndexEntry{}, err
+	}
+	entry, err := index.Keyframe(n)
+	if err != nil {
+		return mpegts.IndexEntry{}, err
+	}
+	return entry, h.seek(entry.Offset)
+}
+
+// seekableIndex returns the index of a handler that supports seeking.
+func (h *FileHandler) seekableIndex() (*mpegts.Index, error) {
+	if h.role != Reader || h.isFIFO {
+		return nil, ErrNotSeekable
+	}
+	return h.LoadIndex()
+}
+
+// seek moves the read position of an open file, or sets where reading starts once opened.
+func (h *FileHandler) seek(offset int64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.startOffset = offset
+	if h.file == nil || !h.isOpen {
+		return nil
+	}
+	_, err := h.file.Seek(offset, io.SeekStart)
+	return err
+}
+
 // writeData handles the data writing operations to the file based on configured timeouts.
 func (h *FileHandler) writeData() {
 	var err error
@@ -218,3 +408,8 @@ func (h *FileHandler) writeData() {
 		}
 	}
 }
+
+// DataChan returns the channel carrying the data the handler reads, or the data it is to write.
+func (h *FileHandler) DataChan() *channels.PacketChan {
+	return h.dataChan
+}
@@ -8,6 +8,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Channel-3-Eugene/tribd/channels"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -90,6 +92,35 @@ func TestFileHandlerFIFO(t *testing.T) {
 	writer.Close()
 }
 
+// TestFileHandlerFIFODataFlow tests that a reader receives the data written to its FIFO, and cannot seek.
+func TestFileHandlerFIFODataFlow(t *testing.T) {
+	filePath := randFileName()
+	reader := NewFileHandler(filePath, Reader, true, 0, 0)
+	assert.Nil(t, reader.Open())
+
+	_, err := reader.SeekTime(0)
+	assert.ErrorIs(t, err, ErrNotSeekable)
+	_, err = reader.SeekKeyframe(0)
+	assert.ErrorIs(t, err, ErrNotSeekable)
+
+	writer, err := os.OpenFile(filePath, os.O_WRONLY, 0666)
+	assert.Nil(t, err)
+	_, err = writer.Write([]byte("hello"))
+	assert.Nil(t, err)
+
+	received := make(chan []byte, 1)
+	go func() { received <- reader.dataChan.Receive() }()
+	select {
+	case <-time.After(time.Second):
+		assert.Fail(t, "Timeout waiting for data")
+	case data := <-received:
+		assert.Equal(t, []byte("hello"), data)
+	}
+
+	writer.Close()
+	assert.Nil(t, reader.Close())
+}
+
 // TestFileHandlerDataFlow tests the complete cycle of writing to and reading from the file.
 func TestFileHandlerDataFlow(t *testing.T) {
 	start := time.Now()
@@ -130,6 +161,109 @@ func TestFileHandlerDataFlow(t *testing.T) {
 	os.Remove(filePath)
 }
 
+// TestFileHandlerReadToEnd tests that a reader set to read to the end delivers the whole file, however
+// small its data channel, and then closes the channel.
+func TestFileHandlerReadToEnd(t *testing.T) {
+	filePath := randFileName()
+	data := testRecording(t)
+	assert.Nil(t, os.WriteFile(filePath, data, 0666))
+	defer os.Remove(filePath)
+
+	reader := NewFileHandler(filePath, Reader, false, 0, 0)
+	reader.dataChan = channels.NewPacketChan(1)
+	reader.SetReadToEnd(true)
+	assert.Nil(t, reader.Open())
+
+	var received []byte
+	for chunk := reader.dataChan.Receive(); chunk != nil; chunk = reader.dataChan.Receive() {
+		received = append(received, chunk...)
+	}
+	assert.Equal(t, data, received)
+	assert.Nil(t, reader.Close())
+}
+
+// TestFileHandlerSeek tests that a reader starts from the keyframe chosen by SeekTime and SeekKeyframe.
+func TestFileHandlerSeek(t *testing.T) {
+	filePath := randFileName()
+	data := testRecording(t)
+	assert.Nil(t, os.WriteFile(filePath, data, 0666))
+	defer os.Remove(filePath)
+	defer os.Remove(mpegts.IndexPath(filePath))
+
+	reader := NewFileHandler(filePath, Reader, false, 0, 0)
+	entry, err := reader.SeekTime(2500 * time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, entry.Time)
+	assert.FileExists(t, mpegts.IndexPath(filePath))
+
+	assert.Nil(t, reader.Open())
+	received := reader.dataChan.Receive()
+	assert.Equal(t, data[entry.Offset:entry.Offset+int64(len(received))], received)
+
+	entry, err = reader.SeekKeyframe(1)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, entry.Time)
+	reader.Close()
+
+	// A second handler loads the sidecar index written by the first.
+	other := NewFileHandler(filePath, Reader, false, 0, 0)
+	index, err := other.LoadIndex()
+	assert.Nil(t, err)
+	assert.Len(t, index.Keyframes, 4)
+
+	_, err = other.SeekKeyframe(4)
+	assert.ErrorIs(t, err, mpegts.ErrKeyframeNotFound)
+
+	// A recording that changed since it was indexed is indexed again.
+	assert.Nil(t, os.WriteFile(filePath, append(data, data...), 0666))
+	index, err = other.LoadIndex()
+	assert.Nil(t, err)
+	assert.Len(t, index.Keyframes, 8)
+	assert.Equal(t, int64(2*len(data)), index.Size)
+	index, err = NewFileHandler(filePath, Reader, false, 0, 0).LoadIndex()
+	assert.Nil(t, err)
+	assert.Len(t, index.Keyframes, 8)
+
+	writer := NewFileHandler(filePath, Writer, false, 0, 0)
+	_, err = writer.SeekTime(0)
+	assert.ErrorIs(t, err, ErrNotSeekable)
+}
+
+// testRecording builds a four second H.264 recording with a keyframe every second.
+func testRecording(t *testing.T) []byte {
+	var data []byte
+	write := func(packets mpegts.EncodedPackets) {
+		for _, ep := range packets {
+			data = append(data, ep[:]...)
+		}
+	}
+
+	pat := mpegts.NewPAT(1, 0)
+	pat.Programs[1] = 0x1000
+	packets, _ := pat.Encode(0)
+	write(packets)
+
+	pmt := &mpegts.PMT{ProgramNumber: 1, CurrentNext: true, PCRPID: 0x100,
+		Streams: []mpegts.ElementaryStream{{StreamType: mpegts.StreamTypeH264, ElementaryPID: 0x100}}}
+	packets, _, err := pmt.Encode(0x1000, 0)
+	assert.Nil(t, err)
+	write(packets)
+
+	pp := mpegts.NewPESPacketizer(0x100)
+	for i := 0; i < 100; i++ {
+		nalType := byte(0x01) // Non-IDR slice.
+		if i%25 == 0 {
+			nalType = 0x65 // IDR slice.
+		}
+		es := append([]byte{0x00, 0x00, 0x01, nalType}, make([]byte, 500)...)
+		pes := &mpegts.PESPacket{StreamID: mpegts.StreamIDVideoBase, HasPTS: true, PTS: mpegts.PTS(i) * 3600, Payload: es}
+		packets, err := pp.Packetize(pes, &mpegts.AdaptationField{HasPCR: true, PCR: mpegts.PCR(i) * 1080000})
+		assert.Nil(t, err)
+		write(packets)
+	}
+	return data
+}
+
 // randFileName generates a random filename for testing, reducing the chance of file conflicts.
 func randFileName() string {
 	randBytes := make([]byte, 8) // Generates a unique identifier of 16 hex characters.
@@ -0,0 +1,150 @@
+package uriHandler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/channels"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+// generatorChunk is the number of packets sent at a time, as in a UDP datagram.
+const generatorChunk = 7
+
+// generatorTick is how often the generator catches up with the wall clock.
+const generatorTick = 5 * time.Millisecond
+
+// ErrAlreadyOpen is returned when opening a handler that is already open.
+var ErrAlreadyOpen = errors.New("uriHandler: handler already open")
+
+// GeneratorStatus represents the status of a GeneratorHandler.
+type GeneratorStatus struct {
+	Mode     Mode
+	Role     Role
+	Address  string
+	Bitrate  int
+	Programs int
+	IsOpen   bool
+	Packets  uint64 // Packets delivered to the data channel since the handler was opened.
+	Dropped  uint64 // Packets dropped because the data channel was full.
+}
+
+// GetMode returns the operation mode of the generator handler.
+func (g GeneratorStatus) GetMode() Mode { return g.Mode }
+
+// GetRole returns the operational role of the generator handler, always Reader.
+func (g GeneratorStatus) GetRole() Role { return g.Role }
+
+// GetAddress returns a description of the generated stream.
+func (g GeneratorStatus) GetAddress() string { return g.Address }
+
+// GeneratorHandler is a live source of synthetic transport stream, paced in real time at the
+// configured bitrate. It stands in for a network input in tests.
+type GeneratorHandler struct {
+	cfg      mpegts.GeneratorConfig
+	gen      *mpegts.StreamGenerator
+	dataChan *channels.PacketChan
+	isOpen   bool
+	packets  uint64
+	dropped  uint64
+	done     chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+}
+
+// NewGeneratorHandler creates a generator handler. The configuration is checked when the handler is
+// opened.
+func NewGeneratorHandler(cfg mpegts.GeneratorConfig) *GeneratorHandler {
+	return &GeneratorHandler{
+		cfg:      cfg,
+		dataChan: channels.NewPacketChan(64 * 1024),
+	}
+}
+
+// Status provides the current status of the GeneratorHandler.
+func (h *GeneratorHandler) Status() GeneratorStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return GeneratorStatus{
+		Mode:     Peer,
+		Role:     Reader,
+		Address:  "generator://",
+		Bitrate:  h.cfg.Bitrate,
+		Programs: len(h.cfg.Programs),
+		IsOpen:   h.isOpen,
+		Packets:  h.packets,
+		Dropped:  h.dropped,
+	}
+}
+
+// Open starts generating the stream.
+func (h *GeneratorHandler) Open() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.isOpen {
+		return ErrAlreadyOpen
+	}
+
+	gen, err := mpegts.NewStreamGenerator(h.cfg)
+	if err != nil {
+		return err
+	}
+	h.gen = gen
+	h.done = make(chan struct{})
+	h.isOpen = true
+
+	h.wg.Add(1)
+	go h.generate()
+	return nil
+}
+
+// Close stops the stream and closes the data channel.
+func (h *GeneratorHandler) Close() error {
+	h.mu.Lock()
+	if !h.isOpen {
+		h.mu.Unlock()
+		return nil
+	}
+	h.isOpen = false
+	close(h.done)
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	h.dataChan.Close()
+	return nil
+}
+
+// generate sends the packets due by the wall clock every tick.
+func (h *GeneratorHandler) generate() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(generatorTick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	buffer := make([]byte, generatorChunk*188)
+	for {
+		for h.gen.Elapsed() < time.Since(start) {
+			n, _ := h.gen.Read(buffer)
+			err := h.dataChan.Send(buffer[:n]) // Dropped when the consumer falls behind, as a network input would.
+			h.mu.Lock()
+			if err != nil {
+				h.dropped += uint64(n / 188)
+			} else {
+				h.packets += uint64(n / 188)
+			}
+			h.mu.Unlock()
+		}
+
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DataChan returns the channel carrying the data the handler reads, or the data it is to write.
+func (h *GeneratorHandler) DataChan() *channels.PacketChan {
+	return h.dataChan
+}
@@ -0,0 +1,59 @@
+package uriHandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/channels"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratorHandler(t *testing.T) {
+	h := NewGeneratorHandler(mpegts.DefaultGeneratorConfig(1))
+	assert.NoError(t, h.Open())
+	assert.ErrorIs(t, h.Open(), ErrAlreadyOpen)
+
+	status := h.Status()
+	assert.True(t, status.IsOpen)
+	assert.Equal(t, Reader, status.GetRole())
+	assert.Equal(t, 1, status.Programs)
+
+	// The stream starts with a PCR on the video PID, then the PAT.
+	data := h.dataChan.Receive()
+	assert.Len(t, data, 7*188)
+	var ep mpegts.EncodedPacket
+	copy(ep[:], data)
+	assert.Equal(t, uint16(0x100), ep.GetPID())
+	copy(ep[:], data[188:])
+	assert.Equal(t, uint16(mpegts.PATPID), ep.GetPID())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, h.Close())
+	status = h.Status()
+	assert.False(t, status.IsOpen)
+
+	// 2.5 Mbit/s is 166 packets in 100 ms.
+	assert.Greater(t, status.Packets, uint64(100))
+	assert.Less(t, status.Packets, uint64(500))
+}
+
+func TestGeneratorHandlerDropped(t *testing.T) {
+	h := NewGeneratorHandler(mpegts.DefaultGeneratorConfig(1))
+	h.dataChan = channels.NewPacketChan(1)
+	assert.NoError(t, h.Open())
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, h.Close())
+
+	// Only the chunk the channel had room for was delivered; the others are counted apart.
+	status := h.Status()
+	assert.Equal(t, uint64(7), status.Packets)
+	assert.Greater(t, status.Dropped, uint64(0))
+}
+
+func TestGeneratorHandlerInvalidConfig(t *testing.T) {
+	h := NewGeneratorHandler(mpegts.GeneratorConfig{})
+	assert.ErrorIs(t, h.Open(), mpegts.ErrInvalidConfig)
+	assert.False(t, h.Status().IsOpen)
+	assert.NoError(t, h.Close())
+}
@@ -202,3 +202,8 @@ func (h *SocketHandler) Close() error {
 	h.dataChan.Close()
 	return nil
 }
+
+// DataChan returns the channel carrying the data the handler reads, or the data it is to write.
+func (h *SocketHandler) DataChan() *channels.PacketChan {
+	return h.dataChan
+}
@@ -136,7 +136,8 @@ func (h *TCPHandler) acceptClients() {
 	}
 }
 
-// manageStream manages the TCP connection stream based on the role of the TCPHandler.
+// manageStream manages the TCP connection stream based on the role of the TCPHandler. A client reader
+// closes its data channel once the server closes the connection.
 func (h *TCPHandler) manageStream(conn net.Conn) {
 	defer func() {
 		conn.Close()
@@ -157,6 +158,9 @@ func (h *TCPHandler) manageStream(conn net.Conn) {
 			}
 		}
 	} else if h.role == Reader {
+		if h.mode == Client {
+			defer h.dataChan.Close() // The stream ends with the connection to the server.
+		}
 		readBuffer := make([]byte, 188*10)
 		for {
 			n, err := conn.Read(readBuffer)
@@ -185,3 +189,8 @@ func (h *TCPHandler) Close() error {
 	h.dataChan.Close()
 	return nil
 }
+
+// DataChan returns the channel carrying the data the handler reads, or the data it is to write.
+func (h *TCPHandler) DataChan() *channels.PacketChan {
+	return h.dataChan
+}
@@ -1,6 +1,7 @@
 package uriHandler
 
 import (
+	"errors"
 	"net"
 	"sync"
 	"time"
@@ -8,6 +9,9 @@ import (
 	"github.com/Channel-3-Eugene/tribd/channels" // Correct import path
 )
 
+// AnySource, listed among the allowed sources of a reader, accepts data from every source address.
+const AnySource = "*"
+
 // UDPStatus represents the status of a UDPHandler, detailing its configuration and state.
 type UDPStatus struct {
 	Mode           Mode
@@ -55,7 +59,7 @@ func NewUDPHandler(address string, readDeadline, writeDeadline time.Duration, ro
 
 	// Populate allowed sources.
 	for _, src := range sources {
-		if _, err := net.ResolveUDPAddr("udp", src); err == nil {
+		if _, err := net.ResolveUDPAddr("udp", src); err == nil || src == AnySource {
 			handler.allowedSources[src] = struct{}{}
 		}
 	}
@@ -102,14 +106,20 @@ func (h *UDPHandler) Status() UDPStatus {
 	}
 }
 
-// Open starts the UDPHandler, setting up a UDP connection for sending or receiving data.
+// Open starts the UDPHandler, setting up a UDP connection for sending or receiving data. A reader whose
+// address is a multicast group joins the group.
 func (h *UDPHandler) Open() error {
 	udpAddr, err := net.ResolveUDPAddr("udp", h.address)
 	if err != nil {
 		return err
 	}
 
-	conn, err := net.ListenUDP("udp", udpAddr)
+	var conn *net.UDPConn
+	if h.role == Reader && udpAddr.IP != nil && udpAddr.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp", nil, udpAddr)
+	} else {
+		conn, err = net.ListenUDP("udp", udpAddr)
+	}
 	if err != nil {
 		return err
 	}
@@ -204,11 +214,17 @@ func (h *UDPHandler) receiveData() {
 		n, addr, err := h.conn.ReadFromUDP(*rawBuffer)
 		if err != nil {
 			bufferPool.Put(rawBuffer)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			continue
 		}
 
 		h.mu.RLock()
 		_, ok := h.allowedSources[addr.IP.String()]
+		if !ok {
+			_, ok = h.allowedSources[AnySource]
+		}
 		h.mu.RUnlock()
 
 		if !ok {
@@ -234,3 +250,8 @@ func (h *UDPHandler) Close() error {
 	h.dataChan.Close()
 	return nil
 }
+
+// DataChan returns the channel carrying the data the handler reads, or the data it is to write.
+func (h *UDPHandler) DataChan() *channels.PacketChan {
+	return h.dataChan
+}
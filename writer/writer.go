@@ -0,0 +1,308 @@
+// Package writer implements the Writer Service. A writer sends one packet to its output on every tick
+// of the PLL: the next packet of the FIFO buffer, or a null packet when the buffer is empty. The output
+// is then a constant bitrate stream at the rate of the ticks, and the share of null packets measures
+// the headroom left for more services.
+package writer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Channel-3-Eugene/tribd/channels"
+	"github.com/Channel-3-Eugene/tribd/fifobuffer"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+)
+
+var (
+	ErrInvalidBitrate = errors.New("writer: invalid bitrate")
+	ErrInvalidFormat  = errors.New("writer: invalid packet format")
+	ErrRunning        = errors.New("writer: already running")
+	ErrStopped        = errors.New("writer: stopped")
+)
+
+const (
+	packetBits   = 188 * 8
+	chunkPackets = 7 // Packets per write, the payload of a 1316 byte UDP datagram.
+)
+
+// nullPacket stuffs the output when no packet is ready.
+var nullPacket = mpegts.NewNullPacket()
+
+// Sink is an output whose data is written to its packet channel. The handlers of the uriHandler package
+// satisfy it in the writer role.
+type Sink interface {
+	Open() error
+	Close() error
+	DataChan() *channels.PacketChan
+}
+
+// Monitor observes the packets of an output as they are written. A *monitor.Monitor satisfies it.
+type Monitor interface {
+	Push(ep *mpegts.EncodedPacket, at time.Time)
+}
+
+// State is the lifecycle state of a writer.
+type State int
+
+const (
+	Idle    State = iota // Not started.
+	Running              // Writing on every tick.
+	Stopped              // Stopped, or its ticks ended.
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case Running:
+		return "running"
+	case Stopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// Stats holds the counters of one output.
+type Stats struct {
+	State   State
+	Started time.Time
+	Bitrate int    // Configured output rate, bits per second.
+	Packets uint64 // Packets written, null packets included.
+	Nulls   uint64 // Null packets written, for want of a ready packet or taken from the buffer.
+	Bytes   uint64 // Bytes handed to the sink, in the packet format of the output.
+	Dropped uint64 // Writes the sink refused because its channel was full or closed.
+
+	// Share of null packets over the last second of output, from 0 when every packet carried data to 1
+	// when the buffer was always empty, and the rate it leaves for more services.
+	Headroom        float64
+	HeadroomBitrate int
+}
+
+// Writer is the Writer Service of one output.
+type Writer struct {
+	buffer  *fifobuffer.FIFOBuffer[*mpegts.EncodedPacket]
+	sink    Sink
+	bitrate int
+	format  mpegts.PacketFormat
+	m2ts    *mpegts.M2TSEncoder // Timestamps the packets of an M2TS output.
+
+	mu     sync.Mutex
+	chunk  []byte
+	window []bool // Whether each of the last packets was a null packet, as a ring.
+	next   int    // Position of the next packet in window.
+	filled int    // Packets recorded in window.
+	nulls  int    // Null packets in window.
+	stats  Stats
+
+	monitor Monitor
+
+	done     chan struct{} // Closed by Stop.
+	stopping bool
+	exited   chan struct{} // Closed once the sink is closed.
+	closeErr error
+}
+
+// NewWriter creates the writer of an output running at bitrate bits per second, taking its packets from
+// buffer.
+func NewWriter(buffer *fifobuffer.FIFOBuffer[*mpegts.EncodedPacket], sink Sink, bitrate int) (*Writer, error) {
+	if bitrate < packetBits {
+		return nil, ErrInvalidBitrate
+	}
+	return &Writer{
+		buffer:  buffer,
+		sink:    sink,
+		bitrate: bitrate,
+		chunk:   make([]byte, 0, chunkPackets*188),
+		window:  make([]bool, bitrate/packetBits), // One second of packets.
+		stats:   Stats{Bitrate: bitrate},
+	}, nil
+}
+
+// SetFormat sets the packet format of the output: plain 188-byte packets, the default, 192-byte M2TS
+// packets whose arrival timestamps follow the bitrate of the writer, or 204-byte packets with their
+// Reed-Solomon parity. It must be called before Start.
+func (w *Writer) SetFormat(format mpegts.PacketFormat) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.stats.State != Idle:
+		return ErrRunning
+	case format != mpegts.FormatTS && format != mpegts.FormatM2TS && format != mpegts.FormatRS:
+		return ErrInvalidFormat
+	}
+
+	w.format = format
+	w.m2ts = nil
+	if format == mpegts.FormatM2TS {
+		w.m2ts = mpegts.NewM2TSEncoder(uint64(w.bitrate))
+	}
+	w.chunk = make([]byte, 0, chunkPackets*format.Size())
+	return nil
+}
+
+// Format returns the packet format of the output.
+func (w *Writer) Format() mpegts.PacketFormat {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.format
+}
+
+// SetMonitor attaches a monitor that measures the output, stuffing included, at the time each packet is
+// written. A nil monitor detaches it. It may be called while the writer runs.
+func (w *Writer) SetMonitor(m Monitor) {
+	w.mu.Lock()
+	w.monitor = m
+	w.mu.Unlock()
+}
+
+// Start opens the sink and writes a packet on every tick until Stop is called or ticks is closed, when
+// the sink is closed. Pass the TriggerCh of a PLL running at the bitrate of the writer. A writer runs
+// once.
+func (w *Writer) Start(ticks <-chan bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch w.stats.State {
+	case Running:
+		return ErrRunning
+	case Stopped:
+		return ErrStopped
+	}
+
+	if err := w.sink.Open(); err != nil {
+		return err
+	}
+	w.stats.State = Running
+	w.stats.Started = time.Now()
+	w.done = make(chan struct{})
+	w.exited = make(chan struct{})
+	go w.run(ticks, w.done, w.exited)
+	return nil
+}
+
+// Stop stops writing, hands the packets of a partial write to the sink and closes it. It returns the
+// error of closing the sink.
+func (w *Writer) Stop() error {
+	w.mu.Lock()
+	if w.exited == nil {
+		w.mu.Unlock()
+		return nil
+	}
+	if !w.stopping {
+		w.stopping = true
+		close(w.done)
+	}
+	exited := w.exited
+	w.mu.Unlock()
+
+	<-exited
+	return w.closeErr
+}
+
+// Done returns a channel closed once the writer has stopped and closed its sink, either by Stop or
+// because its ticks ended. It is nil before Start.
+func (w *Writer) Done() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.exited
+}
+
+// Tick writes the next packet of the buffer, or a null packet when the buffer is empty. Null packets
+// found in the buffer count as stuffing too, as they leave the same room for more services. Start calls
+// it on every tick; call it directly to drive the writer from another clock.
+func (w *Writer) Tick() {
+	ep, ok := w.buffer.Pop()
+	null := !ok || ep == nil || ep.IsNullPacket()
+	if ep == nil {
+		ep = nullPacket
+	}
+
+	w.mu.Lock()
+	monitor := w.monitor
+	w.stats.Packets++
+	if null {
+		w.stats.Nulls++
+	}
+	w.record(null)
+
+	switch w.format {
+	case mpegts.FormatM2TS:
+		w.chunk = append(w.chunk, w.m2ts.Encode(mpegts.EncodedPackets{ep})...)
+	case mpegts.FormatRS:
+		w.chunk = append(w.chunk, mpegts.MarshalRS(ep)...)
+	default:
+		w.chunk = append(w.chunk, ep[:]...)
+	}
+	if len(w.chunk) == cap(w.chunk) {
+		w.flush()
+	}
+	w.mu.Unlock()
+
+	if monitor != nil {
+		monitor.Push(ep, time.Now())
+	}
+}
+
+// Stats returns the counters of the output.
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.stats
+	if w.filled > 0 {
+		stats.Headroom = float64(w.nulls) / float64(w.filled)
+		stats.HeadroomBitrate = int(stats.Headroom * float64(w.bitrate))
+	}
+	return stats
+}
+
+// run writes a packet on every tick until the writer is stopped or the ticks end, then closes the sink.
+func (w *Writer) run(ticks <-chan bool, done, exited chan struct{}) {
+	defer close(exited)
+loop:
+	for {
+		select {
+		case <-done:
+			break loop
+		case _, ok := <-ticks:
+			if !ok {
+				break loop
+			}
+			w.Tick()
+		}
+	}
+
+	w.mu.Lock()
+	if len(w.chunk) > 0 {
+		w.flush()
+	}
+	w.stats.State = Stopped
+	w.mu.Unlock()
+	w.closeErr = w.sink.Close()
+}
+
+// flush hands the pending packets to the sink.
+func (w *Writer) flush() {
+	if err := w.sink.DataChan().Send(w.chunk); err != nil {
+		w.stats.Dropped++
+	} else {
+		w.stats.Bytes += uint64(len(w.chunk))
+	}
+	w.chunk = w.chunk[:0]
+}
+
+// record adds a packet to the headroom window.
+func (w *Writer) record(null bool) {
+	if w.filled == len(w.window) {
+		if w.window[w.next] {
+			w.nulls--
+		}
+	} else {
+		w.filled++
+	}
+	w.window[w.next] = null
+	if null {
+		w.nulls++
+	}
+	w.next = (w.next + 1) % len(w.window)
+}
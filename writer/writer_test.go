@@ -0,0 +1,263 @@
+package writer
+
+import (
+	"testing"
+
+	"github.com/Channel-3-Eugene/tribd/channels"
+	"github.com/Channel-3-Eugene/tribd/fifobuffer"
+	"github.com/Channel-3-Eugene/tribd/monitor"
+	"github.com/Channel-3-Eugene/tribd/mpegts"
+	"github.com/stretchr/testify/assert"
+)
+
+// chanSink collects the data written to it.
+type chanSink struct {
+	dc     *channels.PacketChan
+	opened bool
+	closed bool
+}
+
+func newChanSink() *chanSink {
+	return &chanSink{dc: channels.NewPacketChan(1024)}
+}
+
+func (s *chanSink) Open() error {
+	s.opened = true
+	return nil
+}
+
+func (s *chanSink) Close() error {
+	s.closed = true
+	s.dc.Close()
+	return nil
+}
+
+func (s *chanSink) DataChan() *channels.PacketChan {
+	return s.dc
+}
+
+// written returns the packets written to the sink, which must have been closed.
+func (s *chanSink) written(t *testing.T) []*mpegts.EncodedPacket {
+	var packets []*mpegts.EncodedPacket
+	for data := s.dc.Receive(); data != nil; data = s.dc.Receive() {
+		assert.Zero(t, len(data)%188)
+		for i := 0; i < len(data); i += 188 {
+			ep := &mpegts.EncodedPacket{}
+			copy(ep[:], data[i:])
+			packets = append(packets, ep)
+		}
+	}
+	return packets
+}
+
+func packet(pid uint16) *mpegts.EncodedPacket {
+	return &mpegts.EncodedPacket{0x47, byte(pid >> 8), byte(pid), 0x10}
+}
+
+// rate is the bitrate of n packets per second.
+func rate(n int) int {
+	return n * packetBits
+}
+
+func TestWriterStuffing(t *testing.T) {
+	buffer := fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket]()
+	for i := 0; i < 10; i++ {
+		buffer.Push(packet(0x100))
+	}
+	sink := newChanSink()
+	w, err := NewWriter(buffer, sink, rate(100))
+	assert.NoError(t, err)
+
+	// One packet per tick, whether the buffer has one or not.
+	for i := 0; i < 70; i++ {
+		w.Tick()
+	}
+	sink.Close()
+
+	packets := sink.written(t)
+	assert.Len(t, packets, 70)
+	for i, ep := range packets {
+		assert.Equal(t, i >= 10, ep.IsNullPacket(), "packet %d", i)
+	}
+
+	stats := w.Stats()
+	assert.Equal(t, uint64(70), stats.Packets)
+	assert.Equal(t, uint64(60), stats.Nulls)
+	assert.Equal(t, uint64(70*188), stats.Bytes)
+	assert.InDelta(t, 60.0/70, stats.Headroom, 1e-9)
+	assert.Equal(t, int(60.0/70*float64(rate(100))), stats.HeadroomBitrate)
+}
+
+func TestWriterHeadroomWindow(t *testing.T) {
+	buffer := fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket]()
+	w, err := NewWriter(buffer, newChanSink(), rate(10)) // A window of 10 packets.
+	assert.NoError(t, err)
+	assert.Zero(t, w.Stats().Headroom)
+
+	for i := 0; i < 10; i++ {
+		w.Tick()
+	}
+	assert.Equal(t, 1.0, w.Stats().Headroom)
+
+	// Only the last second counts.
+	for i := 0; i < 15; i++ {
+		buffer.Push(packet(0x100))
+	}
+	for i := 0; i < 5; i++ {
+		w.Tick()
+	}
+	assert.Equal(t, 0.5, w.Stats().Headroom)
+	for i := 0; i < 10; i++ {
+		w.Tick()
+	}
+	assert.Equal(t, 0.0, w.Stats().Headroom)
+	assert.Zero(t, w.Stats().HeadroomBitrate)
+	assert.Equal(t, uint64(10), w.Stats().Nulls)
+}
+
+func TestWriterBufferedNulls(t *testing.T) {
+	buffer := fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket]()
+	w, err := NewWriter(buffer, newChanSink(), rate(10))
+	assert.NoError(t, err)
+
+	// Null packets queued upstream are headroom as much as those the writer stuffs.
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			buffer.Push(packet(0x100))
+		} else {
+			buffer.Push(mpegts.NewNullPacket())
+		}
+	}
+	for i := 0; i < 10; i++ {
+		w.Tick()
+	}
+	stats := w.Stats()
+	assert.Equal(t, uint64(5), stats.Nulls)
+	assert.Equal(t, 0.5, stats.Headroom)
+}
+
+func TestWriterMonitor(t *testing.T) {
+	buffer := fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket]()
+	for i := 0; i < 5; i++ {
+		buffer.Push(packet(0x100))
+	}
+	w, err := NewWriter(buffer, newChanSink(), rate(100))
+	assert.NoError(t, err)
+	m := monitor.NewMonitor("output", monitor.Options{})
+	w.SetMonitor(m)
+
+	for i := 0; i < 20; i++ {
+		w.Tick()
+	}
+	w.SetMonitor(nil)
+	w.Tick()
+
+	// The monitor sees the output, stuffing included.
+	report := m.Report()
+	assert.Equal(t, uint64(20), report.Packets)
+	pids := make(map[uint16]uint64)
+	for _, p := range report.PIDs {
+		pids[p.PID] = p.Packets
+	}
+	assert.Equal(t, map[uint16]uint64{0x100: 5, 0x1FFF: 15}, pids)
+}
+
+func TestWriterLifecycle(t *testing.T) {
+	buffer := fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket]()
+	buffer.Push(packet(0x100))
+	sink := newChanSink()
+	w, err := NewWriter(buffer, sink, rate(1000))
+	assert.NoError(t, err)
+	assert.Equal(t, Idle, w.Stats().State)
+	assert.Nil(t, w.Done())
+	assert.NoError(t, w.Stop()) // Stopping an idle writer does nothing.
+
+	ticks := make(chan bool)
+	assert.NoError(t, w.Start(ticks))
+	assert.True(t, sink.opened)
+	assert.Equal(t, ErrRunning, w.Start(ticks))
+	for i := 0; i < 10; i++ {
+		ticks <- true
+	}
+
+	// Stopping hands over the partial write before closing the sink.
+	assert.NoError(t, w.Stop())
+	assert.True(t, sink.closed)
+	assert.Equal(t, Stopped, w.Stats().State)
+	assert.Equal(t, ErrStopped, w.Start(ticks))
+	assert.NoError(t, w.Stop())
+
+	packets := sink.written(t)
+	assert.Len(t, packets, 10)
+	assert.Equal(t, uint16(0x100), packets[0].GetPID())
+	assert.True(t, packets[9].IsNullPacket())
+}
+
+func TestWriterTicksEnd(t *testing.T) {
+	sink := newChanSink()
+	w, err := NewWriter(fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket](), sink, rate(1000))
+	assert.NoError(t, err)
+
+	ticks := make(chan bool, 3)
+	ticks <- true
+	ticks <- true
+	ticks <- true
+	close(ticks)
+	assert.NoError(t, w.Start(ticks))
+	<-w.Done()
+	assert.True(t, sink.closed)
+	assert.Equal(t, Stopped, w.Stats().State)
+	assert.NoError(t, w.Stop())
+	assert.Len(t, sink.written(t), 3)
+}
+
+func TestWriterM2TS(t *testing.T) {
+	buffer := fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket]()
+	for i := 0; i < 5; i++ {
+		buffer.Push(packet(0x100))
+	}
+	sink := newChanSink()
+	w, err := NewWriter(buffer, sink, rate(1000))
+	assert.NoError(t, err)
+	assert.NoError(t, w.SetFormat(mpegts.FormatM2TS))
+	assert.Equal(t, mpegts.FormatM2TS, w.Format())
+
+	ticks := make(chan bool, 14)
+	for i := 0; i < 14; i++ {
+		ticks <- true
+	}
+	close(ticks)
+	assert.NoError(t, w.Start(ticks))
+	<-w.Done()
+	assert.Equal(t, ErrRunning, w.SetFormat(mpegts.FormatTS))
+
+	var data []byte
+	for chunk := sink.dc.Receive(); chunk != nil; chunk = sink.dc.Receive() {
+		data = append(data, chunk...)
+	}
+	assert.Len(t, data, 14*192)
+	assert.Equal(t, uint64(len(data)), w.Stats().Bytes)
+
+	// The output frames as M2TS, its timestamps one packet time at 1000 packets per second apart.
+	framer := mpegts.NewFramer(0)
+	packets, _ := framer.PushFramed(data)
+	assert.Equal(t, mpegts.FormatM2TS, framer.Format())
+	assert.Len(t, packets, 14)
+	for i, fp := range packets {
+		assert.True(t, fp.HasArrivalTimestamp)
+		assert.Equal(t, uint32(i*27000), fp.ArrivalTimestamp)
+		assert.Equal(t, i >= 5, fp.Packet.IsNullPacket(), "packet %d", i)
+	}
+}
+
+func TestWriterFormatErrors(t *testing.T) {
+	w, err := NewWriter(fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket](), newChanSink(), rate(1000))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, w.SetFormat(mpegts.PacketFormat(7)), ErrInvalidFormat)
+	assert.Equal(t, mpegts.FormatTS, w.Format())
+}
+
+func TestNewWriterBitrate(t *testing.T) {
+	_, err := NewWriter(fifobuffer.NewFIFOBuffer[*mpegts.EncodedPacket](), newChanSink(), 1000)
+	assert.ErrorIs(t, err, ErrInvalidBitrate)
+}